@@ -310,7 +310,7 @@ var _ = Describe("Lifecycle test", func() {
 				files, err := ioutil.ReadDir(destDirectory)
 				Expect(err).ShouldNot(HaveOccurred())
 
-				expectedFileCount := totalFiles + 1 // the version file will be present.
+				expectedFileCount := totalFiles + 2 // the release_id and version files will be present.
 				Expect(err).ShouldNot(HaveOccurred())
 				Expect(files).To(HaveLen(expectedFileCount))
 
@@ -347,11 +347,12 @@ var _ = Describe("Lifecycle test", func() {
 				files, err = ioutil.ReadDir(destDirectory)
 				Expect(err).ShouldNot(HaveOccurred())
 
-				expectedFileCount = 1 // the version file will be present.
+				expectedFileCount = 2 // the release_id and version files will be present.
 				Expect(err).ShouldNot(HaveOccurred())
 				Expect(files).To(HaveLen(expectedFileCount))
 
-				Expect(files[0].Name()).To(Equal("version"))
+				Expect(files[0].Name()).To(Equal("release_id"))
+				Expect(files[1].Name()).To(Equal("version"))
 
 				By("Expecting error with in command and mismatched globs")
 				inRequest = concourse.InRequest{
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write writes the files, as paths relative to dir, to a tar archive at
+// path, compressed with gzip if compress is true. Each file keeps its
+// relative path within the archive.
+func Write(path string, dir string, files []string, compress bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(f)
+		w = gw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		err := addFile(tw, dir, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	if gw != nil {
+		err = gw.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+func addFile(tw *tar.Writer, dir string, file string) error {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(file)
+
+	err = tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,99 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/archive"
+)
+
+var _ = Describe("Archive", func() {
+	var (
+		dir         string
+		archivePath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.MkdirAll(filepath.Join(dir, "osl"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(dir, "a.zip"), []byte("contents-a"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(dir, "osl", "b.txt"), []byte("contents-b"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		archivePath = filepath.Join(dir, "release.tgz")
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	readArchive := func(r io.Reader) map[string]string {
+		contents := map[string]string{}
+
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+			contents[header.Name] = string(b)
+		}
+
+		return contents
+	}
+
+	It("writes the files with their relative paths to a gzipped tar archive", func() {
+		err := archive.Write(archivePath, dir, []string{"a.zip", filepath.Join("osl", "b.txt")}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		f, err := os.Open(archivePath)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		gr, err := gzip.NewReader(f)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readArchive(gr)).To(Equal(map[string]string{
+			"a.zip":     "contents-a",
+			"osl/b.txt": "contents-b",
+		}))
+	})
+
+	Context("when compress is false", func() {
+		It("writes an uncompressed tar archive", func() {
+			err := archive.Write(archivePath, dir, []string{"a.zip"}, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			f, err := os.Open(archivePath)
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+
+			Expect(readArchive(f)).To(Equal(map[string]string{"a.zip": "contents-a"}))
+		})
+	})
+
+	Context("when a file does not exist", func() {
+		It("returns an error", func() {
+			err := archive.Write(archivePath, dir, []string{"missing.zip"}, true)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,22 @@
+package bytesize_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/bytesize"
+)
+
+var _ = Describe("Bytesize", func() {
+	Describe("Format", func() {
+		It("formats sizes below 1 KiB in bytes", func() {
+			Expect(bytesize.Format(0)).To(Equal("0 B"))
+			Expect(bytesize.Format(1023)).To(Equal("1023 B"))
+		})
+
+		It("formats larger sizes in binary units", func() {
+			Expect(bytesize.Format(1536)).To(Equal("1.5 KiB"))
+			Expect(bytesize.Format(10 * 1024 * 1024)).To(Equal("10.0 MiB"))
+			Expect(bytesize.Format(8 * 1024 * 1024 * 1024)).To(Equal("8.0 GiB"))
+		})
+	})
+})
@@ -1,35 +1,68 @@
 package check
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/tlsconfig"
 	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
+const (
+	sortBySemver = "semver"
+)
+
 type CheckCommand struct {
+	ctx         context.Context
 	logger      logger.Logger
 	logFilePath string
 	version     string
 }
 
 func NewCheckCommand(
+	ctx context.Context,
 	version string,
 	logger logger.Logger,
 	logFilePath string,
 ) *CheckCommand {
 	return &CheckCommand{
+		ctx:         ctx,
 		logger:      logger,
 		logFilePath: logFilePath,
 		version:     version,
 	}
 }
 
+// Run returns the versions of the product. If tolerate_maintenance is set,
+// Pivotal Network appearing to be in maintenance mode is not a failure, and
+// the current version is returned unchanged.
 func (c *CheckCommand) Run(input concourse.CheckRequest) (concourse.CheckResponse, error) {
+	response, err := c.run(input)
+
+	var maintenance pivnet.ErrMaintenance
+	if input.Source.TolerateMaintenance && errors.As(err, &maintenance) {
+		c.logger.Warnf("Warning: %s - returning the current version unchanged\n", err.Error())
+
+		if input.Version.ProductVersion == "" {
+			return concourse.CheckResponse{}, nil
+		}
+		return concourse.CheckResponse{input.Version}, nil
+	}
+
+	return response, err
+}
+
+func (c *CheckCommand) run(input concourse.CheckRequest) (concourse.CheckResponse, error) {
 	logDir := filepath.Dir(c.logFilePath)
 	existingLogFiles, err := filepath.Glob(filepath.Join(logDir, "pivnet-resource-check.log*"))
 	if err != nil {
@@ -54,10 +87,148 @@ func (c *CheckCommand) Run(input concourse.CheckRequest) (concourse.CheckRespons
 		return nil, fmt.Errorf("%s must be provided", "api_token")
 	}
 
-	if input.Source.ProductSlug == "" {
+	if input.Source.ProductSlug == "" && len(input.Source.ProductSlugs) == 0 {
 		return nil, fmt.Errorf("%s must be provided", "product_slug")
 	}
 
+	if input.Source.ProductSlug != "" && len(input.Source.ProductSlugs) > 0 {
+		return nil, fmt.Errorf(
+			"only one of %s or %s may be provided",
+			"product_slug",
+			"product_slugs",
+		)
+	}
+
+	switch input.Source.SortBy {
+	case "", sortBySemver:
+	default:
+		return nil, fmt.Errorf(
+			"%s must be %s if provided - got %s",
+			"sort_by",
+			sortBySemver,
+			input.Source.SortBy,
+		)
+	}
+
+	if input.Source.SortBy != "" && len(input.Source.ProductSlugs) > 0 {
+		return nil, fmt.Errorf(
+			"%s may not be provided with %s",
+			"sort_by",
+			"product_slugs",
+		)
+	}
+
+	if len(input.Source.RequireFileGlobs) > 0 && len(input.Source.ProductSlugs) > 0 {
+		return nil, fmt.Errorf(
+			"%s may not be provided with %s",
+			"require_file_globs",
+			"product_slugs",
+		)
+	}
+
+	for _, glob := range input.Source.RequireFileGlobs {
+		_, err := filepath.Match(glob, "")
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%s must only contain valid globs - got %s",
+				"require_file_globs",
+				glob,
+			)
+		}
+	}
+
+	switch input.Source.DuplicateVersionStrategy {
+	case "",
+		concourse.DuplicateVersionStrategyNewest,
+		concourse.DuplicateVersionStrategyOldest,
+		concourse.DuplicateVersionStrategyFail:
+	default:
+		return nil, fmt.Errorf(
+			"%s must be one of %s, %s or %s - got %s",
+			"duplicate_version_strategy",
+			concourse.DuplicateVersionStrategyNewest,
+			concourse.DuplicateVersionStrategyOldest,
+			concourse.DuplicateVersionStrategyFail,
+			input.Source.DuplicateVersionStrategy,
+		)
+	}
+
+	err = versions.ValidateFormat("version_format", input.Source.VersionFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Source.VersionFormat != "" && len(input.Source.ProductSlugs) > 0 {
+		return nil, fmt.Errorf(
+			"%s may not be provided with %s",
+			"version_format",
+			"product_slugs",
+		)
+	}
+
+	if input.Source.VersionFileHashes && len(input.Source.ProductSlugs) > 0 {
+		return nil, fmt.Errorf(
+			"%s may not be provided with %s",
+			"version_includes_file_hashes",
+			"product_slugs",
+		)
+	}
+
+	if input.Source.FirstRunDepth < 0 {
+		return nil, fmt.Errorf("%s must not be negative", "first_run_depth")
+	}
+
+	if input.Source.MaxVersions < 0 {
+		return nil, fmt.Errorf("%s must not be negative", "max_versions")
+	}
+
+	if input.Source.DebounceSeconds < 0 {
+		return nil, fmt.Errorf("%s must not be negative", "debounce_seconds")
+	}
+
+	var excludeVersionRegexp *regexp.Regexp
+	if input.Source.ExcludeVersionRegexp != "" {
+		excludeVersionRegexp, err = regexp.Compile(input.Source.ExcludeVersionRegexp)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%s must be a valid regular expression - got %s: %s",
+				"exclude_version_regexp",
+				input.Source.ExcludeVersionRegexp,
+				err.Error(),
+			)
+		}
+	}
+
+	if input.Source.MinimumVersion != "" && !versions.IsSemver(input.Source.MinimumVersion) {
+		return nil, fmt.Errorf(
+			"%s must be a semantic version, e.g. 2.0.0 - got %s",
+			"minimum_version",
+			input.Source.MinimumVersion,
+		)
+	}
+
+	var since time.Time
+	if input.Source.Since != "" {
+		since, err = time.Parse(time.RFC3339, input.Source.Since)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"%s must be an RFC 3339 timestamp, e.g. 2016-01-02T15:04:05Z - got %s",
+				"since",
+				input.Source.Since,
+			)
+		}
+	}
+
+	err = concourse.ValidateEndpoint("endpoint", input.Source.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := tlsconfig.New(input.Source.CACert, input.Source.SkipSSLVerification)
+	if err != nil {
+		return nil, err
+	}
+
 	c.logger.Debugf("Received input: %+v\n", input)
 
 	var endpoint string
@@ -71,29 +242,193 @@ func (c *CheckCommand) Run(input concourse.CheckRequest) (concourse.CheckRespons
 		Endpoint:  endpoint,
 		Token:     input.Source.APIToken,
 		UserAgent: fmt.Sprintf("pivnet-resource/%s", c.version),
+
+		Debug:     input.Source.Debug,
+		Timings:   input.Source.EmitTimings,
+		Context:   c.ctx,
+		TLSConfig: tlsConfig,
+
+		ExtraHeaders: input.Source.ExtraHeaders,
 	}
 	client := pivnet.NewClient(
 		clientConfig,
 		c.logger,
 	)
 
+	if input.Source.Debug {
+		user, err := client.CurrentUser()
+		if err != nil {
+			c.logger.Debugf("Failed to get current user: %s\n", err.Error())
+		} else {
+			c.logger.Debugf("Authenticated as: {id: %d, email: %s}\n", user.ID, user.Email)
+		}
+	}
+
+	firstRunDepth := input.Source.FirstRunDepth
+	if firstRunDepth == 0 {
+		firstRunDepth = 1
+	}
+
+	// Releases updated after the debounce threshold are still settling, so
+	// they are not returned until a check after the window has passed.
+	var debounceThreshold time.Time
+	if input.Source.DebounceSeconds > 0 {
+		debounceThreshold = time.Now().Add(-time.Duration(input.Source.DebounceSeconds) * time.Second)
+	}
+
+	if len(input.Source.ProductSlugs) > 0 {
+		return c.checkProductSlugs(
+			client,
+			input.Source.ProductSlugs,
+			input.Version,
+			firstRunDepth,
+			excludeVersionRegexp,
+			input.Source.MinimumVersion,
+			since,
+			debounceThreshold,
+			input.Source.MaxVersions,
+			input.Source.FailOnNoReleases,
+			input.Source.DuplicateVersionStrategy,
+		)
+	}
+
+	// Versions are returned with the release ID and file hash appended like
+	// out does, neither of which is part of the version on Pivotal Network.
+	withID := input.Source.VersionFormat == versions.FormatVersionID
+	withFileHash := input.Source.VersionFileHashes
+	if withFileHash {
+		input.Version.ProductVersion, _, _ = versions.SplitFileHash(input.Version.ProductVersion)
+	}
+	if withID {
+		input.Version.ProductVersion, _, _ = versions.SplitID(input.Version.ProductVersion)
+	}
+
 	c.logger.Debugf("Getting all product versions\n")
 
-	allVersions, err := client.ProductVersions(input.Source.ProductSlug)
-	if err != nil {
+	cache := newVersionsCache(logDir, endpoint, input.Source.ProductSlug)
+	cached := cache.load()
+
+	allVersions, etag, err := client.ProductVersionsIfNoneMatch(
+		input.Source.ProductSlug,
+		cached.ETag,
+	)
+	switch err {
+	case nil:
+		err := cache.save(cachedVersions{ETag: etag, Versions: allVersions})
+		if err != nil {
+			// A cache that cannot be written only means the next check
+			// cannot be short-circuited.
+			c.logger.Debugf("Failed to write versions cache: %s\n", err.Error())
+		}
+	case pivnet.ErrNotModified:
+		c.logger.Debugf("Releases not modified since ETag: %s\n", cached.ETag)
+		allVersions = cached.Versions
+	default:
 		return nil, err
 	}
 
 	c.logger.Debugf("All known versions: %+v\n", allVersions)
 
+	if len(versions.Duplicates(allVersions)) > 0 {
+		allVersions, err = c.uniqueVersions(
+			client,
+			input.Source.ProductSlug,
+			allVersions,
+			input.Source.DuplicateVersionStrategy,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(allVersions) == 0 {
+		err := c.noReleases(input.Source.ProductSlug, input.Source.FailOnNoReleases)
+		if err != nil {
+			return nil, err
+		}
 		return concourse.CheckResponse{}, nil
 	}
 
-	newVersions, err := versions.Since(allVersions, input.Version.ProductVersion)
-	if err != nil {
-		// Untested because versions.Since cannot be forced to return an error.
-		return nil, err
+	if excludeVersionRegexp != nil {
+		allVersions = c.excludeVersions(allVersions, excludeVersionRegexp)
+	}
+
+	if input.Source.MinimumVersion != "" {
+		allVersions = c.versionsAtLeast(allVersions, input.Source.MinimumVersion)
+	}
+
+	if !since.IsZero() {
+		allVersions, err = c.versionsUpdatedSince(client, input.Source.ProductSlug, allVersions, since)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !debounceThreshold.IsZero() {
+		allVersions, err = c.versionsSettled(
+			client,
+			input.Source.ProductSlug,
+			allVersions,
+			debounceThreshold,
+			input.Version.ProductVersion,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(input.Source.RequireFileGlobs) > 0 {
+		allVersions, err = c.versionsWithFiles(
+			client,
+			input.Source.ProductSlug,
+			allVersions,
+			input.Source.RequireFileGlobs,
+			newFileGlobsCache(logDir, endpoint, input.Source.ProductSlug, input.Source.RequireFileGlobs),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Source.SortBy == sortBySemver {
+		allVersions = versions.SortSemver(allVersions)
+		c.logger.Debugf("Versions sorted by semver: %+v\n", allVersions)
+	}
+
+	if len(allVersions) == 0 {
+		c.logger.Debugf(
+			"No releases remain after filtering: {product_slug: %s}\n",
+			input.Source.ProductSlug,
+		)
+		return concourse.CheckResponse{}, nil
+	}
+
+	var newVersions []string
+	if input.Version.ProductVersion == "" {
+		// On the first run there is no version to look for, so return the
+		// latest versions up to the first run depth.
+		newVersions = allVersions[:minInt(firstRunDepth, len(allVersions))]
+	} else {
+		// Concourse expects the requested version to be the first version
+		// returned, followed by newer versions.
+		var found bool
+		newVersions, found = versions.From(allVersions, input.Version.ProductVersion)
+		if !found {
+			newVersions = versions.NewerSemver(allVersions, input.Version.ProductVersion)
+			c.logger.Debugf(
+				"Requested version no longer exists - returning newer versions by semver: {version: %s, newer_versions: %v}\n",
+				input.Version.ProductVersion,
+				newVersions,
+			)
+		}
+
+		if (found && len(newVersions) == 1) || (!found && len(newVersions) == 0) {
+			c.logger.Debugf(
+				"No new versions since requested version: {product_slug: %s, version: %s}\n",
+				input.Source.ProductSlug,
+				input.Version.ProductVersion,
+			)
+		}
 	}
 
 	c.logger.Debugf("New versions: %+v\n", newVersions)
@@ -113,7 +448,641 @@ func (c *CheckCommand) Run(input concourse.CheckRequest) (concourse.CheckRespons
 		out = append(out, concourse.Version{ProductVersion: allVersions[0]})
 	}
 
+	out = c.truncate(out, input.Source.MaxVersions)
+
+	if withID || withFileHash {
+		out, err = c.formatVersions(
+			client,
+			input.Source.ProductSlug,
+			out,
+			input.Source.DuplicateVersionStrategy,
+			withID,
+			withFileHash,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.logger.Debugf("Returning output: %+v\n", out)
+
+	return out, nil
+}
+
+// formatVersions returns the versions with the ID of their release and the
+// hash of its files appended as requested, as out does with a version_format
+// of {version}#{id} and with version_includes_file_hashes. Of the releases
+// with a duplicated version, the one picked by the strategy is used, or
+// without a strategy the first listed.
+func (c *CheckCommand) formatVersions(
+	client pivnet.Client,
+	productSlug string,
+	out concourse.CheckResponse,
+	strategy string,
+	withID bool,
+	withFileHash bool,
+) (concourse.CheckResponse, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err = c.uniqueReleases(productSlug, releases, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	releasesByVersion := map[string]pivnet.Release{}
+	for _, r := range releases {
+		if _, ok := releasesByVersion[r.Version]; !ok {
+			releasesByVersion[r.Version] = r
+		}
+	}
+
+	var formatted concourse.CheckResponse
+	for _, v := range out {
+		release, ok := releasesByVersion[v.ProductVersion]
+		if !ok {
+			return nil, fmt.Errorf("release %s of product %s no longer exists", v.ProductVersion, productSlug)
+		}
+
+		version := v.ProductVersion
+		if withID {
+			version = versions.WithID(version, release.ID)
+		}
+
+		if withFileHash {
+			fileHash, err := c.releaseFileHash(client, productSlug, release)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"failed to hash files of release %s: %s",
+					release.Version,
+					err.Error(),
+				)
+			}
+
+			version = versions.WithFileHash(version, fileHash)
+		}
+
+		formatted = append(formatted, concourse.Version{
+			ProductSlug:    v.ProductSlug,
+			ProductVersion: version,
+		})
+	}
+
+	return formatted, nil
+}
+
+// releaseFileHash returns the hash of the MD5s of every file of the release,
+// as out does with version_includes_file_hashes. The MD5 of a product file is
+// only returned for the product file itself.
+func (c *CheckCommand) releaseFileHash(
+	client pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+) (string, error) {
+	productFiles, err := client.ReleaseProductFiles(productSlug, release.ID)
+	if err != nil {
+		return "", err
+	}
+
+	var md5s []string
+	for _, p := range productFiles.ProductFiles {
+		productFile, err := client.GetProductFile(productSlug, release.ID, p.ID)
+		if err != nil {
+			return "", err
+		}
+
+		md5s = append(md5s, productFile.MD5)
+	}
+
+	fileHash := versions.FileHash(md5s)
+
+	c.logger.Debugf(
+		"Hashed release files: {release_id: %d, files: %d, file_hash: %s}\n",
+		release.ID,
+		len(md5s),
+		fileHash,
+	)
+
+	return fileHash, nil
+}
+
+type productRelease struct {
+	productSlug string
+	release     pivnet.Release
+}
+
+// checkProductSlugs returns versions across all of the provided products.
+// Releases are ordered by release ID, which Pivotal Network assigns in
+// creation order across all products.
+func (c *CheckCommand) checkProductSlugs(
+	client pivnet.Client,
+	productSlugs []string,
+	currentVersion concourse.Version,
+	firstRunDepth int,
+	excludeVersionRegexp *regexp.Regexp,
+	minimumVersion string,
+	since time.Time,
+	debounceThreshold time.Time,
+	maxVersions int,
+	failOnNoReleases bool,
+	duplicateVersionStrategy string,
+) (concourse.CheckResponse, error) {
+	var allReleases []productRelease
+	excluded := 0
+	for _, productSlug := range productSlugs {
+		c.logger.Debugf("Getting all releases for product: %s\n", productSlug)
+
+		releases, err := client.ReleasesForProductSlug(productSlug)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(releases) == 0 {
+			err := c.noReleases(productSlug, failOnNoReleases)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		releases, err = c.uniqueReleases(productSlug, releases, duplicateVersionStrategy)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range releases {
+			if excludeVersionRegexp != nil && excludeVersionRegexp.MatchString(r.Version) {
+				c.logger.Debugf(
+					"Excluding release: {product_slug: %s, version: %s}\n",
+					productSlug,
+					r.Version,
+				)
+				excluded++
+				continue
+			}
+
+			if minimumVersion != "" && versions.CompareSemver(r.Version, minimumVersion) < 0 {
+				c.logger.Debugf(
+					"Ignoring release below minimum_version %s: {product_slug: %s, version: %s}\n",
+					minimumVersion,
+					productSlug,
+					r.Version,
+				)
+				continue
+			}
+
+			if !since.IsZero() && !r.UpdatedSince(since) {
+				c.logger.Debugf(
+					"Ignoring release not updated since %s: {product_slug: %s, version: %s, updated_at: %s}\n",
+					since.Format(time.RFC3339),
+					productSlug,
+					r.Version,
+					r.UpdatedAt,
+				)
+				continue
+			}
+
+			if !debounceThreshold.IsZero() &&
+				r.UpdatedAfter(debounceThreshold) &&
+				!(productSlug == currentVersion.ProductSlug && r.Version == currentVersion.ProductVersion) {
+				c.logger.Debugf(
+					"Ignoring release updated within debounce_seconds: {product_slug: %s, version: %s, updated_at: %s}\n",
+					productSlug,
+					r.Version,
+					r.UpdatedAt,
+				)
+				continue
+			}
+
+			allReleases = append(allReleases, productRelease{
+				productSlug: productSlug,
+				release:     r,
+			})
+		}
+	}
+
+	if excludeVersionRegexp != nil {
+		c.logger.Debugf(
+			"Excluded releases matching exclude_version_regexp: {regexp: %s, excluded: %d, remaining: %d}\n",
+			excludeVersionRegexp.String(),
+			excluded,
+			len(allReleases),
+		)
+	}
+
+	if minimumVersion != "" {
+		c.logger.Infof("Only returning releases at or above minimum_version %s\n", minimumVersion)
+	}
+
+	if len(allReleases) == 0 {
+		c.logger.Debugf(
+			"No releases remain across all products: {product_slugs: %v}\n",
+			productSlugs,
+		)
+		return concourse.CheckResponse{}, nil
+	}
+
+	sort.Sort(byReleaseID(allReleases))
+
+	var out concourse.CheckResponse
+	if currentVersion.ProductVersion == "" {
+		first := len(allReleases) - minInt(firstRunDepth, len(allReleases))
+		for _, r := range allReleases[first:] {
+			out = append(out, concourse.Version{
+				ProductSlug:    r.productSlug,
+				ProductVersion: r.release.Version,
+			})
+		}
+	}
+
+	found := false
+	for i, r := range allReleases {
+		if r.productSlug == currentVersion.ProductSlug &&
+			r.release.Version == currentVersion.ProductVersion {
+			found = true
+
+			// Concourse expects the requested version to be the first version
+			// returned, followed by newer versions.
+			for _, newer := range allReleases[i:] {
+				out = append(out, concourse.Version{
+					ProductSlug:    newer.productSlug,
+					ProductVersion: newer.release.Version,
+				})
+			}
+			break
+		}
+	}
+
+	if currentVersion.ProductVersion != "" && !found {
+		// Releases are ordered by ID, which a deleted release no longer has,
+		// so the latest release is returned instead.
+		c.logger.Debugf(
+			"Requested version no longer exists - returning the latest release: {product_slug: %s, version: %s}\n",
+			currentVersion.ProductSlug,
+			currentVersion.ProductVersion,
+		)
+	}
+
+	if len(out) == 0 {
+		latest := allReleases[len(allReleases)-1]
+		out = append(out, concourse.Version{
+			ProductSlug:    latest.productSlug,
+			ProductVersion: latest.release.Version,
+		})
+	}
+
+	out = c.truncate(out, maxVersions)
+
 	c.logger.Debugf("Returning output: %+v\n", out)
 
 	return out, nil
 }
+
+// noReleases logs that the product has no releases at all, as opposed to no
+// new releases, and returns an error if check should fail because of it.
+func (c *CheckCommand) noReleases(productSlug string, failOnNoReleases bool) error {
+	c.logger.Debugf("Product has no releases: {product_slug: %s}\n", productSlug)
+
+	if failOnNoReleases {
+		return fmt.Errorf(
+			"product %s has no releases - check that the product slug is correct (%s is true)",
+			productSlug,
+			"fail_on_no_releases",
+		)
+	}
+
+	return nil
+}
+
+// uniqueVersions returns the versions with each duplicated version listed
+// once, in the position of the release picked by the strategy. The versions
+// cache only holds versions, so the releases are fetched to tell the
+// duplicates apart.
+func (c *CheckCommand) uniqueVersions(
+	client pivnet.Client,
+	productSlug string,
+	allVersions []string,
+	strategy string,
+) ([]string, error) {
+	if strategy == "" {
+		c.logger.Debugf(
+			"Duplicate versions detected: {product_slug: %s, versions: %v}\n",
+			productSlug,
+			versions.Duplicates(allVersions),
+		)
+		return allVersions, nil
+	}
+
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err = c.uniqueReleases(productSlug, releases, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	var unique []string
+	for _, r := range releases {
+		unique = append(unique, r.Version)
+	}
+
+	return unique, nil
+}
+
+// uniqueReleases returns the releases with only the release picked by the
+// strategy kept for each duplicated version, preserving their order. Without
+// a strategy the duplicates are only logged, and kept.
+func (c *CheckCommand) uniqueReleases(
+	productSlug string,
+	releases []pivnet.Release,
+	strategy string,
+) ([]pivnet.Release, error) {
+	var allVersions []string
+	for _, r := range releases {
+		allVersions = append(allVersions, r.Version)
+	}
+
+	duplicates := versions.Duplicates(allVersions)
+	if len(duplicates) == 0 {
+		return releases, nil
+	}
+
+	c.logger.Debugf(
+		"Duplicate versions detected: {product_slug: %s, versions: %v, strategy: %s}\n",
+		productSlug,
+		duplicates,
+		strategy,
+	)
+
+	switch strategy {
+	case "":
+		return releases, nil
+	case concourse.DuplicateVersionStrategyFail:
+		return nil, fmt.Errorf(
+			"product %s has more than one release with version %s (%s is %s)",
+			productSlug,
+			duplicates[0],
+			"duplicate_version_strategy",
+			concourse.DuplicateVersionStrategyFail,
+		)
+	}
+
+	// picked holds the index of the release kept for each version.
+	picked := map[string]int{}
+	for i, r := range releases {
+		p, ok := picked[r.Version]
+		if !ok ||
+			(strategy == concourse.DuplicateVersionStrategyNewest && r.NewerThan(releases[p])) ||
+			(strategy == concourse.DuplicateVersionStrategyOldest && releases[p].NewerThan(r)) {
+			picked[r.Version] = i
+		}
+	}
+
+	var unique []pivnet.Release
+	for i, r := range releases {
+		if picked[r.Version] == i {
+			unique = append(unique, r)
+		}
+	}
+
+	return unique, nil
+}
+
+// truncate returns the newest maxVersions of the versions, which are in
+// ascending order, or all of them if maxVersions is zero.
+func (c *CheckCommand) truncate(out concourse.CheckResponse, maxVersions int) concourse.CheckResponse {
+	if maxVersions == 0 || len(out) <= maxVersions {
+		return out
+	}
+
+	c.logger.Debugf(
+		"Truncating versions to max_versions: {max_versions: %d, found: %d, dropped: %+v}\n",
+		maxVersions,
+		len(out),
+		out[:len(out)-maxVersions],
+	)
+
+	return out[len(out)-maxVersions:]
+}
+
+// excludeVersions returns the versions that do not match the regexp,
+// preserving their order. The versions cache holds every version, so
+// changing the regexp takes effect on the next check.
+func (c *CheckCommand) excludeVersions(
+	allVersions []string,
+	excludeVersionRegexp *regexp.Regexp,
+) []string {
+	var included []string
+	for _, v := range allVersions {
+		if !excludeVersionRegexp.MatchString(v) {
+			included = append(included, v)
+		}
+	}
+
+	c.logger.Debugf(
+		"Excluded releases matching exclude_version_regexp: {regexp: %s, excluded: %d, remaining: %d}\n",
+		excludeVersionRegexp.String(),
+		len(allVersions)-len(included),
+		len(included),
+	)
+
+	return included
+}
+
+// versionsAtLeast returns the versions at or above the minimum version by
+// semver, preserving their order.
+func (c *CheckCommand) versionsAtLeast(allVersions []string, minimumVersion string) []string {
+	atLeast := versions.AtLeastSemver(allVersions, minimumVersion)
+
+	c.logger.Infof(
+		"Only returning releases at or above minimum_version %s: {excluded: %d, remaining: %d}\n",
+		minimumVersion,
+		len(allVersions)-len(atLeast),
+		len(atLeast),
+	)
+
+	return atLeast
+}
+
+// versionsUpdatedSince returns the versions of the releases updated since the
+// time, preserving their order. The versions cache only holds versions, so
+// the releases are always fetched to find their update times.
+func (c *CheckCommand) versionsUpdatedSince(
+	client pivnet.Client,
+	productSlug string,
+	allVersions []string,
+	since time.Time,
+) ([]string, error) {
+	releases, err := client.ReleasesUpdatedSince(productSlug, since)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := map[string]bool{}
+	for _, r := range releases {
+		updated[r.Version] = true
+	}
+
+	var included []string
+	for _, v := range allVersions {
+		if updated[v] {
+			included = append(included, v)
+		}
+	}
+
+	c.logger.Debugf(
+		"Ignored releases not updated since: {since: %s, ignored: %d, remaining: %d}\n",
+		since.Format(time.RFC3339),
+		len(allVersions)-len(included),
+		len(included),
+	)
+
+	return included, nil
+}
+
+// versionsSettled returns the versions of the releases not updated after the
+// debounce threshold, preserving their order. The requested version has
+// already been emitted, so it is always kept.
+func (c *CheckCommand) versionsSettled(
+	client pivnet.Client,
+	productSlug string,
+	allVersions []string,
+	threshold time.Time,
+	currentVersion string,
+) ([]string, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	settling := map[string]bool{}
+	for _, r := range releases {
+		if r.UpdatedAfter(threshold) && r.Version != currentVersion {
+			c.logger.Debugf(
+				"Ignoring release updated within debounce_seconds: {product_slug: %s, version: %s, updated_at: %s}\n",
+				productSlug,
+				r.Version,
+				r.UpdatedAt,
+			)
+			settling[r.Version] = true
+		}
+	}
+
+	var settled []string
+	for _, v := range allVersions {
+		if !settling[v] {
+			settled = append(settled, v)
+		}
+	}
+
+	return settled, nil
+}
+
+// versionsWithFiles returns the versions whose release has at least one
+// product file matching the globs. This gets the product files of every
+// release not already known to have a matching file, so the releases found
+// are cached.
+func (c *CheckCommand) versionsWithFiles(
+	client pivnet.Client,
+	productSlug string,
+	allVersions []string,
+	globs []string,
+	cache fileGlobsCache,
+) ([]string, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	releasesByVersion := map[string]pivnet.Release{}
+	for _, r := range releases {
+		if _, ok := releasesByVersion[r.Version]; !ok {
+			releasesByVersion[r.Version] = r
+		}
+	}
+
+	known := map[int]bool{}
+	for _, id := range cache.load().ReleaseIDs {
+		known[id] = true
+	}
+
+	var included []string
+	var matchedIDs []int
+	requested := 0
+	for _, v := range allVersions {
+		r, ok := releasesByVersion[v]
+		if !ok {
+			continue
+		}
+
+		if !known[r.ID] {
+			requested++
+
+			c.logger.Debugf(
+				"Getting product files to match require_file_globs: {product_slug: %s, version: %s}\n",
+				productSlug,
+				v,
+			)
+
+			productFiles, err := client.GetProductFiles(r)
+			if err != nil {
+				return nil, err
+			}
+
+			if !hasMatchingFile(productFiles, globs) {
+				continue
+			}
+		}
+
+		matchedIDs = append(matchedIDs, r.ID)
+		included = append(included, v)
+	}
+
+	err = cache.save(cachedFileGlobs{ReleaseIDs: matchedIDs})
+	if err != nil {
+		c.logger.Debugf("Failed to write require_file_globs cache: %s\n", err.Error())
+	}
+
+	c.logger.Debugf(
+		"Ignored releases without files matching require_file_globs: {ignored: %d, remaining: %d, product_files_requested: %d}\n",
+		len(allVersions)-len(included),
+		len(included),
+		requested,
+	)
+
+	return included, nil
+}
+
+// hasMatchingFile returns whether the file name of any of the product files
+// matches any of the globs.
+func hasMatchingFile(productFiles pivnet.ProductFiles, globs []string) bool {
+	for _, p := range productFiles.ProductFiles {
+		parts := strings.Split(p.AWSObjectKey, "/")
+		fileName := parts[len(parts)-1]
+
+		for _, glob := range globs {
+			// The globs are validated before use.
+			if matched, _ := filepath.Match(glob, fileName); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type byReleaseID []productRelease
+
+func (r byReleaseID) Len() int           { return len(r) }
+func (r byReleaseID) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byReleaseID) Less(i, j int) bool { return r[i].release.ID < r[j].release.ID }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
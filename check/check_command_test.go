@@ -1,19 +1,23 @@
 package check_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/ghttp"
 	"github.com/pivotal-cf-experimental/pivnet-resource/check"
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
 var _ = Describe("Check", func() {
@@ -69,7 +73,7 @@ var _ = Describe("Check", func() {
 
 		ginkgoLogger = logger.NewLogger(sanitizer)
 
-		checkCommand = check.NewCheckCommand(version, ginkgoLogger, logFilePath)
+		checkCommand = check.NewCheckCommand(context.Background(), version, ginkgoLogger, logFilePath)
 	})
 
 	AfterEach(func() {
@@ -100,6 +104,17 @@ var _ = Describe("Check", func() {
 		})
 	})
 
+	Context("when the endpoint is not an http or https URL", func() {
+		BeforeEach(func() {
+			checkRequest.Source.Endpoint = "network.pivotal.io"
+		})
+
+		It("returns an error", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).To(MatchError("endpoint must be an http or https URL - got network.pivotal.io"))
+		})
+	})
+
 	Context("when no product slug is provided", func() {
 		BeforeEach(func() {
 			checkRequest.Source.ProductSlug = ""
@@ -134,6 +149,204 @@ var _ = Describe("Check", func() {
 
 			Expect(response).To(BeEmpty())
 		})
+
+		Context("when fail_on_no_releases is true", func() {
+			BeforeEach(func() {
+				checkRequest.Source.FailOnNoReleases = true
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError(fmt.Sprintf(
+					"product %s has no releases - check that the product slug is correct (fail_on_no_releases is true)",
+					productSlug,
+				)))
+			})
+
+			Context("when product slugs are provided", func() {
+				BeforeEach(func() {
+					checkRequest.Source.ProductSlug = ""
+					checkRequest.Source.ProductSlugs = []string{"some-other-product-name", productSlug}
+
+					server.Reset()
+					server.AppendHandlers(
+						ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 2, "version":"Z"}]}`),
+						ghttp.RespondWith(http.StatusOK, `{"releases": []}`),
+					)
+				})
+
+				It("returns an error for the product without releases", func() {
+					_, err := checkCommand.Run(checkRequest)
+					Expect(err).To(MatchError(fmt.Sprintf(
+						"product %s has no releases - check that the product slug is correct (fail_on_no_releases is true)",
+						productSlug,
+					)))
+				})
+			})
+		})
+	})
+
+	Context("when version_format includes the release id", func() {
+		BeforeEach(func() {
+			checkRequest.Source.VersionFormat = "{version}#{id}"
+
+			releasesResponse := `{"releases": [{"id": 3, "version": "A"},{"id": 2, "version":"C"},{"id": 1, "version":"B"}]}`
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, releasesResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, releasesResponse),
+				),
+			)
+		})
+
+		It("returns the versions with the id of their release, like out", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{{ProductVersion: "A#3"}}))
+		})
+
+		Context("when the current version includes the release id", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{ProductVersion: "C#2"}
+			})
+
+			It("returns it followed by the newer versions", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "C#2"},
+					{ProductVersion: "A#3"},
+				}))
+			})
+		})
+
+		Context("when the version format is unknown", func() {
+			BeforeEach(func() {
+				checkRequest.Source.VersionFormat = "{id}"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("version_format must be one of {version} or {version}#{id} - got {id}"))
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug}
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("version_format may not be provided with product_slugs"))
+			})
+		})
+	})
+
+	Context("when version_includes_file_hashes is true", func() {
+		var fileHash string
+
+		BeforeEach(func() {
+			checkRequest.Source.VersionFileHashes = true
+
+			releasesResponse := `{"releases": [{"id": 3, "version": "A"},{"id": 2, "version":"C"},{"id": 1, "version":"B"}]}`
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, releasesResponse),
+				ghttp.RespondWith(http.StatusOK, releasesResponse),
+			)
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/3/product_files", apiPrefix, productSlug),
+				ghttp.RespondWith(http.StatusOK, `{"product_files": [{"id": 9}, {"id": 10}]}`),
+			)
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/3/product_files/9", apiPrefix, productSlug),
+				ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 9, "md5": "md5-a"}}`),
+			)
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/3/product_files/10", apiPrefix, productSlug),
+				ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 10, "md5": "md5-b"}}`),
+			)
+
+			fileHash = versions.FileHash([]string{"md5-a", "md5-b"})
+		})
+
+		It("returns the versions with a hash of the md5s of the files of their release, like out", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{{ProductVersion: "A@" + fileHash}}))
+		})
+
+		Context("when the files of the current version have changed", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{ProductVersion: "A@0123456789ab"}
+			})
+
+			It("returns the version with the hash of its files now", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{{ProductVersion: "A@" + fileHash}}))
+			})
+		})
+
+		Context("when version_format includes the release id", func() {
+			BeforeEach(func() {
+				checkRequest.Source.VersionFormat = "{version}#{id}"
+				checkRequest.Version = concourse.Version{ProductVersion: "A#3@" + fileHash}
+			})
+
+			It("appends the hash after the release id", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{{ProductVersion: "A#3@" + fileHash}}))
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug}
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("version_includes_file_hashes may not be provided with product_slugs"))
+			})
+		})
+	})
+
+	Context("when fail_on_no_releases is true and every release is excluded", func() {
+		BeforeEach(func() {
+			checkRequest.Source.FailOnNoReleases = true
+			checkRequest.Source.ExcludeVersionRegexp = ".*"
+		})
+
+		It("returns empty response without error", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(BeEmpty())
+		})
 	})
 
 	Context("when log files already exist", func() {
@@ -169,6 +382,56 @@ var _ = Describe("Check", func() {
 		})
 	})
 
+	Context("when pivnet returns an ETag for the releases", func() {
+		var (
+			releasesPath string
+		)
+
+		BeforeEach(func() {
+			releasesPath = fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", releasesPath),
+					ghttp.RespondWith(http.StatusOK, pivnetResponse, http.Header{
+						"ETag": []string{`"some-etag"`},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", releasesPath),
+					ghttp.VerifyHeaderKV("If-None-Match", `"some-etag"`),
+					ghttp.RespondWith(http.StatusNotModified, nil),
+				),
+			)
+		})
+
+		It("sends the ETag on the next check and reuses the cached versions", func() {
+			firstResponse, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			checkRequest.Version = firstResponse[0]
+
+			secondResponse, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+			Expect(secondResponse).To(Equal(firstResponse))
+		})
+
+		It("does not match the cache file when removing log files", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			cacheFiles, err := filepath.Glob(filepath.Join(tempDir, "pivnet-resource-check-cache-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cacheFiles).To(HaveLen(1))
+		})
+	})
+
 	Context("when there is an error getting product versions", func() {
 		BeforeEach(func() {
 			server.Reset()
@@ -187,20 +450,994 @@ var _ = Describe("Check", func() {
 		})
 	})
 
+	Context("when debug is enabled", func() {
+		var (
+			logBuffer *gbytes.Buffer
+		)
+
+		BeforeEach(func() {
+			checkRequest.Source.Debug = true
+
+			logBuffer = gbytes.NewBuffer()
+			checkCommand = check.NewCheckCommand(context.Background(), version, logger.NewLogger(logBuffer), logFilePath)
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/users/me", apiPrefix)),
+					ghttp.RespondWith(http.StatusOK, `{"user": {"id": 7, "email": "someone@example.com"}}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, pivnetResponse),
+				),
+			)
+		})
+
+		It("logs the user the token belongs to", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logBuffer).To(gbytes.Say(`Authenticated as: {id: 7, email: someone@example.com}`))
+		})
+
+		Context("when the user cannot be found", func() {
+			BeforeEach(func() {
+				server.SetHandler(0, ghttp.RespondWith(http.StatusNotFound, nil))
+			})
+
+			It("does not fail the check", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logBuffer).To(gbytes.Say("Failed to get current user"))
+			})
+		})
+	})
+
+	Context("when emit_timings is set", func() {
+		var (
+			logBuffer *gbytes.Buffer
+		)
+
+		BeforeEach(func() {
+			checkRequest.Source.EmitTimings = true
+
+			logBuffer = gbytes.NewBuffer()
+			checkCommand = check.NewCheckCommand(context.Background(), version, logger.NewLogger(logBuffer), logFilePath)
+		})
+
+		It("logs how long each API call takes", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logBuffer).To(gbytes.Say(
+				`Timing: {phase: api, name: GET %s%s/products/%s/releases, duration_ms: \d+}`,
+				server.URL(),
+				apiPrefix,
+				productSlug,
+			))
+		})
+
+		Context("when emit_timings is not set", func() {
+			BeforeEach(func() {
+				checkRequest.Source.EmitTimings = false
+			})
+
+			It("does not log timings", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logBuffer.Contents()).NotTo(ContainSubstring("Timing:"))
+			})
+		})
+	})
+
+	Context("when a first run depth is provided", func() {
+		BeforeEach(func() {
+			checkRequest.Source.FirstRunDepth = 2
+		})
+
+		It("returns the latest versions in ascending order", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "C"},
+				{ProductVersion: "A"},
+			}))
+		})
+
+		Context("when the depth is greater than the number of versions", func() {
+			BeforeEach(func() {
+				checkRequest.Source.FirstRunDepth = 10
+			})
+
+			It("returns every version in ascending order", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "B"},
+					{ProductVersion: "C"},
+					{ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when a version is provided", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{ProductVersion: "C"}
+			})
+
+			It("returns the provided version followed by the newer versions", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "C"},
+					{ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when the depth is negative", func() {
+			BeforeEach(func() {
+				checkRequest.Source.FirstRunDepth = -1
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("first_run_depth must not be negative"))
+			})
+		})
+	})
+
+	Context("when max versions is provided", func() {
+		BeforeEach(func() {
+			checkRequest.Source.FirstRunDepth = 10
+			checkRequest.Source.MaxVersions = 2
+		})
+
+		It("returns only the newest versions", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "C"},
+				{ProductVersion: "A"},
+			}))
+		})
+
+		Context("when a version is provided", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{ProductVersion: "B"}
+			})
+
+			It("returns only the newest versions", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "C"},
+					{ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when there are no more versions than max versions", func() {
+			BeforeEach(func() {
+				checkRequest.Source.MaxVersions = 3
+			})
+
+			It("returns every version", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(HaveLen(3))
+			})
+		})
+
+		Context("when max versions is negative", func() {
+			BeforeEach(func() {
+				checkRequest.Source.MaxVersions = -1
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("max_versions must not be negative"))
+			})
+		})
+	})
+
+	Context("when an exclude version regexp is provided", func() {
+		BeforeEach(func() {
+			checkRequest.Source.ExcludeVersionRegexp = "^A$"
+		})
+
+		It("ignores the matching versions", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "C"},
+			}))
+		})
+
+		Context("when a first run depth is provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.FirstRunDepth = 10
+			})
+
+			It("does not count the excluded versions towards the depth", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "B"},
+					{ProductVersion: "C"},
+				}))
+			})
+		})
+
+		Context("when every version is excluded", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ExcludeVersionRegexp = "."
+			})
+
+			It("returns an empty response", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(BeEmpty())
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug, "some-other-product-name"}
+				checkRequest.Source.ExcludeVersionRegexp = "-dev$"
+
+				server.Reset()
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 5, "version": "0.0.0-dev"},{"id": 1, "version":"B"}]}`),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 2, "version":"Z"}]}`),
+				)
+			})
+
+			It("ignores the matching releases across all products", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: "some-other-product-name", ProductVersion: "Z"},
+				}))
+			})
+		})
+
+		Context("when the regexp is invalid", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ExcludeVersionRegexp = "("
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError(ContainSubstring(
+					"exclude_version_regexp must be a valid regular expression - got (")))
+			})
+		})
+	})
+
+	Context("when a minimum version is provided", func() {
+		BeforeEach(func() {
+			checkRequest.Source.MinimumVersion = "2.0"
+			checkRequest.Source.FirstRunDepth = 10
+
+			server.SetHandler(0, ghttp.RespondWith(http.StatusOK,
+				`{"releases": [{"version": "2.1.0"},{"version":"1.9.9"},{"version":"2.0.0"},{"version":"legacy"}]}`))
+		})
+
+		It("ignores the versions below it, even on the first run", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "2.0.0"},
+				{ProductVersion: "2.1.0"},
+			}))
+		})
+
+		Context("when the requested version is below it", func() {
+			BeforeEach(func() {
+				checkRequest.Version.ProductVersion = "1.9.9"
+			})
+
+			It("returns only the versions at or above it", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "2.0.0"},
+					{ProductVersion: "2.1.0"},
+				}))
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug, "some-other-product-name"}
+
+				server.Reset()
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 5, "version": "1.9.9"},{"id": 1, "version":"2.0.0"}]}`),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 2, "version":"1.0.0"}]}`),
+				)
+			})
+
+			It("ignores the releases below it across all products", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: productSlug, ProductVersion: "2.0.0"},
+				}))
+			})
+		})
+
+		Context("when the minimum version is not semver", func() {
+			BeforeEach(func() {
+				checkRequest.Source.MinimumVersion = "two"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("minimum_version must be a semantic version, e.g. 2.0.0 - got two"))
+			})
+		})
+	})
+
+	Context("when since is provided", func() {
+		BeforeEach(func() {
+			checkRequest.Source.Since = "2016-02-01T00:00:00Z"
+			checkRequest.Source.FirstRunDepth = 10
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, pivnetResponse),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, `{"releases": [
+						{"version": "A", "updated_at": "2016-03-01T00:00:00.000Z"},
+						{"version": "C", "updated_at": "2016-01-01T00:00:00.000Z"},
+						{"version": "B", "updated_at": "2016-02-01T00:00:00.000Z"}
+					]}`),
+				),
+			)
+		})
+
+		It("only considers the releases updated since then", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "B"},
+				{ProductVersion: "A"},
+			}))
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug, "some-other-product-name"}
+
+				server.Reset()
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 5, "version": "A", "updated_at": "2016-03-01T00:00:00Z"},{"id": 1, "version":"B", "updated_at": "2016-01-01T00:00:00Z"}]}`),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 2, "version":"Z", "updated_at": "2016-02-02T00:00:00Z"}]}`),
+				)
+			})
+
+			It("only considers the releases updated since then across all products", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: "some-other-product-name", ProductVersion: "Z"},
+					{ProductSlug: productSlug, ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when since is not an RFC 3339 timestamp", func() {
+			BeforeEach(func() {
+				checkRequest.Source.Since = "2016-02-01"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError(
+					"since must be an RFC 3339 timestamp, e.g. 2016-01-02T15:04:05Z - got 2016-02-01"))
+			})
+		})
+	})
+
+	Context("when debounce_seconds is provided", func() {
+		var releasesResponse string
+
+		BeforeEach(func() {
+			checkRequest.Source.DebounceSeconds = 3600
+			checkRequest.Source.FirstRunDepth = 10
+
+			releasesResponse = fmt.Sprintf(`{"releases": [
+				{"version": "A", "updated_at": %q},
+				{"version": "C", "updated_at": "2016-01-01T00:00:00.000Z"},
+				{"version": "B"}
+			]}`, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, pivnetResponse),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, releasesResponse),
+				),
+			)
+		})
+
+		It("does not return the releases updated within the window", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "B"},
+				{ProductVersion: "C"},
+			}))
+		})
+
+		Context("when the release updated within the window is the requested version", func() {
+			BeforeEach(func() {
+				checkRequest.Version.ProductVersion = "A"
+			})
+
+			It("still returns it", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug, "some-other-product-name"}
+
+				server.Reset()
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(
+						`{"releases": [{"id": 5, "version": "A", "updated_at": %q},{"id": 1, "version":"B", "updated_at": "2016-01-01T00:00:00Z"}]}`,
+						time.Now().UTC().Format(time.RFC3339),
+					)),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 2, "version":"Z", "updated_at": "2016-02-02T00:00:00Z"}]}`),
+				)
+			})
+
+			It("does not return the releases updated within the window across all products", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: productSlug, ProductVersion: "B"},
+					{ProductSlug: "some-other-product-name", ProductVersion: "Z"},
+				}))
+			})
+		})
+
+		Context("when debounce_seconds is negative", func() {
+			BeforeEach(func() {
+				checkRequest.Source.DebounceSeconds = -1
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("debounce_seconds must not be negative"))
+			})
+		})
+	})
+
+	Context("when Pivnet appears to be in maintenance mode", func() {
+		BeforeEach(func() {
+			checkRequest.Version.ProductVersion = "C"
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(
+					http.StatusOK,
+					"<html><body>Down for maintenance</body></html>",
+					http.Header{"Content-Type": []string{"text/html"}},
+				),
+			)
+		})
+
+		It("returns an error", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).To(MatchError(
+				"Pivnet appears to be in maintenance mode - it responded with text/html rather than JSON"))
+		})
+
+		Context("when tolerate_maintenance is true", func() {
+			BeforeEach(func() {
+				checkRequest.Source.TolerateMaintenance = true
+			})
+
+			It("returns the current version unchanged", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "C"},
+				}))
+			})
+
+			Context("when there is no current version", func() {
+				BeforeEach(func() {
+					checkRequest.Version.ProductVersion = ""
+				})
+
+				It("returns no versions", func() {
+					response, err := checkCommand.Run(checkRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Context("when require_file_globs is provided", func() {
+		var productFilesRequests map[string]int
+
+		BeforeEach(func() {
+			checkRequest.Source.RequireFileGlobs = []string{"*.zip"}
+			checkRequest.Source.FirstRunDepth = 10
+
+			releasesResponse := fmt.Sprintf(`{"releases": [
+				{"id": 1, "version": "A", "_links": {"product_files": {"href": "%[1]s/files/A"}}},
+				{"id": 3, "version": "C", "_links": {"product_files": {"href": "%[1]s/files/C"}}},
+				{"id": 2, "version": "B", "_links": {"product_files": {"href": "%[1]s/files/B"}}}
+			]}`, server.URL())
+
+			server.Reset()
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				ghttp.RespondWith(http.StatusOK, releasesResponse),
+			)
+
+			productFilesRequests = map[string]int{}
+			for version, fileName := range map[string]string{"A": "product.zip", "B": "product.zip", "C": "notes.txt"} {
+				version, fileName := version, fileName
+				server.RouteToHandler("GET", "/files/"+version, func(w http.ResponseWriter, r *http.Request) {
+					productFilesRequests[version]++
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(
+						`{"product_files": [{"aws_object_key": "product_files/%s"}]}`,
+						fileName,
+					))(w, r)
+				})
+			}
+		})
+
+		It("only returns the versions with a file matching a glob", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "B"},
+				{ProductVersion: "A"},
+			}))
+		})
+
+		It("only gets the product files of releases not yet known to match on later checks", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response).To(HaveLen(2))
+
+			Expect(productFilesRequests).To(Equal(map[string]int{"A": 1, "B": 1, "C": 2}))
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug}
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("require_file_globs may not be provided with product_slugs"))
+			})
+		})
+
+		Context("when a glob is invalid", func() {
+			BeforeEach(func() {
+				checkRequest.Source.RequireFileGlobs = []string{"["}
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("require_file_globs must only contain valid globs - got ["))
+			})
+		})
+	})
+
+	Context("when the CA certificate is not PEM encoded", func() {
+		BeforeEach(func() {
+			checkRequest.Source.CACert = "not a certificate"
+		})
+
+		It("returns an error", func() {
+			_, err := checkCommand.Run(checkRequest)
+			Expect(err).To(MatchError("ca_cert must contain at least one PEM encoded certificate"))
+		})
+	})
+
+	Context("when sort_by is semver", func() {
+		BeforeEach(func() {
+			checkRequest.Source.SortBy = "semver"
+			checkRequest.Version = concourse.Version{ProductVersion: "1.2.3-build.9"}
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK,
+					`{"releases": [{"version": "1.2.3-build.9"},{"version":"1.2.3-build.11"},{"version":"1.2.3-build.10"}]}`),
+			)
+		})
+
+		It("orders versions by semver precedence rather than as returned", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "1.2.3-build.9"},
+				{ProductVersion: "1.2.3-build.10"},
+				{ProductVersion: "1.2.3-build.11"},
+			}))
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug}
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("sort_by may not be provided with product_slugs"))
+			})
+		})
+
+		Context("when sort_by is unknown", func() {
+			BeforeEach(func() {
+				checkRequest.Source.SortBy = "date"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError("sort_by must be semver if provided - got date"))
+			})
+		})
+	})
+
+	Context("when releases share a version", func() {
+		BeforeEach(func() {
+			checkRequest.Source.FirstRunDepth = 10
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK,
+					`{"releases": [{"id": 4, "version": "A"},{"id": 3, "version":"B"},{"id": 2, "version":"C"},{"id": 1, "version":"B"}]}`),
+				ghttp.RespondWith(http.StatusOK,
+					`{"releases": [{"id": 4, "version": "A"},{"id": 3, "version":"B"},{"id": 2, "version":"C"},{"id": 1, "version":"B"}]}`),
+			)
+		})
+
+		It("returns the versions as listed without getting the releases", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductVersion: "B"},
+				{ProductVersion: "C"},
+				{ProductVersion: "B"},
+				{ProductVersion: "A"},
+			}))
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		Context("when duplicate_version_strategy is newest", func() {
+			BeforeEach(func() {
+				checkRequest.Source.DuplicateVersionStrategy = "newest"
+			})
+
+			It("keeps the version of the release with the highest id", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "C"},
+					{ProductVersion: "B"},
+					{ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when duplicate_version_strategy is oldest", func() {
+			BeforeEach(func() {
+				checkRequest.Source.DuplicateVersionStrategy = "oldest"
+			})
+
+			It("keeps the version of the release with the lowest id", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "B"},
+					{ProductVersion: "C"},
+					{ProductVersion: "A"},
+				}))
+			})
+
+			Context("when the releases have no ids", func() {
+				BeforeEach(func() {
+					server.Reset()
+					server.AppendHandlers(
+						ghttp.RespondWith(http.StatusOK,
+							`{"releases": [{"version": "B"},{"version":"A"},{"version":"B"}]}`),
+						ghttp.RespondWith(http.StatusOK, `{"releases": [
+							{"version": "B", "updated_at": "2016-03-01T00:00:00Z"},
+							{"version": "A", "updated_at": "2016-02-01T00:00:00Z"},
+							{"version": "B", "updated_at": "2016-01-01T00:00:00Z"}
+						]}`),
+					)
+				})
+
+				It("compares their updated_at", func() {
+					response, err := checkCommand.Run(checkRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response).To(Equal(concourse.CheckResponse{
+						{ProductVersion: "B"},
+						{ProductVersion: "A"},
+					}))
+				})
+			})
+		})
+
+		Context("when duplicate_version_strategy is fail", func() {
+			BeforeEach(func() {
+				checkRequest.Source.DuplicateVersionStrategy = "fail"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError(
+					"product some-product-name has more than one release with version B (duplicate_version_strategy is fail)"))
+			})
+		})
+
+		Context("when product slugs are provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = ""
+				checkRequest.Source.ProductSlugs = []string{productSlug}
+				checkRequest.Source.DuplicateVersionStrategy = "newest"
+			})
+
+			It("keeps the release with the highest id", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: productSlug, ProductVersion: "C"},
+					{ProductSlug: productSlug, ProductVersion: "B"},
+					{ProductSlug: productSlug, ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when duplicate_version_strategy is unknown", func() {
+			BeforeEach(func() {
+				checkRequest.Source.DuplicateVersionStrategy = "random"
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(MatchError(
+					"duplicate_version_strategy must be one of newest, oldest or fail - got random"))
+			})
+		})
+	})
+
+	Context("when product slugs are provided", func() {
+		var (
+			otherProductSlug string
+		)
+
+		BeforeEach(func() {
+			otherProductSlug = "some-other-product-name"
+
+			checkRequest.Source.ProductSlug = ""
+			checkRequest.Source.ProductSlugs = []string{productSlug, otherProductSlug}
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 5, "version": "A"},{"id": 1, "version":"B"}]}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, otherProductSlug)),
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"id": 4, "version": "Y"},{"id": 2, "version":"Z"}]}`),
+				),
+			)
+		})
+
+		It("returns the most recent version across all products", func() {
+			response, err := checkCommand.Run(checkRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response).To(Equal(concourse.CheckResponse{
+				{ProductSlug: productSlug, ProductVersion: "A"},
+			}))
+		})
+
+		Context("when a version is provided", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{
+					ProductSlug:    otherProductSlug,
+					ProductVersion: "Z",
+				}
+			})
+
+			It("returns the provided version and newer versions across all products in release order", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: otherProductSlug, ProductVersion: "Z"},
+					{ProductSlug: otherProductSlug, ProductVersion: "Y"},
+					{ProductSlug: productSlug, ProductVersion: "A"},
+				}))
+			})
+
+			Context("when max versions is provided", func() {
+				BeforeEach(func() {
+					checkRequest.Source.MaxVersions = 2
+				})
+
+				It("returns only the newest versions", func() {
+					response, err := checkCommand.Run(checkRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response).To(Equal(concourse.CheckResponse{
+						{ProductSlug: otherProductSlug, ProductVersion: "Y"},
+						{ProductSlug: productSlug, ProductVersion: "A"},
+					}))
+				})
+			})
+		})
+
+		Context("when a first run depth is provided and no version is provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.FirstRunDepth = 3
+			})
+
+			It("returns the latest versions across all products in release order", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductSlug: otherProductSlug, ProductVersion: "Z"},
+					{ProductSlug: otherProductSlug, ProductVersion: "Y"},
+					{ProductSlug: productSlug, ProductVersion: "A"},
+				}))
+			})
+		})
+
+		Context("when product slug is also provided", func() {
+			BeforeEach(func() {
+				checkRequest.Source.ProductSlug = productSlug
+			})
+
+			It("returns an error", func() {
+				_, err := checkCommand.Run(checkRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*product_slug.*product_slugs"))
+			})
+		})
+	})
+
 	Context("when a version is provided", func() {
 		BeforeEach(func() {
 			checkRequest.Version = concourse.Version{
-				"B",
+				ProductVersion: "B",
 			}
 		})
 
-		It("returns the most recent version", func() {
+		It("returns the provided version followed by the newer versions", func() {
 			response, err := checkCommand.Run(checkRequest)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(response).To(HaveLen(2))
-			Expect(response[0].ProductVersion).To(Equal("C"))
-			Expect(response[1].ProductVersion).To(Equal("A"))
+			Expect(response).To(HaveLen(3))
+			Expect(response[0].ProductVersion).To(Equal("B"))
+			Expect(response[1].ProductVersion).To(Equal("C"))
+			Expect(response[2].ProductVersion).To(Equal("A"))
+		})
+
+		Context("when the provided version no longer exists", func() {
+			BeforeEach(func() {
+				checkRequest.Version = concourse.Version{
+					ProductVersion: "1.2.3",
+				}
+
+				server.Reset()
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK,
+						`{"releases": [{"version": "1.3.0"},{"version":"1.2.10"},{"version":"1.2.2"}]}`),
+				)
+			})
+
+			It("returns the nearest newer versions by semver", func() {
+				response, err := checkCommand.Run(checkRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response).To(Equal(concourse.CheckResponse{
+					{ProductVersion: "1.2.10"},
+					{ProductVersion: "1.3.0"},
+				}))
+			})
+
+			Context("when there are no newer versions", func() {
+				BeforeEach(func() {
+					checkRequest.Version = concourse.Version{
+						ProductVersion: "2.0.0",
+					}
+				})
+
+				It("returns the most recent version", func() {
+					response, err := checkCommand.Run(checkRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response).To(Equal(concourse.CheckResponse{
+						{ProductVersion: "1.3.0"},
+					}))
+				})
+			})
 		})
 	})
 })
@@ -0,0 +1,59 @@
+package check
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// fileGlobsCache records the IDs of the releases found to have a product file
+// matching require_file_globs, so their product files are not requested again
+// on every check. Releases without a matching file are not recorded, as files
+// may still be added to them. Like the versions cache, it lives alongside the
+// log files in the check container.
+type fileGlobsCache struct {
+	path string
+}
+
+type cachedFileGlobs struct {
+	ReleaseIDs []int `json:"release_ids"`
+}
+
+func newFileGlobsCache(dir string, endpoint string, productSlug string, globs []string) fileGlobsCache {
+	key := sha1.Sum([]byte(endpoint + "/" + productSlug + "\n" + strings.Join(globs, "\n")))
+
+	return fileGlobsCache{
+		path: filepath.Join(dir, fmt.Sprintf("pivnet-resource-check-files-cache-%x.json", key)),
+	}
+}
+
+func (f fileGlobsCache) load() cachedFileGlobs {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return cachedFileGlobs{}
+	}
+
+	var cached cachedFileGlobs
+	err = json.Unmarshal(b, &cached)
+	if err != nil {
+		return cachedFileGlobs{}
+	}
+
+	return cached
+}
+
+func (f fileGlobsCache) save(cached cachedFileGlobs) error {
+	if len(cached.ReleaseIDs) == 0 {
+		return removeIfExists(f.path)
+	}
+
+	b, err := json.Marshal(cached)
+	if err != nil {
+		panic(err)
+	}
+
+	return ioutil.WriteFile(f.path, b, 0600)
+}
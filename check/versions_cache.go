@@ -0,0 +1,68 @@
+package check
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// versionsCache records the product versions last returned by Pivotal
+// Network along with the ETag of that response. It lives alongside the log
+// files in the check container, so it is lost whenever the container is
+// recreated; a missing or unreadable cache simply means nothing is skipped.
+type versionsCache struct {
+	path string
+}
+
+type cachedVersions struct {
+	ETag     string   `json:"etag"`
+	Versions []string `json:"versions"`
+}
+
+func newVersionsCache(dir string, endpoint string, productSlug string) versionsCache {
+	key := sha1.Sum([]byte(endpoint + "/" + productSlug))
+
+	return versionsCache{
+		path: filepath.Join(dir, fmt.Sprintf("pivnet-resource-check-cache-%x.json", key)),
+	}
+}
+
+func (v versionsCache) load() cachedVersions {
+	b, err := ioutil.ReadFile(v.path)
+	if err != nil {
+		return cachedVersions{}
+	}
+
+	var cached cachedVersions
+	err = json.Unmarshal(b, &cached)
+	if err != nil {
+		return cachedVersions{}
+	}
+
+	return cached
+}
+
+func (v versionsCache) save(cached cachedVersions) error {
+	if cached.ETag == "" {
+		return removeIfExists(v.path)
+	}
+
+	b, err := json.Marshal(cached)
+	if err != nil {
+		panic(err)
+	}
+
+	return ioutil.WriteFile(v.path, b, 0600)
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
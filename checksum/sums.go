@@ -0,0 +1,37 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Sums are the hex-encoded digests of a file's contents.
+type Sums struct {
+	MD5    string
+	SHA256 string
+}
+
+// FileSums returns the MD5 and SHA256 of the file, reading it only once.
+func FileSums(filepath string) (Sums, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return Sums{}, err
+	}
+	defer file.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), file)
+	if err != nil {
+		return Sums{}, err // not tested
+	}
+
+	return Sums{
+		MD5:    fmt.Sprintf("%x", md5Hash.Sum(nil)),
+		SHA256: fmt.Sprintf("%x", sha256Hash.Sum(nil)),
+	}, nil
+}
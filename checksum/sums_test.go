@@ -0,0 +1,51 @@
+package checksum_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/checksum"
+)
+
+var _ = Describe("FileSums", func() {
+	var (
+		tempDir      string
+		tempFilePath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		tempFilePath = filepath.Join(tempDir, "foobar")
+
+		err = ioutil.WriteFile(tempFilePath, []byte("foobar contents"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(tempDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns the MD5 and SHA256 of a file without error", func() {
+		sums, err := checksum.FileSums(tempFilePath)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sums).To(Equal(checksum.Sums{
+			MD5:    "fdd3d599138fd15d7673f3d3539531c1",
+			SHA256: "070a103eb906d53a5933d96f3301635d6c416491d6a0ebd0bf4d4e448af5762d",
+		}))
+	})
+
+	Context("when there is an error reading the file", func() {
+		It("returns the error", func() {
+			_, err := checksum.FileSums("/not/a/valid/file")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/diff"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+)
+
+var (
+	// version is deliberately left uninitialized so it can be set at compile-time
+	version string
+)
+
+func main() {
+	if version == "" {
+		version = "dev"
+	}
+
+	apiToken := flag.String("api-token", os.Getenv("PIVNET_API_TOKEN"), "Pivnet API token (defaults to $PIVNET_API_TOKEN)")
+	endpoint := flag.String("endpoint", pivnet.Endpoint, "Pivnet endpoint")
+	productSlug := flag.String("product-slug", "", "product slug of the releases to compare")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s --product-slug <slug> <old version> <new version>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *apiToken == "" {
+		log.Fatalf("%s must be provided\n", "api-token")
+	}
+
+	if *productSlug == "" {
+		log.Fatalf("%s must be provided\n", "product-slug")
+	}
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oldVersion := flag.Arg(0)
+	newVersion := flag.Arg(1)
+
+	clientConfig := pivnet.NewClientConfig{
+		Endpoint:  *endpoint,
+		Token:     *apiToken,
+		UserAgent: useragent.UserAgent(version, "diff", *productSlug),
+	}
+	client := pivnet.NewClient(clientConfig, logger.NewLogger(ioutil.Discard))
+
+	oldFiles, err := releaseFiles(client, *productSlug, oldVersion)
+	if err != nil {
+		log.Fatalf("Failed to get files for release %s: %s\n", oldVersion, err.Error())
+	}
+
+	newFiles, err := releaseFiles(client, *productSlug, newVersion)
+	if err != nil {
+		log.Fatalf("Failed to get files for release %s: %s\n", newVersion, err.Error())
+	}
+
+	result := diff.Files(oldFiles, newFiles)
+
+	fmt.Printf("--- %s\n", oldVersion)
+	fmt.Printf("+++ %s\n", newVersion)
+
+	if result.Empty() {
+		fmt.Println("no differences")
+		return
+	}
+
+	for _, f := range result.Removed {
+		fmt.Printf("- %s (md5: %s)\n", f.Name, f.MD5)
+	}
+
+	for _, f := range result.Added {
+		fmt.Printf("+ %s (md5: %s)\n", f.Name, f.MD5)
+	}
+
+	for _, c := range result.Changed {
+		fmt.Printf("~ %s (md5: %s -> %s)\n", c.Name, c.OldMD5, c.NewMD5)
+	}
+}
+
+// releaseFiles returns the files of the release, named as they are when
+// downloaded by in.
+func releaseFiles(client pivnet.Client, productSlug string, version string) ([]diff.File, error) {
+	release, err := client.GetRelease(productSlug, version)
+	if err != nil {
+		return nil, err
+	}
+
+	productFiles, err := client.GetProductFiles(release)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []diff.File
+	for _, p := range productFiles.ProductFiles {
+		productFile, err := client.GetProductFile(productSlug, release.ID, p.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.Split(productFile.AWSObjectKey, "/")
+
+		files = append(files, diff.File{
+			Name: parts[len(parts)-1],
+			MD5:  productFile.MD5,
+		})
+	}
+
+	return files, nil
+}
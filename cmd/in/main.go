@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+	"github.com/pivotal-cf-experimental/pivnet-resource/errorfile"
 	"github.com/pivotal-cf-experimental/pivnet-resource/in"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
@@ -23,6 +27,11 @@ func main() {
 		version = "dev"
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		fmt.Println(version)
+		return
+	}
+
 	if len(os.Args) < 2 {
 		log.Fatalln(fmt.Sprintf(
 			"not enough args - usage: %s <sources directory>", os.Args[0]))
@@ -30,12 +39,6 @@ func main() {
 
 	downloadDir := os.Args[1]
 
-	var input concourse.InRequest
-	err := json.NewDecoder(os.Stdin).Decode(&input)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
 	logFile, err := ioutil.TempFile("", "pivnet-resource-in.log")
 	if err != nil {
 		log.Fatalln(err)
@@ -44,22 +47,74 @@ func main() {
 
 	fmt.Fprintf(os.Stderr, "logging to %s\n", logFile.Name())
 
-	sanitized := concourse.SanitizedSource(input.Source)
-	sanitizer := sanitizer.NewSanitizer(sanitized, logFile)
+	var input concourse.InRequest
+	err = json.NewDecoder(os.Stdin).Decode(&input)
+	if err != nil {
+		fmt.Fprintf(logFile, "Exiting with error: %v\n", err)
+		log.Fatalln(err)
+	}
 
+	// Once the source is decoded, errors are also written to its error_file.
+	// Until the logger is configured they are only logged to the log file.
+	sanitized := concourse.SanitizedSource(input.Source)
+	for k, v := range concourse.SanitizedEndpoint(input.Params.Endpoint) {
+		sanitized[k] = v
+	}
+	if input.Params.APIToken != "" {
+		sanitized[input.Params.APIToken] = "***REDACTED-PIVNET_API_TOKEN***"
+	}
+	var sanitizerOptions []sanitizer.Option
+	if input.Source.RedactPreservingLength {
+		sanitizerOptions = append(sanitizerOptions, sanitizer.PreserveLength())
+	}
+	sanitizer := sanitizer.NewSanitizer(sanitized, logFile, sanitizerOptions...)
 	l := logger.NewLogger(sanitizer)
 
-	response, err := in.NewInCommand(version, l, downloadDir).Run(input)
+	interpolated, err := concourse.InterpolatedSource(input.Source)
 	if err != nil {
-		l.Debugf("Exiting with error: %v\n", err)
-		log.Fatalln(err)
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
+	}
+	input.Source = interpolated
+
+	for k, v := range concourse.SanitizedSource(input.Source) {
+		sanitizer.Add(k, v)
+	}
+
+	stderrLevel, err := logger.ParseStderrLevel(input.Source.LogLevel, input.Source.EmitTimings)
+	if err != nil {
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
+	}
+
+	// The log file has every message, stderr only those at or above the
+	// log_level, so the build output shows them without the debug noise.
+	l = logger.NewTeeLogger(
+		logger.NewLogger(sanitizer),
+		logger.NewLevelLogger(sanitizer.WithSink(os.Stderr), stderrLevel),
+	)
+
+	// Concourse sends SIGTERM when a build is aborted - cancel in-flight
+	// requests rather than leaving them running until they time out.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	response, err := in.NewInCommand(ctx, version, l, downloadDir).Run(input)
+	if err != nil {
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
 	}
 
 	l.Debugf("Returning output: %+v\n", response)
 
 	err = json.NewEncoder(os.Stdout).Encode(response)
 	if err != nil {
-		l.Debugf("Exiting with error: %v\n", err)
+		l.Errorf("Exiting with error: %v\n", err)
 		log.Fatalln(err)
 	}
 }
+
+// exitWithError logs the error, writes it to the error_file, if one is
+// provided, and exits.
+func exitWithError(l logger.Logger, s sanitizer.Sanitizer, errorFile string, err error) {
+	l.Errorf("Exiting with error: %v\n", err)
+	errorfile.Report(l, s, errorFile, err)
+	log.Fatalln(err)
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+	"github.com/pivotal-cf-experimental/pivnet-resource/errorfile"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/out"
 	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
@@ -28,6 +32,11 @@ func main() {
 		version = "dev"
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		fmt.Println(version)
+		return
+	}
+
 	if len(os.Args) < 2 {
 		log.Fatalln(fmt.Sprintf(
 			"not enough args - usage: %s <sources directory>", os.Args[0]))
@@ -40,26 +49,76 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	var input concourse.OutRequest
-
-	err = json.NewDecoder(os.Stdin).Decode(&input)
+	logFile, err := ioutil.TempFile("", "pivnet-resource-out.log")
 	if err != nil {
 		log.Fatalln(err)
 	}
+	fmt.Fprintf(logFile, "PivNet Resource version: %s\n", version)
 
-	logFile, err := ioutil.TempFile("", "pivnet-resource-out.log")
+	fmt.Fprintf(os.Stderr, "logging to %s\n", logFile.Name())
+
+	rawInput, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
+		fmt.Fprintf(logFile, "Exiting with error: %v\n", err)
 		log.Fatalln(err)
 	}
-	fmt.Fprintf(logFile, "PivNet Resource version: %s\n", version)
 
-	fmt.Fprintf(os.Stderr, "logging to %s\n", logFile.Name())
+	var input concourse.OutRequest
 
-	sanitized := concourse.SanitizedSource(input.Source)
-	sanitizer := sanitizer.NewSanitizer(sanitized, logFile)
+	err = json.Unmarshal(rawInput, &input)
+	if err != nil {
+		fmt.Fprintf(logFile, "Exiting with error: %v\n", err)
+		log.Fatalln(err)
+	}
 
+	// Once the source is decoded, errors are also written to its error_file.
+	// Until the logger is configured they are only logged to the log file.
+	sanitized := concourse.SanitizedSource(input.Source)
+	for k, v := range concourse.SanitizedEndpoint(input.Params.Endpoint) {
+		sanitized[k] = v
+	}
+	if input.Params.APIToken != "" {
+		sanitized[input.Params.APIToken] = "***REDACTED-PIVNET_API_TOKEN***"
+	}
+	var sanitizerOptions []sanitizer.Option
+	if input.Source.RedactPreservingLength {
+		sanitizerOptions = append(sanitizerOptions, sanitizer.PreserveLength())
+	}
+	sanitizer := sanitizer.NewSanitizer(sanitized, logFile, sanitizerOptions...)
 	l := logger.NewLogger(sanitizer)
 
+	err = concourse.ValidateOutRequestKeys(rawInput)
+	if err != nil {
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
+	}
+
+	interpolated, err := concourse.InterpolatedSource(input.Source)
+	if err != nil {
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
+	}
+	input.Source = interpolated
+
+	for k, v := range concourse.SanitizedSource(input.Source) {
+		sanitizer.Add(k, v)
+	}
+
+	stderrLevel, err := logger.ParseStderrLevel(input.Source.LogLevel, input.Source.EmitTimings)
+	if err != nil {
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
+	}
+
+	// The log file has every message, stderr only those at or above the
+	// log_level, so the build output shows them without the debug noise.
+	l = logger.NewTeeLogger(
+		logger.NewLogger(sanitizer),
+		logger.NewLevelLogger(sanitizer.WithSink(os.Stderr), stderrLevel),
+	)
+
+	// Concourse sends SIGTERM when a build is aborted - cancel in-flight
+	// requests rather than leaving them running until they time out.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	outCmd := out.NewOutCommand(out.OutCommandConfig{
 		BinaryVersion:   version,
 		Logger:          l,
@@ -67,23 +126,32 @@ func main() {
 		SourcesDir:      sourcesDir,
 		LogFilePath:     logFile.Name(),
 		S3OutBinaryName: s3OutBinaryName,
+		Sanitizer:       sanitizer,
+		Context:         ctx,
 	})
 
 	response, err := outCmd.Run(input)
 	if err != nil {
-		l.Debugf("Exiting with error: %v\n", err)
-		log.Fatalln(err)
+		exitWithError(l, sanitizer, input.Source.ErrorFile, err)
 	}
 
 	l.Debugf("Returning output: %+v\n", response)
 
 	err = json.NewEncoder(os.Stdout).Encode(response)
 	if err != nil {
-		l.Debugf("Exiting with error: %v\n", err)
+		l.Errorf("Exiting with error: %v\n", err)
 		log.Fatalln(err)
 	}
 }
 
+// exitWithError logs the error, writes it to the error_file, if one is
+// provided, and exits.
+func exitWithError(l logger.Logger, s sanitizer.Sanitizer, errorFile string, err error) {
+	l.Errorf("Exiting with error: %v\n", err)
+	errorfile.Report(l, s, errorFile, err)
+	log.Fatalln(err)
+}
+
 func mustBeNonEmpty(input string, key string) {
 	if input == "" {
 		log.Fatalf("%s must be provided\n", key)
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+)
+
+var (
+	// version is deliberately left uninitialized so it can be set at compile-time
+	version string
+)
+
+func main() {
+	if version == "" {
+		version = "dev"
+	}
+
+	apiToken := flag.String("api-token", os.Getenv("PIVNET_API_TOKEN"), "Pivnet API token (defaults to $PIVNET_API_TOKEN)")
+	endpoint := flag.String("endpoint", pivnet.Endpoint, "Pivnet endpoint")
+	productSlug := flag.String("product-slug", "", "product slug of the release")
+	releaseVersion := flag.String("release-version", "", "version of the release the file is attached to")
+	deleteFile := flag.Bool("delete", false, "delete the product file rather than only detaching it from the release")
+	confirm := flag.Bool("confirm", false, "confirm the file should be removed - nothing is changed without it")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s --product-slug <slug> --release-version <version> [--delete] --confirm <file name or id>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *apiToken == "" {
+		log.Fatalf("%s must be provided\n", "api-token")
+	}
+
+	if *productSlug == "" {
+		log.Fatalf("%s must be provided\n", "product-slug")
+	}
+
+	if *releaseVersion == "" {
+		log.Fatalf("%s must be provided\n", "release-version")
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	clientConfig := pivnet.NewClientConfig{
+		Endpoint:  *endpoint,
+		Token:     *apiToken,
+		UserAgent: useragent.UserAgent(version, "prune", *productSlug),
+	}
+	client := pivnet.NewClient(clientConfig, logger.NewLogger(ioutil.Discard))
+
+	release, err := client.GetRelease(*productSlug, *releaseVersion)
+	if err != nil {
+		log.Fatalf("Failed to get release %s: %s\n", *releaseVersion, err.Error())
+	}
+
+	productFile, err := findProductFile(client, release, flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	action := "detach"
+	if *deleteFile {
+		action = "delete"
+	}
+
+	if !*confirm {
+		fmt.Printf(
+			"Would %s product file: {name: %s, id: %d} - re-run with --confirm to %s it\n",
+			action,
+			productFile.Name,
+			productFile.ID,
+			action,
+		)
+		return
+	}
+
+	product, err := client.FindProductForSlug(*productSlug)
+	if err != nil {
+		log.Fatalf("Failed to find product: %s\n", err.Error())
+	}
+
+	err = client.RemoveProductFile(product.ID, release.ID, productFile.ID)
+	if err != nil {
+		log.Fatalf("Failed to detach product file %d: %s\n", productFile.ID, err.Error())
+	}
+
+	fmt.Printf("Detached product file: {name: %s, id: %d}\n", productFile.Name, productFile.ID)
+
+	if !*deleteFile {
+		return
+	}
+
+	_, err = client.DeleteProductFile(*productSlug, productFile.ID)
+	if err != nil {
+		log.Fatalf("Failed to delete product file %d: %s\n", productFile.ID, err.Error())
+	}
+
+	fmt.Printf("Deleted product file: {name: %s, id: %d}\n", productFile.Name, productFile.ID)
+}
+
+// findProductFile returns the single product file of the release whose id or
+// name matches the given identifier.
+func findProductFile(client pivnet.Client, release pivnet.Release, identifier string) (pivnet.ProductFile, error) {
+	productFiles, err := client.GetProductFiles(release)
+	if err != nil {
+		return pivnet.ProductFile{}, fmt.Errorf("Failed to get product files: %s", err.Error())
+	}
+
+	id, idErr := strconv.Atoi(identifier)
+
+	var matches []pivnet.ProductFile
+	for _, p := range productFiles.ProductFiles {
+		if (idErr == nil && p.ID == id) || p.Name == identifier {
+			matches = append(matches, p)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return pivnet.ProductFile{}, fmt.Errorf(
+			"no product file with name or id %s is attached to release %s",
+			identifier,
+			release.Version,
+		)
+	case 1:
+		return matches[0], nil
+	default:
+		return pivnet.ProductFile{}, fmt.Errorf(
+			"%d product files named %s are attached to release %s - use the id instead",
+			len(matches),
+			identifier,
+			release.Version,
+		)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+	"github.com/pivotal-cf-experimental/pivnet-resource/in"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/out"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+)
+
+const (
+	s3OutBinaryName = "s3-out"
+
+	selftestFileName     = "pivnet-resource-selftest.txt"
+	selftestFileContents = "pivnet-resource selftest\n"
+)
+
+var (
+	// version is deliberately left uninitialized so it can be set at compile-time
+	version string
+)
+
+func main() {
+	if version == "" {
+		version = "dev"
+	}
+
+	eulaSlug := flag.String("eula-slug", "", "slug of the EULA of the throwaway release")
+	releaseType := flag.String("release-type", "Developer Release", "release type of the throwaway release")
+	filepathPrefix := flag.String("s3-filepath-prefix", "", "S3 filepath prefix of the product, as for put")
+	uploadBackend := flag.String("upload-backend", "", "upload_backend of the put, as for put")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s --eula-slug <slug> [--s3-filepath-prefix <prefix>] < source.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *eulaSlug == "" {
+		log.Fatalf("%s must be provided\n", "eula-slug")
+	}
+
+	// The source is read as for check, so the source of a resource can be
+	// tested unchanged.
+	rawInput, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = concourse.ValidateCheckRequestKeys(rawInput)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var input concourse.CheckRequest
+	err = json.Unmarshal(rawInput, &input)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	input.Source, err = concourse.InterpolatedSource(input.Source)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	logFile, err := ioutil.TempFile("", "pivnet-resource-selftest.log")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Fprintf(logFile, "PivNet Resource version: %s\n", version)
+
+	fmt.Fprintf(os.Stderr, "logging to %s\n", logFile.Name())
+
+	sanitized := concourse.SanitizedSource(input.Source)
+	sanitizer := sanitizer.NewSanitizer(sanitized, logFile)
+	l := logger.NewLogger(sanitizer)
+
+	// s3-out is expected alongside the binary, as it is for out.
+	binDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := selftest{
+		ctx:            ctx,
+		logger:         l,
+		logFilePath:    logFile.Name(),
+		sanitizer:      sanitizer,
+		binDir:         binDir,
+		stdout:         newStdout(sanitized),
+		source:         input.Source,
+		eulaSlug:       *eulaSlug,
+		releaseType:    *releaseType,
+		filepathPrefix: *filepathPrefix,
+		uploadBackend:  *uploadBackend,
+		productVersion: fmt.Sprintf("selftest-%d", time.Now().Unix()),
+	}
+
+	if !s.run() {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+
+	fmt.Println("PASS")
+}
+
+type selftest struct {
+	ctx         context.Context
+	logger      logger.Logger
+	logFilePath string
+	sanitizer   sanitizer.Sanitizer
+	binDir      string
+	stdout      io.Writer
+
+	source         concourse.Source
+	eulaSlug       string
+	releaseType    string
+	filepathPrefix string
+	uploadBackend  string
+	productVersion string
+}
+
+// run puts a throwaway release with a single small file, gets it back,
+// compares the MD5 of the file with that of the file put and deletes the
+// release, reporting each step. The release is deleted even if a step fails
+// after it is created. It returns whether every step passed.
+func (s selftest) run() bool {
+	tempDir, err := ioutil.TempDir("", "pivnet-resource-selftest")
+	if err != nil {
+		return s.report("create working directory", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourcesDir := filepath.Join(tempDir, "sources")
+	downloadDir := filepath.Join(tempDir, "download")
+
+	putErr := s.put(sourcesDir)
+	passed := s.report(fmt.Sprintf("put release %s", s.productVersion), putErr)
+
+	if passed {
+		getErr := s.get(downloadDir)
+		passed = s.report(fmt.Sprintf("get release %s", s.productVersion), getErr)
+	}
+
+	if passed {
+		passed = s.report("compare md5 of file", compareMD5(
+			filepath.Join(sourcesDir, "files", selftestFileName),
+			filepath.Join(downloadDir, selftestFileName),
+		))
+	}
+
+	// A put that fails may still have created the release.
+	deleted, deleteErr := s.deleteRelease()
+	if deleteErr == nil && !deleted {
+		fmt.Fprintf(s.stdout, "SKIP delete release %s: it was not created\n", s.productVersion)
+		return passed
+	}
+
+	return s.report(fmt.Sprintf("delete release %s", s.productVersion), deleteErr) && passed
+}
+
+func (s selftest) put(sourcesDir string) error {
+	files := map[string]string{
+		"version":                                s.productVersion,
+		"release_type":                           s.releaseType,
+		"eula_slug":                              s.eulaSlug,
+		filepath.Join("files", selftestFileName): selftestFileContents,
+	}
+
+	for name, contents := range files {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(sourcesDir, name)), os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(filepath.Join(sourcesDir, name), []byte(contents), os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+
+	outCmd := out.NewOutCommand(out.OutCommandConfig{
+		BinaryVersion:   version,
+		Logger:          s.logger,
+		OutDir:          s.binDir,
+		SourcesDir:      sourcesDir,
+		LogFilePath:     s.logFilePath,
+		S3OutBinaryName: s3OutBinaryName,
+		Sanitizer:       s.sanitizer,
+		Context:         s.ctx,
+	})
+
+	_, err := outCmd.Run(concourse.OutRequest{
+		Source: s.source,
+		Params: concourse.OutParams{
+			FileGlob:        "files/*",
+			FilepathPrefix:  s.filepathPrefix,
+			VersionFile:     "version",
+			ReleaseTypeFile: "release_type",
+			EulaSlugFile:    "eula_slug",
+			UploadBackend:   s.uploadBackend,
+		},
+	})
+	return err
+}
+
+// get downloads the file of the release, which in checks against the MD5
+// recorded by Pivotal Network.
+func (s selftest) get(downloadDir string) error {
+	_, err := in.NewInCommand(s.ctx, version, s.logger, downloadDir).Run(concourse.InRequest{
+		Source: s.source,
+		Version: concourse.Version{
+			ProductVersion: s.productVersion,
+		},
+		Params: concourse.InParams{
+			Globs: []string{selftestFileName},
+		},
+	})
+	return err
+}
+
+// deleteRelease deletes the product files of the release and then the
+// release, returning whether there was one to delete. Deleting the release
+// only detaches its files, which would otherwise be left on the product.
+func (s selftest) deleteRelease() (bool, error) {
+	endpoint := s.source.Endpoint
+	if endpoint == "" {
+		endpoint = pivnet.Endpoint
+	}
+
+	client := pivnet.NewClient(pivnet.NewClientConfig{
+		Endpoint:  endpoint,
+		Token:     s.source.APIToken,
+		UserAgent: useragent.UserAgent(version, "selftest", s.source.ProductSlug),
+	}, s.logger)
+
+	release, err := client.GetRelease(s.source.ProductSlug, s.productVersion)
+	var notFound pivnet.ErrNotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	productFiles, err := client.ReleaseProductFiles(s.source.ProductSlug, release.ID)
+	if err != nil {
+		return true, err
+	}
+
+	for _, productFile := range productFiles.ProductFiles {
+		_, err = client.DeleteProductFile(s.source.ProductSlug, productFile.ID)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, client.DeleteRelease(s.source.ProductSlug, release)
+}
+
+func compareMD5(putPath string, gotPath string) error {
+	put, err := fileMD5(putPath)
+	if err != nil {
+		return err
+	}
+
+	got, err := fileMD5(gotPath)
+	if err != nil {
+		return err
+	}
+
+	if got != put {
+		return fmt.Errorf("md5 of file got is %s rather than %s", got, put)
+	}
+
+	return nil
+}
+
+func fileMD5(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", md5.Sum(contents)), nil
+}
+
+// report prints whether the step passed and returns whether it did. Errors
+// are sanitized, as they may include the source.
+func (s selftest) report(step string, err error) bool {
+	if err != nil {
+		fmt.Fprintf(s.stdout, "FAIL %s: %s\n", step, err.Error())
+		return false
+	}
+
+	fmt.Fprintf(s.stdout, "PASS %s\n", step)
+	return true
+}
+
+func newStdout(sanitized map[string]string) io.Writer {
+	return sanitizer.NewSanitizer(sanitized, os.Stdout)
+}
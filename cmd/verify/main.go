@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+)
+
+var (
+	// version is deliberately left uninitialized so it can be set at compile-time
+	version string
+)
+
+func main() {
+	if version == "" {
+		version = "dev"
+	}
+
+	apiToken := flag.String("api-token", os.Getenv("PIVNET_API_TOKEN"), "Pivnet API token (defaults to $PIVNET_API_TOKEN)")
+	endpoint := flag.String("endpoint", pivnet.Endpoint, "Pivnet endpoint")
+	productSlug := flag.String("product-slug", "", "product slug to verify")
+	listProducts := flag.Bool("list-products", false, "list the slug and name of every product visible to the token")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *apiToken == "" {
+		log.Fatalf("%s must be provided\n", "api-token")
+	}
+
+	if !*listProducts && *productSlug == "" {
+		log.Fatalf("one of %s or %s must be provided\n", "product-slug", "list-products")
+	}
+
+	clientConfig := pivnet.NewClientConfig{
+		Endpoint:  *endpoint,
+		Token:     *apiToken,
+		UserAgent: useragent.UserAgent(version, "verify", *productSlug),
+	}
+	client := pivnet.NewClient(clientConfig, logger.NewLogger(ioutil.Discard))
+
+	if *listProducts {
+		products, err := client.Products()
+		if err != nil {
+			log.Fatalf("Failed to list products: %s\n", err.Error())
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "SLUG\tNAME")
+		for _, p := range products {
+			fmt.Fprintf(w, "%s\t%s\n", p.Slug, p.Name)
+		}
+		w.Flush()
+		return
+	}
+
+	product, err := client.FindProductForSlug(*productSlug)
+	if err != nil {
+		log.Fatalf(
+			"Failed to find product: %s - run with --list-products to see available slugs\n",
+			err.Error(),
+		)
+	}
+
+	fmt.Printf("Found product: {slug: %s, id: %d}\n", product.Slug, product.ID)
+}
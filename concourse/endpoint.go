@@ -0,0 +1,44 @@
+package concourse
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ValidateEndpoint returns an error if the endpoint configured by the key is
+// provided but is not an http or https URL. A password in the endpoint is
+// redacted from the error.
+func ValidateEndpoint(key string, endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// The parse error includes the endpoint, password and all.
+		return fmt.Errorf("%s must be an http or https URL", key)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL - got %s", key, u.Redacted())
+	}
+
+	return nil
+}
+
+// SanitizedEndpoint returns the password in the endpoint, if it has one,
+// along with its redacted form, in the form of SanitizedSource.
+func SanitizedEndpoint(endpoint string) map[string]string {
+	s := make(map[string]string)
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if password, ok := u.User.Password(); ok && password != "" {
+		s[password] = "***REDACTED-ENDPOINT_PASSWORD***"
+	}
+
+	return s
+}
@@ -0,0 +1,63 @@
+package concourse
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const (
+	APITokenEnvVar        = "PIVNET_API_TOKEN"
+	AccessKeyIDEnvVar     = "AWS_ACCESS_KEY_ID"
+	SecretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+)
+
+// envReference does not use the ((...)) syntax, as Concourse interpolates
+// that itself before the resource sees the source.
+var envReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// InterpolatedSource resolves credentials in the source from environment
+// variables. A value of the form ${VAR_NAME} is replaced with the value of
+// VAR_NAME, and an empty value falls back to a well-known variable.
+func InterpolatedSource(source Source) (Source, error) {
+	var err error
+
+	source.APIToken, err = interpolate("api_token", source.APIToken, APITokenEnvVar)
+	if err != nil {
+		return Source{}, err
+	}
+
+	source.AccessKeyID, err = interpolate("access_key_id", source.AccessKeyID, AccessKeyIDEnvVar)
+	if err != nil {
+		return Source{}, err
+	}
+
+	source.SecretAccessKey, err = interpolate("secret_access_key", source.SecretAccessKey, SecretAccessKeyEnvVar)
+	if err != nil {
+		return Source{}, err
+	}
+
+	return source, nil
+}
+
+func interpolate(key string, value string, fallbackEnvVar string) (string, error) {
+	if value == "" {
+		return os.Getenv(fallbackEnvVar), nil
+	}
+
+	matches := envReference.FindStringSubmatch(value)
+	if matches == nil {
+		return value, nil
+	}
+
+	envValue := os.Getenv(matches[1])
+	if envValue == "" {
+		return "", fmt.Errorf(
+			"%s references environment variable %s which is not set",
+			key,
+			matches[1],
+		)
+	}
+
+	return envValue, nil
+}
@@ -0,0 +1,95 @@
+package concourse_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+)
+
+var _ = Describe("InterpolatedSource", func() {
+	var (
+		source concourse.Source
+	)
+
+	BeforeEach(func() {
+		source = concourse.Source{
+			APIToken:        "some-api-token",
+			AccessKeyID:     "some-access-key-id",
+			SecretAccessKey: "some-secret-access-key",
+			ProductSlug:     "some-product",
+		}
+
+		os.Setenv("SOME_TOKEN_VAR", "token-from-env")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("SOME_TOKEN_VAR")
+		os.Unsetenv(concourse.APITokenEnvVar)
+		os.Unsetenv(concourse.AccessKeyIDEnvVar)
+		os.Unsetenv(concourse.SecretAccessKeyEnvVar)
+	})
+
+	It("leaves literal values untouched", func() {
+		interpolated, err := concourse.InterpolatedSource(source)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(interpolated).To(Equal(source))
+	})
+
+	Context("when a value references an environment variable", func() {
+		BeforeEach(func() {
+			source.APIToken = "${SOME_TOKEN_VAR}"
+		})
+
+		It("replaces the value with the environment variable", func() {
+			interpolated, err := concourse.InterpolatedSource(source)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated.APIToken).To(Equal("token-from-env"))
+			Expect(interpolated.AccessKeyID).To(Equal("some-access-key-id"))
+		})
+
+		Context("when the environment variable is not set", func() {
+			BeforeEach(func() {
+				source.SecretAccessKey = "${SOME_UNSET_VAR}"
+			})
+
+			It("returns an error", func() {
+				_, err := concourse.InterpolatedSource(source)
+				Expect(err).To(MatchError(
+					"secret_access_key references environment variable SOME_UNSET_VAR which is not set"))
+			})
+		})
+	})
+
+	Context("when a value uses the Concourse ((...)) syntax", func() {
+		BeforeEach(func() {
+			source.APIToken = "((env:SOME_TOKEN_VAR))"
+		})
+
+		It("leaves the value unchanged", func() {
+			interpolated, err := concourse.InterpolatedSource(source)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated.APIToken).To(Equal("((env:SOME_TOKEN_VAR))"))
+		})
+	})
+
+	Context("when values are empty", func() {
+		BeforeEach(func() {
+			source.APIToken = ""
+			source.AccessKeyID = ""
+			source.SecretAccessKey = ""
+
+			os.Setenv(concourse.APITokenEnvVar, "fallback-token")
+			os.Setenv(concourse.AccessKeyIDEnvVar, "fallback-access-key-id")
+		})
+
+		It("falls back to the well-known environment variables", func() {
+			interpolated, err := concourse.InterpolatedSource(source)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated.APIToken).To(Equal("fallback-token"))
+			Expect(interpolated.AccessKeyID).To(Equal("fallback-access-key-id"))
+			Expect(interpolated.SecretAccessKey).To(BeEmpty())
+		})
+	})
+})
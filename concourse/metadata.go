@@ -0,0 +1,61 @@
+package concourse
+
+import (
+	"sort"
+	"strings"
+)
+
+// metadataPriority is the order of the well-known metadata names, which are
+// emitted before all other metadata.
+var metadataPriority = []string{
+	"release_id",
+	"release_date",
+	"release_type",
+	"description",
+	"release_notes_url",
+	"eula_slug",
+	"availability",
+	"export_controlled",
+	"end_of_support_date",
+}
+
+// WarningsMetadata returns a warnings entry with the warnings one per line,
+// or no metadata at all if there are no warnings.
+func WarningsMetadata(warnings []string) []Metadata {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	return []Metadata{{Name: "warnings", Value: strings.Join(warnings, "\n")}}
+}
+
+// SortedMetadata returns the metadata with the well-known names first, in a
+// fixed order, followed by the rest ordered by name, so that the same inputs
+// always produce the same metadata. Entries with the same name keep their
+// order.
+func SortedMetadata(metadata []Metadata) []Metadata {
+	priority := map[string]int{}
+	for i, name := range metadataPriority {
+		priority[name] = i
+	}
+
+	rank := func(name string) int {
+		if p, ok := priority[name]; ok {
+			return p
+		}
+		return len(metadataPriority)
+	}
+
+	sorted := make([]Metadata, len(metadata))
+	copy(sorted, metadata)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i].Name), rank(sorted[j].Name)
+		if ri != rj {
+			return ri < rj
+		}
+		return ri == len(metadataPriority) && sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted
+}
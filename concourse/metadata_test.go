@@ -0,0 +1,61 @@
+package concourse_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+)
+
+var _ = Describe("SortedMetadata", func() {
+	It("orders the well-known names first and the rest by name", func() {
+		metadata := []concourse.Metadata{
+			{Name: "sha256: b", Value: "2"},
+			{Name: "release_type", Value: "Minor Release"},
+			{Name: "md5: a", Value: "1"},
+			{Name: "release_date", Value: "2016-01-02"},
+			{Name: "release_id", Value: "1234"},
+		}
+
+		Expect(concourse.SortedMetadata(metadata)).To(Equal([]concourse.Metadata{
+			{Name: "release_id", Value: "1234"},
+			{Name: "release_date", Value: "2016-01-02"},
+			{Name: "release_type", Value: "Minor Release"},
+			{Name: "md5: a", Value: "1"},
+			{Name: "sha256: b", Value: "2"},
+		}))
+	})
+
+	It("produces the same order regardless of the input order", func() {
+		metadata := []concourse.Metadata{
+			{Name: "file_size: b", Value: "2"},
+			{Name: "file_size: a", Value: "1"},
+			{Name: "description", Value: "some description"},
+		}
+		reversed := []concourse.Metadata{metadata[2], metadata[1], metadata[0]}
+
+		Expect(concourse.SortedMetadata(metadata)).To(Equal(concourse.SortedMetadata(reversed)))
+	})
+
+	It("keeps the order of entries with the same name", func() {
+		metadata := []concourse.Metadata{
+			{Name: "label", Value: "b"},
+			{Name: "label", Value: "a"},
+		}
+
+		Expect(concourse.SortedMetadata(metadata)).To(Equal(metadata))
+	})
+})
+
+var _ = Describe("WarningsMetadata", func() {
+	It("returns the warnings one per line", func() {
+		Expect(concourse.WarningsMetadata([]string{"some warning", "another warning"})).To(Equal([]concourse.Metadata{
+			{Name: "warnings", Value: "some warning\nanother warning"},
+		}))
+	})
+
+	Context("when there are no warnings", func() {
+		It("returns no metadata", func() {
+			Expect(concourse.WarningsMetadata(nil)).To(BeEmpty())
+		})
+	})
+})
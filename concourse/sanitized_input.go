@@ -1,5 +1,10 @@
 package concourse
 
+import (
+	"net/http"
+	"strings"
+)
+
 func SanitizedSource(source Source) map[string]string {
 	s := make(map[string]string)
 
@@ -12,6 +17,47 @@ func SanitizedSource(source Source) map[string]string {
 	if source.SecretAccessKey != "" {
 		s[source.SecretAccessKey] = "***REDACTED-AWS_SECRET_ACCESS_KEY***"
 	}
+	for k, v := range source.ExtraHeaders {
+		if v != "" && redactedHeader(k, source.RedactExtraHeaders) {
+			s[v] = "***REDACTED-EXTRA_HEADER***"
+		}
+	}
+	for k, v := range SanitizedEndpoint(source.Endpoint) {
+		s[k] = v
+	}
 
 	return s
 }
+
+// secretHeaderWords are the words in the names of headers that are taken
+// to carry secrets, e.g. Authorization, X-Gateway-Auth or X-Api-Key.
+var secretHeaderWords = []string{
+	"auth",
+	"cookie",
+	"credential",
+	"key",
+	"password",
+	"secret",
+	"session",
+	"token",
+}
+
+// redactedHeader reports whether the value of the extra header is redacted,
+// i.e. whether its name looks like it carries a secret or it is one of the
+// names the user asked to be redacted.
+func redactedHeader(name string, redacted []string) bool {
+	for _, r := range redacted {
+		if http.CanonicalHeaderKey(r) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+
+	name = strings.ToLower(name)
+	for _, w := range secretHeaderWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+
+	return false
+}
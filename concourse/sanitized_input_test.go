@@ -0,0 +1,53 @@
+package concourse_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+)
+
+var _ = Describe("SanitizedSource", func() {
+	It("redacts the values of extra headers that look like secrets", func() {
+		sanitized := concourse.SanitizedSource(concourse.Source{
+			ExtraHeaders: map[string]string{
+				"authorization":     "some-authorization",
+				"X-Gateway-Auth":    "some-gateway-auth",
+				"Cookie":            "some-cookie",
+				"X-Proxy-Token":     "some-token",
+				"x-api-key":         "some-key",
+				"X-Client-Secret":   "some-secret",
+				"X-Proxy-Password":  "some-password",
+				"X-Session-Id":      "some-session",
+				"X-Credentials":     "some-credentials",
+				"X-Request-From":    "concourse",
+				"X-Forwarded-Proto": "https",
+			},
+		})
+
+		Expect(sanitized).To(Equal(map[string]string{
+			"some-authorization": "***REDACTED-EXTRA_HEADER***",
+			"some-gateway-auth":  "***REDACTED-EXTRA_HEADER***",
+			"some-cookie":        "***REDACTED-EXTRA_HEADER***",
+			"some-token":         "***REDACTED-EXTRA_HEADER***",
+			"some-key":           "***REDACTED-EXTRA_HEADER***",
+			"some-secret":        "***REDACTED-EXTRA_HEADER***",
+			"some-password":      "***REDACTED-EXTRA_HEADER***",
+			"some-session":       "***REDACTED-EXTRA_HEADER***",
+			"some-credentials":   "***REDACTED-EXTRA_HEADER***",
+		}))
+	})
+
+	It("redacts the values of the extra headers listed in redact_extra_headers", func() {
+		sanitized := concourse.SanitizedSource(concourse.Source{
+			ExtraHeaders: map[string]string{
+				"X-Proxy-Secret": "some-secret",
+				"X-Request-From": "concourse",
+			},
+			RedactExtraHeaders: []string{"x-proxy-secret"},
+		})
+
+		Expect(sanitized).To(Equal(map[string]string{
+			"some-secret": "***REDACTED-EXTRA_HEADER***",
+		}))
+	})
+})
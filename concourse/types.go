@@ -1,13 +1,50 @@
 package concourse
 
+// The values of Source.DuplicateVersionStrategy, shared by check and in.
+const (
+	DuplicateVersionStrategyNewest = "newest"
+	DuplicateVersionStrategyOldest = "oldest"
+	DuplicateVersionStrategyFail   = "fail"
+)
+
 type Source struct {
-	APIToken        string `json:"api_token"`
-	ProductSlug     string `json:"product_slug"`
-	AccessKeyID     string `json:"access_key_id"`
-	SecretAccessKey string `json:"secret_access_key"`
-	Bucket          string `json:"bucket"`
-	Endpoint        string `json:"endpoint"`
-	Region          string `json:"region"`
+	APIToken        string   `json:"api_token"`
+	ProductSlug     string   `json:"product_slug"`
+	ProductSlugs    []string `json:"product_slugs"`
+	AccessKeyID     string   `json:"access_key_id"`
+	SecretAccessKey string   `json:"secret_access_key"`
+	Bucket          string   `json:"bucket"`
+	Endpoint        string   `json:"endpoint"`
+	Region          string   `json:"region"`
+	Debug           bool     `json:"debug"`
+	FirstRunDepth   int      `json:"first_run_depth"`
+
+	CACert              string `json:"ca_cert"`
+	SkipSSLVerification bool   `json:"skip_ssl_verification"`
+
+	ExtraHeaders            map[string]string `json:"extra_headers"`
+	ExtraHeadersOnDownloads bool              `json:"extra_headers_on_downloads"`
+	RedactExtraHeaders      []string          `json:"redact_extra_headers"`
+
+	ExcludeVersionRegexp string `json:"exclude_version_regexp"`
+	SortBy               string `json:"sort_by"`
+	Since                string `json:"since"`
+	MaxVersions          int    `json:"max_versions"`
+	MinimumVersion       string `json:"minimum_version"`
+	DebounceSeconds      int    `json:"debounce_seconds"`
+	FailOnNoReleases     bool   `json:"fail_on_no_releases"`
+	TolerateMaintenance  bool   `json:"tolerate_maintenance"`
+
+	DuplicateVersionStrategy string `json:"duplicate_version_strategy"`
+	VersionFormat            string `json:"version_format"`
+	VersionFileHashes        bool   `json:"version_includes_file_hashes"`
+
+	RequireFileGlobs []string `json:"require_file_globs"`
+
+	RedactPreservingLength bool   `json:"redact_preserving_length"`
+	LogLevel               string `json:"log_level"`
+	ErrorFile              string `json:"error_file"`
+	EmitTimings            bool   `json:"emit_timings"`
 }
 
 type CheckRequest struct {
@@ -16,6 +53,7 @@ type CheckRequest struct {
 }
 
 type Version struct {
+	ProductSlug    string `json:"product_slug,omitempty"`
 	ProductVersion string `json:"product_version"`
 }
 
@@ -28,7 +66,72 @@ type InRequest struct {
 }
 
 type InParams struct {
-	Globs []string `json:"globs"`
+	Globs           []string `json:"globs"`
+	Files           []string `json:"files"`
+	FileTypes       []string `json:"file_types"`
+	SkipEULA        bool     `json:"skip_eula"`
+	ResumeDownloads bool     `json:"resume_downloads"`
+	SkipExisting    bool     `json:"skip_existing"`
+	Latest          bool     `json:"latest"`
+	ReleaseID       int      `json:"release_id"`
+	LastN           int      `json:"last_n"`
+	ReleasedAfter   string   `json:"released_after"`
+	ReleasedBefore  string   `json:"released_before"`
+	Digest          string   `json:"digest"`
+	DeltaFrom       string   `json:"delta_from"`
+
+	SemverVersionMatch bool   `json:"semver_version_match"`
+	OnMissingVersion   string `json:"on_missing_version"`
+
+	AutoAcceptEULAs []string `json:"auto_accept_eulas"`
+
+	SkipForbiddenFiles bool `json:"skip_forbidden_files"`
+
+	DownloadRetries int `json:"download_retries"`
+
+	WaitForFileProcessing        bool `json:"wait_for_file_processing"`
+	FileProcessingTimeoutSeconds int  `json:"file_processing_timeout_seconds"`
+
+	DownloadBackend string `json:"download_backend"`
+	MirrorBaseURL   string `json:"mirror_base_url"`
+
+	FilenameTemplate string `json:"filename_template"`
+	OnCollision      string `json:"on_collision"`
+
+	SortProductFilesBy string `json:"sort_product_files_by"`
+
+	Select              string `json:"select"`
+	SelectVersionRegexp string `json:"select_version_regexp"`
+
+	VersionFile  string `json:"version_file"`
+	MetadataFile string `json:"metadata_file"`
+
+	MetadataFormats []string `json:"metadata_formats"`
+
+	PackageAs           string `json:"package_as"`
+	RemovePackagedFiles bool   `json:"remove_packaged_files"`
+
+	DownloadImageReferences bool `json:"download_image_references"`
+	DownloadProductIcon     bool `json:"download_product_icon"`
+
+	DumpRawRelease bool `json:"dump_raw_release"`
+
+	FileGroupsMetadata bool `json:"file_groups_metadata"`
+
+	DownloadOSL bool   `json:"download_osl"`
+	OSLGlob     string `json:"osl_glob"`
+
+	DownloadReleaseNotes bool `json:"download_release_notes"`
+
+	RequireMetadata []string `json:"require_metadata"`
+
+	ProgressIntervalSeconds int  `json:"progress_interval_seconds"`
+	DisableProgress         bool `json:"disable_progress"`
+
+	WarningsMetadata bool `json:"warnings_metadata"`
+
+	Endpoint string `json:"endpoint"`
+	APIToken string `json:"api_token"`
 }
 
 type InResponse struct {
@@ -47,16 +150,77 @@ type OutRequest struct {
 }
 
 type OutParams struct {
-	FileGlob            string `json:"file_glob"`
-	FilepathPrefix      string `json:"s3_filepath_prefix"`
-	VersionFile         string `json:"version_file"`
-	ReleaseTypeFile     string `json:"release_type_file"`
-	ReleaseDateFile     string `json:"release_date_file"`
-	EulaSlugFile        string `json:"eula_slug_file"`
-	DescriptionFile     string `json:"description_file"`
-	ReleaseNotesURLFile string `json:"release_notes_url_file"`
-	AvailabilityFile    string `json:"availability_file"`
-	UserGroupIDsFile    string `json:"user_group_ids_file"`
+	FileGlob            string   `json:"file_glob"`
+	ExcludeGlobs        []string `json:"exclude_globs"`
+	FileOrder           []string `json:"file_order"`
+	RequiredGlobs       []string `json:"required_globs"`
+	MinFiles            int      `json:"min_files"`
+	CleanupOnFailure    bool     `json:"cleanup_on_failure"`
+	VerifyUpload        *bool    `json:"verify_upload"`
+	FilepathPrefix      string   `json:"s3_filepath_prefix"`
+	VersionFile         string   `json:"version_file"`
+	VersionFrom         string   `json:"version_from"`
+	VersionGitDir       string   `json:"version_git_dir"`
+	VersionTagPrefix    string   `json:"version_tag_prefix"`
+	ReleaseTypeFile     string   `json:"release_type_file"`
+	ReleaseDateFile     string   `json:"release_date_file"`
+	ReleaseDate         string   `json:"release_date"`
+	EndOfSupportDate    string   `json:"end_of_support_date"`
+	ExportControlled    *bool    `json:"export_controlled"`
+	EulaSlugFile        string   `json:"eula_slug_file"`
+	EulaID              int      `json:"eula_id"`
+	DescriptionFile     string   `json:"description_file"`
+	ReleaseNotesURLFile string   `json:"release_notes_url_file"`
+	AvailabilityFile    string   `json:"availability_file"`
+	UserGroupIDsFile    string   `json:"user_group_ids_file"`
+	DependenciesFile    string   `json:"dependencies_file"`
+	TemplateVersion     string   `json:"template_version"`
+	Resume              bool     `json:"resume"`
+	Mode                string   `json:"mode"`
+	OverwriteExisting   bool     `json:"overwrite_existing"`
+	SyncFiles           bool     `json:"sync_files"`
+	UpdateFields        []string `json:"update_fields"`
+	MirrorProductSlug   string   `json:"mirror_product_slug"`
+	TmpDir              string   `json:"tmp_dir"`
+
+	ReleaseLabels map[string]string `json:"release_labels"`
+
+	DependencySpecifiers []DependencySpecifier `json:"dependency_specifiers"`
+
+	MetadataManifestJSON string `json:"metadata_manifest_json"`
+	FileGroup            string `json:"file_group"`
+
+	UploadBackend string `json:"upload_backend"`
+
+	UploadConcurrency int `json:"upload_concurrency"`
+
+	S3UploadConcurrency  int   `json:"s3_upload_concurrency"`
+	S3MultipartChunkSize int64 `json:"s3_multipart_chunk_size"`
+
+	S3UploadAttempts          int `json:"s3_upload_attempts"`
+	S3UploadRetryDelaySeconds int `json:"s3_upload_retry_delay_seconds"`
+
+	S3SSE      string `json:"s3_sse"`
+	S3KMSKeyID string `json:"s3_kms_key_id"`
+
+	WaitUntilAvailable      bool `json:"wait_until_available"`
+	WaitTimeoutSeconds      int  `json:"wait_timeout_seconds"`
+	WaitPollIntervalSeconds int  `json:"wait_poll_interval_seconds"`
+
+	ProgressIntervalSeconds int  `json:"progress_interval_seconds"`
+	DisableProgress         bool `json:"disable_progress"`
+
+	WarningsMetadata bool `json:"warnings_metadata"`
+
+	Endpoint string `json:"endpoint"`
+	APIToken string `json:"api_token"`
+}
+
+// DependencySpecifier is a range of versions of a product the release
+// depends on, e.g. >=2.0 <3.0.
+type DependencySpecifier struct {
+	ProductSlug string `json:"product_slug"`
+	Specifier   string `json:"specifier"`
 }
 
 type OutResponse struct {
@@ -0,0 +1,83 @@
+package concourse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidateOutRequestKeys returns an error if the params of the raw out
+// request contain keys that do not correspond to any out param.
+func ValidateOutRequestKeys(raw []byte) error {
+	var request struct {
+		Params map[string]json.RawMessage `json:"params"`
+	}
+
+	err := json.Unmarshal(raw, &request)
+	if err != nil {
+		return err
+	}
+
+	return validateKeys("params", request.Params, OutParams{})
+}
+
+// ValidateCheckRequestKeys returns an error if the source of the raw check
+// request contains keys that do not correspond to any source config.
+func ValidateCheckRequestKeys(raw []byte) error {
+	var request struct {
+		Source map[string]json.RawMessage `json:"source"`
+	}
+
+	err := json.Unmarshal(raw, &request)
+	if err != nil {
+		return err
+	}
+
+	return validateKeys("source", request.Source, Source{})
+}
+
+func validateKeys(name string, object map[string]json.RawMessage, v interface{}) error {
+	validKeys := jsonKeys(reflect.TypeOf(v))
+
+	valid := map[string]bool{}
+	for _, k := range validKeys {
+		valid[k] = true
+	}
+
+	var unknownKeys []string
+	for k := range object {
+		if !valid[k] {
+			unknownKeys = append(unknownKeys, k)
+		}
+	}
+
+	if len(unknownKeys) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknownKeys)
+	sort.Strings(validKeys)
+
+	return fmt.Errorf(
+		"unknown keys in %s: %s - valid keys are: %s",
+		name,
+		strings.Join(unknownKeys, ", "),
+		strings.Join(validKeys, ", "),
+	)
+}
+
+func jsonKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		keys = append(keys, tag)
+	}
+
+	return keys
+}
@@ -0,0 +1,61 @@
+package concourse_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+)
+
+var _ = Describe("Unknown keys", func() {
+	Describe("ValidateOutRequestKeys", func() {
+		It("accepts known params", func() {
+			raw := []byte(`{
+				"source": {"api_token": "some-token", "anything": "goes"},
+				"params": {"file_glob": "*", "version_file": "version"}
+			}`)
+
+			Expect(concourse.ValidateOutRequestKeys(raw)).To(Succeed())
+		})
+
+		It("accepts a request with no params", func() {
+			Expect(concourse.ValidateOutRequestKeys([]byte(`{"source": {}}`))).To(Succeed())
+		})
+
+		Context("when params contain unknown keys", func() {
+			It("returns an error listing the unknown and valid keys", func() {
+				raw := []byte(`{"params": {"file_globs": "*", "versionfile": "v", "version_file": "v"}}`)
+
+				err := concourse.ValidateOutRequestKeys(raw)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(HavePrefix("unknown keys in params: file_globs, versionfile - valid keys are: "))
+				Expect(err.Error()).To(ContainSubstring("file_glob, "))
+				Expect(err.Error()).To(ContainSubstring("version_file"))
+			})
+		})
+
+		Context("when the request is malformed", func() {
+			It("returns an error", func() {
+				Expect(concourse.ValidateOutRequestKeys([]byte(`{"params": []}`))).NotTo(Succeed())
+			})
+		})
+	})
+
+	Describe("ValidateCheckRequestKeys", func() {
+		It("accepts known source config", func() {
+			raw := []byte(`{"source": {"api_token": "some-token", "product_slug": "some-product"}}`)
+
+			Expect(concourse.ValidateCheckRequestKeys(raw)).To(Succeed())
+		})
+
+		Context("when source contains unknown keys", func() {
+			It("returns an error listing the unknown and valid keys", func() {
+				raw := []byte(`{"source": {"api_token": "some-token", "product": "some-product"}}`)
+
+				err := concourse.ValidateCheckRequestKeys(raw)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(HavePrefix("unknown keys in source: product - valid keys are: "))
+				Expect(err.Error()).To(ContainSubstring("product_slug"))
+			})
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package diff
+
+import "sort"
+
+// File is a product file of a release, identified by its file name.
+type File struct {
+	Name string
+	MD5  string
+}
+
+type Change struct {
+	Name   string
+	OldMD5 string
+	NewMD5 string
+}
+
+// Result lists the files added, removed and changed between two releases,
+// each sorted by name.
+type Result struct {
+	Added   []File
+	Removed []File
+	Changed []Change
+}
+
+// Empty returns true if the releases have the same files.
+func (r Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// Files compares the files of an old and a new release. A file is changed if
+// it is in both releases with a different MD5.
+func Files(oldFiles []File, newFiles []File) Result {
+	oldByName := map[string]File{}
+	for _, f := range oldFiles {
+		oldByName[f.Name] = f
+	}
+
+	newByName := map[string]File{}
+	for _, f := range newFiles {
+		newByName[f.Name] = f
+	}
+
+	var result Result
+	for _, f := range newFiles {
+		old, ok := oldByName[f.Name]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, f)
+		case old.MD5 != f.MD5:
+			result.Changed = append(result.Changed, Change{
+				Name:   f.Name,
+				OldMD5: old.MD5,
+				NewMD5: f.MD5,
+			})
+		}
+	}
+
+	for _, f := range oldFiles {
+		if _, ok := newByName[f.Name]; !ok {
+			result.Removed = append(result.Removed, f)
+		}
+	}
+
+	sort.Sort(byName(result.Added))
+	sort.Sort(byName(result.Removed))
+	sort.Sort(changesByName(result.Changed))
+
+	return result
+}
+
+type byName []File
+
+func (f byName) Len() int           { return len(f) }
+func (f byName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+
+type changesByName []Change
+
+func (c changesByName) Len() int           { return len(c) }
+func (c changesByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c changesByName) Less(i, j int) bool { return c[i].Name < c[j].Name }
@@ -0,0 +1,49 @@
+package diff_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/diff"
+)
+
+var _ = Describe("Diff", func() {
+	Describe("Files", func() {
+		It("returns the files added, removed and changed, sorted by name", func() {
+			oldFiles := []diff.File{
+				{Name: "unchanged.zip", MD5: "aaa"},
+				{Name: "removed.zip", MD5: "bbb"},
+				{Name: "changed.zip", MD5: "ccc"},
+			}
+
+			newFiles := []diff.File{
+				{Name: "unchanged.zip", MD5: "aaa"},
+				{Name: "z-added.zip", MD5: "eee"},
+				{Name: "changed.zip", MD5: "ddd"},
+				{Name: "a-added.zip", MD5: "fff"},
+			}
+
+			result := diff.Files(oldFiles, newFiles)
+			Expect(result).To(Equal(diff.Result{
+				Added: []diff.File{
+					{Name: "a-added.zip", MD5: "fff"},
+					{Name: "z-added.zip", MD5: "eee"},
+				},
+				Removed: []diff.File{
+					{Name: "removed.zip", MD5: "bbb"},
+				},
+				Changed: []diff.Change{
+					{Name: "changed.zip", OldMD5: "ccc", NewMD5: "ddd"},
+				},
+			}))
+			Expect(result.Empty()).To(BeFalse())
+		})
+
+		Context("when the releases have the same files", func() {
+			It("returns an empty result", func() {
+				files := []diff.File{{Name: "file.zip", MD5: "aaa"}}
+
+				Expect(diff.Files(files, files).Empty()).To(BeTrue())
+			})
+		})
+	})
+})
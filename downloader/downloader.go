@@ -1,51 +1,547 @@
 package downloader
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/md5"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/progress"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/timing"
 )
 
-func Download(downloadDir string, downloadLinks map[string]string, token string) ([]string, error) {
-	client := &http.Client{}
+const (
+	etagSuffix = ".etag"
+
+	// Files are downloaded to a path with partialSuffix and only renamed to
+	// their name once their MD5 is verified, so a file with its name is
+	// always complete, even if the download is killed.
+	partialSuffix = ".partial"
+)
+
+// ForbiddenError is returned when Pivotal Network forbids the download of a
+// file, e.g. because the file is only available to admins.
+type ForbiddenError struct {
+	FileName string
+}
+
+func (e ForbiddenError) Error() string {
+	return fmt.Sprintf(
+		"pivnet returned an error code of 403 for the file: %s - the token may not have access to it",
+		e.FileName,
+	)
+}
+
+// eulaError is returned when the EULA of the release has not been accepted,
+// which retrying cannot fix.
+type eulaError struct {
+	fileName string
+}
+
+func (e eulaError) Error() string {
+	return fmt.Sprintf("the EULA has not been accepted for the file: %s", e.fileName)
+}
+
+// md5Error is returned when a downloaded file does not match its expected
+// MD5.
+type md5Error struct {
+	fileName string
+	expected string
+	actual   string
+}
+
+func (e md5Error) Error() string {
+	return fmt.Sprintf(
+		"Failed MD5 comparison for file: %s. Expected %s, got %s",
+		e.fileName,
+		e.expected,
+		e.actual,
+	)
+}
+
+type Client interface {
+	Download(downloadLinks map[string]string) ([]string, error)
+}
+
+type client struct {
+	downloadDir      string
+	token            string
+	resumeDownloads  bool
+	skipExisting     bool
+	progressInterval time.Duration
+	skipForbidden    bool
+	attempts         int
+	retryBackoff     pivnet.BackoffConfig
+	md5s             map[string]string
+	headers          map[string]string
+	mirrorURLs       map[string]string
+	ctx              context.Context
+
+	httpClient *http.Client
+	logger     logger.Logger
+	timer      timing.Timer
+}
+
+type Config struct {
+	DownloadDir      string
+	Token            string
+	ResumeDownloads  bool
+	ProgressInterval time.Duration
+
+	// TLSConfig is used for connections to Pivotal Network and the file
+	// storage it redirects to. Defaults to the system TLS config.
+	TLSConfig *tls.Config
+
+	// SkipForbiddenFiles skips files that Pivotal Network forbids the
+	// download of, rather than failing the download of all of the files.
+	SkipForbiddenFiles bool
+
+	// Attempts is how many times each file is downloaded before giving up,
+	// waiting with RetryBackoff between attempts. Defaults to 1.
+	Attempts     int
+	RetryBackoff pivnet.BackoffConfig
+
+	// MD5s are the expected MD5s of the files by file name. Each file with
+	// an expected MD5 is verified after every attempt, and a mismatch is
+	// retried like any other failure.
+	MD5s map[string]string
+
+	// SkipExisting skips the download of files that already exist in
+	// DownloadDir with their expected MD5, e.g. from a cached destination.
+	// Files without an expected MD5 are always downloaded.
+	SkipExisting bool
+
+	// Headers are added to every download request, alongside the token.
+	Headers map[string]string
+
+	// MirrorURLs are the URLs of mirrors of the files by file name. Each
+	// file with a mirror URL is first downloaded from it, without the token
+	// or headers, falling back to its download link if the download or the
+	// MD5 verification fails.
+	MirrorURLs map[string]string
+
+	// Context aborts any in-progress download when it is cancelled. Defaults
+	// to context.Background().
+	Context context.Context
+
+	// Timings logs the duration of the download and MD5 verification of
+	// every file at the info level.
+	Timings bool
+
+	Logger logger.Logger
+}
+
+func NewClient(config Config) Client {
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attempts := config.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return &client{
+		downloadDir:      config.DownloadDir,
+		token:            config.Token,
+		resumeDownloads:  config.ResumeDownloads,
+		skipExisting:     config.SkipExisting,
+		progressInterval: config.ProgressInterval,
+		skipForbidden:    config.SkipForbiddenFiles,
+		attempts:         attempts,
+		retryBackoff:     config.RetryBackoff,
+		md5s:             config.MD5s,
+		headers:          config.Headers,
+		mirrorURLs:       config.MirrorURLs,
+		ctx:              ctx,
+
+		httpClient: newHTTPClient(config.TLSConfig),
+		logger:     config.Logger,
+		timer:      timing.NewTimer(config.Logger, config.Timings),
+	}
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return &http.Client{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}
+}
+
+func (c client) Download(downloadLinks map[string]string) ([]string, error) {
+	aggregator := progress.NewAggregator(progress.AggregatorConfig{
+		Files:    len(downloadLinks),
+		Interval: c.progressInterval,
+		Logger:   c.logger,
+	})
 
 	fileNames := []string{}
 	for fileName, downloadLink := range downloadLinks {
-		req, err := http.NewRequest("POST", downloadLink, nil)
-		if err != nil {
-			return nil, err
+		if c.skipExisting {
+			existing, err := c.existing(fileName)
+			if err != nil {
+				aggregator.Fail(fileName, err)
+				return nil, err
+			}
+
+			if existing {
+				c.logger.Debugf("Skipping download of existing file with matching MD5: %s\n", fileName)
+
+				aggregator.Complete(fileName)
+				fileNames = append(fileNames, fileName)
+				continue
+			}
 		}
-		req.Header.Add("Authorization", fmt.Sprintf("Token %s", token))
 
-		response, err := client.Do(req)
+		if mirrorURL, ok := c.mirrorURLs[fileName]; ok {
+			err := c.downloadFromMirror(aggregator, fileName, mirrorURL)
+			if err == nil {
+				aggregator.Complete(fileName)
+				fileNames = append(fileNames, fileName)
+				continue
+			}
+			if c.ctx.Err() != nil {
+				aggregator.Fail(fileName, err)
+				return nil, err
+			}
+
+			c.logger.Warnf(
+				"Warning: failed to download file from mirror - falling back to Pivotal Network: {file: %s, error: %s}\n",
+				fileName,
+				err.Error(),
+			)
+		}
+
+		err := c.downloadFileWithRetries(aggregator, fileName, downloadLink)
+		if err == nil && len(c.mirrorURLs) > 0 {
+			c.logger.Infof("Downloaded file from Pivotal Network: %s\n", fileName)
+		}
+		if _, ok := err.(ForbiddenError); ok && c.skipForbidden {
+			c.logger.Warnf("Warning: skipping file that the token is forbidden to download: %s\n", fileName)
+			continue
+		}
 		if err != nil {
+			aggregator.Fail(fileName, err)
 			return nil, err
 		}
 
-		if response.StatusCode == 451 {
-			return nil, errors.New(fmt.Sprintf("the EULA has not been accepted for the file: %s", fileName))
+		aggregator.Complete(fileName)
+
+		fileNames = append(fileNames, fileName)
+	}
+
+	return fileNames, nil
+}
+
+// downloadFromMirror downloads and verifies the file from its mirror once,
+// removing anything downloaded if it fails so the fallback starts afresh.
+func (c client) downloadFromMirror(
+	aggregator *progress.Aggregator,
+	fileName string,
+	mirrorURL string,
+) error {
+	c.logger.Debugf("Downloading file from mirror: {file: %s, url: %s}\n", fileName, sanitizer.URL(mirrorURL))
+
+	err := c.downloadFile(aggregator, fileName, "GET", mirrorURL, false)
+	if err == nil {
+		err = c.verifyMD5(fileName)
+	}
+	if err == nil {
+		err = c.completeDownload(fileName)
+	}
+	if err != nil {
+		downloadPath := filepath.Join(c.downloadDir, fileName)
+		removeErr := removeAll(downloadPath+partialSuffix, downloadPath+etagSuffix)
+		if removeErr != nil {
+			return removeErr // not tested
+		}
+
+		return err
+	}
+
+	c.logger.Infof("Downloaded file from mirror: {file: %s, url: %s}\n", fileName, sanitizer.URL(mirrorURL))
+
+	return nil
+}
+
+// downloadFileWithRetries downloads and verifies the file, retrying failures
+// other than those retrying cannot fix until the attempts are exhausted.
+func (c client) downloadFileWithRetries(
+	aggregator *progress.Aggregator,
+	fileName string,
+	downloadLink string,
+) error {
+	backoff := pivnet.NewBackoff(c.retryBackoff)
+
+	for attempt := 1; ; attempt++ {
+		stopTimer := c.timer.Start("download", fileName)
+		err := c.downloadFile(aggregator, fileName, "POST", downloadLink, true)
+		stopTimer()
+		if err == nil {
+			err = c.verifyMD5(fileName)
+		}
+		if err == nil {
+			err = c.completeDownload(fileName)
+		}
+
+		if err == nil || attempt >= c.attempts || !retryable(err) || c.ctx.Err() != nil {
+			return err
 		}
 
-		if response.StatusCode != http.StatusOK {
-			return nil, errors.New(fmt.Sprintf("pivnet returned an error code of %d for the file: %s", response.StatusCode, fileName))
+		retryDelay := backoff.Next()
+		c.logger.Debugf(
+			"Retrying download: {file: %s, attempt: %d, attempts: %d, retry_delay: %s, error: %s}\n",
+			fileName,
+			attempt+1,
+			c.attempts,
+			retryDelay.String(),
+			err.Error(),
+		)
+
+		err = backoff.Wait(c.ctx, retryDelay)
+		if err != nil {
+			return err
 		}
+	}
+}
+
+// existing returns whether the file has already been downloaded, i.e. exists
+// with its expected MD5.
+func (c client) existing(fileName string) (bool, error) {
+	expected, ok := c.md5s[fileName]
+	if !ok {
+		return false, nil
+	}
+
+	downloadPath := filepath.Join(c.downloadDir, fileName)
+	_, err := os.Stat(downloadPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := md5.NewFileContentsSummer(downloadPath).Sum()
+	if err != nil {
+		return false, err
+	}
+
+	if actual != expected {
+		c.logger.Debugf(
+			"Existing file does not match expected MD5 - downloading it again: {file: %s, expected: %s, actual: %s}\n",
+			fileName,
+			expected,
+			actual,
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// verifyMD5 returns an error if the partially downloaded file does not match
+// its expected MD5, removing the file so the next attempt starts afresh.
+func (c client) verifyMD5(fileName string) error {
+	expected, ok := c.md5s[fileName]
+	if !ok {
+		return nil
+	}
 
-		downloadPath := filepath.Join(downloadDir, fileName)
-		file, err := os.Create(downloadPath)
+	downloadPath := filepath.Join(c.downloadDir, fileName)
+	partialPath := downloadPath + partialSuffix
+	stopTimer := c.timer.Start("hash", fileName)
+	actual, err := md5.NewFileContentsSummer(partialPath).Sum()
+	stopTimer()
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		err := removeAll(partialPath, downloadPath+etagSuffix)
 		if err != nil {
-			return nil, err // not tested
+			return err // not tested
+		}
+
+		return md5Error{fileName: fileName, expected: expected, actual: actual}
+	}
+
+	c.logger.Debugf("MD5 for downloaded file: %s matched expected: %s\n", downloadPath, actual)
+
+	return nil
+}
+
+// completeDownload renames the verified partial download of the file to its
+// name, replacing any existing file atomically.
+func (c client) completeDownload(fileName string) error {
+	downloadPath := filepath.Join(c.downloadDir, fileName)
+
+	return os.Rename(downloadPath+partialSuffix, downloadPath)
+}
+
+func retryable(err error) bool {
+	switch err.(type) {
+	case ForbiddenError, eulaError:
+		return false
+	default:
+		return true
+	}
+}
+
+// downloadFile downloads the file from the link with the method to its
+// partial download path. Only authenticated requests carry the token and
+// headers, so that they are not sent to mirrors.
+func (c client) downloadFile(
+	aggregator *progress.Aggregator,
+	fileName string,
+	method string,
+	downloadLink string,
+	authenticated bool,
+) error {
+	downloadPath := filepath.Join(c.downloadDir, fileName)
+	partialPath := downloadPath + partialSuffix
+	etagPath := downloadPath + etagSuffix
+
+	var offset int64
+	var etag string
+	if c.resumeDownloads {
+		offset, etag = partialDownload(partialPath, etagPath)
+	}
+
+	req, err := http.NewRequest(method, downloadLink, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c.ctx)
+	if authenticated {
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Add("Authorization", fmt.Sprintf("Token %s", c.token))
+	}
+
+	if offset > 0 {
+		c.logger.Debugf(
+			"Resuming download: {file: %s, offset: %d, etag: %s}\n",
+			fileName,
+			offset,
+			etag,
+		)
+
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", offset))
+		if etag != "" {
+			req.Header.Add("If-Range", etag)
 		}
+	}
+
+	response, err := c.httpClient.Do(req)
+	if err != nil {
+		return sanitizer.URLError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == 451 {
+		return eulaError{fileName: fileName}
+	}
 
-		_, err = io.Copy(file, response.Body)
+	if response.StatusCode == http.StatusForbidden {
+		return ForbiddenError{FileName: fileName}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	var alreadyDownloaded int64
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		flags = os.O_WRONLY | os.O_APPEND
+		alreadyDownloaded = offset
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		c.logger.Debugf("Range not satisfiable - restarting download: %s\n", fileName)
+
+		err := removeAll(partialPath, etagPath)
 		if err != nil {
-			return nil, err // not tested
+			return err // not tested
 		}
+		return c.downloadFile(aggregator, fileName, method, downloadLink, authenticated)
+	case response.StatusCode == http.StatusOK:
+		if offset > 0 {
+			c.logger.Debugf("Server sent whole file - restarting download: %s\n", fileName)
+		}
+	default:
+		return errors.New(fmt.Sprintf("pivnet returned an error code of %d for the file: %s", response.StatusCode, fileName))
+	}
 
-		fileNames = append(fileNames, fileName)
+	if c.resumeDownloads {
+		if responseETag := response.Header.Get("ETag"); responseETag != "" {
+			err := ioutil.WriteFile(etagPath, []byte(responseETag), os.ModePerm)
+			if err != nil {
+				return err // not tested
+			}
+		}
 	}
 
-	return fileNames, nil
+	file, err := os.OpenFile(partialPath, flags, 0666)
+	if err != nil {
+		return err // not tested
+	}
+	defer file.Close()
+
+	var total int64
+	if response.ContentLength > 0 {
+		total = alreadyDownloaded + response.ContentLength
+	}
+
+	reporter := aggregator.Reporter(fileName, alreadyDownloaded, total)
+
+	_, err = io.Copy(file, io.TeeReader(response.Body, reporter))
+	if err != nil {
+		// The partial download is only kept if it can be resumed.
+		if !c.resumeDownloads {
+			removeAll(partialPath)
+		}
+		return err
+	}
+
+	return removeAll(etagPath)
+}
+
+// partialDownload returns the size of any previously downloaded part of the
+// file, along with the ETag recorded when that part was downloaded.
+func partialDownload(partialPath string, etagPath string) (int64, string) {
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		return 0, ""
+	}
+
+	etag, err := ioutil.ReadFile(etagPath)
+	if err != nil {
+		return info.Size(), ""
+	}
+
+	return info.Size(), string(etag)
+}
+
+func removeAll(paths ...string) error {
+	for _, p := range paths {
+		err := os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -1,20 +1,46 @@
 package downloader_test
 
 import (
+	"context"
+	"crypto/md5"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/downloader"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
 )
 
+// instantClock advances by the duration of every wait instead of sleeping,
+// and records the durations waited for.
+type instantClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *instantClock) Now() time.Time {
+	return c.now
+}
+
+func (c *instantClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
 var _ = Describe("Downloader", func() {
 	var (
 		server     *ghttp.Server
@@ -38,10 +64,20 @@ var _ = Describe("Downloader", func() {
 	Describe("Download", func() {
 		var (
 			token string
+
+			downloaderConfig downloader.Config
+			downloaderClient downloader.Client
 		)
 
 		BeforeEach(func() {
 			token = "1234-abcd"
+
+			downloaderConfig = downloader.Config{
+				DownloadDir: dir,
+				Token:       token,
+				Logger:      logger.NewLogger(GinkgoWriter),
+			}
+			downloaderClient = downloader.NewClient(downloaderConfig)
 		})
 
 		It("follows redirects", func() {
@@ -64,7 +100,30 @@ var _ = Describe("Downloader", func() {
 				"the-first-post": apiAddress + "/the-first-post",
 			}
 
-			_, err := downloader.Download(dir, fileNames, token)
+			_, err := downloaderClient.Download(fileNames)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("adds the headers to each download request", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/the-first-post", ""),
+					ghttp.VerifyHeaderKV("X-Proxy-Token", "some-proxy-token"),
+					ghttp.VerifyHeaderKV("Authorization", fmt.Sprintf("Token %s", token)),
+					ghttp.RespondWith(http.StatusOK, make([]byte, 10, 14)),
+				),
+			)
+
+			downloaderConfig.Headers = map[string]string{
+				"X-Proxy-Token": "some-proxy-token",
+			}
+			downloaderClient = downloader.NewClient(downloaderConfig)
+
+			fileNames := map[string]string{
+				"the-first-post": apiAddress + "/the-first-post",
+			}
+
+			_, err := downloaderClient.Download(fileNames)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -83,7 +142,7 @@ var _ = Describe("Downloader", func() {
 				))
 			}
 
-			_, err := downloader.Download(dir, fileNames, token)
+			_, err := downloaderClient.Download(fileNames)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(len(server.ReceivedRequests())).To(Equal(3))
 
@@ -122,7 +181,7 @@ var _ = Describe("Downloader", func() {
 				))
 			}
 
-			files, err := downloader.Download(dir, fileNames, token)
+			files, err := downloaderClient.Download(fileNames)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(len(files)).To(Equal(3))
@@ -132,6 +191,364 @@ var _ = Describe("Downloader", func() {
 			Expect(files).Should(ContainElement("file-2"))
 		})
 
+		Context("when a progress interval is configured", func() {
+			var (
+				fakeLogger *logger_fakes.FakeLogger
+			)
+
+			BeforeEach(func() {
+				fakeLogger = &logger_fakes.FakeLogger{}
+
+				downloaderConfig.ProgressInterval = time.Nanosecond
+				downloaderConfig.Logger = fakeLogger
+				downloaderClient = downloader.NewClient(downloaderConfig)
+			})
+
+			loggedLines := func() []string {
+				var lines []string
+				for i := 0; i < fakeLogger.DebugfCallCount(); i++ {
+					format, args := fakeLogger.DebugfArgsForCall(i)
+					lines = append(lines, fmt.Sprintf(format, args...))
+				}
+				return lines
+			}
+
+			It("logs the progress of all of the files as one status line", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, "contents-0"),
+					ghttp.RespondWith(http.StatusOK, "contents-1"),
+				)
+
+				_, err := downloaderClient.Download(map[string]string{
+					"file-0": apiAddress + "/post-0",
+					"file-1": apiAddress + "/post-1",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				lines := loggedLines()
+				Expect(lines).To(ContainElement(And(
+					HavePrefix("Progress: {files: 0/2"),
+					ContainSubstring("percent: 100%"),
+				)))
+				Expect(lines).To(ContainElement(And(
+					HavePrefix("Progress: {files: 1/2"),
+					ContainSubstring("total: 20 B"),
+				)))
+			})
+
+			It("logs the completion of each file", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, "contents-0"),
+				)
+
+				_, err := downloaderClient.Download(map[string]string{
+					"file-0": apiAddress + "/post-0",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(loggedLines()).To(ContainElement(
+					"Completed: {name: file-0, transferred: 10 B, files: 1/1}\n"))
+			})
+
+			It("logs the failure of a file", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusInternalServerError, nil),
+				)
+
+				_, err := downloaderClient.Download(map[string]string{
+					"file-0": apiAddress + "/post-0",
+				})
+				Expect(err).To(HaveOccurred())
+
+				Expect(loggedLines()).To(ContainElement(HavePrefix("Failed: {name: file-0")))
+			})
+		})
+
+		Context("when resuming downloads is enabled", func() {
+			var (
+				downloadPath string
+				etagPath     string
+				fileNames    map[string]string
+			)
+
+			BeforeEach(func() {
+				downloaderConfig.ResumeDownloads = true
+				downloaderClient = downloader.NewClient(downloaderConfig)
+
+				downloadPath = filepath.Join(dir, "file-0")
+				etagPath = downloadPath + ".etag"
+
+				fileNames = map[string]string{
+					"file-0": apiAddress + "/post-0",
+				}
+			})
+
+			Context("when a partial download exists", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(downloadPath+".partial", []byte("contents"), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+
+					err = ioutil.WriteFile(etagPath, []byte(`"some-etag"`), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("requests and appends the remainder of the file", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/post-0"),
+							ghttp.VerifyHeaderKV("Range", "bytes=8-"),
+							ghttp.VerifyHeaderKV("If-Range", `"some-etag"`),
+							ghttp.RespondWith(http.StatusPartialContent, "-0"),
+						),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(downloadPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("contents-0"))
+
+					_, err = os.Stat(downloadPath + ".partial")
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+
+				It("removes the recorded etag once the download completes", func() {
+					server.AppendHandlers(
+						ghttp.RespondWith(http.StatusPartialContent, "-0"),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = os.Stat(etagPath)
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+
+				Context("when the etag does not match", func() {
+					It("replaces the partial file with the whole file", func() {
+						server.AppendHandlers(
+							ghttp.RespondWith(http.StatusOK, "new-contents-0"),
+						)
+
+						_, err := downloaderClient.Download(fileNames)
+						Expect(err).NotTo(HaveOccurred())
+
+						contents, err := ioutil.ReadFile(downloadPath)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(contents)).To(Equal("new-contents-0"))
+					})
+				})
+
+				Context("when the range is not satisfiable", func() {
+					It("restarts the download without a range", func() {
+						server.AppendHandlers(
+							ghttp.RespondWith(http.StatusRequestedRangeNotSatisfiable, nil),
+							ghttp.CombineHandlers(
+								func(w http.ResponseWriter, r *http.Request) {
+									Expect(r.Header.Get("Range")).To(BeEmpty())
+								},
+								ghttp.RespondWith(http.StatusOK, "contents-0"),
+							),
+						)
+
+						_, err := downloaderClient.Download(fileNames)
+						Expect(err).NotTo(HaveOccurred())
+
+						contents, err := ioutil.ReadFile(downloadPath)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(contents)).To(Equal("contents-0"))
+					})
+				})
+			})
+
+			Context("when no partial download exists", func() {
+				It("downloads the whole file without a range", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							func(w http.ResponseWriter, r *http.Request) {
+								Expect(r.Header.Get("Range")).To(BeEmpty())
+							},
+							ghttp.RespondWith(http.StatusOK, "contents-0"),
+						),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(downloadPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("contents-0"))
+				})
+			})
+		})
+
+		Context("when skipping existing files is enabled", func() {
+			var (
+				downloadPath string
+				fileNames    map[string]string
+			)
+
+			BeforeEach(func() {
+				downloaderConfig.SkipExisting = true
+				downloaderConfig.MD5s = map[string]string{
+					"file-0": fmt.Sprintf("%x", md5.Sum([]byte("contents-0"))),
+				}
+				downloaderClient = downloader.NewClient(downloaderConfig)
+
+				downloadPath = filepath.Join(dir, "file-0")
+
+				fileNames = map[string]string{
+					"file-0": apiAddress + "/post-0",
+				}
+			})
+
+			Context("when the file exists with the expected MD5", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(downloadPath, []byte("contents-0"), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("does not download the file again", func() {
+					downloadedFiles, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(downloadedFiles).To(Equal([]string{"file-0"}))
+					Expect(server.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+
+			Context("when the file exists with a different MD5", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(downloadPath, []byte("old-contents-0"), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("downloads the file again", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/post-0"),
+							ghttp.RespondWith(http.StatusOK, "contents-0"),
+						),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(downloadPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("contents-0"))
+				})
+			})
+
+			Context("when the file does not exist", func() {
+				It("downloads the file", func() {
+					server.AppendHandlers(
+						ghttp.RespondWith(http.StatusOK, "contents-0"),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(server.ReceivedRequests()).To(HaveLen(1))
+				})
+			})
+		})
+
+		Context("when mirror URLs are provided", func() {
+			var (
+				downloadPath string
+				fileNames    map[string]string
+			)
+
+			BeforeEach(func() {
+				downloaderConfig.Headers = map[string]string{
+					"X-Proxy-Token": "some-proxy-token",
+				}
+				downloaderConfig.MD5s = map[string]string{
+					"file-0": fmt.Sprintf("%x", md5.Sum([]byte("contents-0"))),
+				}
+				downloaderConfig.MirrorURLs = map[string]string{
+					"file-0": apiAddress + "/mirror/file-0",
+				}
+				downloaderClient = downloader.NewClient(downloaderConfig)
+
+				downloadPath = filepath.Join(dir, "file-0")
+
+				fileNames = map[string]string{
+					"file-0": apiAddress + "/post-0",
+				}
+			})
+
+			It("downloads the file from the mirror without the token or headers", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/mirror/file-0"),
+						func(w http.ResponseWriter, r *http.Request) {
+							Expect(r.Header.Get("Authorization")).To(BeEmpty())
+							Expect(r.Header.Get("X-Proxy-Token")).To(BeEmpty())
+						},
+						ghttp.RespondWith(http.StatusOK, "contents-0"),
+					),
+				)
+
+				downloadedFiles, err := downloaderClient.Download(fileNames)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(downloadedFiles).To(Equal([]string{"file-0"}))
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+
+				contents, err := ioutil.ReadFile(downloadPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("contents-0"))
+			})
+
+			Context("when the mirror download fails", func() {
+				It("falls back to the download link", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", "/mirror/file-0"),
+							ghttp.RespondWith(http.StatusNotFound, nil),
+						),
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/post-0"),
+							ghttp.VerifyHeaderKV("Authorization", fmt.Sprintf("Token %s", token)),
+							ghttp.RespondWith(http.StatusOK, "contents-0"),
+						),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(downloadPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("contents-0"))
+				})
+			})
+
+			Context("when the mirrored file does not match its MD5", func() {
+				It("falls back to the download link", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", "/mirror/file-0"),
+							ghttp.RespondWith(http.StatusOK, "stale-contents-0"),
+						),
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/post-0"),
+							ghttp.RespondWith(http.StatusOK, "contents-0"),
+						),
+					)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(downloadPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("contents-0"))
+				})
+			})
+		})
+
 		Context("when the user has not accepted the EULA", func() {
 			It("raises an error", func() {
 				server.AppendHandlers(
@@ -146,11 +563,174 @@ var _ = Describe("Downloader", func() {
 					"the-first-post": apiAddress + "/the-first-post",
 				}
 
-				_, err := downloader.Download(dir, fileNames, token)
+				_, err := downloaderClient.Download(fileNames)
 				Expect(err).To(MatchError("the EULA has not been accepted for the file: the-first-post"))
 			})
 		})
 
+		Context("when retries are configured", func() {
+			var (
+				clock    *instantClock
+				contents string
+			)
+
+			BeforeEach(func() {
+				clock = &instantClock{now: time.Unix(0, 0)}
+				contents = "some contents"
+
+				downloaderConfig.Attempts = 3
+				downloaderConfig.RetryBackoff = pivnet.BackoffConfig{
+					InitialInterval: time.Second,
+					Multiplier:      2,
+					Clock:           clock,
+				}
+				downloaderConfig.MD5s = map[string]string{
+					"the-first-post": fmt.Sprintf("%x", md5.Sum([]byte(contents))),
+				}
+				downloaderClient = downloader.NewClient(downloaderConfig)
+			})
+
+			It("retries a failed download with backoff", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusInternalServerError, nil),
+					ghttp.RespondWith(http.StatusInternalServerError, nil),
+					ghttp.RespondWith(http.StatusOK, contents),
+				)
+
+				_, err := downloaderClient.Download(map[string]string{
+					"the-first-post": apiAddress + "/the-first-post",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(clock.waits).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+			})
+
+			It("retries a download that does not match its MD5", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, "some corrupted contents"),
+					ghttp.RespondWith(http.StatusOK, contents),
+				)
+
+				_, err := downloaderClient.Download(map[string]string{
+					"the-first-post": apiAddress + "/the-first-post",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(filepath.Join(dir, "the-first-post"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(b)).To(Equal(contents))
+			})
+
+			Context("when every attempt fails", func() {
+				It("returns the error of the last attempt", func() {
+					server.AppendHandlers(
+						ghttp.RespondWith(http.StatusInternalServerError, nil),
+						ghttp.RespondWith(http.StatusInternalServerError, nil),
+						ghttp.RespondWith(http.StatusOK, "some corrupted contents"),
+					)
+
+					_, err := downloaderClient.Download(map[string]string{
+						"the-first-post": apiAddress + "/the-first-post",
+					})
+					Expect(err).To(MatchError(HavePrefix("Failed MD5 comparison for file: the-first-post")))
+
+					Expect(len(server.ReceivedRequests())).To(Equal(3))
+				})
+
+				Context("when a previous download of the file exists", func() {
+					BeforeEach(func() {
+						err := ioutil.WriteFile(filepath.Join(dir, "the-first-post"), []byte(contents), os.ModePerm)
+						Expect(err).NotTo(HaveOccurred())
+					})
+
+					It("leaves it in place rather than writing over it", func() {
+						server.AppendHandlers(
+							ghttp.RespondWith(http.StatusOK, "some corrupted contents"),
+							ghttp.RespondWith(http.StatusOK, "some corrupted contents"),
+							ghttp.RespondWith(http.StatusOK, "some corrupted contents"),
+						)
+
+						_, err := downloaderClient.Download(map[string]string{
+							"the-first-post": apiAddress + "/the-first-post",
+						})
+						Expect(err).To(HaveOccurred())
+
+						b, err := ioutil.ReadFile(filepath.Join(dir, "the-first-post"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(b)).To(Equal(contents))
+					})
+				})
+			})
+
+			Context("when the EULA has not been accepted", func() {
+				It("does not retry", func() {
+					server.AppendHandlers(ghttp.RespondWith(451, nil))
+
+					_, err := downloaderClient.Download(map[string]string{
+						"the-first-post": apiAddress + "/the-first-post",
+					})
+					Expect(err).To(MatchError("the EULA has not been accepted for the file: the-first-post"))
+
+					Expect(len(server.ReceivedRequests())).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when Pivnet forbids the download of a file", func() {
+			var fileNames map[string]string
+
+			BeforeEach(func() {
+				server.RouteToHandler("POST", "/public-file", ghttp.RespondWith(http.StatusOK, "some contents"))
+				server.RouteToHandler("POST", "/admin-file", ghttp.RespondWith(http.StatusForbidden, nil))
+
+				fileNames = map[string]string{
+					"public-file": apiAddress + "/public-file",
+					"admin-file":  apiAddress + "/admin-file",
+				}
+			})
+
+			It("raises an error naming the file", func() {
+				_, err := downloaderClient.Download(fileNames)
+				Expect(err).To(MatchError(downloader.ForbiddenError{FileName: "admin-file"}))
+				Expect(err).To(MatchError(
+					"pivnet returned an error code of 403 for the file: admin-file - the token may not have access to it"))
+			})
+
+			Context("when skipping forbidden files", func() {
+				BeforeEach(func() {
+					downloaderConfig.SkipForbiddenFiles = true
+					downloaderClient = downloader.NewClient(downloaderConfig)
+				})
+
+				It("downloads the other files", func() {
+					files, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(files).To(Equal([]string{"public-file"}))
+
+					contents, err := ioutil.ReadFile(filepath.Join(dir, "public-file"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("some contents"))
+
+					_, err = os.Stat(filepath.Join(dir, "admin-file"))
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+
+				It("logs a warning naming the skipped file", func() {
+					fakeLogger := &logger_fakes.FakeLogger{}
+					downloaderConfig.Logger = fakeLogger
+					downloaderClient = downloader.NewClient(downloaderConfig)
+
+					_, err := downloaderClient.Download(fileNames)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeLogger.WarnfCallCount()).To(Equal(1))
+					format, args := fakeLogger.WarnfArgsForCall(0)
+					Expect(fmt.Sprintf(format, args...)).To(Equal(
+						"Warning: skipping file that the token is forbidden to download: admin-file\n"))
+				})
+			})
+		})
+
 		Context("when Pivnet returns any other non 302", func() {
 			It("raises an error", func() {
 				server.AppendHandlers(
@@ -165,17 +745,65 @@ var _ = Describe("Downloader", func() {
 					"the-first-post": apiAddress + "/the-first-post",
 				}
 
-				_, err := downloader.Download(dir, fileNames, token)
+				_, err := downloaderClient.Download(fileNames)
 				Expect(err).To(MatchError("pivnet returned an error code of 401 for the file: the-first-post"))
 			})
 		})
 
+		Context("when the context is cancelled during a download", func() {
+			var unblock chan struct{}
+
+			BeforeEach(func() {
+				unblock = make(chan struct{})
+			})
+
+			AfterEach(func() {
+				close(unblock)
+			})
+
+			It("aborts the download", func() {
+				server.AppendHandlers(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Length", "1024")
+					w.WriteHeader(http.StatusOK)
+					w.Write([]byte("some partial contents"))
+					w.(http.Flusher).Flush()
+					<-unblock
+				})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				downloaderConfig.Context = ctx
+				downloaderClient = downloader.NewClient(downloaderConfig)
+
+				errs := make(chan error, 1)
+				go func() {
+					_, err := downloaderClient.Download(map[string]string{
+						"the-first-post": apiAddress + "/the-first-post",
+					})
+					errs <- err
+				}()
+
+				Eventually(func() bool {
+					info, err := os.Stat(filepath.Join(dir, "the-first-post.partial"))
+					return err == nil && info.Size() > 0
+				}).Should(BeTrue())
+				cancel()
+
+				var err error
+				Eventually(errs).Should(Receive(&err))
+				Expect(err).To(MatchError(ContainSubstring("context canceled")))
+
+				_, err = os.Stat(filepath.Join(dir, "the-first-post"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+
+				_, err = os.Stat(filepath.Join(dir, "the-first-post.partial"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
 		Context("when it fails to make a request", func() {
 			It("raises an error", func() {
-				_, err := downloader.Download(
-					dir,
+				_, err := downloaderClient.Download(
 					map[string]string{"^731drop": "&h%%%%"},
-					token,
 				)
 
 				Expect(err).Should(HaveOccurred())
@@ -0,0 +1,110 @@
+package errorfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+)
+
+// The categories of errors, each with a stable code so wrappers can branch
+// on the failure without parsing logs.
+const (
+	CategoryError        = "error"
+	CategoryAuth         = "auth"
+	CategoryRateLimit    = "rate_limit"
+	CategoryNotFound     = "not_found"
+	CategoryEULARequired = "eula_required"
+	CategoryAPI          = "api"
+)
+
+var codes = map[string]int{
+	CategoryError:        1,
+	CategoryAuth:         2,
+	CategoryRateLimit:    3,
+	CategoryNotFound:     4,
+	CategoryEULARequired: 5,
+	CategoryAPI:          6,
+}
+
+// Error is the machine-readable description of the error a command exited
+// with.
+type Error struct {
+	Code     int    `json:"code"`
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// New returns the description of the error, categorised by the typed errors
+// of the pivnet client. Any other error is in CategoryError.
+func New(err error) Error {
+	category := CategoryError
+
+	var (
+		unauthorized  pivnet.ErrUnauthorized
+		rateLimited   pivnet.ErrRateLimited
+		notFound      pivnet.ErrNotFound
+		eulaRequired  pivnet.ErrEULARequired
+		responseError pivnet.ResponseError
+	)
+
+	switch {
+	case errors.As(err, &unauthorized):
+		category = CategoryAuth
+	case errors.As(err, &rateLimited):
+		category = CategoryRateLimit
+	case errors.As(err, &notFound):
+		category = CategoryNotFound
+	case errors.As(err, &eulaRequired):
+		category = CategoryEULARequired
+	case errors.As(err, &responseError):
+		category = CategoryAPI
+	}
+
+	return Error{
+		Code:     codes[category],
+		Category: category,
+		Message:  err.Error(),
+	}
+}
+
+// Write writes the description of the error to the file as JSON. The
+// message is redacted by the sanitizer, as errors of the pivnet client
+// include the URLs and bodies of responses.
+func Write(path string, err error, s sanitizer.Sanitizer) error {
+	e := New(err)
+
+	var message bytes.Buffer
+	_, writeErr := s.WithSink(&message).Write([]byte(e.Message))
+	if writeErr != nil {
+		// Untested as writing to a buffer does not fail.
+		return writeErr
+	}
+	e.Message = message.String()
+
+	b, marshalErr := json.Marshal(e)
+	if marshalErr != nil {
+		// Untested as an Error always marshals.
+		return marshalErr
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Report writes the error to the file, if one is provided, so that wrappers
+// can branch on why the command failed. Failing to write it is only a
+// warning as the command is exiting with the error regardless.
+func Report(l logger.Logger, s sanitizer.Sanitizer, path string, err error) {
+	if path == "" {
+		return
+	}
+
+	writeErr := Write(path, err, s)
+	if writeErr != nil {
+		l.Warnf("Warning: failed to write error_file: %v\n", writeErr)
+	}
+}
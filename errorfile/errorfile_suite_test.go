@@ -0,0 +1,13 @@
+package errorfile_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestErrorFile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ErrorFile Suite")
+}
@@ -0,0 +1,160 @@
+package errorfile_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/errorfile"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+)
+
+var _ = Describe("ErrorFile", func() {
+	Describe("New", func() {
+		It("categorises the typed errors of the pivnet client", func() {
+			responseErr := pivnet.ResponseError{StatusCode: 500, ExpectedStatusCode: 200}
+
+			Expect(errorfile.New(pivnet.ErrUnauthorized{ResponseError: responseErr}).Category).To(Equal("auth"))
+			Expect(errorfile.New(pivnet.ErrRateLimited{ResponseError: responseErr}).Category).To(Equal("rate_limit"))
+			Expect(errorfile.New(pivnet.ErrNotFound{ResponseError: responseErr}).Category).To(Equal("not_found"))
+			Expect(errorfile.New(pivnet.ErrEULARequired{ResponseError: responseErr}).Category).To(Equal("eula_required"))
+			Expect(errorfile.New(responseErr).Category).To(Equal("api"))
+		})
+
+		It("categorises wrapped errors by the error they wrap", func() {
+			err := fmt.Errorf("Failed to get Release: %w", pivnet.ErrRateLimited{})
+
+			Expect(errorfile.New(err)).To(Equal(errorfile.Error{
+				Code:     3,
+				Category: "rate_limit",
+				Message:  err.Error(),
+			}))
+		})
+
+		It("categorises any other error as error", func() {
+			Expect(errorfile.New(errors.New("some error"))).To(Equal(errorfile.Error{
+				Code:     1,
+				Category: "error",
+				Message:  "some error",
+			}))
+		})
+	})
+
+	Describe("Write", func() {
+		var (
+			dir             string
+			secretSanitizer sanitizer.Sanitizer
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			secretSanitizer = sanitizer.NewSanitizer(map[string]string{
+				"some-secret": "***REDACTED-SOME_SECRET***",
+			}, ioutil.Discard)
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("writes the error as JSON", func() {
+			path := filepath.Join(dir, "error.json")
+
+			err := errorfile.Write(path, pivnet.ErrUnauthorized{ResponseError: pivnet.ResponseError{
+				StatusCode:         401,
+				ExpectedStatusCode: 200,
+			}}, secretSanitizer)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			var written map[string]interface{}
+			err = json.Unmarshal(b, &written)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(written).To(Equal(map[string]interface{}{
+				"code":     float64(2),
+				"category": "auth",
+				"message":  "Pivnet returned status code: 401 for the request - expected 200",
+			}))
+		})
+
+		It("redacts the message", func() {
+			path := filepath.Join(dir, "error.json")
+
+			err := errorfile.Write(path, errors.New("failed to get https://example.com?token=some-secret"), secretSanitizer)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).NotTo(ContainSubstring("some-secret"))
+			Expect(string(b)).To(ContainSubstring("token=***REDACTED-SOME_SECRET***"))
+		})
+
+		It("writes a file that is not executable or writable by others", func() {
+			path := filepath.Join(dir, "error.json")
+
+			err := errorfile.Write(path, errors.New("some error"), secretSanitizer)
+			Expect(err).NotTo(HaveOccurred())
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm() &^ 0644).To(BeZero())
+		})
+	})
+
+	Describe("Report", func() {
+		var (
+			dir             string
+			fakeLogger      *logger_fakes.FakeLogger
+			secretSanitizer sanitizer.Sanitizer
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeLogger = &logger_fakes.FakeLogger{}
+			secretSanitizer = sanitizer.NewSanitizer(map[string]string{}, ioutil.Discard)
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("writes the error to the file", func() {
+			path := filepath.Join(dir, "error.json")
+
+			errorfile.Report(fakeLogger, secretSanitizer, path, errors.New("some error"))
+
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring(`"message":"some error"`))
+		})
+
+		It("does nothing when no file is provided", func() {
+			errorfile.Report(fakeLogger, secretSanitizer, "", errors.New("some error"))
+
+			Expect(fakeLogger.WarnfCallCount()).To(Equal(0))
+		})
+
+		It("warns when the file cannot be written", func() {
+			errorfile.Report(fakeLogger, secretSanitizer, filepath.Join(dir, "missing", "error.json"), errors.New("some error"))
+
+			Expect(fakeLogger.WarnfCallCount()).To(Equal(1))
+		})
+	})
+})
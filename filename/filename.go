@@ -0,0 +1,114 @@
+package filename
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var placeholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Fields are the values available to a template, e.g. the template
+// "{product}-{version}-{name}" renders as "my-product-1.2.3-file.zip".
+type Fields struct {
+	Product string
+	Version string
+	Name    string
+}
+
+func (f Fields) values() map[string]string {
+	return map[string]string{
+		"product": f.Product,
+		"version": f.Version,
+		"name":    f.Name,
+	}
+}
+
+type Template struct {
+	raw string
+}
+
+// Parse returns an error if the template contains unknown placeholders,
+// unbalanced braces or path separators.
+func Parse(template string) (Template, error) {
+	if strings.Contains(template, "/") {
+		return Template{}, fmt.Errorf("filename template must not contain /: %s", template)
+	}
+
+	valid := Fields{}.values()
+
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := valid[match[1]]; !ok {
+			var names []string
+			for name := range valid {
+				names = append(names, "{"+name+"}")
+			}
+			sort.Strings(names)
+
+			return Template{}, fmt.Errorf(
+				"unknown placeholder in filename template: %s - valid placeholders are: %s",
+				match[0],
+				strings.Join(names, ", "),
+			)
+		}
+	}
+
+	remaining := placeholder.ReplaceAllString(template, "")
+	if strings.ContainsAny(remaining, "{}") {
+		return Template{}, fmt.Errorf("filename template has unbalanced braces: %s", template)
+	}
+
+	return Template{raw: template}, nil
+}
+
+func (t Template) Render(fields Fields) string {
+	values := fields.values()
+
+	return placeholder.ReplaceAllStringFunc(t.raw, func(match string) string {
+		return values[match[1:len(match)-1]]
+	})
+}
+
+// Rename renders the template for each of the file names, returning a map of
+// each file name to its new name. It returns an error if any two files would
+// be given the same name, or if a new name would not be a valid file name.
+func Rename(t Template, product string, version string, names []string) (map[string]string, error) {
+	renamed := map[string]string{}
+	renamedFrom := map[string]string{}
+
+	for _, name := range names {
+		newName := t.Render(Fields{
+			Product: product,
+			Version: version,
+			Name:    name,
+		})
+
+		if newName == "" || newName == "." || newName == ".." || strings.Contains(newName, "/") {
+			return nil, fmt.Errorf(
+				"filename template renders an invalid file name for %s: %q",
+				name,
+				newName,
+			)
+		}
+
+		if other, ok := renamedFrom[newName]; ok {
+			first, second := other, name
+			if second < first {
+				first, second = second, first
+			}
+
+			return nil, fmt.Errorf(
+				"filename template renders the same file name %s for %s and %s",
+				newName,
+				first,
+				second,
+			)
+		}
+
+		renamed[name] = newName
+		renamedFrom[newName] = name
+	}
+
+	return renamed, nil
+}
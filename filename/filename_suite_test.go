@@ -0,0 +1,13 @@
+package filename_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFilename(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Filename Suite")
+}
@@ -0,0 +1,92 @@
+package filename_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/filename"
+)
+
+var _ = Describe("Filename", func() {
+	Describe("Parse", func() {
+		It("accepts templates with known placeholders", func() {
+			_, err := filename.Parse("{product}-{version}-{name}")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("accepts templates without placeholders", func() {
+			_, err := filename.Parse("some-file.zip")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the template contains an unknown placeholder", func() {
+			It("returns an error listing the valid placeholders", func() {
+				_, err := filename.Parse("{product}-{release}")
+				Expect(err).To(MatchError(
+					"unknown placeholder in filename template: {release} - valid placeholders are: {name}, {product}, {version}"))
+			})
+		})
+
+		Context("when the template has unbalanced braces", func() {
+			It("returns an error", func() {
+				_, err := filename.Parse("{product-{name}")
+				Expect(err).To(MatchError("filename template has unbalanced braces: {product-{name}"))
+			})
+		})
+
+		Context("when the template contains a path separator", func() {
+			It("returns an error", func() {
+				_, err := filename.Parse("{product}/{name}")
+				Expect(err).To(MatchError("filename template must not contain /: {product}/{name}"))
+			})
+		})
+	})
+
+	Describe("Render", func() {
+		It("replaces each placeholder with its field", func() {
+			t, err := filename.Parse("{product}-{version}-{name}")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(t.Render(filename.Fields{
+				Product: "my-product",
+				Version: "1.2.3",
+				Name:    "file.zip",
+			})).To(Equal("my-product-1.2.3-file.zip"))
+		})
+	})
+
+	Describe("Rename", func() {
+		It("returns the new name of each file", func() {
+			t, err := filename.Parse("{version}-{name}")
+			Expect(err).NotTo(HaveOccurred())
+
+			renamed, err := filename.Rename(t, "my-product", "1.2.3", []string{"a.zip", "b.zip"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(renamed).To(Equal(map[string]string{
+				"a.zip": "1.2.3-a.zip",
+				"b.zip": "1.2.3-b.zip",
+			}))
+		})
+
+		Context("when two files would be given the same name", func() {
+			It("returns an error", func() {
+				t, err := filename.Parse("{product}-{version}.zip")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = filename.Rename(t, "my-product", "1.2.3", []string{"b.zip", "a.zip"})
+				Expect(err).To(MatchError(
+					"filename template renders the same file name my-product-1.2.3.zip for a.zip and b.zip"))
+			})
+		})
+
+		Context("when a field would introduce a path separator", func() {
+			It("returns an error", func() {
+				t, err := filename.Parse("{version}-{name}")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = filename.Rename(t, "my-product", "1.2/3", []string{"a.zip"})
+				Expect(err).To(MatchError(
+					`filename template renders an invalid file name for a.zip: "1.2/3-a.zip"`))
+			})
+		})
+	})
+})
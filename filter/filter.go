@@ -3,11 +3,58 @@ package filter
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
+// FileTypes are the product file types known to Pivotal Network.
+var FileTypes = []string{"Software", "Documentation", "Open Source License"}
+
+// ValidateFileTypes returns an error if any of the file types is not one of
+// FileTypes.
+func ValidateFileTypes(fileTypes []string) error {
+	for _, fileType := range fileTypes {
+		known := false
+		for _, t := range FileTypes {
+			known = known || t == fileType
+		}
+
+		if !known {
+			return fmt.Errorf(
+				"unknown file type: %s - valid file types are: %s",
+				fileType,
+				strings.Join(FileTypes, ", "),
+			)
+		}
+	}
+
+	return nil
+}
+
+// DownloadLinksByFileType returns the download links for the files whose type,
+// looked up by file name in fileTypesByName, is one of the file types.
+func DownloadLinksByFileType(
+	downloadLinks map[string]string,
+	fileTypesByName map[string]string,
+	fileTypes []string,
+) map[string]string {
+	filtered := make(map[string]string)
+
+	for file, downloadLink := range downloadLinks {
+		for _, fileType := range fileTypes {
+			if fileTypesByName[file] == fileType {
+				filtered[file] = downloadLink
+			}
+		}
+	}
+
+	return filtered
+}
+
 func DownloadLinksByGlob(downloadLinks map[string]string, glob []string) (map[string]string, error) {
 	filtered := make(map[string]string)
 
@@ -32,6 +79,84 @@ func DownloadLinksByGlob(downloadLinks map[string]string, glob []string) (map[st
 	return filtered, nil
 }
 
+// LatestDownloadLinksByGlob returns, for each glob, only the download link of
+// the matching file with the highest semver version. The version of a file is
+// the first submatch of the version regexp in its name, or the whole match if
+// the regexp has no subexpressions. Files without a version are not selected,
+// and files with the same version are chosen between by name.
+func LatestDownloadLinksByGlob(
+	downloadLinks map[string]string,
+	globs []string,
+	versionRegexp *regexp.Regexp,
+) (map[string]string, error) {
+	filtered := make(map[string]string)
+
+	for _, pattern := range globs {
+		matched, err := DownloadLinksByGlob(downloadLinks, []string{pattern})
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for file := range matched {
+			names = append(names, file)
+		}
+		sort.Strings(names)
+
+		var latest, latestVersion string
+		for _, file := range names {
+			version, ok := fileVersion(file, versionRegexp)
+			if !ok {
+				continue
+			}
+
+			if latest == "" || versions.CompareSemver(version, latestVersion) > 0 {
+				latest, latestVersion = file, version
+			}
+		}
+
+		if latest == "" {
+			return nil, fmt.Errorf(
+				"no files matching glob %s have a version matching %s",
+				pattern,
+				versionRegexp.String(),
+			)
+		}
+
+		filtered[latest] = matched[latest]
+	}
+
+	return filtered, nil
+}
+
+func fileVersion(file string, versionRegexp *regexp.Regexp) (string, bool) {
+	matches := versionRegexp.FindStringSubmatch(file)
+	if matches == nil {
+		return "", false
+	}
+
+	if len(matches) > 1 {
+		return matches[1], true
+	}
+
+	return matches[0], true
+}
+
+func DownloadLinksByName(downloadLinks map[string]string, names []string) (map[string]string, error) {
+	filtered := make(map[string]string)
+
+	for _, name := range names {
+		downloadLink, ok := downloadLinks[name]
+		if !ok {
+			return nil, fmt.Errorf("no file found with name: %s", name)
+		}
+
+		filtered[name] = downloadLink
+	}
+
+	return filtered, nil
+}
+
 func DownloadLinks(p pivnet.ProductFiles) map[string]string {
 	links := make(map[string]string)
 
@@ -39,7 +164,13 @@ func DownloadLinks(p pivnet.ProductFiles) map[string]string {
 		parts := strings.Split(productFile.AWSObjectKey, "/")
 		fileName := parts[len(parts)-1]
 
-		links[fileName] = productFile.Links.Download["href"]
+		// Files still being processed have no download link yet.
+		var link string
+		if productFile.Links != nil {
+			link = productFile.Links.Download["href"]
+		}
+
+		links[fileName] = link
 	}
 
 	return links
@@ -1,6 +1,8 @@
 package filter_test
 
 import (
+	"regexp"
+
 	"github.com/pivotal-cf-experimental/pivnet-resource/filter"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
 
@@ -86,4 +88,143 @@ var _ = Describe("Filter", func() {
 			Expect(err).To(MatchError("no files match glob: does-not-exist.txt"))
 		})
 	})
+
+	Describe("LatestDownloadLinksByGlob", func() {
+		var (
+			downloadLinks map[string]string
+			versionRegexp *regexp.Regexp
+		)
+
+		BeforeEach(func() {
+			downloadLinks = map[string]string{
+				"stemcell-621.9-vsphere.tgz":  "/product_files/1/download",
+				"stemcell-621.10-vsphere.tgz": "/product_files/2/download",
+				"stemcell-456.1-vsphere.tgz":  "/product_files/3/download",
+				"docs-1.0.pdf":                "/product_files/4/download",
+			}
+			versionRegexp = regexp.MustCompile(`\d+(?:\.\d+)+`)
+		})
+
+		It("returns the matching file with the highest version for each glob", func() {
+			links, err := filter.LatestDownloadLinksByGlob(
+				downloadLinks,
+				[]string{"stemcell-*", "docs-*"},
+				versionRegexp,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(links).To(Equal(map[string]string{
+				"stemcell-621.10-vsphere.tgz": "/product_files/2/download",
+				"docs-1.0.pdf":                "/product_files/4/download",
+			}))
+		})
+
+		Context("when the regexp has a subexpression", func() {
+			BeforeEach(func() {
+				downloadLinks["stemcell-999.1-build-1.0-vsphere.tgz"] = "/product_files/5/download"
+				versionRegexp = regexp.MustCompile(`build-(\d+\.\d+)`)
+			})
+
+			It("uses the first submatch as the version, ignoring files without one", func() {
+				links, err := filter.LatestDownloadLinksByGlob(downloadLinks, []string{"stemcell-*"}, versionRegexp)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(links).To(Equal(map[string]string{
+					"stemcell-999.1-build-1.0-vsphere.tgz": "/product_files/5/download",
+				}))
+			})
+		})
+
+		Context("when no file matches the glob", func() {
+			It("returns an error", func() {
+				_, err := filter.LatestDownloadLinksByGlob(downloadLinks, []string{"tile-*"}, versionRegexp)
+				Expect(err).To(MatchError("no files match glob: tile-*"))
+			})
+		})
+
+		Context("when no matching file has a version", func() {
+			It("returns an error", func() {
+				_, err := filter.LatestDownloadLinksByGlob(
+					downloadLinks,
+					[]string{"stemcell-*"},
+					regexp.MustCompile(`v(\d+)`),
+				)
+				Expect(err).To(MatchError(`no files matching glob stemcell-* have a version matching v(\d+)`))
+			})
+		})
+	})
+
+	Describe("DownloadLinksByName", func() {
+		var (
+			downloadLinks map[string]string
+		)
+
+		BeforeEach(func() {
+			downloadLinks = map[string]string{
+				"android-file.zip": "/products/banana/releases/666/product_files/6/download",
+				"ios-file.zip":     "/products/banana/releases/666/product_files/8/download",
+			}
+		})
+
+		It("returns the download links for the named files", func() {
+			filtered, err := filter.DownloadLinksByName(downloadLinks, []string{"ios-file.zip"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filtered).To(Equal(map[string]string{
+				"ios-file.zip": "/products/banana/releases/666/product_files/8/download",
+			}))
+		})
+
+		It("does not treat names as globs", func() {
+			_, err := filter.DownloadLinksByName(downloadLinks, []string{"*.zip"})
+			Expect(err).To(MatchError("no file found with name: *.zip"))
+		})
+
+		Context("when a named file does not exist", func() {
+			It("returns an error", func() {
+				_, err := filter.DownloadLinksByName(downloadLinks, []string{"android-file.zip", "does-not-exist.txt"})
+				Expect(err).To(MatchError("no file found with name: does-not-exist.txt"))
+			})
+		})
+	})
+
+	Describe("ValidateFileTypes", func() {
+		It("accepts the known file types", func() {
+			err := filter.ValidateFileTypes([]string{"Software", "Documentation", "Open Source License"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when a file type is unknown", func() {
+			It("returns an error listing the known file types", func() {
+				err := filter.ValidateFileTypes([]string{"Software", "software"})
+				Expect(err).To(MatchError(
+					"unknown file type: software - valid file types are: Software, Documentation, Open Source License"))
+			})
+		})
+	})
+
+	Describe("DownloadLinksByFileType", func() {
+		It("returns the download links for files of the given types", func() {
+			downloadLinks := map[string]string{
+				"file.zip":   "/products/banana/releases/666/product_files/6/download",
+				"docs.pdf":   "/products/banana/releases/666/product_files/7/download",
+				"license.md": "/products/banana/releases/666/product_files/8/download",
+			}
+
+			fileTypesByName := map[string]string{
+				"file.zip":   "Software",
+				"docs.pdf":   "Documentation",
+				"license.md": "Open Source License",
+			}
+
+			filtered := filter.DownloadLinksByFileType(
+				downloadLinks,
+				fileTypesByName,
+				[]string{"Software", "Open Source License"},
+			)
+			Expect(filtered).To(Equal(map[string]string{
+				"file.zip":   "/products/banana/releases/666/product_files/6/download",
+				"license.md": "/products/banana/releases/666/product_files/8/download",
+			}))
+		})
+	})
 })
@@ -1,34 +1,116 @@
 package in
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pivotal-cf-experimental/pivnet-resource/archive"
+	"github.com/pivotal-cf-experimental/pivnet-resource/bytesize"
+	"github.com/pivotal-cf-experimental/pivnet-resource/checksum"
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
 	"github.com/pivotal-cf-experimental/pivnet-resource/downloader"
+	"github.com/pivotal-cf-experimental/pivnet-resource/filename"
 	"github.com/pivotal-cf-experimental/pivnet-resource/filter"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
-	"github.com/pivotal-cf-experimental/pivnet-resource/md5"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/progress"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/tlsconfig"
 	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
+const (
+	downloadBackendS3     = "s3"
+	downloadBackendPivnet = "pivnet"
+
+	oslFileType = "Open Source License"
+	oslDir      = "osl"
+
+	versionFile          = "version"
+	releaseIDFile        = "release_id"
+	pulledArtifactsFile  = "pulled_artifacts.json"
+	releasesManifestFile = "releases.json"
+	deltaManifestFile    = "delta.json"
+
+	releaseDateFormat = "2006-01-02"
+
+	sortProductFilesByName     = "name"
+	sortProductFilesByID       = "id"
+	sortProductFilesByFileType = "file_type"
+
+	packageAsTar = "tar"
+	packageAsTgz = "tgz"
+
+	packageTarFile = "release.tar"
+	packageTgzFile = "release.tgz"
+
+	metadataFormatYAML = "yaml"
+	metadataFormatJSON = "json"
+	metadataFormatEnv  = "env"
+
+	releaseNotesFile    = "release_notes.md"
+	productIconFile     = "product_icon.png"
+	rawReleaseFile      = "release_raw.json"
+	imageReferencesFile = "image_references.yaml"
+
+	redactedDownloadLink = "***REDACTED-DOWNLOAD_LINK***"
+
+	onCollisionFail   = "fail"
+	onCollisionSuffix = "suffix"
+	onCollisionSubdir = "subdir"
+
+	selectLatest = "latest"
+
+	onMissingVersionFail         = "fail"
+	onMissingVersionNearestNewer = "nearest_newer"
+	onMissingVersionNearestOlder = "nearest_older"
+	onMissingVersionLatest       = "latest"
+
+	defaultDownloadRetries = 3
+
+	defaultFileProcessingTimeout = 10 * time.Minute
+)
+
+// digestPattern matches the digests of product files and artifact references.
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// defaultSelectVersionRegexp matches the versions in file names, e.g. 621.90,
+// when select is latest and select_version_regexp is not provided.
+var defaultSelectVersionRegexp = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// nonEnvNameCharacters are the characters replaced in the names of the env
+// metadata format.
+var nonEnvNameCharacters = regexp.MustCompile(`[^A-Z0-9]+`)
+
 type InCommand struct {
+	ctx           context.Context
 	logger        logger.Logger
 	downloadDir   string
 	binaryVersion string
 }
 
 func NewInCommand(
+	ctx context.Context,
 	version string,
 	logger logger.Logger,
 	downloadDir string,
 ) *InCommand {
 	return &InCommand{
+		ctx:           ctx,
 		logger:        logger,
 		downloadDir:   downloadDir,
 		binaryVersion: version,
@@ -36,181 +118,2992 @@ func NewInCommand(
 }
 
 func (c *InCommand) Run(input concourse.InRequest) (concourse.InResponse, error) {
+	// Warnings are recorded for the whole get, including those of the
+	// clients, which are created with the logger of the command.
+	var recorder *logger.Recorder
+	if input.Params.WarningsMetadata {
+		recorder = logger.NewRecorder(c.logger)
+		defer func(l logger.Logger) { c.logger = l }(c.logger)
+		c.logger = recorder
+	}
+
 	token := input.Source.APIToken
+	if input.Params.APIToken != "" {
+		token = input.Params.APIToken
+	}
 	if token == "" {
 		return concourse.InResponse{}, fmt.Errorf("%s must be provided", "api_token")
 	}
 
+	err := filter.ValidateFileTypes(input.Params.FileTypes)
+	if err != nil {
+		return concourse.InResponse{}, err
+	}
+
+	switch input.Params.DownloadBackend {
+	case "", downloadBackendS3, downloadBackendPivnet:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be one of %s or %s - got %s",
+			"download_backend",
+			downloadBackendS3,
+			downloadBackendPivnet,
+			input.Params.DownloadBackend,
+		)
+	}
+
+	switch input.Params.SortProductFilesBy {
+	case "", sortProductFilesByName, sortProductFilesByID, sortProductFilesByFileType:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be one of %s, %s or %s - got %s",
+			"sort_product_files_by",
+			sortProductFilesByName,
+			sortProductFilesByID,
+			sortProductFilesByFileType,
+			input.Params.SortProductFilesBy,
+		)
+	}
+
+	switch input.Params.OnCollision {
+	case "", onCollisionFail, onCollisionSuffix, onCollisionSubdir:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be one of %s, %s or %s - got %s",
+			"on_collision",
+			onCollisionFail,
+			onCollisionSuffix,
+			onCollisionSubdir,
+			input.Params.OnCollision,
+		)
+	}
+
+	switch input.Params.OnMissingVersion {
+	case "", onMissingVersionFail, onMissingVersionNearestNewer, onMissingVersionNearestOlder, onMissingVersionLatest:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be one of %s, %s, %s or %s - got %s",
+			"on_missing_version",
+			onMissingVersionFail,
+			onMissingVersionNearestNewer,
+			onMissingVersionNearestOlder,
+			onMissingVersionLatest,
+			input.Params.OnMissingVersion,
+		)
+	}
+
+	if input.Params.ReleaseID < 0 {
+		return concourse.InResponse{}, fmt.Errorf("%s must not be negative", "release_id")
+	}
+
+	if input.Params.FileProcessingTimeoutSeconds < 0 {
+		return concourse.InResponse{}, fmt.Errorf("%s must not be negative", "file_processing_timeout_seconds")
+	}
+
+	if input.Params.FileProcessingTimeoutSeconds > 0 && !input.Params.WaitForFileProcessing {
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s may only be provided when %s is %s",
+			"file_processing_timeout_seconds",
+			"wait_for_file_processing",
+			"true",
+		)
+	}
+
+	if input.Params.LastN < 0 {
+		return concourse.InResponse{}, fmt.Errorf("%s must not be negative", "last_n")
+	}
+
+	if input.Params.LastN > 0 {
+		if len(input.Params.Globs) == 0 {
+			return concourse.InResponse{}, fmt.Errorf("%s must be provided with %s", "globs", "last_n")
+		}
+
+		if input.Params.ReleaseID != 0 {
+			return concourse.InResponse{}, fmt.Errorf(
+				"only one of %s or %s may be provided",
+				"release_id",
+				"last_n",
+			)
+		}
+
+		// Only globs select the files of the other releases.
+		for _, p := range []struct {
+			name     string
+			provided bool
+		}{
+			{"files", len(input.Params.Files) > 0},
+			{"file_types", len(input.Params.FileTypes) > 0},
+			{"filename_template", input.Params.FilenameTemplate != ""},
+			{"download_osl", input.Params.DownloadOSL},
+		} {
+			if p.provided {
+				return concourse.InResponse{}, fmt.Errorf("%s may not be provided with %s", p.name, "last_n")
+			}
+		}
+	}
+
+	var releasedAfter, releasedBefore time.Time
+	for _, p := range []struct {
+		name  string
+		value string
+		date  *time.Time
+	}{
+		{"released_after", input.Params.ReleasedAfter, &releasedAfter},
+		{"released_before", input.Params.ReleasedBefore, &releasedBefore},
+	} {
+		if p.value == "" {
+			continue
+		}
+
+		*p.date, err = time.Parse(releaseDateFormat, p.value)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must be in the form YYYY-MM-DD - got %s",
+				p.name,
+				p.value,
+			)
+		}
+	}
+
+	releasedBetween := !releasedAfter.IsZero() || !releasedBefore.IsZero()
+	if releasedBetween {
+		rangeParam := "released_after"
+		if releasedAfter.IsZero() {
+			rangeParam = "released_before"
+		}
+
+		if len(input.Params.Globs) == 0 {
+			return concourse.InResponse{}, fmt.Errorf("%s must be provided with %s", "globs", rangeParam)
+		}
+
+		if !releasedAfter.IsZero() && !releasedBefore.IsZero() && releasedAfter.After(releasedBefore) {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must not be after %s - got %s and %s",
+				"released_after",
+				"released_before",
+				input.Params.ReleasedAfter,
+				input.Params.ReleasedBefore,
+			)
+		}
+
+		// Like last_n, only globs select the files of the other releases.
+		for _, p := range []struct {
+			name     string
+			provided bool
+		}{
+			{"last_n", input.Params.LastN > 0},
+			{"release_id", input.Params.ReleaseID != 0},
+			{"files", len(input.Params.Files) > 0},
+			{"file_types", len(input.Params.FileTypes) > 0},
+			{"filename_template", input.Params.FilenameTemplate != ""},
+			{"download_osl", input.Params.DownloadOSL},
+		} {
+			if p.provided {
+				return concourse.InResponse{}, fmt.Errorf("%s may not be provided with %s", p.name, rangeParam)
+			}
+		}
+	}
+
+	if input.Params.Digest != "" {
+		if !digestPattern.MatchString(input.Params.Digest) {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must be of the form sha256:<64 lowercase hex characters> - got %s",
+				"digest",
+				input.Params.Digest,
+			)
+		}
+
+		// The digest alone selects the files to download.
+		for _, p := range []struct {
+			name     string
+			provided bool
+		}{
+			{"globs", len(input.Params.Globs) > 0},
+			{"files", len(input.Params.Files) > 0},
+			{"file_types", len(input.Params.FileTypes) > 0},
+			{"last_n", input.Params.LastN > 0},
+		} {
+			if p.provided {
+				return concourse.InResponse{}, fmt.Errorf("%s may not be provided with %s", p.name, "digest")
+			}
+		}
+	}
+
+	if input.Params.DeltaFrom != "" {
+		// The delta is of the files of the release, not of other releases.
+		for _, p := range []struct {
+			name     string
+			provided bool
+		}{
+			{"last_n", input.Params.LastN > 0},
+			{"released_after", input.Params.ReleasedAfter != ""},
+			{"released_before", input.Params.ReleasedBefore != ""},
+		} {
+			if p.provided {
+				return concourse.InResponse{}, fmt.Errorf("%s may not be provided with %s", p.name, "delta_from")
+			}
+		}
+	}
+
+	if len(input.Params.AutoAcceptEULAs) > 0 && input.Params.SkipEULA {
+		return concourse.InResponse{}, fmt.Errorf("%s may not be provided with %s", "auto_accept_eulas", "skip_eula")
+	}
+
+	if input.Params.ReleaseID != 0 && input.Params.Latest {
+		return concourse.InResponse{}, fmt.Errorf(
+			"only one of %s or %s may be provided",
+			"release_id",
+			"latest",
+		)
+	}
+
+	if input.Params.DownloadRetries < 0 {
+		return concourse.InResponse{}, fmt.Errorf("%s must not be negative", "download_retries")
+	}
+
+	if input.Params.OSLGlob != "" {
+		if !input.Params.DownloadOSL {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s may only be provided when %s is %s",
+				"osl_glob",
+				"download_osl",
+				"true",
+			)
+		}
+
+		_, err := filepath.Match(input.Params.OSLGlob, "")
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must be a valid glob - got %s",
+				"osl_glob",
+				input.Params.OSLGlob,
+			)
+		}
+	}
+
+	switch input.Params.PackageAs {
+	case "", packageAsTar, packageAsTgz:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be one of %s or %s - got %s",
+			"package_as",
+			packageAsTar,
+			packageAsTgz,
+			input.Params.PackageAs,
+		)
+	}
+
+	if input.Params.RemovePackagedFiles && input.Params.PackageAs == "" {
+		return concourse.InResponse{}, fmt.Errorf("%s must be provided with %s", "package_as", "remove_packaged_files")
+	}
+
+	switch input.Params.Select {
+	case "", selectLatest:
+	default:
+		return concourse.InResponse{}, fmt.Errorf(
+			"%s must be %s if provided - got %s",
+			"select",
+			selectLatest,
+			input.Params.Select,
+		)
+	}
+
+	if input.Params.Select != "" && len(input.Params.Globs) == 0 {
+		return concourse.InResponse{}, fmt.Errorf("%s must be provided with %s", "globs", "select")
+	}
+
+	if input.Params.SelectVersionRegexp != "" {
+		if input.Params.Select == "" {
+			return concourse.InResponse{}, fmt.Errorf("%s must be provided with %s", "select", "select_version_regexp")
+		}
+
+		_, err := regexp.Compile(input.Params.SelectVersionRegexp)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must be a valid regular expression - got %s: %s",
+				"select_version_regexp",
+				input.Params.SelectVersionRegexp,
+				err.Error(),
+			)
+		}
+	}
+
+	for _, e := range []struct {
+		key      string
+		endpoint string
+	}{
+		{"endpoint", input.Source.Endpoint},
+		{"params.endpoint", input.Params.Endpoint},
+	} {
+		err := concourse.ValidateEndpoint(e.key, e.endpoint)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	if input.Params.MirrorBaseURL != "" {
+		mirrorBaseURL, err := url.Parse(input.Params.MirrorBaseURL)
+		if err != nil || (mirrorBaseURL.Scheme != "http" && mirrorBaseURL.Scheme != "https") || mirrorBaseURL.Host == "" {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must be an http or https URL - got %s",
+				"mirror_base_url",
+				input.Params.MirrorBaseURL,
+			)
+		}
+	}
+
+	for _, format := range input.Params.MetadataFormats {
+		switch format {
+		case metadataFormatYAML, metadataFormatJSON, metadataFormatEnv:
+		default:
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must only contain %s, %s or %s - got %s",
+				"metadata_formats",
+				metadataFormatYAML,
+				metadataFormatJSON,
+				metadataFormatEnv,
+				format,
+			)
+		}
+	}
+
+	versionFilepath := filepath.Join(c.downloadDir, versionFile)
+	if input.Params.VersionFile != "" {
+		versionFilepath, err = destinationPath(c.downloadDir, input.Params.VersionFile, "version_file")
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	var metadataFilepath string
+	if input.Params.MetadataFile != "" {
+		metadataFilepath, err = destinationPath(c.downloadDir, input.Params.MetadataFile, "metadata_file")
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+
+		for _, format := range input.Params.MetadataFormats {
+			if metadataFilepath == filepath.Join(c.downloadDir, "metadata."+format) {
+				return concourse.InResponse{}, fmt.Errorf(
+					"%s may not be metadata.%s when %s contains %s",
+					"metadata_file",
+					format,
+					"metadata_formats",
+					format,
+				)
+			}
+		}
+	}
+
+	for _, name := range input.Params.RequireMetadata {
+		if !contains(releaseMetadataNames, name) {
+			return concourse.InResponse{}, fmt.Errorf(
+				"%s must only contain release metadata names - got %s, valid names are: %s",
+				"require_metadata",
+				name,
+				strings.Join(releaseMetadataNames, ", "),
+			)
+		}
+	}
+
+	var filenameTemplate filename.Template
+	if input.Params.FilenameTemplate != "" {
+		filenameTemplate, err = filename.Parse(input.Params.FilenameTemplate)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	tlsConfig, err := tlsconfig.New(input.Source.CACert, input.Source.SkipSSLVerification)
+	if err != nil {
+		return concourse.InResponse{}, err
+	}
+
 	c.logger.Debugf("Received input: %+v\n", input)
 
 	c.logger.Debugf("Creating download directory: %s\n", c.downloadDir)
-	err := os.MkdirAll(c.downloadDir, os.ModePerm)
+	err = os.MkdirAll(c.downloadDir, os.ModePerm)
 	if err != nil {
-		log.Fatalf("Failed to create download directory: %s\n", err.Error())
+		return concourse.InResponse{}, fmt.Errorf("Failed to create download directory: %w", err)
 	}
 
+	// The endpoint of the params lets a single resource get from more than
+	// one instance of Pivotal Network.
 	var endpoint string
-	if input.Source.Endpoint != "" {
+	if input.Params.Endpoint != "" {
+		endpoint = input.Params.Endpoint
+	} else if input.Source.Endpoint != "" {
 		endpoint = input.Source.Endpoint
 	} else {
 		endpoint = pivnet.Endpoint
 	}
 
 	productSlug := input.Source.ProductSlug
+	if input.Version.ProductSlug != "" {
+		if !contains(input.Source.ProductSlugs, input.Version.ProductSlug) {
+			return concourse.InResponse{}, fmt.Errorf(
+				"product_slug %s from version is not one of product_slugs: %v",
+				input.Version.ProductSlug,
+				input.Source.ProductSlugs,
+			)
+		}
+
+		productSlug = input.Version.ProductSlug
+	}
 
 	clientConfig := pivnet.NewClientConfig{
 		Endpoint:  endpoint,
 		Token:     token,
 		UserAgent: useragent.UserAgent(c.binaryVersion, "get", productSlug),
+
+		Debug:     input.Source.Debug,
+		Timings:   input.Source.EmitTimings,
+		Context:   c.ctx,
+		TLSConfig: tlsConfig,
+
+		ExtraHeaders: input.Source.ExtraHeaders,
 	}
 	client := pivnet.NewClient(
 		clientConfig,
 		c.logger,
 	)
 
-	productVersion := input.Version.ProductVersion
-
-	c.logger.Debugf(
-		"Getting release: {product_slug: %s, product_version: %s}\n",
-		productSlug,
-		productVersion,
-	)
-
-	release, err := client.GetRelease(productSlug, productVersion)
-	if err != nil {
-		log.Fatalf("Failed to get Release: %s\n", err.Error())
+	if input.Source.Debug {
+		user, err := client.CurrentUser()
+		if err != nil {
+			c.logger.Debugf("Failed to get current user: %s\n", err.Error())
+		} else {
+			c.logger.Debugf("Authenticated as: {id: %d, email: %s}\n", user.ID, user.Email)
+		}
 	}
 
-	c.logger.Debugf(
-		"Accepting EULA: {product_slug: %s, release_id: %d}\n",
-		productSlug,
-		release.ID,
-	)
-
-	err = client.AcceptEULA(productSlug, release.ID)
-	if err != nil {
-		log.Fatalf("EULA acceptance failed for the release: %s\n", err.Error())
+	// Versions from out with version_includes_file_hashes end with a hash of
+	// the MD5s of the files of their release, which is compared with the
+	// files fetched. Other versions are never split, as they may end with
+	// something that looks like a hash.
+	productVersion := input.Version.ProductVersion
+	var versionFileHash string
+	var versionHasFileHash bool
+	if input.Source.VersionFileHashes {
+		productVersion, versionFileHash, versionHasFileHash = versions.SplitFileHash(productVersion)
 	}
+	requestedVersion := productVersion
 
-	c.logger.Debugf(
-		"Getting product files: {release_id: %d}\n",
-		release.ID,
-	)
-
-	productFiles, err := client.GetProductFiles(release)
-	if err != nil {
-		log.Fatalf("Failed to get Product Files: %s\n", err.Error())
+	// Versions from out with a version_format of {version}#{id} carry the ID
+	// of their release, which is returned unchanged as the version fetched.
+	versionWithoutID := productVersion
+	var versionReleaseID int
+	var versionHasID bool
+	if input.Source.VersionFormat == versions.FormatVersionID {
+		versionWithoutID, versionReleaseID, versionHasID = versions.SplitID(productVersion)
 	}
 
-	c.logger.Debugf(
-		"Getting download links: {product_files: %+v}\n",
-		productFiles,
-	)
+	// missingVersion is the requested version when another release is
+	// fetched in its place by on_missing_version.
+	var missingVersion string
 
-	downloadLinksMD5 := map[string]string{}
-	for _, p := range productFiles.ProductFiles {
-		productFile, err := client.GetProductFile(
+	var release pivnet.Release
+	if input.Params.Latest {
+		c.logger.Debugf(
+			"Getting latest release instead of requested version: {product_slug: %s, requested_version: %s}\n",
 			productSlug,
-			release.ID,
-			p.ID,
+			productVersion,
 		)
+
+		release, err = latestRelease(client, productSlug)
 		if err != nil {
-			log.Fatalf("Failed to get Product File: %s\n", err.Error())
+			return concourse.InResponse{}, fmt.Errorf("Failed to get latest Release: %w", err)
 		}
 
-		parts := strings.Split(productFile.AWSObjectKey, "/")
-		fileName := parts[len(parts)-1]
-
-		downloadLinksMD5[fileName] = productFile.MD5
-	}
-
-	downloadLinks := filter.DownloadLinks(productFiles)
-
-	if len(input.Params.Globs) > 0 {
+		productVersion = release.Version
+	} else if input.Params.ReleaseID != 0 {
 		c.logger.Debugf(
-			"Filtering download links with globs: {globs: %+v}\n",
-			input.Params.Globs,
+			"Getting release by id instead of requested version: {product_slug: %s, release_id: %d, requested_version: %s}\n",
+			productSlug,
+			input.Params.ReleaseID,
+			productVersion,
 		)
 
-		var err error
-		downloadLinks, err = filter.DownloadLinksByGlob(downloadLinks, input.Params.Globs)
+		release, err = client.ReleaseForID(productSlug, input.Params.ReleaseID)
 		if err != nil {
-			log.Fatalf("Failed to filter Product Files: %s\n", err.Error())
+			return concourse.InResponse{}, fmt.Errorf("Failed to get Release: %w", err)
+		}
+
+		if productVersion != "" && productVersion != release.Version {
+			c.logger.Warnf(
+				"Warning: release %d has version %s rather than the requested version %s\n",
+				release.ID,
+				release.Version,
+				productVersion,
+			)
 		}
 
+		productVersion = release.Version
+	} else if versionHasID {
 		c.logger.Debugf(
-			"Downloading files: {download_links: %+v, download_dir: %s}\n",
-			downloadLinks,
-			c.downloadDir,
+			"Getting release by the id in the requested version: {product_slug: %s, release_id: %d, requested_version: %s}\n",
+			productSlug,
+			versionReleaseID,
+			productVersion,
 		)
 
-		files, err := downloader.Download(c.downloadDir, downloadLinks, token)
+		release, err = client.ReleaseForID(productSlug, versionReleaseID)
 		if err != nil {
-			log.Fatalf("Failed to Download Files: %s\n", err.Error())
+			return concourse.InResponse{}, fmt.Errorf("Failed to get Release: %w", err)
 		}
 
-		for _, f := range files {
-			downloadPath := filepath.Join(c.downloadDir, f)
+		if release.Version != versionWithoutID {
+			c.logger.Warnf(
+				"Warning: release %d has version %s rather than the requested version %s\n",
+				release.ID,
+				release.Version,
+				versionWithoutID,
+			)
+		}
 
-			c.logger.Debugf(
-				"Calcuating MD5 for downloaded file: %s\n",
-				downloadPath,
+		productVersion = release.Version
+	} else {
+		c.logger.Debugf(
+			"Getting release: {product_slug: %s, product_version: %s}\n",
+			productSlug,
+			productVersion,
+		)
+
+		if input.Source.DuplicateVersionStrategy != "" {
+			release, err = releaseForVersion(
+				client,
+				productSlug,
+				productVersion,
+				input.Source.DuplicateVersionStrategy,
 			)
-			md5, err := md5.NewFileContentsSummer(downloadPath).Sum()
-			if err != nil {
-				log.Fatalf("Failed to calculate MD5: %s\n", err.Error())
+		} else {
+			release, err = client.GetRelease(productSlug, productVersion)
+		}
+		var notFound pivnet.ErrNotFound
+		if errors.As(err, &notFound) && input.Params.SemverVersionMatch {
+			equivalent, found, listErr := semverEquivalentRelease(client, productSlug, productVersion)
+			if listErr != nil {
+				err = listErr
+			} else if found {
+				c.logger.Infof(
+					"Using release %s, which is semver-equivalent to the requested version %s\n",
+					equivalent.Version,
+					productVersion,
+				)
+				release, err = equivalent, nil
 			}
-
-			expectedMD5 := downloadLinksMD5[f]
-			if md5 != expectedMD5 {
-				log.Fatalf(
-					"Failed MD5 comparison for file: %s. Expected %s, got %s\n",
-					f,
-					expectedMD5,
-					md5,
+		}
+		if errors.As(err, &notFound) &&
+			input.Params.OnMissingVersion != "" &&
+			input.Params.OnMissingVersion != onMissingVersionFail {
+			substitute, found, listErr := substituteRelease(client, productSlug, productVersion, input.Params.OnMissingVersion)
+			if listErr != nil {
+				err = listErr
+			} else if found {
+				c.logger.Warnf(
+					"Warning: version %s was not found - fetching %s instead as on_missing_version is %s\n",
+					productVersion,
+					substitute.Version,
+					input.Params.OnMissingVersion,
 				)
+				release, err = substitute, nil
+				missingVersion = productVersion
+				productVersion = release.Version
 			}
-
-			c.logger.Debugf(
-				"MD5 for downloaded file: %s matched expected: %s\n",
-				downloadPath,
-				md5,
+		}
+		if errors.As(err, &notFound) {
+			return concourse.InResponse{}, fmt.Errorf(
+				"Failed to get Release: %w - the release may have been deleted or the token may not have access to it",
+				err,
 			)
 		}
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to get Release: %w", err)
+		}
 	}
 
-	versionFilepath := filepath.Join(c.downloadDir, "version")
+	metadata := releaseMetadata(release)
+	if missingVersion != "" {
+		metadata = append(metadata,
+			concourse.Metadata{Name: "requested_version", Value: missingVersion},
+			concourse.Metadata{Name: "fetched_version", Value: release.Version},
+		)
+	}
 
-	c.logger.Debugf(
-		"Writing version to file: {version: %s, version_filepath: %s}\n",
-		productVersion,
-		versionFilepath,
-	)
+	err = requireMetadata(metadata, input.Params.RequireMetadata)
+	if err != nil {
+		return concourse.InResponse{}, fmt.Errorf(
+			"release %s of product %s: %s",
+			productVersion,
+			productSlug,
+			err.Error(),
+		)
+	}
 
-	err = ioutil.WriteFile(versionFilepath, []byte(productVersion), os.ModePerm)
+	err = c.acceptEULA(client, input.Params, endpoint, productSlug, release)
 	if err != nil {
-		log.Fatalln(err)
+		return concourse.InResponse{}, err
 	}
 
-	metadata := []concourse.Metadata{
-		{Name: "release_type", Value: release.ReleaseType},
-		{Name: "release_date", Value: release.ReleaseDate},
-		{Name: "description", Value: release.Description},
-		{Name: "release_notes_url", Value: release.ReleaseNotesURL},
+	files, err := c.releaseFiles(client, productSlug, release, input.Params.SkipEULA)
+	if err != nil {
+		return concourse.InResponse{}, err
 	}
 
-	if release.Eula != nil {
-		metadata = append(metadata,
-			concourse.Metadata{Name: "eula_slug", Value: release.Eula.Slug},
-		)
+	if versionHasFileHash {
+		fileHash := files.fileHash()
+		if fileHash != versionFileHash {
+			c.logger.Warnf(
+				"Warning: the files of release %s hash to %s rather than %s - they have changed since version %s was put\n",
+				release.Version,
+				fileHash,
+				versionFileHash,
+				input.Version.ProductVersion,
+			)
+		}
+
+		metadata = append(metadata, concourse.Metadata{Name: "file_hash", Value: fileHash})
 	}
 
-	out := concourse.InResponse{
-		Version: concourse.Version{
-			ProductVersion: productVersion,
-		},
-		Metadata: metadata,
+	if input.Params.FileGroupsMetadata {
+		fileGroupsMetadata, err := c.fileGroupsMetadata(client, productSlug, release)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+		metadata = append(metadata, fileGroupsMetadata)
 	}
 
-	return out, nil
+	productFiles := files.productFiles
+	downloadLinksMD5 := files.md5s
+	downloadLinksSize := files.sizes
+	downloadLinksFileType := files.fileTypes
+	downloadLinksPivnet := files.pivnetLinks
+	downloadLinksID := files.ids
+	productFileDetails := files.details
+
+	downloadLinks := filter.DownloadLinks(productFiles)
+	if input.Params.DownloadBackend == downloadBackendPivnet {
+		c.logger.Debugf(
+			"Downloading from the download endpoint of %s instead of the product file links\n",
+			endpoint,
+		)
+
+		downloadLinks = downloadLinksPivnet
+	}
+
+	oslLinks := oslDownloadLinks(downloadLinks, downloadLinksFileType, input.Params.OSLGlob)
+	oslMD5s := downloadLinksMD5
+	oslIDs := downloadLinksID
+
+	downloadRetries := input.Params.DownloadRetries
+	if downloadRetries == 0 {
+		downloadRetries = defaultDownloadRetries
+	}
+
+	downloaderConfig := downloader.Config{
+		DownloadDir:     c.downloadDir,
+		Token:           token,
+		ResumeDownloads: input.Params.ResumeDownloads,
+		SkipExisting:    input.Params.SkipExisting,
+
+		SkipForbiddenFiles: input.Params.SkipForbiddenFiles,
+		TLSConfig:          tlsConfig,
+
+		Attempts: downloadRetries + 1,
+
+		ProgressInterval: progress.Interval(
+			input.Params.ProgressIntervalSeconds,
+			input.Params.DisableProgress,
+		),
+		Timings: input.Source.EmitTimings,
+		Context: c.ctx,
+		Logger:  c.logger,
+	}
+
+	if input.Source.ExtraHeadersOnDownloads {
+		downloaderConfig.Headers = input.Source.ExtraHeaders
+	}
+
+	var digestLinks map[string]string
+	var digestMetadata []concourse.Metadata
+	if input.Params.Digest != "" {
+		digestLinks, digestMetadata, err = c.artifactsByDigest(
+			client,
+			productSlug,
+			release,
+			input.Params.Digest,
+			downloadLinks,
+			downloadLinksID,
+			productFileDetails,
+		)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	var sizeMetadata []concourse.Metadata
+	var fileLabelsMetadata []concourse.Metadata
+	var lastNMetadata []concourse.Metadata
+	var releasedBetweenMetadata []concourse.Metadata
+	var deltaMetadata []concourse.Metadata
+	var artifacts []pulledArtifact
+	downloaded := false
+
+	if input.Params.LastN > 0 {
+		artifacts, downloadLinksFileType, lastNMetadata, err = c.downloadLastN(
+			client,
+			input.Params,
+			endpoint,
+			productSlug,
+			release,
+			downloaderConfig,
+		)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to Download Files of the last %d releases: %w", input.Params.LastN, err)
+		}
+		downloaded = true
+	} else if releasedBetween {
+		artifacts, downloadLinksFileType, releasedBetweenMetadata, err = c.downloadReleasedBetween(
+			client,
+			input.Params,
+			endpoint,
+			productSlug,
+			release,
+			releasedAfter,
+			releasedBefore,
+			downloaderConfig,
+		)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to Download Files of the releases within the release date range: %w", err)
+		}
+		downloaded = true
+	} else if len(input.Params.Globs) > 0 ||
+		len(input.Params.Files) > 0 ||
+		len(input.Params.FileTypes) > 0 ||
+		len(digestLinks) > 0 {
+		filteredLinks := map[string]string{}
+		if len(input.Params.Globs) == 0 && len(input.Params.Files) == 0 {
+			filteredLinks = downloadLinks
+		}
+
+		if len(digestLinks) > 0 {
+			filteredLinks = digestLinks
+		}
+
+		if len(input.Params.Globs) > 0 {
+			c.logger.Debugf(
+				"Filtering download links with globs: {globs: %+v}\n",
+				input.Params.Globs,
+			)
+
+			linksByGlob, err := linksByGlob(downloadLinks, input.Params)
+			if err != nil {
+				return concourse.InResponse{}, fmt.Errorf("Failed to filter Product Files: %w", err)
+			}
+
+			for fileName, link := range linksByGlob {
+				filteredLinks[fileName] = link
+			}
+		}
+
+		if len(input.Params.Files) > 0 {
+			c.logger.Debugf(
+				"Filtering download links with file names: {files: %+v}\n",
+				input.Params.Files,
+			)
+
+			linksByName, err := filter.DownloadLinksByName(downloadLinks, input.Params.Files)
+			if err != nil {
+				return concourse.InResponse{}, fmt.Errorf("Failed to filter Product Files: %w", err)
+			}
+
+			for fileName, link := range linksByName {
+				filteredLinks[fileName] = link
+			}
+		}
+
+		downloadLinks = filteredLinks
+
+		if len(input.Params.FileTypes) > 0 {
+			c.logger.Debugf(
+				"Filtering download links with file types: {file_types: %+v}\n",
+				input.Params.FileTypes,
+			)
+
+			downloadLinks = filter.DownloadLinksByFileType(
+				downloadLinks,
+				downloadLinksFileType,
+				input.Params.FileTypes,
+			)
+		}
+
+		var delta deltaManifest
+		if input.Params.DeltaFrom != "" {
+			downloadLinks, delta, err = c.deltaDownloadLinks(
+				client,
+				input,
+				productSlug,
+				downloadLinks,
+				files,
+			)
+			if err != nil {
+				return concourse.InResponse{}, err
+			}
+
+			err = c.writeDeltaManifest(delta)
+			if err != nil {
+				return concourse.InResponse{}, fmt.Errorf("Failed to write %s: %w", deltaManifestFile, err)
+			}
+			deltaMetadata = delta.metadata()
+		}
+
+		linksByID := files.linksByID
+		if input.Params.DownloadBackend == downloadBackendPivnet {
+			linksByID = files.pivnetLinksByID
+		}
+
+		// The filters above select by file name, so each of the product files
+		// sharing a name is checked against those that select by product file.
+		selected := func(productFile pivnet.ProductFile) bool {
+			if input.Params.Digest != "" &&
+				productFile.SHA256 != strings.TrimPrefix(input.Params.Digest, "sha256:") {
+				return false
+			}
+
+			if len(input.Params.FileTypes) > 0 && !contains(input.Params.FileTypes, productFile.FileType) {
+				return false
+			}
+
+			return input.Params.DeltaFrom == "" || !delta.unchanged(productFile)
+		}
+
+		downloadLinks, downloadLinksMD5, downloadLinksSize, downloadLinksID, err = c.resolveCollisions(
+			input.Params.OnCollision,
+			c.downloadDir,
+			files,
+			selected,
+			linksByID,
+			downloadLinks,
+			downloadLinksMD5,
+			downloadLinksSize,
+			downloadLinksID,
+		)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+
+		if input.Params.FilenameTemplate != "" {
+			reserved, err := c.reservedFiles(versionFilepath, metadataFilepath)
+			if err != nil {
+				return concourse.InResponse{}, err
+			}
+
+			downloadLinks, downloadLinksMD5, downloadLinksSize, downloadLinksID, err = renameDownloads(
+				filenameTemplate,
+				reserved,
+				productSlug,
+				productVersion,
+				downloadLinks,
+				downloadLinksMD5,
+				downloadLinksSize,
+				downloadLinksID,
+			)
+			if err != nil {
+				return concourse.InResponse{}, fmt.Errorf("Failed to apply filename_template: %w", err)
+			}
+		}
+
+		err = c.waitForDownloadLinks(
+			client,
+			input.Params,
+			productSlug,
+			release,
+			downloadLinks,
+			downloadLinksID,
+			files.linksByID,
+		)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+
+		c.logger.Debugf(
+			"Downloading files: {download_links: %+v, download_dir: %s}\n",
+			downloadLinks,
+			c.downloadDir,
+		)
+
+		downloaderConfig.MD5s = downloadLinksMD5
+		if input.Params.MirrorBaseURL != "" {
+			downloaderConfig.MirrorURLs = mirrorURLs(
+				input.Params.MirrorBaseURL,
+				downloadLinks,
+				downloadLinksID,
+				productFileDetails,
+			)
+		}
+		downloaderClient := downloader.NewClient(downloaderConfig)
+
+		files, err := downloaderClient.Download(downloadLinks)
+		if _, ok := err.(downloader.ForbiddenError); ok {
+			return concourse.InResponse{}, fmt.Errorf(
+				"Failed to Download Files: %w - set skip_forbidden_files to skip files the token cannot download",
+				err,
+			)
+		}
+		if err != nil {
+			if input.Params.SkipEULA {
+				return concourse.InResponse{}, fmt.Errorf(
+					"Failed to Download Files: %w - the release may require EULA acceptance, remove skip_eula to accept it",
+					err,
+				)
+			}
+			return concourse.InResponse{}, fmt.Errorf("Failed to Download Files: %w", err)
+		}
+
+		sizeMetadata, err = c.downloadSizeMetadata(files, downloadLinksSize)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to determine download sizes: %w", err)
+		}
+
+		fileLabelsMetadata = c.fileLabelsMetadata(files, downloadLinksID, productFileDetails)
+
+		fileArtifacts, err := c.pulledArtifacts("", files, downloadLinksID, productFileDetails, productSlug, productVersion)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to record pulled artifacts: %w", err)
+		}
+
+		if input.Params.Digest != "" {
+			for _, a := range fileArtifacts {
+				if "sha256:"+a.SHA256 != input.Params.Digest {
+					return concourse.InResponse{}, fmt.Errorf(
+						"Failed to verify digest: downloaded file %s has digest sha256:%s rather than %s",
+						a.Name,
+						a.SHA256,
+						input.Params.Digest,
+					)
+				}
+			}
+		}
+		artifacts = append(artifacts, fileArtifacts...)
+		downloaded = true
+	}
+
+	var oslMetadata []concourse.Metadata
+	if input.Params.DownloadOSL {
+		oslFiles, metadata, err := c.downloadOSL(productSlug, release, oslLinks, oslMD5s, downloaderConfig)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+		oslMetadata = metadata
+
+		oslArtifacts, err := c.pulledArtifacts(oslDir, oslFiles, oslIDs, productFileDetails, productSlug, productVersion)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to record pulled artifacts: %w", err)
+		}
+		artifacts = append(artifacts, oslArtifacts...)
+		downloaded = true
+	}
+
+	if downloaded {
+		err := c.writePulledArtifacts(
+			artifacts,
+			input.Params.SortProductFilesBy,
+			downloadLinksFileType,
+		)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to write %s: %w", pulledArtifactsFile, err)
+		}
+	}
+
+	c.logger.Debugf(
+		"Writing version to file: {version: %s, version_filepath: %s}\n",
+		productVersion,
+		versionFilepath,
+	)
+
+	err = os.MkdirAll(filepath.Dir(versionFilepath), os.ModePerm)
+	if err != nil {
+		return concourse.InResponse{}, err
+	}
+
+	err = ioutil.WriteFile(versionFilepath, []byte(productVersion), os.ModePerm)
+	if err != nil {
+		return concourse.InResponse{}, err
+	}
+
+	releaseIDFilepath := filepath.Join(c.downloadDir, releaseIDFile)
+
+	c.logger.Debugf(
+		"Writing release ID to file: {release_id: %d, release_id_filepath: %s}\n",
+		release.ID,
+		releaseIDFilepath,
+	)
+
+	err = ioutil.WriteFile(releaseIDFilepath, []byte(strconv.Itoa(release.ID)), os.ModePerm)
+	if err != nil {
+		return concourse.InResponse{}, err
+	}
+
+	if input.Params.DownloadReleaseNotes {
+		releaseNotesFilepath := filepath.Join(c.downloadDir, releaseNotesFile)
+
+		// Pivnet has no release notes field, only the description and a
+		// release notes URL, so the description is written as returned.
+		if release.Description == "" {
+			c.logger.Debugf(
+				"Release has no release notes - writing an empty file: {release_notes_filepath: %s}\n",
+				releaseNotesFilepath,
+			)
+		} else {
+			c.logger.Debugf(
+				"Writing release notes to file: {release_notes_filepath: %s}\n",
+				releaseNotesFilepath,
+			)
+		}
+
+		err = ioutil.WriteFile(releaseNotesFilepath, []byte(release.Description), os.ModePerm)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	if input.Params.DownloadImageReferences {
+		c.logger.Debugf(
+			"Getting image references: {product_slug: %s, release_id: %d}\n",
+			productSlug,
+			release.ID,
+		)
+
+		imageReferences, err := client.ImageReferences(productSlug, release.ID)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to get Image References: %w", err)
+		}
+
+		imageReferencesFilepath := filepath.Join(c.downloadDir, imageReferencesFile)
+
+		c.logger.Debugf(
+			"Writing image references to file: {count: %d, image_references_filepath: %s}\n",
+			len(imageReferences),
+			imageReferencesFilepath,
+		)
+
+		err = ioutil.WriteFile(
+			imageReferencesFilepath,
+			imageReferencesYAML(imageReferences),
+			os.ModePerm,
+		)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	if input.Params.DownloadProductIcon {
+		err = c.downloadProductIcon(client, productSlug)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	if input.Params.DumpRawRelease {
+		err = c.dumpRawRelease(client, productSlug, release.ID)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to dump raw release: %w", err)
+		}
+	}
+
+	metadata = append(metadata, sizeMetadata...)
+	metadata = append(metadata, fileLabelsMetadata...)
+	metadata = append(metadata, lastNMetadata...)
+	metadata = append(metadata, releasedBetweenMetadata...)
+	metadata = append(metadata, deltaMetadata...)
+	metadata = append(metadata, digestMetadata...)
+	metadata = append(metadata, oslMetadata...)
+	metadata = concourse.SortedMetadata(metadata)
+
+	if metadataFilepath != "" {
+		c.logger.Debugf(
+			"Writing metadata to file: {metadata_filepath: %s}\n",
+			metadataFilepath,
+		)
+
+		b, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		err = os.MkdirAll(filepath.Dir(metadataFilepath), os.ModePerm)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+
+		err = ioutil.WriteFile(metadataFilepath, b, os.ModePerm)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	for _, format := range input.Params.MetadataFormats {
+		metadataFormatFilepath := filepath.Join(c.downloadDir, "metadata."+format)
+
+		c.logger.Debugf(
+			"Writing metadata to file: {metadata_filepath: %s, format: %s}\n",
+			metadataFormatFilepath,
+			format,
+		)
+
+		err = ioutil.WriteFile(metadataFormatFilepath, formatMetadata(metadata, format), os.ModePerm)
+		if err != nil {
+			return concourse.InResponse{}, err
+		}
+	}
+
+	if input.Params.PackageAs != "" {
+		err = c.packageRelease(input.Params, artifacts, downloaded, metadataFilepath)
+		if err != nil {
+			return concourse.InResponse{}, fmt.Errorf("Failed to package release: %w", err)
+		}
+	}
+
+	fetchedVersion := productVersion
+	if versionHasID && release.ID == versionReleaseID {
+		fetchedVersion = input.Version.ProductVersion
+	} else if versionHasFileHash && productVersion == requestedVersion {
+		fetchedVersion = input.Version.ProductVersion
+	}
+
+	// Warnings are only added to the metadata returned, as the metadata
+	// file has already been written.
+	if recorder != nil {
+		metadata = append(metadata, concourse.WarningsMetadata(recorder.Warnings())...)
+	}
+
+	out := concourse.InResponse{
+		Version: concourse.Version{
+			ProductSlug:    input.Version.ProductSlug,
+			ProductVersion: fetchedVersion,
+		},
+		Metadata: metadata,
+	}
+
+	return out, nil
+}
+
+// acceptEULA accepts the EULA of the release unless it has none or skip_eula
+// is set.
+func (c InCommand) acceptEULA(
+	client pivnet.Client,
+	params concourse.InParams,
+	endpoint string,
+	productSlug string,
+	release pivnet.Release,
+) error {
+	if release.Eula == nil {
+		c.logger.Debugf(
+			"Skipping EULA acceptance as the release has no EULA: {product_slug: %s, release_id: %d}\n",
+			productSlug,
+			release.ID,
+		)
+
+		return nil
+	}
+
+	if params.SkipEULA {
+		c.logger.Debugf(
+			"Skipping EULA acceptance: {product_slug: %s, release_id: %d}\n",
+			productSlug,
+			release.ID,
+		)
+
+		return nil
+	}
+
+	if len(params.AutoAcceptEULAs) > 0 {
+		if !contains(params.AutoAcceptEULAs, release.Eula.Slug) {
+			c.logger.Infof(
+				"Not accepting EULA %s of release %s, which is not in auto_accept_eulas\n",
+				release.Eula.Slug,
+				release.Version,
+			)
+
+			return fmt.Errorf(
+				"the EULA %s of release %s of product %s is not in auto_accept_eulas - "+
+					"review it at %s/products/%s#/releases/%d and add it to auto_accept_eulas to accept it",
+				release.Eula.Slug,
+				release.Version,
+				productSlug,
+				endpoint,
+				productSlug,
+				release.ID,
+			)
+		}
+
+		c.logger.Infof(
+			"Accepting EULA %s of release %s, which is in auto_accept_eulas\n",
+			release.Eula.Slug,
+			release.Version,
+		)
+	}
+
+	c.logger.Debugf(
+		"Accepting EULA: {product_slug: %s, release_id: %d}\n",
+		productSlug,
+		release.ID,
+	)
+
+	err := client.AcceptEULA(productSlug, release.ID)
+	if err != nil {
+		return fmt.Errorf("EULA acceptance failed for the release: %w", err)
+	}
+
+	return nil
+}
+
+// releaseFiles are the product files of a release along with their details
+// by file name.
+type releaseFiles struct {
+	productFiles pivnet.ProductFiles
+
+	md5s        map[string]string
+	sizes       map[string]int64
+	fileTypes   map[string]string
+	pivnetLinks map[string]string
+	ids         map[string]int
+
+	// details holds each product file by its ID, which survives renaming.
+	details map[int]pivnet.ProductFile
+
+	// collisions holds the IDs of the product files sharing each file name
+	// that more than one of them has, in the order they are listed.
+	collisions      map[string][]int
+	linksByID       map[int]string
+	pivnetLinksByID map[int]string
+}
+
+// releaseFiles gets the product files of the release and the details of each
+// of them.
+func (c InCommand) releaseFiles(
+	client pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	skipEULA bool,
+) (releaseFiles, error) {
+	c.logger.Debugf(
+		"Getting product files: {release_id: %d}\n",
+		release.ID,
+	)
+
+	productFiles, err := client.GetProductFiles(release)
+	if err != nil {
+		return releaseFiles{}, fmt.Errorf("Failed to get Product Files: %w%s", err, eulaHint(err, skipEULA))
+	}
+
+	c.logger.Debugf(
+		"Getting download links: {product_files: %+v}\n",
+		productFiles,
+	)
+
+	files := releaseFiles{
+		productFiles: productFiles,
+
+		md5s:        map[string]string{},
+		sizes:       map[string]int64{},
+		fileTypes:   map[string]string{},
+		pivnetLinks: map[string]string{},
+		ids:         map[string]int{},
+
+		details: map[int]pivnet.ProductFile{},
+
+		collisions:      map[string][]int{},
+		linksByID:       map[int]string{},
+		pivnetLinksByID: map[int]string{},
+	}
+	fileIDs := map[string][]int{}
+	for _, p := range productFiles.ProductFiles {
+		productFile, err := client.GetProductFile(
+			productSlug,
+			release.ID,
+			p.ID,
+		)
+		if err != nil {
+			return releaseFiles{}, fmt.Errorf("Failed to get Product File: %w%s", err, eulaHint(err, skipEULA))
+		}
+
+		fileName := productFile.FileName()
+
+		files.md5s[fileName] = productFile.MD5
+		files.sizes[fileName] = productFile.Size
+		files.fileTypes[fileName] = productFile.FileType
+		files.ids[fileName] = p.ID
+		files.details[p.ID] = productFile
+		files.pivnetLinks[fileName] = client.ProductFileDownloadURL(
+			productSlug,
+			release.ID,
+			p.ID,
+		)
+
+		if p.Links != nil {
+			files.linksByID[p.ID] = p.Links.Download["href"]
+		}
+		files.pivnetLinksByID[p.ID] = files.pivnetLinks[fileName]
+
+		fileIDs[fileName] = append(fileIDs[fileName], p.ID)
+		if len(fileIDs[fileName]) > 1 {
+			files.collisions[fileName] = fileIDs[fileName]
+		}
+	}
+
+	return files, nil
+}
+
+// linksByGlob returns the download links matching the globs. When select is
+// latest only the matching file with the highest version is returned for
+// each glob.
+func linksByGlob(downloadLinks map[string]string, params concourse.InParams) (map[string]string, error) {
+	if params.Select != selectLatest {
+		return filter.DownloadLinksByGlob(downloadLinks, params.Globs)
+	}
+
+	versionRegexp := defaultSelectVersionRegexp
+	if params.SelectVersionRegexp != "" {
+		// Already validated by Run.
+		versionRegexp = regexp.MustCompile(params.SelectVersionRegexp)
+	}
+
+	return filter.LatestDownloadLinksByGlob(downloadLinks, params.Globs, versionRegexp)
+}
+
+// fileHash returns the hash of the MD5s of every file of the release, as
+// appended to the version by out with version_includes_file_hashes.
+func (f releaseFiles) fileHash() string {
+	var md5s []string
+	for _, p := range f.details {
+		md5s = append(md5s, p.MD5)
+	}
+
+	return versions.FileHash(md5s)
+}
+
+// deltaManifest records how the files selected from the release compare with
+// those of the release of delta_from. Removed files are those of the release
+// of delta_from that the release no longer has.
+type deltaManifest struct {
+	From      string   `json:"from"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+	Removed   []string `json:"removed"`
+
+	// fromMD5s holds the MD5s of the product files of the release of
+	// delta_from by file name, including those sharing a name.
+	fromMD5s map[string]map[string]bool
+}
+
+// unchanged returns whether the release of delta_from has a product file of
+// the same name and MD5 as the product file.
+func (d deltaManifest) unchanged(productFile pivnet.ProductFile) bool {
+	return productFile.MD5 != "" && d.fromMD5s[productFile.FileName()][productFile.MD5]
+}
+
+func (d deltaManifest) metadata() []concourse.Metadata {
+	return []concourse.Metadata{
+		{Name: "delta_from", Value: d.From},
+		{Name: "delta_changed", Value: strconv.Itoa(len(d.Changed))},
+		{Name: "delta_unchanged", Value: strconv.Itoa(len(d.Unchanged))},
+		{Name: "delta_removed", Value: strconv.Itoa(len(d.Removed))},
+	}
+}
+
+// deltaDownloadLinks returns only the download links of the files that are
+// new since the release of delta_from or whose MD5 differs from that of its
+// file of the same name, along with the manifest of the delta. Files without
+// an MD5 are always downloaded.
+func (c InCommand) deltaDownloadLinks(
+	client pivnet.Client,
+	input concourse.InRequest,
+	productSlug string,
+	downloadLinks map[string]string,
+	files releaseFiles,
+) (map[string]string, deltaManifest, error) {
+	from := input.Params.DeltaFrom
+
+	c.logger.Debugf(
+		"Getting release of delta_from: {product_slug: %s, product_version: %s}\n",
+		productSlug,
+		from,
+	)
+
+	var fromRelease pivnet.Release
+	var err error
+	if input.Source.DuplicateVersionStrategy != "" {
+		fromRelease, err = releaseForVersion(
+			client,
+			productSlug,
+			from,
+			input.Source.DuplicateVersionStrategy,
+		)
+	} else {
+		fromRelease, err = client.GetRelease(productSlug, from)
+	}
+	if err != nil {
+		return nil, deltaManifest{}, fmt.Errorf("Failed to get Release %s of %s: %w", from, "delta_from", err)
+	}
+
+	fromFiles, err := c.releaseFiles(client, productSlug, fromRelease, input.Params.SkipEULA)
+	if err != nil {
+		return nil, deltaManifest{}, err
+	}
+
+	delta := deltaManifest{
+		From:      fromRelease.Version,
+		Changed:   []string{},
+		Unchanged: []string{},
+		Removed:   []string{},
+
+		fromMD5s: map[string]map[string]bool{},
+	}
+
+	for _, productFile := range fromFiles.details {
+		fileName := productFile.FileName()
+		if delta.fromMD5s[fileName] == nil {
+			delta.fromMD5s[fileName] = map[string]bool{}
+		}
+		delta.fromMD5s[fileName][productFile.MD5] = true
+	}
+
+	changedLinks := map[string]string{}
+	for fileName, link := range downloadLinks {
+		fromMD5, ok := fromFiles.md5s[fileName]
+		if ok && fromMD5 != "" && fromMD5 == files.md5s[fileName] {
+			delta.Unchanged = append(delta.Unchanged, fileName)
+			continue
+		}
+
+		delta.Changed = append(delta.Changed, fileName)
+		changedLinks[fileName] = link
+	}
+
+	for fileName := range fromFiles.md5s {
+		if _, ok := files.md5s[fileName]; !ok {
+			delta.Removed = append(delta.Removed, fileName)
+		}
+	}
+
+	sort.Strings(delta.Changed)
+	sort.Strings(delta.Unchanged)
+	sort.Strings(delta.Removed)
+
+	c.logger.Infof(
+		"Downloading only the files changed since %s: {changed: %d, unchanged: %d, removed: %d}\n",
+		delta.From,
+		len(delta.Changed),
+		len(delta.Unchanged),
+		len(delta.Removed),
+	)
+
+	return changedLinks, delta, nil
+}
+
+// writeDeltaManifest writes delta.json to the destination.
+func (c InCommand) writeDeltaManifest(delta deltaManifest) error {
+	b, err := json.MarshalIndent(delta, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	deltaManifestFilepath := filepath.Join(c.downloadDir, deltaManifestFile)
+
+	c.logger.Debugf(
+		"Writing delta manifest to file: {changed: %d, delta_manifest_filepath: %s}\n",
+		len(delta.Changed),
+		deltaManifestFilepath,
+	)
+
+	return ioutil.WriteFile(deltaManifestFilepath, b, os.ModePerm)
+}
+
+// resolveCollisions resolves the file names of the download links shared by
+// more than one product file of the release with the on_collision strategy.
+// Only the product files sharing a name that are selected are considered, or
+// all of them if selected is nil. Without a strategy only the last of them is
+// downloaded, as before. With suffix or subdir every one of them is
+// downloaded, as <name>-<product file id><extension> or
+// <product file id>/<name> within the dir.
+func (c InCommand) resolveCollisions(
+	strategy string,
+	dir string,
+	files releaseFiles,
+	selected func(pivnet.ProductFile) bool,
+	linksByID map[int]string,
+	downloadLinks map[string]string,
+	md5s map[string]string,
+	sizes map[string]int64,
+	ids map[string]int,
+) (map[string]string, map[string]string, map[string]int64, map[string]int, error) {
+	var names []string
+	collisions := map[string][]int{}
+	for name := range downloadLinks {
+		if len(files.collisions[name]) > 1 {
+			names = append(names, name)
+
+			for _, id := range files.collisions[name] {
+				if selected == nil || selected(files.details[id]) {
+					collisions[name] = append(collisions[name], id)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return downloadLinks, md5s, sizes, ids, nil
+	}
+
+	resolvedLinks := map[string]string{}
+	resolvedMD5s := map[string]string{}
+	resolvedSizes := map[string]int64{}
+	resolvedIDs := map[string]int{}
+	for name, link := range downloadLinks {
+		resolvedLinks[name] = link
+		resolvedMD5s[name] = md5s[name]
+		resolvedSizes[name] = sizes[name]
+		resolvedIDs[name] = ids[name]
+	}
+
+	for _, name := range names {
+		collidingIDs := collisions[name]
+
+		// Without more than one selected product file there is no collision
+		// left, only the file to download under its own name, if any.
+		if len(collidingIDs) < 2 {
+			delete(resolvedLinks, name)
+			delete(resolvedMD5s, name)
+			delete(resolvedSizes, name)
+			delete(resolvedIDs, name)
+
+			for _, id := range collidingIDs {
+				resolvedLinks[name] = linksByID[id]
+				resolvedMD5s[name] = files.details[id].MD5
+				resolvedSizes[name] = files.details[id].Size
+				resolvedIDs[name] = id
+			}
+			continue
+		}
+
+		var idStrings []string
+		for _, id := range collidingIDs {
+			idStrings = append(idStrings, strconv.Itoa(id))
+		}
+
+		c.logger.Infof(
+			"Product files share a file name: {name: %s, product_file_ids: %s, on_collision: %s}\n",
+			name,
+			strings.Join(idStrings, ", "),
+			strategy,
+		)
+
+		switch strategy {
+		case "":
+			last := collidingIDs[len(collidingIDs)-1]
+			resolvedLinks[name] = linksByID[last]
+			resolvedMD5s[name] = files.details[last].MD5
+			resolvedSizes[name] = files.details[last].Size
+			resolvedIDs[name] = last
+
+			c.logger.Warnf(
+				"Warning: product files %s share the name %s - only product file %d is downloaded, set on_collision to download all of them\n",
+				strings.Join(idStrings, ", "),
+				name,
+				last,
+			)
+			continue
+		case onCollisionFail:
+			return nil, nil, nil, nil, fmt.Errorf(
+				"product files %s share the name %s (%s is %s)",
+				strings.Join(idStrings, ", "),
+				name,
+				"on_collision",
+				onCollisionFail,
+			)
+		}
+
+		delete(resolvedLinks, name)
+		delete(resolvedMD5s, name)
+		delete(resolvedSizes, name)
+		delete(resolvedIDs, name)
+
+		for _, id := range collidingIDs {
+			var newName string
+			if strategy == onCollisionSubdir {
+				newName = filepath.Join(strconv.Itoa(id), name)
+
+				err := os.MkdirAll(filepath.Join(dir, strconv.Itoa(id)), os.ModePerm)
+				if err != nil {
+					return nil, nil, nil, nil, err
+				}
+			} else {
+				ext := filepath.Ext(name)
+				newName = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), id, ext)
+			}
+
+			c.logger.Debugf(
+				"Resolved file name collision: {name: %s, product_file_id: %d, file_name: %s}\n",
+				name,
+				id,
+				newName,
+			)
+
+			resolvedLinks[newName] = linksByID[id]
+			resolvedMD5s[newName] = files.details[id].MD5
+			resolvedSizes[newName] = files.details[id].Size
+			resolvedIDs[newName] = id
+		}
+	}
+
+	return resolvedLinks, resolvedMD5s, resolvedSizes, resolvedIDs, nil
+}
+
+// waitForDownloadLinks checks that each of the product files to download has
+// a download link, which files still being processed after the release is
+// published do not. If wait_for_file_processing is set it polls for each of
+// them until it has one, updating the download links, and otherwise returns
+// an error naming them.
+func (c InCommand) waitForDownloadLinks(
+	client pivnet.Client,
+	params concourse.InParams,
+	productSlug string,
+	release pivnet.Release,
+	downloadLinks map[string]string,
+	ids map[string]int,
+	linksByID map[int]string,
+) error {
+	var unavailable []string
+	for name := range downloadLinks {
+		if linksByID[ids[name]] == "" {
+			unavailable = append(unavailable, name)
+		}
+	}
+	sort.Strings(unavailable)
+
+	if len(unavailable) == 0 {
+		return nil
+	}
+
+	if !params.WaitForFileProcessing {
+		return fmt.Errorf(
+			"file not yet available for download: %s of release %s of product %s - it may still be processing, set wait_for_file_processing to wait for it",
+			strings.Join(unavailable, ", "),
+			release.Version,
+			productSlug,
+		)
+	}
+
+	timeout := defaultFileProcessingTimeout
+	if params.FileProcessingTimeoutSeconds > 0 {
+		timeout = time.Duration(params.FileProcessingTimeoutSeconds) * time.Second
+	}
+
+	for _, name := range unavailable {
+		c.logger.Infof(
+			"Waiting for file to be available for download: {name: %s, product_file_id: %d, timeout: %s}\n",
+			name,
+			ids[name],
+			timeout.String(),
+		)
+
+		productFile, err := client.WaitForProductFile(productSlug, release.ID, ids[name], timeout)
+		if err != nil {
+			return fmt.Errorf("file %s: %w", name, err)
+		}
+
+		if params.DownloadBackend != downloadBackendPivnet {
+			downloadLinks[name] = productFile.Links.Download["href"]
+		}
+	}
+
+	return nil
+}
+
+// artifactsByDigest returns the download links of the product files of the
+// release with the digest, along with metadata recording the digest and the
+// artifact references of the release with it. Artifact references are not
+// downloaded. It returns an error if neither a product file nor an artifact
+// reference has the digest.
+func (c InCommand) artifactsByDigest(
+	client pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	digest string,
+	downloadLinks map[string]string,
+	ids map[string]int,
+	details map[int]pivnet.ProductFile,
+) (map[string]string, []concourse.Metadata, error) {
+	sha256 := strings.TrimPrefix(digest, "sha256:")
+
+	links := map[string]string{}
+	for fileName, link := range downloadLinks {
+		if details[ids[fileName]].SHA256 == sha256 {
+			links[fileName] = link
+		}
+	}
+
+	c.logger.Debugf(
+		"Getting artifact references: {product_slug: %s, release_id: %d}\n",
+		productSlug,
+		release.ID,
+	)
+
+	artifactReferences, err := client.ArtifactReferences(productSlug, release.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get artifact references: %s", err.Error())
+	}
+
+	metadata := []concourse.Metadata{{Name: "digest", Value: digest}}
+	for _, r := range artifactReferences {
+		if r.Digest == digest {
+			metadata = append(metadata, concourse.Metadata{
+				Name:  "artifact_reference: " + r.Name,
+				Value: r.ArtifactPath,
+			})
+		}
+	}
+
+	if len(links) == 0 && len(metadata) == 1 {
+		return nil, nil, fmt.Errorf(
+			"no file or artifact reference of release %s of product %s has digest %s",
+			release.Version,
+			productSlug,
+			digest,
+		)
+	}
+
+	if len(links) == 0 {
+		c.logger.Warnf(
+			"Warning: no file of release %s of product %s has digest %s - only artifact references have it, which are not downloaded\n",
+			release.Version,
+			productSlug,
+			digest,
+		)
+	}
+
+	c.logger.Debugf(
+		"Selected artifacts by digest: {digest: %s, files: %d, artifact_references: %d}\n",
+		digest,
+		len(links),
+		len(metadata)-1,
+	)
+
+	return links, metadata, nil
+}
+
+// downloadLastN downloads the files matching the globs from each of the last
+// n releases up to and including the release, to a directory per version. It
+// returns the records of the downloaded files, their file types and metadata
+// listing the versions and files downloaded.
+func (c InCommand) downloadLastN(
+	client pivnet.Client,
+	params concourse.InParams,
+	endpoint string,
+	productSlug string,
+	release pivnet.Release,
+	config downloader.Config,
+) ([]pulledArtifact, map[string]string, []concourse.Metadata, error) {
+	allReleases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	start := -1
+	for i, r := range allReleases {
+		if r.ID == release.ID {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return nil, nil, nil, fmt.Errorf(
+			"release %s is not one of the releases of product %s",
+			release.Version,
+			productSlug,
+		)
+	}
+
+	releases := allReleases[start:]
+	if len(releases) > params.LastN {
+		releases = releases[:params.LastN]
+	} else if len(releases) < params.LastN {
+		c.logger.Warnf(
+			"Warning: only %d releases up to and including %s - downloading from all of them: {last_n: %d}\n",
+			len(releases),
+			release.Version,
+			params.LastN,
+		)
+	}
+
+	downloads, artifacts, fileTypes, err := c.downloadReleases(
+		client,
+		params,
+		endpoint,
+		productSlug,
+		release,
+		releases,
+		config,
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return artifacts, fileTypes, releaseDownloadsMetadata("last_n", downloads), nil
+}
+
+// downloadReleasedBetween downloads the files matching the globs from each of
+// the releases with a release date within released_after and released_before,
+// to a directory per version, and writes releases.json recording the
+// releases and files downloaded. It returns the records of the downloaded
+// files, their file types and metadata listing the versions and files
+// downloaded.
+func (c InCommand) downloadReleasedBetween(
+	client pivnet.Client,
+	params concourse.InParams,
+	endpoint string,
+	productSlug string,
+	release pivnet.Release,
+	after time.Time,
+	before time.Time,
+	config downloader.Config,
+) ([]pulledArtifact, map[string]string, []concourse.Metadata, error) {
+	allReleases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var releases []pivnet.Release
+	for _, r := range allReleases {
+		releaseDate, err := time.Parse(releaseDateFormat, r.ReleaseDate)
+		if err != nil {
+			c.logger.Debugf(
+				"Ignoring release without a valid release date: {version: %s, release_date: %s}\n",
+				r.Version,
+				r.ReleaseDate,
+			)
+			continue
+		}
+
+		if (!after.IsZero() && releaseDate.Before(after)) ||
+			(!before.IsZero() && releaseDate.After(before)) {
+			continue
+		}
+
+		releases = append(releases, r)
+	}
+
+	if len(releases) == 0 {
+		c.logger.Warnf(
+			"Warning: no releases of product %s have a release date within the range - downloading no files: {released_after: %s, released_before: %s}\n",
+			productSlug,
+			params.ReleasedAfter,
+			params.ReleasedBefore,
+		)
+	}
+
+	downloads, artifacts, fileTypes, err := c.downloadReleases(
+		client,
+		params,
+		endpoint,
+		productSlug,
+		release,
+		releases,
+		config,
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = c.writeReleasesManifest(downloads)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return artifacts, fileTypes, releaseDownloadsMetadata("released_between", downloads), nil
+}
+
+// releaseDownload is the files downloaded from one of several releases.
+type releaseDownload struct {
+	release pivnet.Release
+	files   []string
+}
+
+// downloadReleases downloads the files matching the globs from each of the
+// releases to a directory per version, accepting the EULA of each release
+// other than the requested release, which has already been accepted.
+func (c InCommand) downloadReleases(
+	client pivnet.Client,
+	params concourse.InParams,
+	endpoint string,
+	productSlug string,
+	release pivnet.Release,
+	releases []pivnet.Release,
+	config downloader.Config,
+) ([]releaseDownload, []pulledArtifact, map[string]string, error) {
+	var downloads []releaseDownload
+	var artifacts []pulledArtifact
+	fileTypes := map[string]string{}
+	for _, r := range releases {
+		dir, err := destinationPath(c.downloadDir, r.Version, "release version")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// The EULA of the requested release has already been accepted.
+		if r.ID != release.ID {
+			err = c.acceptEULA(client, params, endpoint, productSlug, r)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		files, err := c.releaseFiles(client, productSlug, r, params.SkipEULA)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		links := filter.DownloadLinks(files.productFiles)
+		if params.DownloadBackend == downloadBackendPivnet {
+			links = files.pivnetLinks
+		}
+
+		links, err = linksByGlob(links, params)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("release %s: %s", r.Version, err.Error())
+		}
+
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		linksByID := files.linksByID
+		if params.DownloadBackend == downloadBackendPivnet {
+			linksByID = files.pivnetLinksByID
+		}
+
+		links, md5s, _, ids, err := c.resolveCollisions(
+			params.OnCollision,
+			dir,
+			files,
+			nil,
+			linksByID,
+			links,
+			files.md5s,
+			files.sizes,
+			files.ids,
+		)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("release %s: %s", r.Version, err.Error())
+		}
+
+		config.DownloadDir = dir
+		config.MD5s = md5s
+
+		c.logger.Debugf(
+			"Downloading files: {version: %s, download_links: %+v, download_dir: %s}\n",
+			r.Version,
+			links,
+			config.DownloadDir,
+		)
+
+		downloaded, err := downloader.NewClient(config).Download(links)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("release %s: %s", r.Version, err.Error())
+		}
+		sort.Strings(downloaded)
+
+		versionArtifacts, err := c.pulledArtifacts(r.Version, downloaded, ids, files.details, productSlug, r.Version)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		artifacts = append(artifacts, versionArtifacts...)
+
+		for name, fileType := range files.fileTypes {
+			fileTypes[name] = fileType
+		}
+
+		downloads = append(downloads, releaseDownload{release: r, files: downloaded})
+	}
+
+	return downloads, artifacts, fileTypes, nil
+}
+
+// releaseDownloadsMetadata returns metadata listing the versions downloaded
+// from and the files downloaded from each, with names starting with the
+// prefix.
+func releaseDownloadsMetadata(prefix string, downloads []releaseDownload) []concourse.Metadata {
+	var versions []string
+	var filesMetadata []concourse.Metadata
+	for _, d := range downloads {
+		downloadedFiles := "none"
+		if len(d.files) > 0 {
+			downloadedFiles = strings.Join(d.files, ", ")
+		}
+
+		versions = append(versions, d.release.Version)
+		filesMetadata = append(filesMetadata, concourse.Metadata{
+			Name:  prefix + "_files: " + d.release.Version,
+			Value: downloadedFiles,
+		})
+	}
+
+	metadata := []concourse.Metadata{
+		{Name: prefix + "_versions", Value: strings.Join(versions, ", ")},
+	}
+
+	return append(metadata, filesMetadata...)
+}
+
+type releasesManifestRelease struct {
+	Version     string   `json:"version"`
+	ReleaseID   int      `json:"release_id"`
+	ReleaseDate string   `json:"release_date"`
+	Files       []string `json:"files"`
+}
+
+type releasesManifest struct {
+	Releases []releasesManifestRelease `json:"releases"`
+}
+
+// writeReleasesManifest writes releases.json to the destination, recording
+// each of the releases downloaded from and the files downloaded from it.
+func (c InCommand) writeReleasesManifest(downloads []releaseDownload) error {
+	manifest := releasesManifest{Releases: []releasesManifestRelease{}}
+	for _, d := range downloads {
+		files := d.files
+		if files == nil {
+			files = []string{}
+		}
+
+		manifest.Releases = append(manifest.Releases, releasesManifestRelease{
+			Version:     d.release.Version,
+			ReleaseID:   d.release.ID,
+			ReleaseDate: d.release.ReleaseDate,
+			Files:       files,
+		})
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	releasesManifestFilepath := filepath.Join(c.downloadDir, releasesManifestFile)
+
+	c.logger.Debugf(
+		"Writing releases manifest to file: {releases: %d, releases_manifest_filepath: %s}\n",
+		len(manifest.Releases),
+		releasesManifestFilepath,
+	)
+
+	return ioutil.WriteFile(releasesManifestFilepath, b, os.ModePerm)
+}
+
+// oslDownloadLinks returns the links of the open source license files, i.e.
+// the files of that file type or matching the glob if one is provided.
+func oslDownloadLinks(
+	downloadLinks map[string]string,
+	fileTypes map[string]string,
+	oslGlob string,
+) map[string]string {
+	oslLinks := map[string]string{}
+	for fileName, link := range downloadLinks {
+		matched := fileTypes[fileName] == oslFileType
+		if oslGlob != "" {
+			// The glob is validated up front.
+			matched, _ = filepath.Match(oslGlob, fileName)
+		}
+
+		if matched {
+			oslLinks[fileName] = link
+		}
+	}
+
+	return oslLinks
+}
+
+// downloadOSL downloads the open source license files of the release to the
+// osl directory of the destination, returning them along with metadata
+// listing them. A release without one is only warned about, as not every
+// release has one.
+func (c InCommand) downloadOSL(
+	productSlug string,
+	release pivnet.Release,
+	oslLinks map[string]string,
+	md5s map[string]string,
+	config downloader.Config,
+) ([]string, []concourse.Metadata, error) {
+	var files []string
+	if len(oslLinks) > 0 {
+		config.DownloadDir = filepath.Join(c.downloadDir, oslDir)
+		config.MD5s = md5s
+
+		c.logger.Debugf(
+			"Downloading open source license files: {download_links: %+v, download_dir: %s}\n",
+			oslLinks,
+			config.DownloadDir,
+		)
+
+		err := os.MkdirAll(config.DownloadDir, os.ModePerm)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files, err = downloader.NewClient(config).Download(oslLinks)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to Download Open Source License Files: %w", err)
+		}
+	}
+
+	if len(files) == 0 {
+		c.logger.Warnf(
+			"Warning: no open source license file found: {product_slug: %s, release_id: %d}\n",
+			productSlug,
+			release.ID,
+		)
+
+		return nil, []concourse.Metadata{{Name: "osl_files", Value: "none"}}, nil
+	}
+
+	sort.Strings(files)
+
+	return files, []concourse.Metadata{{Name: "osl_files", Value: strings.Join(files, ", ")}}, nil
+}
+
+// pulledArtifact is the record of a downloaded file in pulled_artifacts.json.
+type pulledArtifact struct {
+	Name           string `json:"name"`
+	Path           string `json:"path"`
+	MD5            string `json:"md5"`
+	SHA256         string `json:"sha256"`
+	Size           int64  `json:"size"`
+	PivnetFileID   int    `json:"pivnet_file_id"`
+	ProductSlug    string `json:"product_slug"`
+	ReleaseVersion string `json:"release_version"`
+
+	Platforms     []string `json:"platforms,omitempty"`
+	IncludedFiles []string `json:"included_files,omitempty"`
+	ReleasedAt    string   `json:"released_at,omitempty"`
+}
+
+type pulledArtifacts struct {
+	Artifacts []pulledArtifact `json:"artifacts"`
+}
+
+// pulledArtifacts returns the records of the files downloaded to the
+// directory within the destination, including the details of their product
+// files that Pivotal Network provides.
+func (c InCommand) pulledArtifacts(
+	dir string,
+	files []string,
+	ids map[string]int,
+	details map[int]pivnet.ProductFile,
+	productSlug string,
+	productVersion string,
+) ([]pulledArtifact, error) {
+	var artifacts []pulledArtifact
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		fullPath := filepath.Join(c.downloadDir, path)
+
+		sums, err := checksum.FileSums(fullPath)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+
+		productFile := details[ids[f]]
+
+		artifacts = append(artifacts, pulledArtifact{
+			Name:           f,
+			Path:           filepath.ToSlash(path),
+			MD5:            sums.MD5,
+			SHA256:         sums.SHA256,
+			Size:           info.Size(),
+			PivnetFileID:   ids[f],
+			ProductSlug:    productSlug,
+			ReleaseVersion: productVersion,
+
+			Platforms:     productFile.Platforms,
+			IncludedFiles: productFile.IncludedFiles,
+			ReleasedAt:    productFile.ReleasedAt,
+		})
+	}
+
+	return artifacts, nil
+}
+
+// writePulledArtifacts writes the records of every downloaded file to
+// pulled_artifacts.json in the destination, ordered by the sort key.
+func (c InCommand) writePulledArtifacts(
+	artifacts []pulledArtifact,
+	sortBy string,
+	fileTypes map[string]string,
+) error {
+	sortArtifacts(artifacts, sortBy, fileTypes)
+
+	if artifacts == nil {
+		artifacts = []pulledArtifact{}
+	}
+
+	b, err := json.MarshalIndent(pulledArtifacts{Artifacts: artifacts}, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	artifactsFilepath := filepath.Join(c.downloadDir, pulledArtifactsFile)
+
+	c.logger.Debugf(
+		"Writing pulled artifacts to file: {count: %d, pulled_artifacts_filepath: %s}\n",
+		len(artifacts),
+		artifactsFilepath,
+	)
+
+	return ioutil.WriteFile(artifactsFilepath, b, os.ModePerm)
+}
+
+// sortArtifacts orders the records of downloaded files by the product file ID,
+// the file type or, by default, the path. Ties are broken by path so that the
+// order does not depend on the order Pivnet returns the files in.
+func sortArtifacts(artifacts []pulledArtifact, sortBy string, fileTypes map[string]string) {
+	sort.Slice(artifacts, func(i, j int) bool {
+		a, b := artifacts[i], artifacts[j]
+
+		switch sortBy {
+		case sortProductFilesByID:
+			if a.PivnetFileID != b.PivnetFileID {
+				return a.PivnetFileID < b.PivnetFileID
+			}
+		case sortProductFilesByFileType:
+			if fileTypes[a.Name] != fileTypes[b.Name] {
+				return fileTypes[a.Name] < fileTypes[b.Name]
+			}
+		}
+
+		return a.Path < b.Path
+	})
+}
+
+// eulaHint returns a hint to accept the EULA if the error is because the EULA
+// was not accepted with skip_eula.
+func eulaHint(err error, skipEULA bool) string {
+	var eulaRequired pivnet.ErrEULARequired
+	if skipEULA && errors.As(err, &eulaRequired) {
+		return " - the release requires EULA acceptance, remove skip_eula to accept it"
+	}
+
+	return ""
+}
+
+// releaseMetadataNames are the names of the metadata taken from the release
+// itself, which are the only names require_metadata may contain.
+var releaseMetadataNames = []string{
+	"release_id",
+	"release_type",
+	"release_date",
+	"description",
+	"release_notes_url",
+	"eula_required",
+	"eula_slug",
+}
+
+func releaseMetadata(release pivnet.Release) []concourse.Metadata {
+	metadata := []concourse.Metadata{
+		{Name: "release_id", Value: strconv.Itoa(release.ID)},
+		{Name: "release_type", Value: release.ReleaseType},
+		{Name: "release_date", Value: release.ReleaseDate},
+		{Name: "description", Value: release.Description},
+		{Name: "release_notes_url", Value: release.ReleaseNotesURL},
+		{Name: "eula_required", Value: strconv.FormatBool(release.Eula != nil)},
+	}
+
+	if release.Eula != nil {
+		metadata = append(metadata,
+			concourse.Metadata{Name: "eula_slug", Value: release.Eula.Slug},
+		)
+	}
+
+	return metadata
+}
+
+// requireMetadata returns an error listing every required name that is
+// absent from the metadata or has an empty value.
+func requireMetadata(metadata []concourse.Metadata, required []string) error {
+	values := map[string]string{}
+	for _, m := range metadata {
+		values[m.Name] = m.Value
+	}
+
+	var missing []string
+	for _, name := range required {
+		if values[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"missing required metadata: %s",
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
+
+// fileGroupsMetadata returns metadata recording the file names in each file
+// group of the release as a JSON object of group name to file names, which is
+// empty for a release without file groups.
+func (c InCommand) fileGroupsMetadata(
+	client pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+) (concourse.Metadata, error) {
+	c.logger.Debugf(
+		"Getting file groups: {product_slug: %s, release_id: %d}\n",
+		productSlug,
+		release.ID,
+	)
+
+	fileGroups, err := client.ReleaseFileGroups(productSlug, release.ID)
+	if err != nil {
+		return concourse.Metadata{}, fmt.Errorf("Failed to get File Groups: %w", err)
+	}
+
+	groups := map[string][]string{}
+	for _, fg := range fileGroups {
+		fileNames := groups[fg.Name]
+		if fileNames == nil {
+			fileNames = []string{}
+		}
+
+		for _, p := range fg.ProductFiles {
+			fileName := p.Name
+			if p.AWSObjectKey != "" {
+				parts := strings.Split(p.AWSObjectKey, "/")
+				fileName = parts[len(parts)-1]
+			}
+			fileNames = append(fileNames, fileName)
+		}
+		sort.Strings(fileNames)
+
+		groups[fg.Name] = fileNames
+	}
+
+	b, err := json.Marshal(groups)
+	if err != nil {
+		panic(err)
+	}
+
+	return concourse.Metadata{Name: "file_groups", Value: string(b)}, nil
+}
+
+func (c InCommand) downloadSizeMetadata(
+	files []string,
+	sizes map[string]int64,
+) ([]concourse.Metadata, error) {
+	sortedFiles := make([]string, len(files))
+	copy(sortedFiles, files)
+	sort.Strings(sortedFiles)
+
+	var total int64
+	var fileMetadata []concourse.Metadata
+	for _, f := range sortedFiles {
+		size := sizes[f]
+		if size == 0 {
+			info, err := os.Stat(filepath.Join(c.downloadDir, f))
+			if err != nil {
+				return nil, err
+			}
+			size = info.Size()
+		}
+
+		total += size
+
+		fileMetadata = append(fileMetadata, concourse.Metadata{
+			Name:  fmt.Sprintf("file_size: %s", f),
+			Value: fmt.Sprintf("%d (%s)", size, bytesize.Format(size)),
+		})
+	}
+
+	metadata := []concourse.Metadata{
+		{Name: "total_download_size_bytes", Value: strconv.FormatInt(total, 10)},
+		{Name: "total_download_size", Value: bytesize.Format(total)},
+	}
+
+	return append(metadata, fileMetadata...), nil
+}
+
+// mirrorURLs returns the URL of each file under the mirror base URL, by its
+// AWS object key. Files without an AWS object key have no mirror URL.
+func mirrorURLs(
+	mirrorBaseURL string,
+	downloadLinks map[string]string,
+	ids map[string]int,
+	details map[int]pivnet.ProductFile,
+) map[string]string {
+	urls := map[string]string{}
+	for fileName := range downloadLinks {
+		key := details[ids[fileName]].AWSObjectKey
+		if key == "" {
+			continue
+		}
+
+		urls[fileName] = strings.TrimSuffix(mirrorBaseURL, "/") + "/" + strings.TrimPrefix(key, "/")
+	}
+
+	return urls
+}
+
+// fileLabelsMetadata returns metadata listing the labels rendered into the
+// description of each downloaded file by out, in file name order. Files
+// without labels are omitted.
+func (c InCommand) fileLabelsMetadata(
+	files []string,
+	ids map[string]int,
+	details map[int]pivnet.ProductFile,
+) []concourse.Metadata {
+	sortedFiles := make([]string, len(files))
+	copy(sortedFiles, files)
+	sort.Strings(sortedFiles)
+
+	var metadata []concourse.Metadata
+	for _, f := range sortedFiles {
+		fileLabels, _, err := labels.ParseFileLabels(details[ids[f]].Description)
+		if err != nil {
+			c.logger.Warnf("Warning: ignoring labels of file %s: %s\n", f, err.Error())
+			continue
+		}
+
+		if len(fileLabels) == 0 {
+			continue
+		}
+
+		metadata = append(metadata, concourse.Metadata{
+			Name:  fmt.Sprintf("file_labels: %s", f),
+			Value: strings.Join(fileLabels, ", "),
+		})
+	}
+
+	return metadata
+}
+
+// packageRelease bundles the downloaded files, along with the pulled
+// artifacts file recording their checksums and the metadata file, into a
+// single archive in the destination, removing the downloaded files from the
+// destination if remove_packaged_files is set.
+func (c InCommand) packageRelease(
+	params concourse.InParams,
+	artifacts []pulledArtifact,
+	downloaded bool,
+	metadataFilepath string,
+) error {
+	var files []string
+	for _, a := range artifacts {
+		files = append(files, filepath.FromSlash(a.Path))
+	}
+
+	packaged := len(files)
+
+	if downloaded {
+		files = append(files, pulledArtifactsFile)
+	}
+
+	if metadataFilepath != "" {
+		metadataFile, err := filepath.Rel(c.downloadDir, metadataFilepath)
+		if err != nil {
+			return err
+		}
+		files = append(files, metadataFile)
+	}
+
+	archiveName := packageTarFile
+	if params.PackageAs == packageAsTgz {
+		archiveName = packageTgzFile
+	}
+	archivePath := filepath.Join(c.downloadDir, archiveName)
+
+	c.logger.Debugf(
+		"Packaging files: {files: %v, archive_path: %s}\n",
+		files,
+		archivePath,
+	)
+
+	err := archive.Write(archivePath, c.downloadDir, files, params.PackageAs == packageAsTgz)
+	if err != nil {
+		return err
+	}
+
+	if params.RemovePackagedFiles {
+		for _, f := range files[:packaged] {
+			c.logger.Debugf("Removing packaged file: {file: %s}\n", f)
+
+			err := os.Remove(filepath.Join(c.downloadDir, f))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// downloadProductIcon writes the icon of the product to product_icon.png in
+// the destination. The icon is only a nice-to-have, so a product without one,
+// or an icon that cannot be fetched, does not fail the get.
+func (c InCommand) downloadProductIcon(client pivnet.Client, productSlug string) error {
+	c.logger.Debugf("Getting product icon: {product_slug: %s}\n", productSlug)
+
+	icon, iconURL, err := client.ProductIcon(productSlug)
+	if err != nil {
+		c.logger.Warnf("Warning: failed to get product icon: %s\n", err.Error())
+		return nil
+	}
+
+	if icon == nil {
+		c.logger.Debugf("Product has no icon - not writing %s\n", productIconFile)
+		return nil
+	}
+
+	productIconFilepath := filepath.Join(c.downloadDir, productIconFile)
+
+	c.logger.Debugf(
+		"Writing product icon to file: {url: %s, product_icon_filepath: %s}\n",
+		sanitizer.URL(iconURL),
+		productIconFilepath,
+	)
+
+	return ioutil.WriteFile(productIconFilepath, icon, os.ModePerm)
+}
+
+// dumpRawRelease writes the release and its product files, as returned by
+// Pivotal Network, to release_raw.json. Fields are kept whether or not they
+// are modelled, but download links are redacted.
+func (c InCommand) dumpRawRelease(client pivnet.Client, productSlug string, releaseID int) error {
+	c.logger.Debugf(
+		"Getting raw release: {product_slug: %s, release_id: %d}\n",
+		productSlug,
+		releaseID,
+	)
+
+	rawRelease, err := client.RawRelease(productSlug, releaseID)
+	if err != nil {
+		return err
+	}
+
+	rawProductFiles, err := client.RawReleaseProductFiles(productSlug, releaseID)
+	if err != nil {
+		return err
+	}
+
+	var dump struct {
+		Release      interface{} `json:"release"`
+		ProductFiles interface{} `json:"product_files"`
+	}
+
+	err = decodeRawJSON(rawRelease, &dump.Release)
+	if err != nil {
+		return err
+	}
+
+	var productFiles struct {
+		ProductFiles interface{} `json:"product_files"`
+	}
+	err = decodeRawJSON(rawProductFiles, &productFiles)
+	if err != nil {
+		return err
+	}
+	dump.ProductFiles = productFiles.ProductFiles
+
+	redactDownloadLinks(dump.Release)
+	redactDownloadLinks(dump.ProductFiles)
+
+	rawReleaseFilepath := filepath.Join(c.downloadDir, rawReleaseFile)
+
+	c.logger.Debugf(
+		"Writing raw release to file: {raw_release_filepath: %s}\n",
+		rawReleaseFilepath,
+	)
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(dump)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(rawReleaseFilepath, b.Bytes(), os.ModePerm)
+}
+
+// decodeRawJSON decodes numbers as json.Number so that they are written back
+// exactly as Pivotal Network returned them.
+func decodeRawJSON(raw json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// redactDownloadLinks replaces the href of every download link in the
+// decoded JSON, at any depth, with a placeholder.
+func redactDownloadLinks(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if links, ok := v["_links"].(map[string]interface{}); ok {
+			for name, link := range links {
+				link, ok := link.(map[string]interface{})
+				if ok && strings.Contains(name, "download") {
+					if _, ok := link["href"]; ok {
+						link["href"] = redactedDownloadLink
+					}
+				}
+			}
+		}
+
+		for _, value := range v {
+			redactDownloadLinks(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			redactDownloadLinks(value)
+		}
+	}
+}
+
+// imageReferencesYAML renders the image references as YAML. Values are
+// written as JSON strings, which are also valid YAML double-quoted scalars.
+func imageReferencesYAML(imageReferences []pivnet.ImageReference) []byte {
+	if len(imageReferences) == 0 {
+		return []byte("image_references: []\n")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("image_references:\n")
+	for _, r := range imageReferences {
+		fmt.Fprintf(&b, "- name: %s\n", yamlString(r.Name))
+		fmt.Fprintf(&b, "  repository: %s\n", yamlString(r.Repository()))
+		fmt.Fprintf(&b, "  tag: %s\n", yamlString(r.Tag()))
+		fmt.Fprintf(&b, "  digest: %s\n", yamlString(r.Digest))
+	}
+
+	return b.Bytes()
+}
+
+// formatMetadata renders the metadata as a mapping of names to values in the
+// format, which is one of yaml, json or env. The env format is a source-able
+// file of KEY='value' lines, with names uppercased and anything but letters
+// and digits replaced by underscores.
+func formatMetadata(metadata []concourse.Metadata, format string) []byte {
+	var b bytes.Buffer
+
+	switch format {
+	case metadataFormatJSON:
+		values := make(map[string]string, len(metadata))
+		for _, m := range metadata {
+			values[m.Name] = m.Value
+		}
+
+		j, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		b.Write(j)
+		b.WriteString("\n")
+	case metadataFormatYAML:
+		if len(metadata) == 0 {
+			return []byte("{}\n")
+		}
+
+		for _, m := range metadata {
+			fmt.Fprintf(&b, "%s: %s\n", yamlString(m.Name), yamlString(m.Value))
+		}
+	case metadataFormatEnv:
+		for _, m := range metadata {
+			fmt.Fprintf(&b, "%s=%s\n", envName(m.Name), shellQuote(m.Value))
+		}
+	}
+
+	return b.Bytes()
+}
+
+func envName(name string) string {
+	return strings.Trim(nonEnvNameCharacters.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func yamlString(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
+
+// destinationPath returns the path within the download directory, or an
+// error if the path would be outside of it.
+func destinationPath(downloadDir string, path string, param string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s must be relative to the destination - got %s", param, path)
+	}
+
+	fullPath := filepath.Join(downloadDir, path)
+
+	rel, err := filepath.Rel(downloadDir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s must be within the destination - got %s", param, path)
+	}
+
+	return fullPath, nil
+}
+
+// latestRelease returns the most recent release of the product, which
+// Pivotal Network lists first.
+func latestRelease(client pivnet.Client, productSlug string) (pivnet.Release, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return pivnet.Release{}, err
+	}
+
+	if len(releases) == 0 {
+		return pivnet.Release{}, fmt.Errorf("no releases found for product: %s", productSlug)
+	}
+
+	return releases[0], nil
+}
+
+// semverEquivalentRelease returns the newest release of the product whose
+// version has the same semver precedence as the version, e.g. 1.2.0 for 1.2.
+func semverEquivalentRelease(
+	client pivnet.Client,
+	productSlug string,
+	version string,
+) (pivnet.Release, bool, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return pivnet.Release{}, false, err
+	}
+
+	version = strings.TrimSpace(version)
+	for _, r := range releases {
+		if versions.EquivalentSemver(strings.TrimSpace(r.Version), version) {
+			return r, true, nil
+		}
+	}
+
+	return pivnet.Release{}, false, nil
+}
+
+// substituteRelease returns the release of the product to fetch in place of
+// the missing version with the on_missing_version strategy, and whether there
+// is one. The nearest strategies only consider semver versions, and find none
+// for a version that is not semver.
+func substituteRelease(
+	client pivnet.Client,
+	productSlug string,
+	version string,
+	strategy string,
+) (pivnet.Release, bool, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return pivnet.Release{}, false, err
+	}
+
+	if strategy == onMissingVersionLatest {
+		if len(releases) == 0 {
+			return pivnet.Release{}, false, nil
+		}
+		return releases[0], true, nil
+	}
+
+	version = strings.TrimSpace(version)
+	if !versions.IsSemver(version) {
+		return pivnet.Release{}, false, nil
+	}
+
+	var nearest pivnet.Release
+	found := false
+	for _, r := range releases {
+		v := strings.TrimSpace(r.Version)
+		if !versions.IsSemver(v) {
+			continue
+		}
+
+		comparison := versions.CompareSemver(v, version)
+		switch {
+		case strategy == onMissingVersionNearestNewer && comparison > 0:
+			if !found || versions.CompareSemver(v, strings.TrimSpace(nearest.Version)) < 0 {
+				nearest, found = r, true
+			}
+		case strategy == onMissingVersionNearestOlder && comparison < 0:
+			if !found || versions.CompareSemver(v, strings.TrimSpace(nearest.Version)) > 0 {
+				nearest, found = r, true
+			}
+		}
+	}
+
+	return nearest, found, nil
+}
+
+// releaseForVersion returns the release of the product with the version,
+// picking between releases that share the version with the same
+// duplicate_version_strategy as check, so the release checked is the one
+// downloaded.
+func releaseForVersion(
+	client pivnet.Client,
+	productSlug string,
+	version string,
+	strategy string,
+) (pivnet.Release, error) {
+	releases, err := client.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return pivnet.Release{}, err
+	}
+
+	var matching []pivnet.Release
+	for _, r := range releases {
+		if strings.TrimSpace(r.Version) == strings.TrimSpace(version) {
+			matching = append(matching, r)
+		}
+	}
+
+	if len(matching) == 0 {
+		return pivnet.Release{}, pivnet.ErrNotFound{ResponseError: pivnet.ResponseError{
+			Message: fmt.Sprintf("The requested version: %s - could not be found", version),
+		}}
+	}
+
+	if len(matching) > 1 && strategy == concourse.DuplicateVersionStrategyFail {
+		return pivnet.Release{}, fmt.Errorf(
+			"product %s has more than one release with version %s (%s is %s)",
+			productSlug,
+			version,
+			"duplicate_version_strategy",
+			concourse.DuplicateVersionStrategyFail,
+		)
+	}
+
+	picked := matching[0]
+	for _, r := range matching[1:] {
+		switch strategy {
+		case concourse.DuplicateVersionStrategyNewest:
+			if r.NewerThan(picked) {
+				picked = r
+			}
+		case concourse.DuplicateVersionStrategyOldest:
+			if picked.NewerThan(r) {
+				picked = r
+			}
+		}
+	}
+
+	return picked, nil
+}
+
+// reservedFiles returns the paths, relative to the download directory, of the
+// files the resource writes besides the downloaded files, including the
+// version and metadata files at their configured paths. Every file written
+// to the download directory must be listed here so that no downloaded file
+// is renamed over it.
+func (c InCommand) reservedFiles(versionFilepath string, metadataFilepath string) ([]string, error) {
+	reserved := []string{
+		versionFile,
+		releaseIDFile,
+		pulledArtifactsFile,
+		releasesManifestFile,
+		deltaManifestFile,
+		packageTarFile,
+		packageTgzFile,
+		releaseNotesFile,
+		productIconFile,
+		rawReleaseFile,
+		imageReferencesFile,
+		oslDir,
+		"metadata." + metadataFormatYAML,
+		"metadata." + metadataFormatJSON,
+		"metadata." + metadataFormatEnv,
+	}
+
+	for _, path := range []string{versionFilepath, metadataFilepath} {
+		if path == "" {
+			continue
+		}
+
+		rel, err := filepath.Rel(c.downloadDir, path)
+		if err != nil {
+			return nil, err
+		}
+		reserved = append(reserved, rel)
+	}
+
+	return reserved, nil
+}
+
+// renameDownloads re-keys the download links, MD5s, sizes and IDs by the names
+// rendered from the filename template, so files are written under their
+// new names. It returns an error if a name is one of the reserved files.
+func renameDownloads(
+	template filename.Template,
+	reserved []string,
+	productSlug string,
+	productVersion string,
+	downloadLinks map[string]string,
+	md5s map[string]string,
+	sizes map[string]int64,
+	ids map[string]int,
+) (map[string]string, map[string]string, map[string]int64, map[string]int, error) {
+	var names []string
+	for name := range downloadLinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	renamed, err := filename.Rename(template, productSlug, productVersion, names)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	renamedLinks := map[string]string{}
+	renamedMD5s := map[string]string{}
+	renamedSizes := map[string]int64{}
+	renamedIDs := map[string]int{}
+	for _, name := range names {
+		newName := renamed[name]
+		if contains(reserved, newName) {
+			return nil, nil, nil, nil, fmt.Errorf(
+				"filename template renders %s as %s, which is reserved by the resource",
+				name,
+				newName,
+			)
+		}
+
+		renamedLinks[newName] = downloadLinks[name]
+		renamedMD5s[newName] = md5s[name]
+		renamedSizes[newName] = sizes[name]
+		renamedIDs[newName] = ids[name]
+	}
+
+	return renamedLinks, renamedMD5s, renamedSizes, renamedIDs, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
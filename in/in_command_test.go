@@ -1,20 +1,31 @@
 package in_test
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
 	"github.com/pivotal-cf-experimental/pivnet-resource/in"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
 	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
 var _ = Describe("In", func() {
@@ -27,6 +38,9 @@ var _ = Describe("In", func() {
 		ginkgoLogger logger.Logger
 
 		productVersion string
+		releaseID      int
+
+		pivnetReleasesResponse pivnet.Response
 
 		inRequest concourse.InRequest
 		inCommand *in.InCommand
@@ -36,17 +50,18 @@ var _ = Describe("In", func() {
 		server = ghttp.NewServer()
 
 		productVersion = "C"
-		releaseID := 1234
+		releaseID = 1234
 		file1URLPath := "/file1"
 		file1URL := fmt.Sprintf("%s%s", server.URL(), file1URLPath)
 		file1Contents = ""
 
-		pivnetReleasesResponse := pivnet.Response{
+		pivnetReleasesResponse = pivnet.Response{
 			Releases: []pivnet.Release{
 				{Version: "A"},
 				{
 					Version: productVersion,
 					ID:      releaseID,
+					Eula:    &pivnet.Eula{Slug: "some-eula"},
 					Links: &pivnet.Links{
 						ProductFiles: map[string]string{
 							"href": file1URL,
@@ -103,7 +118,7 @@ var _ = Describe("In", func() {
 				Endpoint:    server.URL(),
 			},
 			Version: concourse.Version{
-				productVersion,
+				ProductVersion: productVersion,
 			},
 		}
 
@@ -113,7 +128,7 @@ var _ = Describe("In", func() {
 		ginkgoLogger = logger.NewLogger(sanitizer)
 
 		binaryVersion := "v0.1.2"
-		inCommand = in.NewInCommand(binaryVersion, ginkgoLogger, downloadDir)
+		inCommand = in.NewInCommand(context.Background(), binaryVersion, ginkgoLogger, downloadDir)
 	})
 
 	AfterEach(func() {
@@ -133,6 +148,120 @@ var _ = Describe("In", func() {
 		Expect(string(versionContents)).To(Equal(productVersion))
 	})
 
+	It("creates a release_id file with the ID of the downloaded release", func() {
+		_, err := inCommand.Run(inRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		releaseIDFilepath := filepath.Join(downloadDir, "release_id")
+		releaseIDContents, err := ioutil.ReadFile(releaseIDFilepath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(releaseIDContents)).To(Equal(strconv.Itoa(releaseID)))
+	})
+
+	It("includes the release ID in the metadata", func() {
+		response, err := inCommand.Run(inRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+			Name:  "release_id",
+			Value: strconv.Itoa(releaseID),
+		}))
+	})
+
+	It("includes the EULA of the release in the metadata", func() {
+		response, err := inCommand.Run(inRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "eula_required", Value: "true"}))
+		Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "eula_slug", Value: "some-eula"}))
+	})
+
+	It("does not get the file groups of the release", func() {
+		response, err := inCommand.Run(inRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, m := range response.Metadata {
+			Expect(m.Name).NotTo(Equal("file_groups"))
+		}
+	})
+
+	Context("when file_groups_metadata is true", func() {
+		BeforeEach(func() {
+			inRequest.Params.FileGroupsMetadata = true
+
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/file_groups", apiPrefix, productSlug, releaseID),
+				ghttp.RespondWith(http.StatusOK, `{}`),
+			)
+		})
+
+		It("includes empty file groups in the metadata when the release has none", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "file_groups", Value: "{}"}))
+		})
+
+		Context("when the release has file groups", func() {
+			BeforeEach(func() {
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d/file_groups", apiPrefix, productSlug, releaseID),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.FileGroupsResponse{
+						FileGroups: []pivnet.FileGroup{
+							{
+								Name: "tiles",
+								ProductFiles: []pivnet.ProductFile{
+									{ID: 2, Name: "Some Tile", AWSObjectKey: "product_files/banana/tile-b.pivotal"},
+									{ID: 1, Name: "Other Tile", AWSObjectKey: "product_files/banana/tile-a.pivotal"},
+								},
+							},
+							{Name: "docs"},
+						},
+					}),
+				)
+
+				inRequest.Params.MetadataFile = "metadata.json"
+			})
+
+			It("includes the file names of each group in the metadata and the metadata file", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				fileGroups := concourse.Metadata{
+					Name:  "file_groups",
+					Value: `{"docs":[],"tiles":["tile-a.pivotal","tile-b.pivotal"]}`,
+				}
+				Expect(response.Metadata).To(ContainElement(fileGroups))
+
+				b, err := ioutil.ReadFile(filepath.Join(downloadDir, "metadata.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var metadata []concourse.Metadata
+				err = json.Unmarshal(b, &metadata)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metadata).To(ContainElement(fileGroups))
+			})
+		})
+
+		Context("when getting the file groups fails", func() {
+			BeforeEach(func() {
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d/file_groups", apiPrefix, productSlug, releaseID),
+					ghttp.RespondWith(http.StatusTeapot, `{"message":"nope"}`),
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Failed to get File Groups"))
+			})
+		})
+	})
+
 	It("does not download any of the files in the specified release", func() {
 		_, err := inCommand.Run(inRequest)
 		Expect(err).NotTo(HaveOccurred())
@@ -140,9 +269,2784 @@ var _ = Describe("In", func() {
 		files, err := ioutil.ReadDir(downloadDir)
 		Expect(err).ShouldNot(HaveOccurred())
 
-		// the version file will always exist
-		Expect(len(files)).To(Equal(1))
-		Expect(files[0].Name()).To(Equal("version"))
+		// the release_id and version files will always exist
+		Expect(len(files)).To(Equal(2))
+		Expect(files[0].Name()).To(Equal("release_id"))
+		Expect(files[1].Name()).To(Equal("version"))
+	})
+
+	Context("when globs are provided", func() {
+		var (
+			productFileID       int
+			downloadFileName    string
+			downloadFileContent string
+			productFileResponse pivnet.ProductFile
+		)
+
+		BeforeEach(func() {
+			productFileID = 5678
+			downloadFileName = "file-to-download.zip"
+			downloadFileContent = "some file contents"
+
+			productFileResponse = pivnet.ProductFile{
+				ID:           productFileID,
+				AWSObjectKey: "product_files/banana/" + downloadFileName,
+				FileType:     "Software",
+				MD5:          fmt.Sprintf("%x", md5.Sum([]byte(downloadFileContent))),
+				Links: &pivnet.Links{
+					Download: map[string]string{
+						"href": server.URL() + "/download",
+					},
+				},
+			}
+
+			server.Reset()
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"POST",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/eula_acceptance",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						),
+					),
+					ghttp.RespondWith(http.StatusOK, ""),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+						ProductFiles: []pivnet.ProductFile{productFileResponse},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/product_files/%d",
+							apiPrefix,
+							productSlug,
+							releaseID,
+							productFileID,
+						),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: productFileResponse,
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/download"),
+					ghttp.RespondWith(http.StatusOK, downloadFileContent),
+				),
+			)
+
+			inRequest.Params.Globs = []string{"*.zip"}
+		})
+
+		It("downloads the matching files", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(downloadFileContent))
+		})
+
+		Context("when downloading the files fails", func() {
+			BeforeEach(func() {
+				server.SetHandler(4, ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/download"),
+					ghttp.RespondWith(http.StatusForbidden, ""),
+				))
+			})
+
+			It("returns an error rather than exiting", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Failed to Download Files"))
+				Expect(err.Error()).To(ContainSubstring("skip_forbidden_files"))
+			})
+		})
+
+		Context("when skip_existing is true", func() {
+			BeforeEach(func() {
+				inRequest.Params.SkipExisting = true
+			})
+
+			Context("when the file already exists with the same MD5", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(filepath.Join(downloadDir, downloadFileName), []byte(downloadFileContent), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("does not download it again", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, r := range server.ReceivedRequests() {
+						Expect(r.URL.Path).NotTo(Equal("/download"))
+					}
+				})
+			})
+
+			Context("when the file already exists with a different MD5", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(filepath.Join(downloadDir, downloadFileName), []byte("stale contents"), os.ModePerm)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("downloads it again", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+				})
+			})
+		})
+
+		Context("when select is latest", func() {
+			var olderFileResponse pivnet.ProductFile
+
+			BeforeEach(func() {
+				productFileResponse.AWSObjectKey = "product_files/banana/file-to-download-2.10.zip"
+				olderFileResponse = pivnet.ProductFile{
+					ID:           1111,
+					AWSObjectKey: "product_files/banana/file-to-download-2.9.zip",
+					FileType:     "Software",
+					MD5:          productFileResponse.MD5,
+					Links: &pivnet.Links{
+						Download: map[string]string{
+							"href": server.URL() + "/older-download",
+						},
+					},
+				}
+
+				server.SetHandler(2, ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+						ProductFiles: []pivnet.ProductFile{olderFileResponse, productFileResponse},
+					}),
+				))
+				server.SetHandler(3, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, releaseID, 1111),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: olderFileResponse,
+					}),
+				))
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, releaseID, productFileID),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: productFileResponse,
+					}),
+				)
+
+				inRequest.Params.Select = "latest"
+			})
+
+			It("downloads only the matching file with the highest version", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "file-to-download-2.10.zip"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+
+				_, err = os.Stat(filepath.Join(downloadDir, "file-to-download-2.9.zip"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			Context("when select is unknown", func() {
+				BeforeEach(func() {
+					inRequest.Params.Select = "newest"
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError("select must be latest if provided - got newest"))
+				})
+			})
+
+			Context("when select_version_regexp is invalid", func() {
+				BeforeEach(func() {
+					inRequest.Params.SelectVersionRegexp = "("
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(HavePrefix("select_version_regexp must be a valid regular expression - got (:")))
+				})
+			})
+
+			Context("when globs are not provided", func() {
+				BeforeEach(func() {
+					inRequest.Params.Globs = nil
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError("globs must be provided with select"))
+				})
+			})
+		})
+
+		Context("when delta_from is provided", func() {
+			var (
+				previousReleaseID    int
+				previousFileResponse pivnet.ProductFile
+				removedFileResponse  pivnet.ProductFile
+			)
+
+			readDeltaManifest := func() map[string]interface{} {
+				b, err := ioutil.ReadFile(filepath.Join(downloadDir, "delta.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var manifest map[string]interface{}
+				err = json.Unmarshal(b, &manifest)
+				Expect(err).NotTo(HaveOccurred())
+
+				return manifest
+			}
+
+			BeforeEach(func() {
+				previousReleaseID = 999
+
+				previousFileResponse = productFileResponse
+				removedFileResponse = pivnet.ProductFile{
+					ID:           4321,
+					AWSObjectKey: "product_files/banana/removed-file.zip",
+					FileType:     "Software",
+					MD5:          "removed-md5",
+				}
+
+				inRequest.Params.DeltaFrom = "B"
+
+				productFilePath := func(releaseID int, productFileID int) string {
+					return fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, releaseID, productFileID)
+				}
+
+				server.Reset()
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.Response{
+						Releases: []pivnet.Release{
+							pivnetReleasesResponse.Releases[1],
+							{
+								Version: "B",
+								ID:      previousReleaseID,
+								Links: &pivnet.Links{
+									ProductFiles: map[string]string{
+										"href": server.URL() + "/file0",
+									},
+								},
+							},
+						},
+					}),
+				)
+				server.RouteToHandler(
+					"POST",
+					fmt.Sprintf("%s/products/%s/releases/%d/eula_acceptance", apiPrefix, productSlug, releaseID),
+					ghttp.RespondWith(http.StatusOK, ""),
+				)
+				server.RouteToHandler("GET", "/file1", ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+					ProductFiles: []pivnet.ProductFile{productFileResponse},
+				}))
+				server.RouteToHandler("GET", productFilePath(releaseID, productFileID), ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: productFileResponse,
+				}))
+				server.RouteToHandler("GET", "/file0", ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+					ProductFiles: []pivnet.ProductFile{previousFileResponse, removedFileResponse},
+				}))
+				// Encoded when requested, as contexts change the previous file.
+				server.RouteToHandler(
+					"GET",
+					productFilePath(previousReleaseID, productFileID),
+					func(w http.ResponseWriter, r *http.Request) {
+						ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+							ProductFile: previousFileResponse,
+						})(w, r)
+					},
+				)
+				server.RouteToHandler("GET", productFilePath(previousReleaseID, removedFileResponse.ID), ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: removedFileResponse,
+				}))
+				server.RouteToHandler("POST", "/download", ghttp.RespondWith(http.StatusOK, downloadFileContent))
+			})
+
+			Context("when a file is unchanged since the release", func() {
+				It("does not download it", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, r := range server.ReceivedRequests() {
+						Expect(r.URL.Path).NotTo(Equal("/download"))
+					}
+				})
+
+				It("writes the unchanged and removed files to the delta manifest", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(readDeltaManifest()).To(Equal(map[string]interface{}{
+						"from":      "B",
+						"changed":   []interface{}{},
+						"unchanged": []interface{}{downloadFileName},
+						"removed":   []interface{}{"removed-file.zip"},
+					}))
+				})
+
+				It("emits the delta in metadata", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "delta_from", Value: "B"}))
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "delta_changed", Value: "0"}))
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "delta_unchanged", Value: "1"}))
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "delta_removed", Value: "1"}))
+				})
+			})
+
+			Context("when the MD5 of a file differs from that of the release", func() {
+				BeforeEach(func() {
+					previousFileResponse.MD5 = "previous-md5"
+				})
+
+				It("downloads it and writes it to the delta manifest as changed", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+
+					manifest := readDeltaManifest()
+					Expect(manifest["changed"]).To(Equal([]interface{}{downloadFileName}))
+					Expect(manifest["unchanged"]).To(BeEmpty())
+				})
+			})
+
+			Context("when the release does not exist", func() {
+				BeforeEach(func() {
+					inRequest.Params.DeltaFrom = "Z"
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(HavePrefix("Failed to get Release Z of delta_from:")))
+				})
+			})
+
+			Context("when last_n is provided", func() {
+				BeforeEach(func() {
+					inRequest.Params.LastN = 2
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError("last_n may not be provided with delta_from"))
+				})
+			})
+		})
+
+		It("emits the total and per-file download sizes in metadata", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			size := len(downloadFileContent)
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+				Name:  "total_download_size_bytes",
+				Value: fmt.Sprintf("%d", size),
+			}))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+				Name:  "total_download_size",
+				Value: fmt.Sprintf("%d B", size),
+			}))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+				Name:  "file_size: " + downloadFileName,
+				Value: fmt.Sprintf("%d (%d B)", size, size),
+			}))
+		})
+
+		Context("when mirror_base_url is provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.MirrorBaseURL = server.URL() + "/mirror/"
+
+				server.RouteToHandler(
+					"GET",
+					"/mirror/product_files/banana/"+downloadFileName,
+					ghttp.RespondWith(http.StatusOK, downloadFileContent),
+				)
+			})
+
+			It("downloads the files from the mirror by their AWS object key", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.URL.Path).NotTo(Equal("/download"))
+				}
+			})
+
+			Context("when the mirror does not have a file", func() {
+				BeforeEach(func() {
+					server.RouteToHandler(
+						"GET",
+						"/mirror/product_files/banana/"+downloadFileName,
+						ghttp.RespondWith(http.StatusNotFound, nil),
+					)
+				})
+
+				It("downloads it from Pivotal Network", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+				})
+			})
+
+			Context("when mirror_base_url is not an http or https URL", func() {
+				BeforeEach(func() {
+					inRequest.Params.MirrorBaseURL = "ftp://mirror.example.com"
+				})
+
+				It("returns an error without contacting Pivotal Network", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError("mirror_base_url must be an http or https URL - got ftp://mirror.example.com"))
+
+					Expect(server.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+		})
+
+		It("does not emit labels for files without them", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, m := range response.Metadata {
+				Expect(m.Name).NotTo(HavePrefix("file_labels: "))
+			}
+		})
+
+		Context("when the description of a file has labels", func() {
+			BeforeEach(func() {
+				productFileResponse.Description = labels.RenderFileLabels([]string{"linux", "amd64"}, "some description")
+
+				server.SetHandler(3, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/product_files/%d",
+							apiPrefix,
+							productSlug,
+							releaseID,
+							productFileID,
+						),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: productFileResponse,
+					}),
+				))
+			})
+
+			It("emits the labels of the file in metadata", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "file_labels: " + downloadFileName,
+					Value: "linux, amd64",
+				}))
+			})
+		})
+
+		Context("when the download backend is pivnet", func() {
+			BeforeEach(func() {
+				inRequest.Params.DownloadBackend = "pivnet"
+
+				header := http.Header{}
+				header.Add("Location", server.URL()+"/storage/"+downloadFileName)
+
+				server.SetHandler(4, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"POST",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/product_files/%d/download",
+							apiPrefix,
+							productSlug,
+							releaseID,
+							productFileID,
+						),
+					),
+					ghttp.VerifyHeaderKV("Authorization", "Token some-api-token"),
+					ghttp.RespondWith(http.StatusFound, nil, header),
+				))
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/storage/"+downloadFileName),
+						ghttp.RespondWith(http.StatusOK, downloadFileContent),
+					),
+				)
+			})
+
+			It("downloads from the download endpoint of the Pivotal Network API", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+			})
+		})
+
+		Context("when package_as is tgz", func() {
+			BeforeEach(func() {
+				inRequest.Params.PackageAs = "tgz"
+				inRequest.Params.MetadataFile = "metadata.json"
+			})
+
+			readPackage := func() map[string]string {
+				f, err := os.Open(filepath.Join(downloadDir, "release.tgz"))
+				Expect(err).NotTo(HaveOccurred())
+				defer f.Close()
+
+				gr, err := gzip.NewReader(f)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents := map[string]string{}
+				tr := tar.NewReader(gr)
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					Expect(err).NotTo(HaveOccurred())
+
+					b, err := ioutil.ReadAll(tr)
+					Expect(err).NotTo(HaveOccurred())
+					contents[header.Name] = string(b)
+				}
+
+				return contents
+			}
+
+			It("packages the files, checksums and metadata into release.tgz", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents := readPackage()
+				Expect(contents).To(HaveLen(3))
+				Expect(contents[downloadFileName]).To(Equal(downloadFileContent))
+				Expect(contents["pulled_artifacts.json"]).To(ContainSubstring(
+					fmt.Sprintf("%x", sha256.Sum256([]byte(downloadFileContent)))))
+				Expect(contents).To(HaveKey("metadata.json"))
+
+				_, err = os.Stat(filepath.Join(downloadDir, downloadFileName))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			Context("when remove_packaged_files is true", func() {
+				BeforeEach(func() {
+					inRequest.Params.RemovePackagedFiles = true
+				})
+
+				It("removes the downloaded files from the destination", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(readPackage()).To(HaveKey(downloadFileName))
+
+					_, err = os.Stat(filepath.Join(downloadDir, downloadFileName))
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+			})
+		})
+
+		Context("when package_as is unknown", func() {
+			BeforeEach(func() {
+				inRequest.Params.PackageAs = "zip"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("package_as must be one of tar or tgz - got zip"))
+			})
+		})
+
+		Context("when remove_packaged_files is true without package_as", func() {
+			BeforeEach(func() {
+				inRequest.Params.RemovePackagedFiles = true
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("package_as must be provided with remove_packaged_files"))
+			})
+		})
+
+		It("records the downloaded files in pulled_artifacts.json", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(filepath.Join(downloadDir, "pulled_artifacts.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var pulledArtifacts struct {
+				Artifacts []map[string]interface{} `json:"artifacts"`
+			}
+			err = json.Unmarshal(b, &pulledArtifacts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pulledArtifacts.Artifacts).To(Equal([]map[string]interface{}{
+				{
+					"name":            downloadFileName,
+					"path":            downloadFileName,
+					"md5":             fmt.Sprintf("%x", md5.Sum([]byte(downloadFileContent))),
+					"sha256":          fmt.Sprintf("%x", sha256.Sum256([]byte(downloadFileContent))),
+					"size":            float64(len(downloadFileContent)),
+					"pivnet_file_id":  float64(productFileID),
+					"product_slug":    productSlug,
+					"release_version": productVersion,
+				},
+			}))
+		})
+
+		Context("when the product file has no download link yet", func() {
+			BeforeEach(func() {
+				unprocessed := productFileResponse
+				unprocessed.Links = nil
+
+				server.SetHandler(2, ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+						ProductFiles: []pivnet.ProductFile{unprocessed},
+					}),
+				))
+			})
+
+			It("returns an error naming the file", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(fmt.Sprintf(
+					"file not yet available for download: %s of release %s of product %s - it may still be processing, set wait_for_file_processing to wait for it",
+					downloadFileName,
+					productVersion,
+					productSlug,
+				)))
+			})
+
+			Context("when wait_for_file_processing is true", func() {
+				BeforeEach(func() {
+					inRequest.Params.WaitForFileProcessing = true
+
+					downloadHandler := server.GetHandler(4)
+					server.SetHandler(4, ghttp.CombineHandlers(
+						ghttp.VerifyRequest(
+							"GET",
+							fmt.Sprintf(
+								"%s/products/%s/releases/%d/product_files/%d",
+								apiPrefix,
+								productSlug,
+								releaseID,
+								productFileID,
+							),
+						),
+						ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+							ProductFile: productFileResponse,
+						}),
+					))
+					server.AppendHandlers(downloadHandler)
+				})
+
+				It("waits for the download link before downloading the file", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+				})
+			})
+		})
+
+		Context("when file_processing_timeout_seconds is provided without wait_for_file_processing", func() {
+			BeforeEach(func() {
+				inRequest.Params.FileProcessingTimeoutSeconds = 60
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(
+					"file_processing_timeout_seconds may only be provided when wait_for_file_processing is true",
+				))
+			})
+		})
+
+		Context("when two product files share a file name", func() {
+			var (
+				otherProductFileID       int
+				otherDownloadFileContent string
+				otherFileType            string
+			)
+
+			BeforeEach(func() {
+				otherProductFileID = 5679
+				otherDownloadFileContent = "other file contents"
+				otherFileType = "Software"
+			})
+
+			JustBeforeEach(func() {
+
+				otherProductFileResponse := pivnet.ProductFile{
+					ID:           otherProductFileID,
+					AWSObjectKey: "product_files/apple/" + downloadFileName,
+					FileType:     otherFileType,
+					MD5:          fmt.Sprintf("%x", md5.Sum([]byte(otherDownloadFileContent))),
+					Links: &pivnet.Links{
+						Download: map[string]string{
+							"href": server.URL() + "/download2",
+						},
+					},
+				}
+
+				server.SetHandler(2, ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+						ProductFiles: []pivnet.ProductFile{
+							{
+								ID:           productFileID,
+								AWSObjectKey: "product_files/banana/" + downloadFileName,
+								Links: &pivnet.Links{
+									Download: map[string]string{"href": server.URL() + "/download"},
+								},
+							},
+							otherProductFileResponse,
+						},
+					}),
+				))
+				server.SetHandler(4, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/product_files/%d",
+							apiPrefix,
+							productSlug,
+							releaseID,
+							otherProductFileID,
+						),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: otherProductFileResponse,
+					}),
+				))
+
+				// Downloads are routed as the order they are made in is not
+				// fixed.
+				server.RouteToHandler("POST", "/download", ghttp.RespondWith(http.StatusOK, downloadFileContent))
+				server.RouteToHandler("POST", "/download2", ghttp.RespondWith(http.StatusOK, otherDownloadFileContent))
+			})
+
+			Context("when on_collision is fail", func() {
+				BeforeEach(func() {
+					inRequest.Params.OnCollision = "fail"
+				})
+
+				It("returns an error naming the product files", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(fmt.Sprintf(
+						"product files %d, %d share the name %s (on_collision is fail)",
+						productFileID,
+						otherProductFileID,
+						downloadFileName,
+					)))
+				})
+			})
+
+			Context("when on_collision is suffix", func() {
+				BeforeEach(func() {
+					inRequest.Params.OnCollision = "suffix"
+				})
+
+				It("downloads each file with its product file id appended to its name", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "file-to-download-5678.zip"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+
+					contents, err = ioutil.ReadFile(filepath.Join(downloadDir, "file-to-download-5679.zip"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(otherDownloadFileContent))
+				})
+
+				Context("when file_types selects only one of the files", func() {
+					BeforeEach(func() {
+						otherFileType = "Documentation"
+						inRequest.Params.FileTypes = []string{"Documentation"}
+					})
+
+					It("downloads only the selected file, under its own name", func() {
+						_, err := inCommand.Run(inRequest)
+						Expect(err).NotTo(HaveOccurred())
+
+						contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(contents)).To(Equal(otherDownloadFileContent))
+
+						_, err = os.Stat(filepath.Join(downloadDir, "file-to-download-5678.zip"))
+						Expect(os.IsNotExist(err)).To(BeTrue())
+
+						for _, r := range server.ReceivedRequests() {
+							Expect(r.URL.Path).NotTo(Equal("/download"))
+						}
+					})
+				})
+			})
+
+			Context("when on_collision is subdir", func() {
+				BeforeEach(func() {
+					inRequest.Params.OnCollision = "subdir"
+				})
+
+				It("downloads each file to a directory named after its product file id", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "5678", downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+
+					contents, err = ioutil.ReadFile(filepath.Join(downloadDir, "5679", downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(otherDownloadFileContent))
+				})
+			})
+		})
+
+		Context("when on_collision is not supported", func() {
+			BeforeEach(func() {
+				inRequest.Params.OnCollision = "replace"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("on_collision must be one of fail, suffix or subdir - got replace"))
+			})
+		})
+
+		Context("when the product file has platforms, included files and a release date", func() {
+			BeforeEach(func() {
+				server.SetHandler(3, ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: pivnet.ProductFile{
+						ID:            productFileID,
+						AWSObjectKey:  "product_files/banana/" + downloadFileName,
+						MD5:           fmt.Sprintf("%x", md5.Sum([]byte(downloadFileContent))),
+						Platforms:     []string{"Linux", "Windows"},
+						IncludedFiles: []string{"bin/banana", "README"},
+						ReleasedAt:    "2016-01-02",
+					},
+				}))
+			})
+
+			It("records them in pulled_artifacts.json", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(filepath.Join(downloadDir, "pulled_artifacts.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var pulledArtifacts struct {
+					Artifacts []map[string]interface{} `json:"artifacts"`
+				}
+				err = json.Unmarshal(b, &pulledArtifacts)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(pulledArtifacts.Artifacts).To(HaveLen(1))
+				Expect(pulledArtifacts.Artifacts[0]).To(HaveKeyWithValue(
+					"platforms", []interface{}{"Linux", "Windows"}))
+				Expect(pulledArtifacts.Artifacts[0]).To(HaveKeyWithValue(
+					"included_files", []interface{}{"bin/banana", "README"}))
+				Expect(pulledArtifacts.Artifacts[0]).To(HaveKeyWithValue(
+					"released_at", "2016-01-02"))
+			})
+		})
+
+		Context("when a digest is provided", func() {
+			var (
+				digest             string
+				artifactReferences string
+			)
+
+			BeforeEach(func() {
+				digest = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(downloadFileContent)))
+				artifactReferences = fmt.Sprintf(
+					`{"artifact_references": [{"id": 1, "name": "some-artifact", "artifact_path": "registry.example.com/some-artifact", "digest": "%s"}]}`,
+					digest,
+				)
+
+				inRequest.Params.Globs = nil
+				inRequest.Params.Digest = digest
+
+				server.SetHandler(3, ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: pivnet.ProductFile{
+						ID:           productFileID,
+						AWSObjectKey: "product_files/banana/" + downloadFileName,
+						MD5:          fmt.Sprintf("%x", md5.Sum([]byte(downloadFileContent))),
+						SHA256:       strings.TrimPrefix(digest, "sha256:"),
+						Links: &pivnet.Links{
+							Download: map[string]string{
+								"href": server.URL() + "/download",
+							},
+						},
+					},
+				}))
+			})
+
+			JustBeforeEach(func() {
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d/artifact_references", apiPrefix, productSlug, releaseID),
+					ghttp.RespondWith(http.StatusOK, artifactReferences),
+				)
+			})
+
+			It("downloads the file with the digest and records the matching artifact references", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "digest",
+					Value: digest,
+				}))
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "artifact_reference: some-artifact",
+					Value: "registry.example.com/some-artifact",
+				}))
+			})
+
+			Context("when only an artifact reference has the digest", func() {
+				BeforeEach(func() {
+					inRequest.Params.Digest = "sha256:" + strings.Repeat("0", 64)
+					inRequest.Params.WarningsMetadata = true
+					artifactReferences = fmt.Sprintf(
+						`{"artifact_references": [{"id": 1, "name": "some-artifact", "artifact_path": "registry.example.com/some-artifact", "digest": "%s"}]}`,
+						inRequest.Params.Digest,
+					)
+				})
+
+				It("records the artifact reference and warns that no file was downloaded", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = os.Stat(filepath.Join(downloadDir, downloadFileName))
+					Expect(os.IsNotExist(err)).To(BeTrue())
+
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+						Name:  "artifact_reference: some-artifact",
+						Value: "registry.example.com/some-artifact",
+					}))
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+						Name: "warnings",
+						Value: fmt.Sprintf(
+							"no file of release %s of product %s has digest sha256:%s - only artifact references have it, which are not downloaded",
+							productVersion,
+							productSlug,
+							strings.Repeat("0", 64),
+						),
+					}))
+				})
+			})
+
+			Context("when neither a file nor an artifact reference has the digest", func() {
+				BeforeEach(func() {
+					inRequest.Params.Digest = "sha256:" + strings.Repeat("0", 64)
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(fmt.Sprintf(
+						"no file or artifact reference of release %s of product %s has digest sha256:%s",
+						productVersion,
+						productSlug,
+						strings.Repeat("0", 64),
+					)))
+				})
+			})
+
+			Context("when the digest is not a sha256 digest", func() {
+				BeforeEach(func() {
+					inRequest.Params.Digest = "md5:abc"
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(
+						"digest must be of the form sha256:<64 lowercase hex characters> - got md5:abc"))
+				})
+			})
+
+			Context("when globs are also provided", func() {
+				BeforeEach(func() {
+					inRequest.Params.Globs = []string{"*.zip"}
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError("globs may not be provided with digest"))
+				})
+			})
+		})
+
+		Context("when download_osl is true", func() {
+			BeforeEach(func() {
+				inRequest.Params.Globs = nil
+				inRequest.Params.DownloadOSL = true
+			})
+
+			Context("when the release has no open source license file", func() {
+				It("notes its absence in metadata without failing", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response.Metadata).To(ContainElement(
+						concourse.Metadata{Name: "osl_files", Value: "none"}))
+
+					_, err = os.Stat(filepath.Join(downloadDir, "osl"))
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+
+				It("logs a warning", func() {
+					inRequest.Params.WarningsMetadata = true
+
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+						Name: "warnings",
+						Value: fmt.Sprintf(
+							"no open source license file found: {product_slug: %s, release_id: %d}",
+							productSlug,
+							releaseID,
+						),
+					}))
+				})
+			})
+
+			Context("when osl_glob matches a file", func() {
+				BeforeEach(func() {
+					inRequest.Params.OSLGlob = "*.zip"
+				})
+
+				It("downloads it to the osl directory and notes it in metadata", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "osl", downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+
+					Expect(response.Metadata).To(ContainElement(
+						concourse.Metadata{Name: "osl_files", Value: downloadFileName}))
+				})
+			})
+		})
+
+		Context("when osl_glob is provided without download_osl", func() {
+			BeforeEach(func() {
+				inRequest.Params.OSLGlob = "*.txt"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("osl_glob may only be provided when download_osl is true"))
+			})
+		})
+
+		Context("when the download backend is not supported", func() {
+			BeforeEach(func() {
+				inRequest.Params.DownloadBackend = "ftp"
+			})
+
+			It("returns an error without contacting Pivotal Network", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("download_backend must be one of s3 or pivnet - got ftp"))
+
+				Expect(len(server.ReceivedRequests())).To(Equal(0))
+			})
+		})
+
+		Context("when file types are provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.FileTypes = []string{"Documentation"}
+			})
+
+			It("only downloads matching files of those types", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(downloadDir, downloadFileName))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			Context("when no globs are provided", func() {
+				BeforeEach(func() {
+					inRequest.Params.Globs = nil
+					inRequest.Params.FileTypes = []string{"Software"}
+				})
+
+				It("downloads every file of those types", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal(downloadFileContent))
+				})
+			})
+
+			Context("when a file type is unknown", func() {
+				BeforeEach(func() {
+					inRequest.Params.FileTypes = []string{"Binaries"}
+				})
+
+				It("returns an error without contacting Pivotal Network", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(ContainSubstring("unknown file type: Binaries")))
+
+					Expect(server.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when filename_template is provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.FilenameTemplate = "{product}-{version}-{name}"
+			})
+
+			It("writes the files under the rendered names", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				renamedFileName := fmt.Sprintf("%s-%s-%s", productSlug, productVersion, downloadFileName)
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, renamedFileName))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+
+				_, err = os.Stat(filepath.Join(downloadDir, downloadFileName))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "file_size: " + renamedFileName,
+					Value: fmt.Sprintf("%d (%d B)", len(downloadFileContent), len(downloadFileContent)),
+				}))
+			})
+		})
+
+		Context("when filename_template renders a name reserved by the resource", func() {
+			BeforeEach(func() {
+				inRequest.Params.FilenameTemplate = "release_notes.md"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring(
+					"filename template renders file-to-download.zip as release_notes.md, which is reserved by the resource")))
+			})
+
+			Context("when it renders the configured version file", func() {
+				BeforeEach(func() {
+					inRequest.Params.FilenameTemplate = "{product}-version"
+					inRequest.Params.VersionFile = productSlug + "-version"
+				})
+
+				It("returns an error", func() {
+					_, err := inCommand.Run(inRequest)
+					Expect(err).To(MatchError(ContainSubstring("which is reserved by the resource")))
+				})
+			})
+		})
+
+		Context("when filename_template is invalid", func() {
+			BeforeEach(func() {
+				inRequest.Params.FilenameTemplate = "{product}-{unknown}"
+			})
+
+			It("returns an error without contacting Pivotal Network", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring("unknown placeholder in filename template: {unknown}")))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when files are provided instead of globs", func() {
+			BeforeEach(func() {
+				inRequest.Params.Globs = nil
+				inRequest.Params.Files = []string{downloadFileName}
+			})
+
+			It("downloads the named files", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, downloadFileName))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(downloadFileContent))
+			})
+		})
+
+		Context("when files are provided alongside globs matching the same file", func() {
+			BeforeEach(func() {
+				inRequest.Params.Files = []string{downloadFileName}
+			})
+
+			It("downloads the file once", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				downloadRequests := 0
+				for _, r := range server.ReceivedRequests() {
+					if r.URL.Path == "/download" {
+						downloadRequests++
+					}
+				}
+				Expect(downloadRequests).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when several files are downloaded", func() {
+		BeforeEach(func() {
+			// Pivnet returns the files in neither name, id nor file type order.
+			productFiles := []pivnet.ProductFile{
+				{ID: 1, AWSObjectKey: "product_files/banana/c.zip", FileType: "Software"},
+				{ID: 3, AWSObjectKey: "product_files/banana/a.zip", FileType: "Software"},
+				{ID: 2, AWSObjectKey: "product_files/banana/b.zip", FileType: "Documentation"},
+			}
+
+			server.Reset()
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+			)
+			server.RouteToHandler(
+				"POST",
+				fmt.Sprintf("%s/products/%s/releases/%d/eula_acceptance", apiPrefix, productSlug, releaseID),
+				ghttp.RespondWith(http.StatusOK, ""),
+			)
+
+			for i, p := range productFiles {
+				name := filepath.Base(p.AWSObjectKey)
+				p.MD5 = fmt.Sprintf("%x", md5.Sum([]byte(name)))
+				p.Links = &pivnet.Links{
+					Download: map[string]string{"href": server.URL() + "/download/" + name},
+				}
+				productFiles[i] = p
+
+				server.RouteToHandler(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, releaseID, p.ID),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{ProductFile: p}),
+				)
+				server.RouteToHandler("POST", "/download/"+name, ghttp.RespondWith(http.StatusOK, name))
+			}
+
+			server.RouteToHandler("GET", "/file1", ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+				ProductFiles: productFiles,
+			}))
+
+			inRequest.Params.Globs = []string{"*.zip"}
+		})
+
+		pulledArtifactNames := func() []string {
+			b, err := ioutil.ReadFile(filepath.Join(downloadDir, "pulled_artifacts.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var pulledArtifacts struct {
+				Artifacts []struct {
+					Name string `json:"name"`
+				} `json:"artifacts"`
+			}
+			err = json.Unmarshal(b, &pulledArtifacts)
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, a := range pulledArtifacts.Artifacts {
+				names = append(names, a.Name)
+			}
+			return names
+		}
+
+		It("records the files in pulled_artifacts.json ordered by name", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pulledArtifactNames()).To(Equal([]string{"a.zip", "b.zip", "c.zip"}))
+		})
+
+		Context("when sort_product_files_by is id", func() {
+			BeforeEach(func() {
+				inRequest.Params.SortProductFilesBy = "id"
+			})
+
+			It("orders the files by product file id", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(pulledArtifactNames()).To(Equal([]string{"c.zip", "b.zip", "a.zip"}))
+			})
+		})
+
+		Context("when sort_product_files_by is file_type", func() {
+			BeforeEach(func() {
+				inRequest.Params.SortProductFilesBy = "file_type"
+			})
+
+			It("orders the files by file type and then by name", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(pulledArtifactNames()).To(Equal([]string{"b.zip", "a.zip", "c.zip"}))
+			})
+		})
+
+		Context("when sort_product_files_by is not supported", func() {
+			BeforeEach(func() {
+				inRequest.Params.SortProductFilesBy = "size"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("sort_product_files_by must be one of name, id or file_type - got size"))
+			})
+		})
+	})
+
+	Context("when last_n is provided", func() {
+		var olderReleaseID int
+
+		BeforeEach(func() {
+			olderReleaseID = 1233
+			pivnetReleasesResponse.Releases[2] = pivnet.Release{
+				Version: "B",
+				ID:      olderReleaseID,
+				Eula:    &pivnet.Eula{Slug: "some-eula"},
+				Links: &pivnet.Links{
+					ProductFiles: map[string]string{"href": server.URL() + "/file2"},
+				},
+			}
+
+			server.Reset()
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+			)
+
+			releaseFiles := map[int][]pivnet.ProductFile{
+				releaseID: {
+					{ID: 1, AWSObjectKey: "product_files/banana/product-C.ova"},
+					{ID: 2, AWSObjectKey: "product_files/banana/notes-C.txt"},
+				},
+				olderReleaseID: {
+					{ID: 3, AWSObjectKey: "product_files/banana/product-B.ova"},
+				},
+			}
+			productFilesPaths := map[int]string{releaseID: "/file1", olderReleaseID: "/file2"}
+
+			for id, productFiles := range releaseFiles {
+				server.RouteToHandler(
+					"POST",
+					fmt.Sprintf("%s/products/%s/releases/%d/eula_acceptance", apiPrefix, productSlug, id),
+					ghttp.RespondWith(http.StatusOK, ""),
+				)
+
+				for i, p := range productFiles {
+					name := filepath.Base(p.AWSObjectKey)
+					p.MD5 = fmt.Sprintf("%x", md5.Sum([]byte(name)))
+					p.Links = &pivnet.Links{
+						Download: map[string]string{"href": server.URL() + "/download/" + name},
+					}
+					productFiles[i] = p
+
+					server.RouteToHandler(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, id, p.ID),
+						ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{ProductFile: p}),
+					)
+					server.RouteToHandler("POST", "/download/"+name, ghttp.RespondWith(http.StatusOK, name))
+				}
+
+				server.RouteToHandler("GET", productFilesPaths[id], ghttp.RespondWithJSONEncoded(
+					http.StatusOK,
+					pivnet.ProductFiles{ProductFiles: productFiles},
+				))
+			}
+
+			inRequest.Params.Globs = []string{"*.ova"}
+			inRequest.Params.LastN = 2
+		})
+
+		It("downloads the matching files of each release to a directory per version", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, path := range []string{"C/product-C.ova", "B/product-B.ova"} {
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, path))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(filepath.Base(path)))
+			}
+
+			_, err = os.Stat(filepath.Join(downloadDir, "C", "notes-C.txt"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("lists the versions and files downloaded in metadata", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version.ProductVersion).To(Equal(productVersion))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "last_n_versions", Value: "C, B"}))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "last_n_files: C", Value: "product-C.ova"}))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "last_n_files: B", Value: "product-B.ova"}))
+		})
+
+		It("records the files of every release in pulled_artifacts.json", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(filepath.Join(downloadDir, "pulled_artifacts.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var pulledArtifacts struct {
+				Artifacts []struct {
+					Path           string `json:"path"`
+					ReleaseVersion string `json:"release_version"`
+				} `json:"artifacts"`
+			}
+			err = json.Unmarshal(b, &pulledArtifacts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pulledArtifacts.Artifacts).To(HaveLen(2))
+			Expect(pulledArtifacts.Artifacts[0].Path).To(Equal("B/product-B.ova"))
+			Expect(pulledArtifacts.Artifacts[0].ReleaseVersion).To(Equal("B"))
+			Expect(pulledArtifacts.Artifacts[1].Path).To(Equal("C/product-C.ova"))
+			Expect(pulledArtifacts.Artifacts[1].ReleaseVersion).To(Equal("C"))
+		})
+
+		Context("when there are fewer than last_n releases up to the version", func() {
+			BeforeEach(func() {
+				inRequest.Params.LastN = 5
+			})
+
+			It("downloads from all of them", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "last_n_versions", Value: "C, B"}))
+			})
+		})
+
+		Context("when last_n is negative", func() {
+			BeforeEach(func() {
+				inRequest.Params.LastN = -1
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("last_n must not be negative"))
+			})
+		})
+
+		Context("when no globs are provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.Globs = nil
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("globs must be provided with last_n"))
+			})
+		})
+
+		Context("when release_id is also provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.ReleaseID = releaseID
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("only one of release_id or last_n may be provided"))
+			})
+		})
+
+		Context("when files are also provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.Files = []string{"product-C.ova"}
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("files may not be provided with last_n"))
+			})
+		})
+	})
+
+	Context("when released_after and released_before are provided", func() {
+		var olderReleaseID int
+
+		BeforeEach(func() {
+			olderReleaseID = 1233
+			pivnetReleasesResponse.Releases[0].ReleaseDate = "2016-03-01"
+			pivnetReleasesResponse.Releases[1].ReleaseDate = "2016-02-01"
+			pivnetReleasesResponse.Releases[2] = pivnet.Release{
+				Version:     "B",
+				ID:          olderReleaseID,
+				ReleaseDate: "2016-01-01",
+				Eula:        &pivnet.Eula{Slug: "some-eula"},
+				Links: &pivnet.Links{
+					ProductFiles: map[string]string{"href": server.URL() + "/file2"},
+				},
+			}
+
+			server.Reset()
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+			)
+
+			releaseFiles := map[int][]pivnet.ProductFile{
+				releaseID:      {{ID: 1, AWSObjectKey: "product_files/banana/product-C.ova"}},
+				olderReleaseID: {{ID: 3, AWSObjectKey: "product_files/banana/product-B.ova"}},
+			}
+			productFilesPaths := map[int]string{releaseID: "/file1", olderReleaseID: "/file2"}
+
+			for id, productFiles := range releaseFiles {
+				server.RouteToHandler(
+					"POST",
+					fmt.Sprintf("%s/products/%s/releases/%d/eula_acceptance", apiPrefix, productSlug, id),
+					ghttp.RespondWith(http.StatusOK, ""),
+				)
+
+				for i, p := range productFiles {
+					name := filepath.Base(p.AWSObjectKey)
+					p.MD5 = fmt.Sprintf("%x", md5.Sum([]byte(name)))
+					p.Links = &pivnet.Links{
+						Download: map[string]string{"href": server.URL() + "/download/" + name},
+					}
+					productFiles[i] = p
+
+					server.RouteToHandler(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d", apiPrefix, productSlug, id, p.ID),
+						ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{ProductFile: p}),
+					)
+					server.RouteToHandler("POST", "/download/"+name, ghttp.RespondWith(http.StatusOK, name))
+				}
+
+				server.RouteToHandler("GET", productFilesPaths[id], ghttp.RespondWithJSONEncoded(
+					http.StatusOK,
+					pivnet.ProductFiles{ProductFiles: productFiles},
+				))
+			}
+
+			inRequest.Params.Globs = []string{"*.ova"}
+			inRequest.Params.ReleasedAfter = "2016-01-01"
+			inRequest.Params.ReleasedBefore = "2016-02-01"
+		})
+
+		It("downloads the matching files of each release within the range to a directory per version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, path := range []string{"C/product-C.ova", "B/product-B.ova"} {
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, path))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal(filepath.Base(path)))
+			}
+
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "released_between_versions", Value: "C, B"}))
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "released_between_files: B", Value: "product-B.ova"}))
+		})
+
+		It("writes a manifest of the releases and files downloaded to releases.json", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(filepath.Join(downloadDir, "releases.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(MatchJSON(fmt.Sprintf(`{"releases": [
+				{"version": "C", "release_id": %d, "release_date": "2016-02-01", "files": ["product-C.ova"]},
+				{"version": "B", "release_id": %d, "release_date": "2016-01-01", "files": ["product-B.ova"]}
+			]}`, releaseID, olderReleaseID)))
+		})
+
+		Context("when only released_before is provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.ReleasedAfter = ""
+				inRequest.Params.ReleasedBefore = "2016-01-15"
+			})
+
+			It("downloads from the releases on or before it", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "released_between_versions", Value: "B"}))
+			})
+		})
+
+		Context("when released_after is after released_before", func() {
+			BeforeEach(func() {
+				inRequest.Params.ReleasedAfter = "2016-03-01"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("released_after must not be after released_before - got 2016-03-01 and 2016-02-01"))
+			})
+		})
+
+		Context("when a date is not in the form YYYY-MM-DD", func() {
+			BeforeEach(func() {
+				inRequest.Params.ReleasedBefore = "Feb 1 2016"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("released_before must be in the form YYYY-MM-DD - got Feb 1 2016"))
+			})
+		})
+
+		Context("when no globs are provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.Globs = nil
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("globs must be provided with released_after"))
+			})
+		})
+
+		Context("when last_n is also provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.LastN = 2
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("last_n may not be provided with released_after"))
+			})
+		})
+	})
+	Context("when a version file is provided", func() {
+		BeforeEach(func() {
+			inRequest.Params.VersionFile = "some/dir/product-version"
+		})
+
+		It("writes the version to that file instead", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			versionContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "some", "dir", "product-version"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(versionContents)).To(Equal(productVersion))
+
+			_, err = os.Stat(filepath.Join(downloadDir, "version"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Context("when the version file is outside the destination", func() {
+			BeforeEach(func() {
+				inRequest.Params.VersionFile = "../version"
+			})
+
+			It("returns an error without contacting Pivotal Network", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("version_file must be within the destination - got ../version"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when the version file is absolute", func() {
+			BeforeEach(func() {
+				inRequest.Params.VersionFile = "/tmp/version"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("version_file must be relative to the destination - got /tmp/version"))
+			})
+		})
+	})
+
+	Context("when a metadata file is provided", func() {
+		BeforeEach(func() {
+			inRequest.Params.MetadataFile = "metadata.json"
+		})
+
+		It("writes the metadata to that file as JSON", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "metadata.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var metadata []concourse.Metadata
+			err = json.Unmarshal(contents, &metadata)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata).To(Equal(response.Metadata))
+		})
+
+		Context("when the metadata file is outside the destination", func() {
+			BeforeEach(func() {
+				inRequest.Params.MetadataFile = "a/../../metadata.json"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("metadata_file must be within the destination - got a/../../metadata.json"))
+			})
+		})
+	})
+
+	Context("when metadata_formats is provided", func() {
+		BeforeEach(func() {
+			inRequest.Params.MetadataFormats = []string{"yaml", "json", "env"}
+		})
+
+		It("writes the metadata in each format", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "metadata.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var values map[string]string
+			err = json.Unmarshal(contents, &values)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(HaveLen(len(response.Metadata)))
+			Expect(values).To(HaveKeyWithValue("release_id", strconv.Itoa(releaseID)))
+			Expect(values).To(HaveKeyWithValue("eula_slug", "some-eula"))
+
+			contents, err = ioutil.ReadFile(filepath.Join(downloadDir, "metadata.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("\"release_id\": \"%d\"\n", releaseID)))
+			Expect(string(contents)).To(ContainSubstring("\"eula_slug\": \"some-eula\"\n"))
+
+			contents, err = ioutil.ReadFile(filepath.Join(downloadDir, "metadata.env"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(fmt.Sprintf("RELEASE_ID='%d'\n", releaseID)))
+			Expect(string(contents)).To(ContainSubstring("EULA_SLUG='some-eula'\n"))
+		})
+
+		Context("when a value contains a single quote", func() {
+			BeforeEach(func() {
+				inRequest.Params.MetadataFormats = []string{"env"}
+				pivnetReleasesResponse.Releases[1].Description = "it's a release"
+
+				server.SetHandler(0, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+				))
+			})
+
+			It("quotes it for the shell", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "metadata.env"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`DESCRIPTION='it'\''s a release'` + "\n"))
+			})
+		})
+
+		Context("when a format is invalid", func() {
+			BeforeEach(func() {
+				inRequest.Params.MetadataFormats = []string{"yaml", "xml"}
+			})
+
+			It("returns an error without contacting Pivotal Network", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("metadata_formats must only contain yaml, json or env - got xml"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when metadata_file is the file of a format", func() {
+			BeforeEach(func() {
+				inRequest.Params.MetadataFile = "metadata.json"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("metadata_file may not be metadata.json when metadata_formats contains json"))
+			})
+		})
+	})
+
+	Context("when duplicate_version_strategy is provided and releases share the version", func() {
+		BeforeEach(func() {
+			inRequest.Source.DuplicateVersionStrategy = "newest"
+
+			duplicatesResponse := pivnet.Response{
+				Releases: []pivnet.Release{
+					{Version: productVersion, ID: 99},
+					pivnetReleasesResponse.Releases[1],
+				},
+			}
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, duplicatesResponse),
+			))
+		})
+
+		It("gets the release picked by the strategy rather than the first listed", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			releaseIDContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_id"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(releaseIDContents)).To(Equal(strconv.Itoa(releaseID)))
+		})
+	})
+
+	Context("when the requested version is only semver-equivalent to a release version", func() {
+		BeforeEach(func() {
+			inRequest.Version.ProductVersion = "1.2"
+			inRequest.Params.SemverVersionMatch = true
+
+			semverResponse := pivnet.Response{
+				Releases: []pivnet.Release{
+					{Version: "1.2.1", ID: 99},
+					{
+						Version: "1.2.0",
+						ID:      releaseID,
+						Eula:    pivnetReleasesResponse.Releases[1].Eula,
+						Links:   pivnetReleasesResponse.Releases[1].Links,
+					},
+				},
+			}
+
+			semverReleasesHandler := ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, semverResponse),
+			)
+
+			// The releases are listed again to find the semver-equivalent
+			// release once the exact version is not found.
+			server.SetHandler(0, semverReleasesHandler)
+			server.SetHandler(1, semverReleasesHandler)
+			server.SetHandler(2, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"POST",
+					fmt.Sprintf(
+						"%s/products/%s/releases/%d/eula_acceptance",
+						apiPrefix,
+						productSlug,
+						releaseID,
+					),
+				),
+				ghttp.RespondWith(http.StatusOK, ""),
+			))
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWith(http.StatusOK, file1Contents),
+				),
+			)
+		})
+
+		It("gets the semver-equivalent release and keeps the requested version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.Version.ProductVersion).To(Equal("1.2"))
+
+			releaseIDContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_id"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(releaseIDContents)).To(Equal(strconv.Itoa(releaseID)))
+		})
+
+		Context("when semver_version_match is not provided", func() {
+			BeforeEach(func() {
+				inRequest.Params.SemverVersionMatch = false
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring("The requested version: 1.2 - could not be found")))
+			})
+		})
+	})
+
+	Context("when the requested version is not found", func() {
+		BeforeEach(func() {
+			inRequest.Version.ProductVersion = "1.2.3"
+
+			missingResponse := pivnet.Response{
+				Releases: []pivnet.Release{
+					{
+						Version: "1.2.5",
+						ID:      releaseID,
+						Eula:    pivnetReleasesResponse.Releases[1].Eula,
+						Links:   pivnetReleasesResponse.Releases[1].Links,
+					},
+					{Version: "1.3.0", ID: 99},
+					{Version: "1.1.0", ID: 98},
+				},
+			}
+
+			missingReleasesHandler := ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, missingResponse),
+			)
+
+			// The releases are listed again to find the release to fetch
+			// instead once the version is not found.
+			server.SetHandler(0, missingReleasesHandler)
+			server.SetHandler(1, missingReleasesHandler)
+			server.SetHandler(2, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"POST",
+					fmt.Sprintf(
+						"%s/products/%s/releases/%d/eula_acceptance",
+						apiPrefix,
+						productSlug,
+						releaseID,
+					),
+				),
+				ghttp.RespondWith(http.StatusOK, ""),
+			))
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/file1"),
+					ghttp.RespondWith(http.StatusOK, file1Contents),
+				),
+			)
+		})
+
+		It("returns an error", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).To(MatchError(ContainSubstring("The requested version: 1.2.3 - could not be found")))
+		})
+
+		for _, strategy := range []struct {
+			name      string
+			requested string
+		}{
+			{"nearest_newer", "1.2.3"},
+			{"nearest_older", "1.2.9"},
+			{"latest", "1.2.3"},
+		} {
+			strategy := strategy
+
+			Context("when on_missing_version is "+strategy.name, func() {
+				BeforeEach(func() {
+					inRequest.Params.OnMissingVersion = strategy.name
+					inRequest.Version.ProductVersion = strategy.requested
+				})
+
+				It("gets the release to fetch instead and returns its version", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response.Version.ProductVersion).To(Equal("1.2.5"))
+					Expect(response.Metadata).To(ContainElement(
+						concourse.Metadata{Name: "requested_version", Value: strategy.requested},
+					))
+					Expect(response.Metadata).To(ContainElement(
+						concourse.Metadata{Name: "fetched_version", Value: "1.2.5"},
+					))
+
+					releaseIDContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_id"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(releaseIDContents)).To(Equal(strconv.Itoa(releaseID)))
+				})
+			})
+		}
+
+		Context("when on_missing_version finds no release to fetch instead", func() {
+			BeforeEach(func() {
+				inRequest.Params.OnMissingVersion = "nearest_older"
+				inRequest.Version.ProductVersion = "1.0.0"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring("The requested version: 1.0.0 - could not be found")))
+			})
+		})
+
+		Context("when on_missing_version is unknown", func() {
+			BeforeEach(func() {
+				inRequest.Params.OnMissingVersion = "nearest"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(
+					"on_missing_version must be one of fail, nearest_newer, nearest_older or latest - got nearest"))
+			})
+		})
+	})
+
+	Context("when latest is true", func() {
+		var latestVersion string
+
+		BeforeEach(func() {
+			inRequest.Params.Latest = true
+			inRequest.Version.ProductVersion = "A"
+
+			latestVersion = "D"
+			latestReleasesResponse := pivnet.Response{
+				Releases: []pivnet.Release{
+					{
+						Version: latestVersion,
+						ID:      releaseID,
+						Eula:    pivnetReleasesResponse.Releases[1].Eula,
+						Links:   pivnetReleasesResponse.Releases[1].Links,
+					},
+					{Version: "A"},
+				},
+			}
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, latestReleasesResponse),
+			))
+		})
+
+		It("gets the latest release instead of the requested version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: latestVersion,
+			}))
+
+			versionContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "version"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(versionContents)).To(Equal(latestVersion))
+		})
+	})
+
+	Context("when a release id is provided", func() {
+		BeforeEach(func() {
+			inRequest.Params.ReleaseID = releaseID
+			inRequest.Version.ProductVersion = "A"
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.Release{
+					Version: "E",
+					ID:      releaseID,
+					Eula:    pivnetReleasesResponse.Releases[1].Eula,
+					Links:   pivnetReleasesResponse.Releases[1].Links,
+				}),
+			))
+		})
+
+		It("gets the release with the id instead of the requested version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: "E",
+			}))
+
+			versionContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "version"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(versionContents)).To(Equal("E"))
+		})
+
+		Context("when latest is also true", func() {
+			BeforeEach(func() {
+				inRequest.Params.Latest = true
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("only one of release_id or latest may be provided"))
+			})
+		})
+
+		Context("when the release id is negative", func() {
+			BeforeEach(func() {
+				inRequest.Params.ReleaseID = -1
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("release_id must not be negative"))
+			})
+		})
+	})
+
+	Context("when the version includes the release id", func() {
+		BeforeEach(func() {
+			inRequest.Source.VersionFormat = versions.FormatVersionID
+			inRequest.Version.ProductVersion = fmt.Sprintf("%s#%d", productVersion, releaseID)
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse.Releases[1]),
+			))
+		})
+
+		It("gets the release with the id and keeps the requested version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: fmt.Sprintf("%s#%d", productVersion, releaseID),
+			}))
+
+			versionContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "version"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(versionContents)).To(Equal(productVersion))
+		})
+	})
+
+	Context("when the version contains # but version_format is not {version}#{id}", func() {
+		BeforeEach(func() {
+			inRequest.Version.ProductVersion = fmt.Sprintf("%s#%d", productVersion, releaseID)
+		})
+
+		It("gets the release with the whole version", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(
+				"The requested version: %s#%d - could not be found",
+				productVersion,
+				releaseID,
+			))))
+		})
+	})
+
+	Context("when the version includes a file hash", func() {
+		var fileHash string
+
+		BeforeEach(func() {
+			fileHash = versions.FileHash(nil)
+			inRequest.Source.VersionFileHashes = true
+			inRequest.Version.ProductVersion = fmt.Sprintf("%s@%s", productVersion, fileHash)
+		})
+
+		Context("when version_includes_file_hashes is false", func() {
+			BeforeEach(func() {
+				inRequest.Source.VersionFileHashes = false
+			})
+
+			It("gets the release with the whole version", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(
+					"The requested version: %s@%s - could not be found",
+					productVersion,
+					fileHash,
+				))))
+			})
+		})
+
+		It("gets the release without the hash and keeps the requested version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: fmt.Sprintf("%s@%s", productVersion, fileHash),
+			}))
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "file_hash", Value: fileHash},
+			))
+
+			versionContents, err := ioutil.ReadFile(filepath.Join(downloadDir, "version"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(versionContents)).To(Equal(productVersion))
+		})
+
+		Context("when the files of the release have changed since", func() {
+			BeforeEach(func() {
+				inRequest.Version.ProductVersion = fmt.Sprintf("%s@%s", productVersion, "0123456789ab")
+			})
+
+			It("records the hash of the files fetched", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(
+					concourse.Metadata{Name: "file_hash", Value: fileHash},
+				))
+			})
+
+			Context("when warnings_metadata is true", func() {
+				BeforeEach(func() {
+					inRequest.Params.WarningsMetadata = true
+				})
+
+				It("reports that the files have changed in metadata", func() {
+					response, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+						Name: "warnings",
+						Value: fmt.Sprintf(
+							"the files of release %s hash to %s rather than 0123456789ab - they have changed since version %s@0123456789ab was put",
+							productVersion,
+							fileHash,
+							productVersion,
+						),
+					}))
+				})
+
+				It("does not write the warnings to the metadata files", func() {
+					inRequest.Params.MetadataFormats = []string{"yaml"}
+
+					_, err := inCommand.Run(inRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "metadata.yaml"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).NotTo(ContainSubstring("warnings"))
+				})
+			})
+		})
+
+		Context("when the version also includes the release id", func() {
+			BeforeEach(func() {
+				inRequest.Source.VersionFormat = versions.FormatVersionID
+				inRequest.Version.ProductVersion = fmt.Sprintf("%s#%d@%s", productVersion, releaseID, fileHash)
+
+				server.SetHandler(0, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse.Releases[1]),
+				))
+			})
+
+			It("gets the release with the id and keeps the requested version", func() {
+				response, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Version).To(Equal(concourse.Version{
+					ProductVersion: fmt.Sprintf("%s#%d@%s", productVersion, releaseID, fileHash),
+				}))
+			})
+		})
+	})
+
+	Context("when download_release_notes is true", func() {
+		var description string
+
+		BeforeEach(func() {
+			inRequest.Params.DownloadReleaseNotes = true
+			description = "# Release notes\n\n* Fixed a bug\n"
+		})
+
+		JustBeforeEach(func() {
+			release := pivnetReleasesResponse.Releases[1]
+			release.Description = description
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.Response{
+					Releases: []pivnet.Release{release},
+				}),
+			))
+		})
+
+		It("writes the release notes to release_notes.md as returned", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_notes.md"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(description))
+		})
+
+		Context("when the release has no release notes", func() {
+			BeforeEach(func() {
+				description = ""
+			})
+
+			It("writes an empty file", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_notes.md"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when download_product_icon is true", func() {
+		var productResponse string
+
+		BeforeEach(func() {
+			inRequest.Params.DownloadProductIcon = true
+
+			productResponse = fmt.Sprintf(
+				`{"id": 1, "slug": "%s", "logo_url": "%s/logos/product.png"}`,
+				productSlug,
+				server.URL(),
+			)
+		})
+
+		JustBeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s", apiPrefix, productSlug)),
+					ghttp.RespondWith(http.StatusOK, productResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/logos/product.png"),
+					ghttp.RespondWith(http.StatusOK, "some icon"),
+				),
+			)
+		})
+
+		It("writes the icon to product_icon.png", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "product_icon.png"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some icon"))
+		})
+
+		Context("when the product has no icon", func() {
+			BeforeEach(func() {
+				productResponse = fmt.Sprintf(`{"id": 1, "slug": "%s"}`, productSlug)
+			})
+
+			It("does not write product_icon.png", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(downloadDir, "product_icon.png"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("when the icon cannot be fetched", func() {
+			JustBeforeEach(func() {
+				server.SetHandler(4, ghttp.RespondWith(http.StatusNotFound, ""))
+			})
+
+			It("does not fail the get", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(downloadDir, "product_icon.png"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when dump_raw_release is true", func() {
+		BeforeEach(func() {
+			inRequest.Params.DumpRawRelease = true
+		})
+
+		JustBeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(`{
+						"id": %d,
+						"unmodelled": {"count": 12345678901234567890},
+						"_links": {"product_files": {"href": "https://example.com/product_files"}}
+					}`, releaseID)),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWith(http.StatusOK, `{"product_files": [{
+						"id": 3,
+						"unmodelled": "a&b",
+						"_links": {
+							"download": {"href": "https://example.com/download?signature=secret"},
+							"signature_file_download": {"href": "https://example.com/signature?signature=secret"}
+						}
+					}]}`),
+				),
+			)
+		})
+
+		It("writes the release and its product files to release_raw.json with download links redacted", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "release_raw.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).NotTo(ContainSubstring("secret"))
+			Expect(contents).To(MatchJSON(fmt.Sprintf(`{
+				"release": {
+					"id": %d,
+					"unmodelled": {"count": 12345678901234567890},
+					"_links": {"product_files": {"href": "https://example.com/product_files"}}
+				},
+				"product_files": [{
+					"id": 3,
+					"unmodelled": "a&b",
+					"_links": {
+						"download": {"href": "***REDACTED-DOWNLOAD_LINK***"},
+						"signature_file_download": {"href": "***REDACTED-DOWNLOAD_LINK***"}
+					}
+				}]
+			}`, releaseID)))
+			Expect(string(contents)).To(ContainSubstring("12345678901234567890"))
+			Expect(string(contents)).To(ContainSubstring(`"a&b"`))
+		})
+
+		Context("when the raw release cannot be fetched", func() {
+			JustBeforeEach(func() {
+				server.SetHandler(4, ghttp.RespondWith(http.StatusTeapot, nil))
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Failed to dump raw release"))
+			})
+		})
+	})
+
+	Context("when download_image_references is true", func() {
+		var imageReferencesResponse string
+
+		BeforeEach(func() {
+			inRequest.Params.DownloadImageReferences = true
+
+			imageReferencesResponse = `{"image_references": [{
+				"id": 3,
+				"name": "my-image",
+				"image_path": "registry.example.com/my-image:1.2.3",
+				"digest": "sha256:abc123"
+			}]}`
+		})
+
+		JustBeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf(
+							"%s/products/%s/releases/%d/image_references",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						),
+					),
+					ghttp.RespondWith(http.StatusOK, imageReferencesResponse),
+				),
+			)
+		})
+
+		It("writes the image references to image_references.yaml", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "image_references.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(`image_references:
+- name: "my-image"
+  repository: "registry.example.com/my-image"
+  tag: "1.2.3"
+  digest: "sha256:abc123"
+`))
+		})
+
+		Context("when the release has no image references", func() {
+			BeforeEach(func() {
+				imageReferencesResponse = `{"image_references": []}`
+			})
+
+			It("writes an empty list", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(filepath.Join(downloadDir, "image_references.yaml"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("image_references: []\n"))
+			})
+		})
+	})
+
+	Context("when require_metadata is provided", func() {
+		BeforeEach(func() {
+			inRequest.Params.RequireMetadata = []string{"release_id"}
+		})
+
+		It("succeeds when the metadata is present", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when required metadata is empty or absent", func() {
+			BeforeEach(func() {
+				inRequest.Params.RequireMetadata = []string{"release_id", "release_type", "release_notes_url"}
+			})
+
+			It("returns an error naming the missing metadata without accepting the EULA", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(fmt.Sprintf(
+					"release %s of product %s: missing required metadata: release_type, release_notes_url",
+					productVersion,
+					productSlug,
+				)))
+
+				Expect(len(server.ReceivedRequests())).To(Equal(1))
+			})
+		})
+
+		Context("when a name is not release metadata", func() {
+			BeforeEach(func() {
+				inRequest.Params.RequireMetadata = []string{"size"}
+			})
+
+			It("returns an error without contacting Pivotal Network", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(ContainSubstring("require_metadata must only contain release metadata names - got size")))
+
+				Expect(len(server.ReceivedRequests())).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the release has no EULA", func() {
+		BeforeEach(func() {
+			pivnetReleasesResponse.Releases[1].Eula = nil
+
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnetReleasesResponse),
+			))
+
+			productFilesHandler := server.GetHandler(2)
+			server.SetHandler(1, productFilesHandler)
+		})
+
+		It("does not accept the EULA and records that none was required", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, r := range server.ReceivedRequests() {
+				Expect(r.URL.Path).NotTo(ContainSubstring("eula_acceptance"))
+			}
+
+			Expect(response.Metadata).To(ContainElement(concourse.Metadata{Name: "eula_required", Value: "false"}))
+			for _, m := range response.Metadata {
+				Expect(m.Name).NotTo(Equal("eula_slug"))
+			}
+		})
+	})
+
+	Context("when skip_eula is true", func() {
+		BeforeEach(func() {
+			inRequest.Params.SkipEULA = true
+
+			productFilesHandler := server.GetHandler(2)
+			server.SetHandler(1, productFilesHandler)
+		})
+
+		It("does not accept the EULA", func() {
+			_, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, r := range server.ReceivedRequests() {
+				Expect(r.URL.Path).NotTo(ContainSubstring("eula_acceptance"))
+			}
+		})
+	})
+
+	Context("when auto_accept_eulas is provided", func() {
+		Context("when the EULA of the release is in auto_accept_eulas", func() {
+			BeforeEach(func() {
+				inRequest.Params.AutoAcceptEULAs = []string{"some-other-eula", "some-eula"}
+			})
+
+			It("accepts the EULA", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				var accepted bool
+				for _, r := range server.ReceivedRequests() {
+					accepted = accepted || (r.Method == "POST" && strings.HasSuffix(r.URL.Path, "eula_acceptance"))
+				}
+				Expect(accepted).To(BeTrue())
+			})
+		})
+
+		Context("when the EULA of the release is not in auto_accept_eulas", func() {
+			BeforeEach(func() {
+				inRequest.Params.AutoAcceptEULAs = []string{"some-other-eula"}
+			})
+
+			It("returns an error without accepting the EULA", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError(fmt.Sprintf(
+					"the EULA some-eula of release %s of product %s is not in auto_accept_eulas - "+
+						"review it at %s/products/%s#/releases/%d and add it to auto_accept_eulas to accept it",
+					productVersion,
+					productSlug,
+					server.URL(),
+					productSlug,
+					releaseID,
+				)))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.URL.Path).NotTo(ContainSubstring("eula_acceptance"))
+				}
+			})
+		})
+
+		Context("when skip_eula is true", func() {
+			BeforeEach(func() {
+				inRequest.Params.AutoAcceptEULAs = []string{"some-eula"}
+				inRequest.Params.SkipEULA = true
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("auto_accept_eulas may not be provided with skip_eula"))
+			})
+		})
+	})
+
+	Context("when the version includes a product slug", func() {
+		BeforeEach(func() {
+			inRequest.Source.ProductSlug = ""
+			inRequest.Source.ProductSlugs = []string{"some-other-product", productSlug}
+			inRequest.Version.ProductSlug = productSlug
+		})
+
+		It("gets the release from that product and returns the same version", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductSlug:    productSlug,
+				ProductVersion: productVersion,
+			}))
+		})
+
+		Context("when the product slug is not one of the product slugs", func() {
+			BeforeEach(func() {
+				inRequest.Version.ProductSlug = "unknown-product"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(ContainSubstring("unknown-product"))
+			})
+		})
+	})
+
+	Context("when an endpoint is provided in the params", func() {
+		BeforeEach(func() {
+			inRequest.Params.Endpoint = inRequest.Source.Endpoint
+			inRequest.Source.Endpoint = "http://127.0.0.1:1"
+		})
+
+		It("gets the release from the endpoint of the params", func() {
+			response, err := inCommand.Run(inRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version.ProductVersion).To(Equal(productVersion))
+		})
+
+		Context("when an api token is provided in the params", func() {
+			BeforeEach(func() {
+				inRequest.Params.APIToken = "other-api-token"
+			})
+
+			It("gets the release with the api token of the params", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(server.ReceivedRequests()).NotTo(BeEmpty())
+				for _, r := range server.ReceivedRequests() {
+					if strings.HasPrefix(r.URL.Path, apiPrefix) {
+						Expect(r.Header.Get("Authorization")).To(Equal("Token other-api-token"))
+					}
+				}
+			})
+		})
+
+		Context("when it is not an http or https URL", func() {
+			BeforeEach(func() {
+				inRequest.Params.Endpoint = "network.pivotal.io"
+			})
+
+			It("returns an error", func() {
+				_, err := inCommand.Run(inRequest)
+				Expect(err).To(MatchError("params.endpoint must be an http or https URL - got network.pivotal.io"))
+			})
+		})
 	})
 
 	Context("when no api token is provided", func() {
@@ -0,0 +1,155 @@
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const delimiter = "---"
+
+var validKey = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// Validate returns an error unless every key is made only of lower-case
+// letters, digits, underscores, dots and dashes, so that the rendered block
+// can be parsed unambiguously.
+func Validate(labels map[string]string) error {
+	for _, key := range sortedKeys(labels) {
+		if !validKey.MatchString(key) {
+			return fmt.Errorf(
+				"release_labels keys must only contain a-z, 0-9, _, . and - - got %q",
+				key,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Render prepends the labels to the description as a YAML front-matter
+// block, with one quoted value per line in key order, e.g.
+//
+//	---
+//	build_id: "123"
+//	git_sha: "abc123"
+//	---
+//	Some description
+//
+// The description is returned unchanged if there are no labels.
+func Render(labels map[string]string, description string) string {
+	if len(labels) == 0 {
+		return description
+	}
+
+	lines := []string{delimiter}
+	for _, key := range sortedKeys(labels) {
+		b, err := json.Marshal(labels[key])
+		if err != nil {
+			panic(err)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s", key, string(b)))
+	}
+	lines = append(lines, delimiter)
+
+	return strings.Join(lines, "\n") + "\n" + description
+}
+
+// Parse extracts the labels rendered into the description by Render,
+// returning them along with the rest of the description. A description
+// without a front-matter block has no labels.
+func Parse(description string) (map[string]string, string, error) {
+	labels := map[string]string{}
+
+	if !strings.HasPrefix(description, delimiter+"\n") {
+		return labels, description, nil
+	}
+
+	lines := strings.Split(description, "\n")
+	for i, line := range lines[1:] {
+		if line == delimiter {
+			rest := strings.Join(lines[i+2:], "\n")
+			return labels, rest, nil
+		}
+
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 || !validKey.MatchString(parts[0]) {
+			return nil, "", fmt.Errorf("invalid release label line: %q", line)
+		}
+
+		var value string
+		err := json.Unmarshal([]byte(parts[1]), &value)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid release label value: %q", line)
+		}
+
+		labels[parts[0]] = value
+	}
+
+	return nil, "", fmt.Errorf("release labels block is not terminated by %s", delimiter)
+}
+
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fileLabelsKey is the key of the block rendered into the description of a
+// product file, whose value is its labels joined by commas.
+const fileLabelsKey = "labels"
+
+// ValidateFileLabels returns an error unless every file label is made only of
+// lower-case letters, digits, underscores, dots and dashes, the same as the
+// keys of release labels, so none can contain the comma they are joined by.
+func ValidateFileLabels(fileLabels []string) error {
+	for _, label := range fileLabels {
+		if !validKey.MatchString(label) {
+			return fmt.Errorf(
+				"labels must only contain a-z, 0-9, _, . and - - got %q",
+				label,
+			)
+		}
+	}
+
+	return nil
+}
+
+// RenderFileLabels prepends the labels of a product file to its description
+// in the same front-matter block as Render, e.g.
+//
+//	---
+//	labels: "linux,amd64"
+//	---
+//	Some description
+//
+// The description is returned unchanged if there are no labels.
+func RenderFileLabels(fileLabels []string, description string) string {
+	if len(fileLabels) == 0 {
+		return description
+	}
+
+	return Render(map[string]string{fileLabelsKey: strings.Join(fileLabels, ",")}, description)
+}
+
+// ParseFileLabels extracts the labels rendered into the description of a
+// product file by RenderFileLabels, returning them in order along with the
+// rest of the description.
+func ParseFileLabels(description string) ([]string, string, error) {
+	parsed, rest, err := Parse(description)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if parsed[fileLabelsKey] == "" {
+		return nil, rest, nil
+	}
+
+	return strings.Split(parsed[fileLabelsKey], ","), rest, nil
+}
@@ -0,0 +1,136 @@
+package labels_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
+)
+
+var _ = Describe("Labels", func() {
+	var releaseLabels map[string]string
+
+	BeforeEach(func() {
+		releaseLabels = map[string]string{
+			"git_sha":  "abc123",
+			"build_id": "42",
+		}
+	})
+
+	Describe("Render", func() {
+		It("prepends the labels as a front-matter block in key order", func() {
+			rendered := labels.Render(releaseLabels, "Some description")
+
+			Expect(rendered).To(Equal(`---
+build_id: "42"
+git_sha: "abc123"
+---
+Some description`))
+		})
+
+		It("quotes values so they can be parsed back", func() {
+			rendered := labels.Render(map[string]string{"note": "a: \"b\"\nc"}, "")
+
+			parsed, _, err := labels.Parse(rendered)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(map[string]string{"note": "a: \"b\"\nc"}))
+		})
+
+		Context("when there are no labels", func() {
+			It("returns the description unchanged", func() {
+				Expect(labels.Render(nil, "Some description")).To(Equal("Some description"))
+			})
+		})
+	})
+
+	Describe("Parse", func() {
+		It("returns the labels and the rest of the description", func() {
+			parsed, description, err := labels.Parse(labels.Render(releaseLabels, "Some\ndescription"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(parsed).To(Equal(releaseLabels))
+			Expect(description).To(Equal("Some\ndescription"))
+		})
+
+		Context("when the description has no labels", func() {
+			It("returns no labels and the whole description", func() {
+				parsed, description, err := labels.Parse("Some description")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(parsed).To(BeEmpty())
+				Expect(description).To(Equal("Some description"))
+			})
+		})
+
+		Context("when the block is not terminated", func() {
+			It("returns an error", func() {
+				_, _, err := labels.Parse("---\nbuild_id: \"42\"\nSome description")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts keys that can be parsed", func() {
+			Expect(labels.Validate(releaseLabels)).To(Succeed())
+		})
+
+		Context("when a key cannot be parsed", func() {
+			It("returns an error", func() {
+				err := labels.Validate(map[string]string{"Git SHA": "abc123"})
+				Expect(err).To(MatchError(`release_labels keys must only contain a-z, 0-9, _, . and - - got "Git SHA"`))
+			})
+		})
+	})
+
+	Describe("RenderFileLabels", func() {
+		It("prepends the labels as a front-matter block in order", func() {
+			rendered := labels.RenderFileLabels([]string{"linux", "amd64"}, "Some description")
+
+			Expect(rendered).To(Equal(`---
+labels: "linux,amd64"
+---
+Some description`))
+		})
+
+		Context("when there are no labels", func() {
+			It("returns the description unchanged", func() {
+				Expect(labels.RenderFileLabels(nil, "Some description")).To(Equal("Some description"))
+			})
+		})
+	})
+
+	Describe("ParseFileLabels", func() {
+		It("returns the labels and the rest of the description", func() {
+			parsed, description, err := labels.ParseFileLabels(
+				labels.RenderFileLabels([]string{"linux", "amd64"}, "Some\ndescription"),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(parsed).To(Equal([]string{"linux", "amd64"}))
+			Expect(description).To(Equal("Some\ndescription"))
+		})
+
+		Context("when the description has no labels", func() {
+			It("returns no labels and the whole description", func() {
+				parsed, description, err := labels.ParseFileLabels("Some description")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(parsed).To(BeEmpty())
+				Expect(description).To(Equal("Some description"))
+			})
+		})
+	})
+
+	Describe("ValidateFileLabels", func() {
+		It("accepts labels that can be parsed", func() {
+			Expect(labels.ValidateFileLabels([]string{"linux", "amd64"})).To(Succeed())
+		})
+
+		Context("when a label cannot be parsed", func() {
+			It("returns an error", func() {
+				err := labels.ValidateFileLabels([]string{"linux", "x86,64"})
+				Expect(err).To(MatchError(`labels must only contain a-z, 0-9, _, . and - - got "x86,64"`))
+			})
+		})
+	})
+})
@@ -8,6 +8,36 @@ import (
 )
 
 type FakeLogger struct {
+	ErrorfStub        func(format string, a ...interface{}) (n int, err error)
+	errorfMutex       sync.RWMutex
+	errorfArgsForCall []struct {
+		format string
+		a      []interface{}
+	}
+	errorfReturns struct {
+		result1 int
+		result2 error
+	}
+	WarnfStub        func(format string, a ...interface{}) (n int, err error)
+	warnfMutex       sync.RWMutex
+	warnfArgsForCall []struct {
+		format string
+		a      []interface{}
+	}
+	warnfReturns struct {
+		result1 int
+		result2 error
+	}
+	InfofStub        func(format string, a ...interface{}) (n int, err error)
+	infofMutex       sync.RWMutex
+	infofArgsForCall []struct {
+		format string
+		a      []interface{}
+	}
+	infofReturns struct {
+		result1 int
+		result2 error
+	}
 	DebugfStub        func(format string, a ...interface{}) (n int, err error)
 	debugfMutex       sync.RWMutex
 	debugfArgsForCall []struct {
@@ -20,6 +50,108 @@ type FakeLogger struct {
 	}
 }
 
+func (fake *FakeLogger) Errorf(format string, a ...interface{}) (n int, err error) {
+	fake.errorfMutex.Lock()
+	fake.errorfArgsForCall = append(fake.errorfArgsForCall, struct {
+		format string
+		a      []interface{}
+	}{format, a})
+	fake.errorfMutex.Unlock()
+	if fake.ErrorfStub != nil {
+		return fake.ErrorfStub(format, a...)
+	} else {
+		return fake.errorfReturns.result1, fake.errorfReturns.result2
+	}
+}
+
+func (fake *FakeLogger) ErrorfCallCount() int {
+	fake.errorfMutex.RLock()
+	defer fake.errorfMutex.RUnlock()
+	return len(fake.errorfArgsForCall)
+}
+
+func (fake *FakeLogger) ErrorfArgsForCall(i int) (string, []interface{}) {
+	fake.errorfMutex.RLock()
+	defer fake.errorfMutex.RUnlock()
+	return fake.errorfArgsForCall[i].format, fake.errorfArgsForCall[i].a
+}
+
+func (fake *FakeLogger) ErrorfReturns(result1 int, result2 error) {
+	fake.ErrorfStub = nil
+	fake.errorfReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLogger) Warnf(format string, a ...interface{}) (n int, err error) {
+	fake.warnfMutex.Lock()
+	fake.warnfArgsForCall = append(fake.warnfArgsForCall, struct {
+		format string
+		a      []interface{}
+	}{format, a})
+	fake.warnfMutex.Unlock()
+	if fake.WarnfStub != nil {
+		return fake.WarnfStub(format, a...)
+	} else {
+		return fake.warnfReturns.result1, fake.warnfReturns.result2
+	}
+}
+
+func (fake *FakeLogger) WarnfCallCount() int {
+	fake.warnfMutex.RLock()
+	defer fake.warnfMutex.RUnlock()
+	return len(fake.warnfArgsForCall)
+}
+
+func (fake *FakeLogger) WarnfArgsForCall(i int) (string, []interface{}) {
+	fake.warnfMutex.RLock()
+	defer fake.warnfMutex.RUnlock()
+	return fake.warnfArgsForCall[i].format, fake.warnfArgsForCall[i].a
+}
+
+func (fake *FakeLogger) WarnfReturns(result1 int, result2 error) {
+	fake.WarnfStub = nil
+	fake.warnfReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLogger) Infof(format string, a ...interface{}) (n int, err error) {
+	fake.infofMutex.Lock()
+	fake.infofArgsForCall = append(fake.infofArgsForCall, struct {
+		format string
+		a      []interface{}
+	}{format, a})
+	fake.infofMutex.Unlock()
+	if fake.InfofStub != nil {
+		return fake.InfofStub(format, a...)
+	} else {
+		return fake.infofReturns.result1, fake.infofReturns.result2
+	}
+}
+
+func (fake *FakeLogger) InfofCallCount() int {
+	fake.infofMutex.RLock()
+	defer fake.infofMutex.RUnlock()
+	return len(fake.infofArgsForCall)
+}
+
+func (fake *FakeLogger) InfofArgsForCall(i int) (string, []interface{}) {
+	fake.infofMutex.RLock()
+	defer fake.infofMutex.RUnlock()
+	return fake.infofArgsForCall[i].format, fake.infofArgsForCall[i].a
+}
+
+func (fake *FakeLogger) InfofReturns(result1 int, result2 error) {
+	fake.InfofStub = nil
+	fake.infofReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeLogger) Debugf(format string, a ...interface{}) (n int, err error) {
 	fake.debugfMutex.Lock()
 	fake.debugfArgsForCall = append(fake.debugfArgsForCall, struct {
@@ -5,22 +5,153 @@ import (
 	"io"
 )
 
+// Level is the verbosity of a logger. Messages are only written if they are
+// at or below the level of the logger.
+type Level int
+
+const (
+	// LevelNone discards every message.
+	LevelNone Level = iota - 1
+	LevelError
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = map[string]Level{
+	"error": LevelError,
+	"warn":  LevelWarn,
+	"info":  LevelInfo,
+	"debug": LevelDebug,
+}
+
+// ParseLevel returns the level with the name. An empty name is the debug
+// level, so everything is logged unless a level is configured.
+func ParseLevel(name string) (Level, error) {
+	if name == "" {
+		return LevelDebug, nil
+	}
+
+	level, ok := levelNames[name]
+	if !ok {
+		return LevelDebug, fmt.Errorf(
+			"%s must be one of error, warn, info or debug - got %s",
+			"log_level",
+			name,
+		)
+	}
+
+	return level, nil
+}
+
+// ParseStderrLevel returns the level of the messages a command writes to
+// stderr, as well as to its log file. Nothing is written to stderr unless the
+// level is named, other than the timings at the info level if they are
+// emitted.
+func ParseStderrLevel(name string, timings bool) (Level, error) {
+	if name == "" {
+		if timings {
+			return LevelInfo, nil
+		}
+		return LevelNone, nil
+	}
+
+	return ParseLevel(name)
+}
+
 //go:generate counterfeiter . Logger
 
 type Logger interface {
+	Errorf(format string, a ...interface{}) (n int, err error)
+	Warnf(format string, a ...interface{}) (n int, err error)
+	Infof(format string, a ...interface{}) (n int, err error)
 	Debugf(format string, a ...interface{}) (n int, err error)
 }
 
 type logger struct {
-	sink io.Writer
+	sink  io.Writer
+	level Level
 }
 
+// NewLogger returns a logger that writes messages of every level to the sink.
 func NewLogger(sink io.Writer) Logger {
+	return NewLevelLogger(sink, LevelDebug)
+}
+
+// NewLevelLogger returns a logger that writes messages at or below the level
+// to the sink. Messages above the level are discarded before reaching the
+// sink, so a sanitizing sink still sees every message that is written.
+func NewLevelLogger(sink io.Writer, level Level) Logger {
 	return &logger{
-		sink: sink,
+		sink:  sink,
+		level: level,
 	}
 }
 
+func (l logger) Errorf(format string, a ...interface{}) (int, error) {
+	return l.logf(LevelError, format, a...)
+}
+
+func (l logger) Warnf(format string, a ...interface{}) (int, error) {
+	return l.logf(LevelWarn, format, a...)
+}
+
+func (l logger) Infof(format string, a ...interface{}) (int, error) {
+	return l.logf(LevelInfo, format, a...)
+}
+
 func (l logger) Debugf(format string, a ...interface{}) (int, error) {
+	return l.logf(LevelDebug, format, a...)
+}
+
+func (l logger) logf(level Level, format string, a ...interface{}) (int, error) {
+	if level > l.level {
+		return 0, nil
+	}
+
 	return fmt.Fprintf(l.sink, format, a...)
 }
+
+type teeLogger struct {
+	loggers []Logger
+}
+
+// NewTeeLogger returns a logger that passes every message on to each of the
+// loggers, which apply their own level. It returns the result of the first.
+func NewTeeLogger(loggers ...Logger) Logger {
+	return &teeLogger{
+		loggers: loggers,
+	}
+}
+
+func (t teeLogger) Errorf(format string, a ...interface{}) (int, error) {
+	return t.each(func(l Logger) (int, error) { return l.Errorf(format, a...) })
+}
+
+func (t teeLogger) Warnf(format string, a ...interface{}) (int, error) {
+	return t.each(func(l Logger) (int, error) { return l.Warnf(format, a...) })
+}
+
+func (t teeLogger) Infof(format string, a ...interface{}) (int, error) {
+	return t.each(func(l Logger) (int, error) { return l.Infof(format, a...) })
+}
+
+func (t teeLogger) Debugf(format string, a ...interface{}) (int, error) {
+	return t.each(func(l Logger) (int, error) { return l.Debugf(format, a...) })
+}
+
+func (t teeLogger) each(logf func(Logger) (int, error)) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	for i, l := range t.loggers {
+		written, logErr := logf(l)
+		if i == 0 {
+			n, err = written, logErr
+		}
+	}
+
+	return n, err
+}
@@ -9,7 +9,9 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
 )
 
 var _ = Describe("Logger", func() {
@@ -61,4 +63,164 @@ var _ = Describe("Logger", func() {
 			})
 		})
 	})
+
+	Describe("NewLevelLogger", func() {
+		var sink *gbytes.Buffer
+
+		BeforeEach(func() {
+			sink = gbytes.NewBuffer()
+			l = logger.NewLevelLogger(sink, logger.LevelWarn)
+		})
+
+		It("writes messages at or below the level", func() {
+			l.Errorf("some error\n")
+			l.Warnf("some warning\n")
+
+			Expect(string(sink.Contents())).To(Equal("some error\nsome warning\n"))
+		})
+
+		It("discards messages above the level", func() {
+			l.Infof("some info\n")
+			l.Debugf("some debug\n")
+
+			Expect(sink.Contents()).To(BeEmpty())
+		})
+
+		Context("when the sink is a sanitizer", func() {
+			BeforeEach(func() {
+				s := sanitizer.NewSanitizer(map[string]string{"some-secret": "***REDACTED***"}, sink)
+				l = logger.NewLevelLogger(s, logger.LevelError)
+			})
+
+			It("still sanitizes the messages that are written", func() {
+				l.Errorf("token: %s\n", "some-secret")
+
+				Expect(string(sink.Contents())).To(Equal("token: ***REDACTED***\n"))
+			})
+		})
+	})
+
+	Describe("NewTeeLogger", func() {
+		var (
+			fileSink   *gbytes.Buffer
+			stderrSink *gbytes.Buffer
+		)
+
+		BeforeEach(func() {
+			fileSink = gbytes.NewBuffer()
+			stderrSink = gbytes.NewBuffer()
+			l = logger.NewTeeLogger(
+				logger.NewLogger(fileSink),
+				logger.NewLevelLogger(stderrSink, logger.LevelWarn),
+			)
+		})
+
+		It("passes every message on to each logger, which applies its level", func() {
+			l.Warnf("some warning\n")
+			l.Debugf("some debug\n")
+
+			Expect(string(fileSink.Contents())).To(Equal("some warning\nsome debug\n"))
+			Expect(string(stderrSink.Contents())).To(Equal("some warning\n"))
+		})
+
+		It("returns the result of the first logger", func() {
+			n, err := l.Debugf("some debug\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(len("some debug\n")))
+		})
+	})
+
+	Describe("Recorder", func() {
+		var (
+			sink     *gbytes.Buffer
+			recorder *logger.Recorder
+		)
+
+		BeforeEach(func() {
+			sink = gbytes.NewBuffer()
+			recorder = logger.NewRecorder(logger.NewLevelLogger(sink, logger.LevelError))
+		})
+
+		It("records warnings without their prefix", func() {
+			recorder.Warnf("Warning: skipping file %s\n", "some-file")
+			recorder.Warnf("another warning\n")
+
+			Expect(recorder.Warnings()).To(Equal([]string{
+				"skipping file some-file",
+				"another warning",
+			}))
+		})
+
+		It("passes messages on to the wrapped logger, which applies its level", func() {
+			recorder.Errorf("some error\n")
+			recorder.Warnf("Warning: some warning\n")
+
+			Expect(string(sink.Contents())).To(Equal("some error\n"))
+		})
+
+		It("does not record messages at other levels", func() {
+			recorder.Errorf("some error\n")
+			recorder.Infof("some info\n")
+
+			Expect(recorder.Warnings()).To(BeEmpty())
+		})
+	})
+
+	Describe("ParseLevel", func() {
+		It("returns the level with the name", func() {
+			level, err := logger.ParseLevel("info")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(level).To(Equal(logger.LevelInfo))
+		})
+
+		Context("when the name is empty", func() {
+			It("returns the debug level", func() {
+				level, err := logger.ParseLevel("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(level).To(Equal(logger.LevelDebug))
+			})
+		})
+
+		Context("when the name is unknown", func() {
+			It("returns an error", func() {
+				_, err := logger.ParseLevel("verbose")
+				Expect(err).To(MatchError("log_level must be one of error, warn, info or debug - got verbose"))
+			})
+		})
+	})
+
+	Describe("ParseStderrLevel", func() {
+		It("returns the level with the name", func() {
+			level, err := logger.ParseStderrLevel("warn", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(level).To(Equal(logger.LevelWarn))
+		})
+
+		Context("when the name is empty", func() {
+			It("returns the level that discards every message", func() {
+				level, err := logger.ParseStderrLevel("", false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(level).To(Equal(logger.LevelNone))
+
+				sink := gbytes.NewBuffer()
+				logger.NewLevelLogger(sink, level).Errorf("some error\n")
+				Expect(sink.Contents()).To(BeEmpty())
+			})
+
+			Context("when timings are emitted", func() {
+				It("returns the info level so the timings are written", func() {
+					level, err := logger.ParseStderrLevel("", true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(level).To(Equal(logger.LevelInfo))
+				})
+			})
+		})
+
+		Context("when the name is unknown", func() {
+			It("returns an error", func() {
+				_, err := logger.ParseStderrLevel("verbose", false)
+				Expect(err).To(MatchError("log_level must be one of error, warn, info or debug - got verbose"))
+			})
+		})
+	})
 })
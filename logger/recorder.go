@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Recorder is a logger that records the warnings written through it, so they
+// can be reported somewhere other than the log, and passes every message on
+// to the logger it wraps.
+type Recorder struct {
+	Logger
+
+	warnings []string
+}
+
+// NewRecorder returns a recorder wrapping the logger.
+func NewRecorder(l Logger) *Recorder {
+	return &Recorder{
+		Logger: l,
+	}
+}
+
+// Warnf records the warning, whatever the level of the wrapped logger, and
+// logs it. The "Warning: " prefix of the message and surrounding whitespace
+// are not recorded.
+func (r *Recorder) Warnf(format string, a ...interface{}) (int, error) {
+	warning := strings.TrimSpace(fmt.Sprintf(format, a...))
+	r.warnings = append(r.warnings, strings.TrimPrefix(warning, "Warning: "))
+
+	return r.Logger.Warnf(format, a...)
+}
+
+// Warnings returns the recorded warnings in the order they were logged.
+func (r *Recorder) Warnings() []string {
+	return r.warnings
+}
@@ -0,0 +1,192 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/filter"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
+	"github.com/pivotal-cf-experimental/pivnet-resource/s3"
+)
+
+// maxSystemRequirementsBytes is the size of the largest system requirements
+// file that is read, far more than any real list of requirements.
+const maxSystemRequirementsBytes = 64 * 1024
+
+// Manifest holds the Pivotal Network metadata of the files to upload. It is
+// read from JSON, e.g.
+//
+//	{"files": [{"file": "*.pivotal", "description": "The tile"}]}
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// File is the metadata of every file matching the glob or name in File.
+type File struct {
+	File        string `json:"file"`
+	Description string `json:"description"`
+	DocsURL     string `json:"docs_url"`
+	FileType    string `json:"file_type"`
+	FileGroup   string `json:"file_group"`
+
+	// Labels are rendered into the description of the product file, from
+	// which the in command parses them back.
+	Labels []string `json:"labels"`
+
+	// S3Region and S3Bucket override the region and bucket the file is
+	// uploaded to.
+	S3Region string `json:"s3_region"`
+	S3Bucket string `json:"s3_bucket"`
+
+	// SystemRequirementsFile is the path of a file listing the system
+	// requirements of the file, one per line, which are read into
+	// SystemRequirements by the out command.
+	SystemRequirementsFile string   `json:"system_requirements_file"`
+	SystemRequirements     []string `json:"-"`
+}
+
+// Read returns the manifest at the path, or an error if it cannot be parsed
+// or any entry is invalid.
+func Read(path string) (Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var m Manifest
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return Manifest{}, fmt.Errorf(
+			"failed to parse metadata manifest %s - it must be JSON: %s",
+			path,
+			err.Error(),
+		)
+	}
+
+	for i, f := range m.Files {
+		if f.File == "" {
+			return Manifest{}, fmt.Errorf("metadata manifest entry %d must provide %s", i, "file")
+		}
+
+		_, err := filepath.Match(f.File, "")
+		if err != nil {
+			return Manifest{}, fmt.Errorf(
+				"metadata manifest entry %s is not a valid glob: %s",
+				f.File,
+				err.Error(),
+			)
+		}
+
+		if f.FileType != "" {
+			err := filter.ValidateFileTypes([]string{f.FileType})
+			if err != nil {
+				return Manifest{}, fmt.Errorf(
+					"metadata manifest entry %s: %s",
+					f.File,
+					err.Error(),
+				)
+			}
+		}
+
+		err = labels.ValidateFileLabels(f.Labels)
+		if err != nil {
+			return Manifest{}, fmt.Errorf(
+				"metadata manifest entry %s: %s",
+				f.File,
+				err.Error(),
+			)
+		}
+
+		if f.S3Region != "" {
+			err := s3.ValidateRegion(f.S3Region)
+			if err != nil {
+				return Manifest{}, fmt.Errorf(
+					"metadata manifest entry %s: %s",
+					f.File,
+					err.Error(),
+				)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// ReadSystemRequirements returns the lines of the system requirements file at
+// the path, without blank lines and surrounding whitespace. It returns an
+// error if the file is too large or is not UTF-8.
+func ReadSystemRequirements(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() > maxSystemRequirementsBytes {
+		return nil, fmt.Errorf(
+			"system_requirements_file %s is %d bytes - it must be at most %d bytes",
+			path,
+			info.Size(),
+			maxSystemRequirementsBytes,
+		)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utf8.Valid(b) {
+		return nil, fmt.Errorf("system_requirements_file %s must be UTF-8", path)
+	}
+
+	var requirements []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			requirements = append(requirements, line)
+		}
+	}
+
+	return requirements, nil
+}
+
+// Match returns the metadata of each of the files by file name. Entries are
+// matched against both the path and the file name, and the first matching
+// entry applies. It returns an error if any entry matches none of the files,
+// e.g. because the file it refers to was renamed.
+func (m Manifest) Match(files []string) (map[string]File, error) {
+	matches := map[string]File{}
+	for _, entry := range m.Files {
+		matched := false
+		for _, f := range files {
+			name := filepath.Base(f)
+
+			for _, candidate := range []string{f, name} {
+				ok, _ := filepath.Match(entry.File, candidate)
+				if !ok {
+					continue
+				}
+
+				matched = true
+				if _, exists := matches[name]; !exists {
+					matches[name] = entry
+				}
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf(
+				"metadata manifest entry %s matches none of the files to upload: %v",
+				entry.File,
+				files,
+			)
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,194 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/manifest"
+)
+
+var _ = Describe("Manifest", func() {
+	var (
+		tempDir      string
+		manifestPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		manifestPath = filepath.Join(tempDir, "manifest.json")
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(tempDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	writeManifest := func(contents string) {
+		err := ioutil.WriteFile(manifestPath, []byte(contents), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Describe("Read", func() {
+		It("reads the metadata of each entry", func() {
+			writeManifest(`{
+  "files": [
+    {"file": "*.pivotal", "description": "The tile", "docs_url": "https://docs.example.com", "file_type": "Software"},
+    {"file": "LICENSE", "file_type": "Open Source License"}
+  ]
+}`)
+
+			m, err := manifest.Read(manifestPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(m.Files).To(Equal([]manifest.File{
+				{File: "*.pivotal", Description: "The tile", DocsURL: "https://docs.example.com", FileType: "Software"},
+				{File: "LICENSE", FileType: "Open Source License"},
+			}))
+		})
+
+		Context("when the manifest cannot be parsed", func() {
+			It("returns an error", func() {
+				writeManifest("files:\n- file: '*.pivotal'\n")
+
+				_, err := manifest.Read(manifestPath)
+				Expect(err).To(MatchError(ContainSubstring("it must be JSON")))
+			})
+		})
+
+		Context("when an entry has no file", func() {
+			It("returns an error", func() {
+				writeManifest(`{"files": [{"description": "The tile"}]}`)
+
+				_, err := manifest.Read(manifestPath)
+				Expect(err).To(MatchError("metadata manifest entry 0 must provide file"))
+			})
+		})
+
+		Context("when an entry has an unknown file type", func() {
+			It("returns an error", func() {
+				writeManifest(`{"files": [{"file": "*.pivotal", "file_type": "Tile"}]}`)
+
+				_, err := manifest.Read(manifestPath)
+				Expect(err).To(MatchError(HavePrefix("metadata manifest entry *.pivotal: unknown file type: Tile")))
+			})
+		})
+
+		Context("when an entry overrides the s3 region and bucket", func() {
+			It("reads the overrides", func() {
+				writeManifest(`{"files": [{"file": "*.pivotal", "s3_region": "us-gov-east-1", "s3_bucket": "local-bucket"}]}`)
+
+				m, err := manifest.Read(manifestPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(m.Files[0].S3Region).To(Equal("us-gov-east-1"))
+				Expect(m.Files[0].S3Bucket).To(Equal("local-bucket"))
+			})
+
+			Context("when the region is not valid", func() {
+				It("returns an error", func() {
+					writeManifest(`{"files": [{"file": "*.pivotal", "s3_region": "EU West"}]}`)
+
+					_, err := manifest.Read(manifestPath)
+					Expect(err).To(MatchError(
+						"metadata manifest entry *.pivotal: EU West is not a valid AWS region, e.g. eu-west-1"))
+				})
+			})
+		})
+
+		Context("when an entry is not a valid glob", func() {
+			It("returns an error", func() {
+				writeManifest(`{"files": [{"file": "["}]}`)
+
+				_, err := manifest.Read(manifestPath)
+				Expect(err).To(MatchError(HavePrefix("metadata manifest entry [ is not a valid glob")))
+			})
+		})
+	})
+
+	Describe("ReadSystemRequirements", func() {
+		var requirementsPath string
+
+		BeforeEach(func() {
+			requirementsPath = filepath.Join(tempDir, "requirements.txt")
+		})
+
+		writeRequirements := func(contents []byte) {
+			err := ioutil.WriteFile(requirementsPath, contents, os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("returns each non-blank line", func() {
+			writeRequirements([]byte("Ops Manager 2.10 or later\r\n\n  4 GB of memory per VM  \n"))
+
+			requirements, err := manifest.ReadSystemRequirements(requirementsPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requirements).To(Equal([]string{
+				"Ops Manager 2.10 or later",
+				"4 GB of memory per VM",
+			}))
+		})
+
+		Context("when the file is not UTF-8", func() {
+			It("returns an error", func() {
+				writeRequirements([]byte{0xff, 0xfe, 'a'})
+
+				_, err := manifest.ReadSystemRequirements(requirementsPath)
+				Expect(err).To(MatchError(ContainSubstring("must be UTF-8")))
+			})
+		})
+
+		Context("when the file is too large", func() {
+			It("returns an error", func() {
+				writeRequirements([]byte(strings.Repeat("a", 64*1024+1)))
+
+				_, err := manifest.ReadSystemRequirements(requirementsPath)
+				Expect(err).To(MatchError(ContainSubstring("it must be at most 65536 bytes")))
+			})
+		})
+
+		Context("when the file does not exist", func() {
+			It("returns an error", func() {
+				_, err := manifest.ReadSystemRequirements(filepath.Join(tempDir, "missing"))
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Match", func() {
+		var m manifest.Manifest
+
+		BeforeEach(func() {
+			m = manifest.Manifest{Files: []manifest.File{
+				{File: "tiles/*.pivotal", Description: "The tile"},
+				{File: "*", Description: "Everything else"},
+			}}
+		})
+
+		It("returns the first matching entry by file name", func() {
+			matches, err := m.Match([]string{"tiles/product.pivotal", "README.md"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(matches).To(Equal(map[string]manifest.File{
+				"product.pivotal": m.Files[0],
+				"README.md":       m.Files[1],
+			}))
+		})
+
+		Context("when an entry matches none of the files", func() {
+			It("returns an error", func() {
+				m.Files = append(m.Files, manifest.File{File: "missing.zip"})
+
+				_, err := m.Match([]string{"tiles/product.pivotal"})
+				Expect(err).To(MatchError(
+					"metadata manifest entry missing.zip matches none of the files to upload: [tiles/product.pivotal]"))
+			})
+		})
+	})
+})
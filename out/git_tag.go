@@ -0,0 +1,32 @@
+package out
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// latestGitTag returns the most recent tag reachable from the HEAD of the git
+// repository in the directory.
+func latestGitTag(ctx context.Context, dir string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", "describe", "--tags", "--abbrev=0")
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf(
+			"failed to find the latest git tag in %s: %s - %s",
+			dir,
+			err.Error(),
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
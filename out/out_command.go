@@ -1,35 +1,77 @@
 package out
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/pivotal-cf-experimental/pivnet-resource/checksum"
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
-	"github.com/pivotal-cf-experimental/pivnet-resource/md5"
+	"github.com/pivotal-cf-experimental/pivnet-resource/manifest"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/presigned"
+	"github.com/pivotal-cf-experimental/pivnet-resource/progress"
 	"github.com/pivotal-cf-experimental/pivnet-resource/s3"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/timing"
+	"github.com/pivotal-cf-experimental/pivnet-resource/tlsconfig"
 	"github.com/pivotal-cf-experimental/pivnet-resource/uploader"
 	"github.com/pivotal-cf-experimental/pivnet-resource/useragent"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
 const (
 	defaultBucket = "pivotalnetwork"
 	defaultRegion = "eu-west-1"
+
+	releaseDateFormat = "2006-01-02"
+
+	minMultipartChunkSize = 5 * 1024 * 1024
+	maxMultipartChunkSize = 5 * 1024 * 1024 * 1024
+
+	defaultS3UploadRetryDelay = 10 * time.Second
+
+	defaultWaitTimeout      = 5 * time.Minute
+	defaultWaitPollInterval = 10 * time.Second
+
+	sseAES256 = "AES256"
+	sseKMS    = "aws:kms"
+
+	uploadBackendS3        = "s3"
+	uploadBackendPresigned = "presigned"
+
+	modeCreate = "create"
+	modeAttach = "attach"
+	modeMirror = "mirror"
+
+	versionFromFile   = "file"
+	versionFromGitTag = "git_tag"
+
+	updateFieldAvailability     = "availability"
+	updateFieldEndOfSupportDate = "end_of_support_date"
 )
 
 type OutCommand struct {
+	ctx             context.Context
 	binaryVersion   string
 	logger          logger.Logger
 	outDir          string
 	sourcesDir      string
 	logFilePath     string
 	s3OutBinaryName string
+	sanitizer       sanitizer.Sanitizer
+	timer           timing.Timer
 }
 
 type OutCommandConfig struct {
@@ -39,25 +81,55 @@ type OutCommandConfig struct {
 	SourcesDir      string
 	LogFilePath     string
 	S3OutBinaryName string
+
+	// Sanitizer, if set, redacts credentials that are issued while the
+	// command runs, e.g. federated S3 credentials.
+	Sanitizer sanitizer.Sanitizer
+
+	// Context aborts in-flight Pivnet requests and uploads when it is
+	// cancelled. Defaults to context.Background().
+	Context context.Context
 }
 
 func NewOutCommand(config OutCommandConfig) *OutCommand {
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	return &OutCommand{
+		ctx:             ctx,
 		binaryVersion:   config.BinaryVersion,
 		logger:          config.Logger,
 		outDir:          config.OutDir,
 		sourcesDir:      config.SourcesDir,
 		logFilePath:     config.LogFilePath,
 		s3OutBinaryName: config.S3OutBinaryName,
+		sanitizer:       config.Sanitizer,
 	}
 }
 
 func (c *OutCommand) Run(input concourse.OutRequest) (concourse.OutResponse, error) {
+	// Warnings are recorded for the whole put, including those of the
+	// clients, which are created with the logger of the command.
+	var recorder *logger.Recorder
+	if input.Params.WarningsMetadata {
+		recorder = logger.NewRecorder(c.logger)
+		defer func(l logger.Logger) { c.logger = l }(c.logger)
+		c.logger = recorder
+	}
+
+	c.timer = timing.NewTimer(c.logger, input.Source.EmitTimings)
+
 	if c.outDir == "" {
 		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "out dir")
 	}
 
-	if input.Source.APIToken == "" {
+	token := input.Source.APIToken
+	if input.Params.APIToken != "" {
+		token = input.Params.APIToken
+	}
+	if token == "" {
 		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "api_token")
 	}
 
@@ -65,27 +137,282 @@ func (c *OutCommand) Run(input concourse.OutRequest) (concourse.OutResponse, err
 		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "product_slug")
 	}
 
-	if input.Params.VersionFile == "" {
-		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "version_file")
+	switch input.Params.VersionFrom {
+	case "", versionFromFile:
+		if input.Params.VersionFile == "" {
+			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "version_file")
+		}
+
+		for _, p := range []struct {
+			name     string
+			provided bool
+		}{
+			{"version_git_dir", input.Params.VersionGitDir != ""},
+			{"version_tag_prefix", input.Params.VersionTagPrefix != ""},
+		} {
+			if p.provided {
+				return concourse.OutResponse{}, fmt.Errorf(
+					"%s may only be provided when %s is %s",
+					p.name,
+					"version_from",
+					versionFromGitTag,
+				)
+			}
+		}
+	case versionFromGitTag:
+		if input.Params.VersionGitDir == "" {
+			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "version_git_dir")
+		}
+
+		if input.Params.VersionFile != "" {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s may only be provided when %s is %s",
+				"version_file",
+				"version_from",
+				versionFromFile,
+			)
+		}
+	default:
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s must be one of %s or %s - got %s",
+			"version_from",
+			versionFromFile,
+			versionFromGitTag,
+			input.Params.VersionFrom,
+		)
+	}
+
+	switch input.Params.Mode {
+	case "", modeCreate, modeAttach, modeMirror:
+	default:
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s must be one of %s, %s or %s - got %s",
+			"mode",
+			modeCreate,
+			modeAttach,
+			modeMirror,
+			input.Params.Mode,
+		)
+	}
+
+	err := versions.ValidateFormat("version_format", input.Source.VersionFormat)
+	if err != nil {
+		return concourse.OutResponse{}, err
+	}
+
+	for i, d := range input.Params.DependencySpecifiers {
+		key := fmt.Sprintf("dependency_specifiers[%d]", i)
+		if d.ProductSlug == "" {
+			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", key+".product_slug")
+		}
+
+		if d.Specifier == "" {
+			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", key+".specifier")
+		}
+
+		if !versions.IsSpecifier(d.Specifier) {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be a version range such as >=2.0 <3.0 or 2.1.* - got %s",
+				key+".specifier",
+				d.Specifier,
+			)
+		}
+	}
+
+	// In attach mode the release already exists, so only files are added to
+	// it and none of the settings of the release may be provided.
+	attach := input.Params.Mode == modeAttach
+	if provided := releaseParams(input.Params); attach && len(provided) > 0 {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may not be provided when %s is %s",
+			provided[0],
+			"mode",
+			modeAttach,
+		)
+	}
+
+	if input.Params.Resume && attach {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may not be provided when %s is %s",
+			"resume",
+			"mode",
+			modeAttach,
+		)
+	}
+
+	if input.Params.Resume && input.Params.CleanupOnFailure {
+		return concourse.OutResponse{}, fmt.Errorf("%s may not be provided with %s", "cleanup_on_failure", "resume")
+	}
+
+	if input.Params.OverwriteExisting && !attach {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may only be provided when %s is %s",
+			"overwrite_existing",
+			"mode",
+			modeAttach,
+		)
+	}
+
+	if input.Params.SyncFiles && !attach {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may only be provided when %s is %s",
+			"sync_files",
+			"mode",
+			modeAttach,
+		)
+	}
+
+	// update_fields restricts the settings applied to a release the put did
+	// not create, which are otherwise applied again over any manual edits.
+	if input.Params.UpdateFields != nil && !attach && !input.Params.Resume {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may only be provided when %s is %s or with %s",
+			"update_fields",
+			"mode",
+			modeAttach,
+			"resume",
+		)
+	}
+
+	for i, f := range input.Params.UpdateFields {
+		switch f {
+		case updateFieldAvailability, updateFieldEndOfSupportDate:
+		default:
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be one of %s or %s - got %s",
+				fmt.Sprintf("update_fields[%d]", i),
+				updateFieldAvailability,
+				updateFieldEndOfSupportDate,
+				f,
+			)
+		}
+	}
+
+	// In mirror mode the release with the same version in the mirrored
+	// product is the template, and its files are added to the new release.
+	mirror := input.Params.Mode == modeMirror
+	if mirror && input.Params.MirrorProductSlug == "" {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s must be provided when %s is %s",
+			"mirror_product_slug",
+			"mode",
+			modeMirror,
+		)
+	}
+
+	if input.Params.MirrorProductSlug != "" && !mirror {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may only be provided when %s is %s",
+			"mirror_product_slug",
+			"mode",
+			modeMirror,
+		)
+	}
+
+	for _, e := range []struct {
+		key      string
+		endpoint string
+	}{
+		{"endpoint", input.Source.Endpoint},
+		{"params.endpoint", input.Params.Endpoint},
+	} {
+		err := concourse.ValidateEndpoint(e.key, e.endpoint)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
+
+	if mirror && input.Params.TemplateVersion != "" {
+		return concourse.OutResponse{}, fmt.Errorf(
+			"%s may not be provided when %s is %s",
+			"template_version",
+			"mode",
+			modeMirror,
+		)
 	}
 
-	if input.Params.ReleaseTypeFile == "" {
+	templated := input.Params.TemplateVersion != "" || mirror
+
+	if input.Params.ReleaseTypeFile == "" && !templated && !attach {
 		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "release_type_file")
 	}
 
-	if input.Params.EulaSlugFile == "" {
+	if input.Params.EulaSlugFile == "" &&
+		input.Params.EulaID == 0 &&
+		!templated &&
+		!attach {
 		return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "eula_slug_file")
 	}
 
+	if input.Params.EulaID < 0 {
+		return concourse.OutResponse{}, fmt.Errorf("%s must not be negative", "eula_id")
+	}
+
+	if input.Params.ReleaseDate != "" {
+		if input.Params.ReleaseDateFile != "" {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"only one of %s or %s may be provided",
+				"release_date",
+				"release_date_file",
+			)
+		}
+
+		_, err := time.Parse(releaseDateFormat, input.Params.ReleaseDate)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be in the form YYYY-MM-DD - got %s",
+				"release_date",
+				input.Params.ReleaseDate,
+			)
+		}
+	}
+
+	if input.Params.EndOfSupportDate != "" {
+		_, err := time.Parse(releaseDateFormat, input.Params.EndOfSupportDate)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be in the form YYYY-MM-DD - got %s",
+				"end_of_support_date",
+				input.Params.EndOfSupportDate,
+			)
+		}
+	}
+
+	err = labels.Validate(input.Params.ReleaseLabels)
+	if err != nil {
+		return concourse.OutResponse{}, err
+	}
+
 	skipUpload := input.Params.FileGlob == "" && input.Params.FilepathPrefix == ""
 
+	uploadBackend := input.Params.UploadBackend
+	if uploadBackend == "" {
+		uploadBackend = uploadBackendS3
+	}
+
 	if !skipUpload {
-		if input.Source.AccessKeyID == "" {
-			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "access_key_id")
+		switch uploadBackend {
+		case uploadBackendS3, uploadBackendPresigned:
+		default:
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be one of %s or %s - got %s",
+				"upload_backend",
+				uploadBackendS3,
+				uploadBackendPresigned,
+				uploadBackend,
+			)
 		}
 
-		if input.Source.SecretAccessKey == "" {
-			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "secret_access_key")
+		// Without static AWS keys, temporary credentials are requested from
+		// Pivotal Network.
+		if uploadBackend == uploadBackendS3 {
+			if input.Source.AccessKeyID == "" && input.Source.SecretAccessKey != "" {
+				return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "access_key_id")
+			}
+
+			if input.Source.AccessKeyID != "" && input.Source.SecretAccessKey == "" {
+				return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "secret_access_key")
+			}
 		}
 
 		if input.Params.FileGlob == "" {
@@ -95,12 +422,158 @@ func (c *OutCommand) Run(input concourse.OutRequest) (concourse.OutResponse, err
 		if input.Params.FilepathPrefix == "" {
 			return concourse.OutResponse{}, fmt.Errorf("%s must be provided", "s3_filepath_prefix")
 		}
+
+		if input.Params.S3UploadConcurrency < 0 {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must not be negative", "s3_upload_concurrency")
+		}
+
+		if input.Params.UploadConcurrency < 0 {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must not be negative", "upload_concurrency")
+		}
+
+		if input.Params.S3UploadAttempts < 0 {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must not be negative", "s3_upload_attempts")
+		}
+
+		if input.Params.S3UploadRetryDelaySeconds < 0 {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must not be negative", "s3_upload_retry_delay_seconds")
+		}
+
+		switch input.Params.S3SSE {
+		case "", sseAES256, sseKMS:
+		default:
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be one of %s or %s - got %s",
+				"s3_sse",
+				sseAES256,
+				sseKMS,
+				input.Params.S3SSE,
+			)
+		}
+
+		// The presigned backend PUTs each file in a single request, so none
+		// of the params of s3-out apply to it.
+		if provided := s3OutParams(input.Params); uploadBackend != uploadBackendS3 && len(provided) > 0 {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s may only be provided when %s is %s",
+				provided[0],
+				"upload_backend",
+				uploadBackendS3,
+			)
+		}
+
+		if input.Params.S3KMSKeyID != "" && input.Params.S3SSE != sseKMS {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s may only be provided when %s is %s",
+				"s3_kms_key_id",
+				"s3_sse",
+				sseKMS,
+			)
+		}
+
+		chunkSize := input.Params.S3MultipartChunkSize
+		if chunkSize != 0 &&
+			(chunkSize < minMultipartChunkSize || chunkSize > maxMultipartChunkSize) {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"%s must be between %d and %d bytes - got %d",
+				"s3_multipart_chunk_size",
+				minMultipartChunkSize,
+				maxMultipartChunkSize,
+				chunkSize,
+			)
+		}
+	}
+
+	if input.Params.MinFiles < 0 {
+		return concourse.OutResponse{}, fmt.Errorf("%s must not be negative", "min_files")
+	}
+
+	if input.Params.WaitTimeoutSeconds < 0 {
+		return concourse.OutResponse{}, fmt.Errorf("%s must not be negative", "wait_timeout_seconds")
+	}
+
+	if input.Params.WaitPollIntervalSeconds < 0 {
+		return concourse.OutResponse{}, fmt.Errorf("%s must not be negative", "wait_poll_interval_seconds")
+	}
+
+	tlsConfig, err := tlsconfig.New(input.Source.CACert, input.Source.SkipSSLVerification)
+	if err != nil {
+		return concourse.OutResponse{}, err
 	}
 
 	c.logger.Debugf("Received input: %+v\n", input)
 
+	exactGlobs := []string{}
+	if !skipUpload && input.Params.FileGlob != "" {
+		globber := uploader.NewClient(uploader.Config{
+			FileGlob:     input.Params.FileGlob,
+			ExcludeGlobs: input.Params.ExcludeGlobs,
+			FileOrder:    input.Params.FileOrder,
+			SourcesDir:   c.sourcesDir,
+
+			Logger: c.logger,
+		})
+
+		var err error
+		exactGlobs, err = globber.ExactGlobs()
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
+
+	err = c.verifyRequiredFiles(input.Params, exactGlobs)
+	if err != nil {
+		return concourse.OutResponse{}, err
+	}
+
+	fileManifest := map[string]manifest.File{}
+	if input.Params.MetadataManifestJSON != "" {
+		m, err := manifest.Read(filepath.Join(c.sourcesDir, input.Params.MetadataManifestJSON))
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+
+		fileManifest, err = m.Match(exactGlobs)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+
+		for name, f := range fileManifest {
+			if (f.S3Region != "" || f.S3Bucket != "") && uploadBackend != uploadBackendS3 {
+				return concourse.OutResponse{}, fmt.Errorf(
+					"%s may only be provided when %s is %s",
+					"metadata manifest s3_region and s3_bucket",
+					"upload_backend",
+					uploadBackendS3,
+				)
+			}
+
+			if f.SystemRequirementsFile != "" {
+				f.SystemRequirements, err = manifest.ReadSystemRequirements(
+					filepath.Join(c.sourcesDir, f.SystemRequirementsFile),
+				)
+				if err != nil {
+					return concourse.OutResponse{}, fmt.Errorf(
+						"metadata manifest entry %s: %s",
+						f.File,
+						err.Error(),
+					)
+				}
+				fileManifest[name] = f
+			}
+		}
+	}
+
+	// The endpoint of the params lets a single resource put to more than
+	// one instance of Pivotal Network.
 	var endpoint string
-	if input.Source.Endpoint != "" {
+	if input.Params.Endpoint != "" {
+		endpoint = input.Params.Endpoint
+	} else if input.Source.Endpoint != "" {
 		endpoint = input.Source.Endpoint
 	} else {
 		endpoint = pivnet.Endpoint
@@ -108,193 +581,2087 @@ func (c *OutCommand) Run(input concourse.OutRequest) (concourse.OutResponse, err
 
 	productSlug := input.Source.ProductSlug
 
+	waitPollInterval := defaultWaitPollInterval
+	if input.Params.WaitPollIntervalSeconds > 0 {
+		waitPollInterval = time.Duration(input.Params.WaitPollIntervalSeconds) * time.Second
+	}
+
 	clientConfig := pivnet.NewClientConfig{
 		Endpoint:  endpoint,
-		Token:     input.Source.APIToken,
+		Token:     token,
 		UserAgent: useragent.UserAgent(c.binaryVersion, "put", productSlug),
+
+		Backoff: pivnet.BackoffConfig{
+			InitialInterval: waitPollInterval,
+		},
+		Debug:     input.Source.Debug,
+		Timings:   input.Source.EmitTimings,
+		Context:   c.ctx,
+		TLSConfig: tlsConfig,
+
+		ExtraHeaders: input.Source.ExtraHeaders,
 	}
 	pivnetClient := pivnet.NewClient(
 		clientConfig,
 		c.logger,
 	)
 
+	if input.Source.Debug {
+		user, err := pivnetClient.CurrentUser()
+		if err != nil {
+			c.logger.Debugf("Failed to get current user: %s\n", err.Error())
+		} else {
+			c.logger.Debugf("Authenticated as: {id: %d, email: %s}\n", user.ID, user.Email)
+		}
+	}
+
 	productVersion := readStringContents(c.sourcesDir, input.Params.VersionFile)
+	if input.Params.VersionFrom == versionFromGitTag {
+		productVersion, err = c.gitTagVersion(input.Params.VersionGitDir, input.Params.VersionTagPrefix)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
 
 	existingVersions, err := pivnetClient.ProductVersions(productSlug)
 	if err != nil {
 		return concourse.OutResponse{}, err
 	}
 
+	exists := false
 	for _, v := range existingVersions {
 		if v == productVersion {
-			return concourse.OutResponse{}, fmt.Errorf("release already exists with version: %s", productVersion)
+			exists = true
+			break
 		}
 	}
 
-	config := pivnet.CreateReleaseConfig{
-		ProductSlug:     productSlug,
-		ReleaseType:     readStringContents(c.sourcesDir, input.Params.ReleaseTypeFile),
-		EulaSlug:        readStringContents(c.sourcesDir, input.Params.EulaSlugFile),
-		ProductVersion:  productVersion,
-		Description:     readStringContents(c.sourcesDir, input.Params.DescriptionFile),
-		ReleaseNotesURL: readStringContents(c.sourcesDir, input.Params.ReleaseNotesURLFile),
-		ReleaseDate:     readStringContents(c.sourcesDir, input.Params.ReleaseDateFile),
+	if attach {
+		if !exists {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"release does not exist with version: %s - %s %s only adds files to an existing release",
+				productVersion,
+				"mode",
+				modeAttach,
+			)
+		}
+	} else if exists && !input.Params.Resume {
+		return concourse.OutResponse{}, fmt.Errorf("release already exists with version: %s", productVersion)
 	}
 
-	release, err := pivnetClient.CreateRelease(config)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	// A resumed put reuses the release a previous put created, which is the
+	// only record of its progress that outlives the put.
+	resumed := input.Params.Resume && exists
 
-	if skipUpload {
-		c.logger.Debugf("File glob and s3_filepath_prefix not provided - skipping upload to s3")
-	} else {
-		bucket := input.Source.Bucket
-		if bucket == "" {
-			bucket = defaultBucket
+	var template pivnet.Release
+	templateFiles := map[string]manifest.File{}
+	var templateUserGroupIDs []int
+	var templateDependencies []releaseDependency
+	if mirror {
+		c.logger.Debugf(
+			"Getting mirrored release: {product_slug: %s, version: %s}\n",
+			input.Params.MirrorProductSlug,
+			productVersion,
+		)
+
+		template, err = pivnetClient.GetRelease(input.Params.MirrorProductSlug, productVersion)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get release %s of mirrored product %s: %s",
+				productVersion,
+				input.Params.MirrorProductSlug,
+				err.Error(),
+			)
 		}
+	} else if input.Params.TemplateVersion != "" {
+		c.logger.Debugf(
+			"Getting template release: {product_slug: %s, version: %s}\n",
+			productSlug,
+			input.Params.TemplateVersion,
+		)
 
-		region := input.Source.Region
-		if region == "" {
-			region = defaultRegion
+		template, err = pivnetClient.GetRelease(productSlug, input.Params.TemplateVersion)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get template release %s: %s",
+				input.Params.TemplateVersion,
+				err.Error(),
+			)
 		}
 
-		logFile, err := os.OpenFile(c.logFilePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+		templateFiles, err = c.templateFiles(pivnetClient, template)
 		if err != nil {
-			panic(err)
+			return concourse.OutResponse{}, err
 		}
 
-		s3Client := s3.NewClient(s3.NewClientConfig{
-			AccessKeyID:     input.Source.AccessKeyID,
-			SecretAccessKey: input.Source.SecretAccessKey,
-			RegionName:      region,
-			Bucket:          bucket,
+		if input.Params.UserGroupIDsFile == "" {
+			templateUserGroupIDs, err = c.templateUserGroupIDs(pivnetClient, productSlug, template)
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+		}
 
-			Logger: c.logger,
+		if input.Params.DependenciesFile == "" {
+			templateDependencies, err = c.templateDependencies(pivnetClient, productSlug, template)
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+		}
+	}
 
-			Stdout: os.Stdout,
-			Stderr: logFile,
+	var templateEulaSlug string
+	if template.Eula != nil {
+		templateEulaSlug = template.Eula.Slug
+	}
 
-			OutBinaryPath: filepath.Join(c.outDir, c.s3OutBinaryName),
-		})
+	eulaSlug := readStringContents(c.sourcesDir, input.Params.EulaSlugFile)
+	if input.Params.EulaID != 0 {
+		c.logger.Debugf("Getting EULA: {eula_id: %d}\n", input.Params.EulaID)
 
-		uploaderClient := uploader.NewClient(uploader.Config{
-			FileGlob:       input.Params.FileGlob,
-			FilepathPrefix: input.Params.FilepathPrefix,
-			SourcesDir:     c.sourcesDir,
+		eula, err := pivnetClient.EULA(input.Params.EulaID)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get EULA %d: %s",
+				input.Params.EulaID,
+				err.Error(),
+			)
+		}
 
-			Logger: c.logger,
+		if eulaSlug != "" && eulaSlug != eula.Slug {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"eula_id %d is EULA %s but eula_slug_file contains %s",
+				input.Params.EulaID,
+				eula.Slug,
+				eulaSlug,
+			)
+		}
 
-			Transport: s3Client,
-		})
+		eulaSlug = eula.Slug
+	} else {
+		eulaSlug = c.inherit("eula_slug", eulaSlug, templateEulaSlug)
+	}
 
-		exactGlobs, err := uploaderClient.ExactGlobs()
+	var federated *federation
+	if !skipUpload && uploadBackend == uploadBackendS3 && input.Source.AccessKeyID == "" {
+		federated, err = c.newFederation(pivnetClient, productSlug)
 		if err != nil {
-			log.Fatalln(err)
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get federated S3 credentials: %s",
+				err.Error(),
+			)
 		}
+	}
 
-		for _, exactGlob := range exactGlobs {
-			fullFilepath := filepath.Join(c.sourcesDir, exactGlob)
-			fileContentsMD5, err := md5.NewFileContentsSummer(fullFilepath).Sum()
-			if err != nil {
-				log.Fatalln(err)
-			}
+	_, templateDescription, err := labels.Parse(template.Description)
+	if err != nil {
+		templateDescription = template.Description
+	}
 
-			remotePath, err := uploaderClient.UploadFile(exactGlob)
-			if err != nil {
-				return concourse.OutResponse{}, err
-			}
+	availability := c.inherit(
+		"availability",
+		readStringContents(c.sourcesDir, input.Params.AvailabilityFile),
+		template.Availability,
+	)
 
-			product, err := pivnetClient.FindProductForSlug(productSlug)
-			if err != nil {
-				log.Fatalln(err)
-			}
+	releaseDate := input.Params.ReleaseDate
+	if releaseDate == "" {
+		releaseDate = readStringContents(c.sourcesDir, input.Params.ReleaseDateFile)
+	}
 
-			filename := filepath.Base(exactGlob)
+	description := labels.Render(
+		input.Params.ReleaseLabels,
+		c.inherit(
+			"description",
+			readStringContents(c.sourcesDir, input.Params.DescriptionFile),
+			templateDescription,
+		),
+	)
+
+	controlled := template.Controlled
+	if input.Params.ExportControlled != nil {
+		if input.Params.TemplateVersion != "" && *input.Params.ExportControlled != controlled {
 			c.logger.Debugf(
-				"Creating product file: {product_slug: %s, filename: %s, aws_object_key: %s, file_version: %s}\n",
-				productSlug,
-				filename,
-				remotePath,
-				release.Version,
+				"Overriding template release: {setting: %s, value: %t, template_value: %t}\n",
+				"export_controlled",
+				*input.Params.ExportControlled,
+				controlled,
 			)
+		}
+		controlled = *input.Params.ExportControlled
+	} else if controlled {
+		c.logger.Debugf("Inherited from template release: {setting: %s, value: %t}\n", "export_controlled", true)
+	}
 
-			productFile, err := pivnetClient.CreateProductFile(pivnet.CreateProductFileConfig{
-				ProductSlug:  productSlug,
-				Name:         filename,
-				AWSObjectKey: remotePath,
-				FileVersion:  release.Version,
-				MD5:          fileContentsMD5,
-			})
-			if err != nil {
-				log.Fatalln(err)
-			}
+	config := pivnet.CreateReleaseConfig{
+		ProductSlug: productSlug,
+		ReleaseType: c.inherit(
+			"release_type",
+			readStringContents(c.sourcesDir, input.Params.ReleaseTypeFile),
+			template.ReleaseType,
+		),
+		EulaSlug:       eulaSlug,
+		EulaID:         input.Params.EulaID,
+		ProductVersion: productVersion,
+		Description:    description,
+		ReleaseNotesURL: c.inherit(
+			"release_notes_url",
+			readStringContents(c.sourcesDir, input.Params.ReleaseNotesURLFile),
+			template.ReleaseNotesURL,
+		),
+		ReleaseDate: releaseDate,
+		Controlled:  controlled,
+	}
 
-			c.logger.Debugf(
-				"Adding product file: {product_slug: %s, product_id: %d, filename: %s, product_file_id: %d, release_id: %d}\n",
-				productSlug,
-				product.ID,
-				filename,
-				productFile.ID,
-				release.ID,
-			)
+	var dependencies []releaseDependency
+	if input.Params.DependenciesFile != "" {
+		dependencies, err = c.resolveDependencies(
+			pivnetClient,
+			readStringContents(c.sourcesDir, input.Params.DependenciesFile),
+		)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	} else if len(templateDependencies) > 0 {
+		c.logger.Debugf(
+			"Inherited from template release: {setting: %s, value: %d dependencies}\n",
+			"dependencies",
+			len(templateDependencies),
+		)
+		dependencies = templateDependencies
+	}
 
-			err = pivnetClient.AddProductFile(product.ID, release.ID, productFile.ID)
-			if err != nil {
-				log.Fatalln(err)
-			}
+	var release pivnet.Release
+	if resumed {
+		c.logger.Debugf(
+			"Resuming existing release: {product_slug: %s, version: %s}\n",
+			productSlug,
+			productVersion,
+		)
+
+		release, err = pivnetClient.GetRelease(productSlug, productVersion)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get release %s to resume: %s",
+				productVersion,
+				err.Error(),
+			)
 		}
+	} else if attach {
+		c.logger.Debugf(
+			"Attaching files to existing release: {product_slug: %s, version: %s}\n",
+			productSlug,
+			productVersion,
+		)
 
+		release, err = pivnetClient.GetRelease(productSlug, productVersion)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to get release %s to attach files to: %s",
+				productVersion,
+				err.Error(),
+			)
+		}
+	} else {
+		release, err = pivnetClient.CreateRelease(config)
 		if err != nil {
-			log.Fatal(err)
+			return concourse.OutResponse{}, err
 		}
 	}
 
-	availability := readStringContents(c.sourcesDir, input.Params.AvailabilityFile)
-	if availability != "Admins Only" {
-		releaseUpdate := pivnet.Release{
-			ID:           release.ID,
-			Availability: availability,
+	// uploadedFiles holds the product file IDs of the files added to the
+	// release by file name, starting with those a resumed put already added.
+	uploadedFiles := map[string]int{}
+	var resumedFiles map[string]pivnet.ProductFile
+	if resumed {
+		resumedFiles, err = c.resumedFiles(pivnetClient, productSlug, release)
+		if err != nil {
+			return concourse.OutResponse{}, err
 		}
-		release, err = pivnetClient.UpdateRelease(productSlug, releaseUpdate)
+	}
+
+	if controlled && !release.Controlled {
+		c.logger.Warnf(
+			"Warning: export_controlled was requested but Pivnet did not mark the release as controlled - the product may not support it\n",
+		)
+	}
+
+	var replacedFiles map[string]pivnet.ProductFile
+	if attach && !skipUpload {
+		replacedFiles, err = c.replacedFiles(
+			pivnetClient,
+			release,
+			exactGlobs,
+			input.Params.OverwriteExisting,
+		)
 		if err != nil {
-			log.Fatalln(err)
+			return concourse.OutResponse{}, err
 		}
 
-		if availability == "Selected User Groups Only" {
-			userGroupIDs := strings.Split(
-				readStringContents(c.sourcesDir, input.Params.UserGroupIDsFile),
-				",",
-			)
+		if input.Params.SyncFiles {
+			staleFiles, err := c.staleFiles(pivnetClient, release, exactGlobs)
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+
+			for _, pf := range staleFiles {
+				c.logger.Infof(
+					"Removing file no longer matched by file_glob from release: {filename: %s, product_file_id: %d}\n",
+					pf.FileName(),
+					pf.ID,
+				)
 
-			for _, userGroupIDString := range userGroupIDs {
-				userGroupID, err := strconv.Atoi(userGroupIDString)
+				err = c.detachFile(pivnetClient, productSlug, release, pf)
 				if err != nil {
-					log.Fatalln(err)
+					return concourse.OutResponse{}, err
 				}
-
-				pivnetClient.AddUserGroup(productSlug, release.ID, userGroupID)
 			}
 		}
 	}
 
-	out := concourse.OutResponse{
-		Version: concourse.Version{
-			ProductVersion: release.Version,
-		},
-		Metadata: []concourse.Metadata{
-			{Name: "release_type", Value: release.ReleaseType},
-			{Name: "release_date", Value: release.ReleaseDate},
-			{Name: "description", Value: release.Description},
-			{Name: "release_notes_url", Value: release.ReleaseNotesURL},
-			{Name: "eula_slug", Value: release.Eula.Slug},
-			{Name: "availability", Value: release.Availability},
+	var fileMetadata []concourse.Metadata
+	if skipUpload {
+		c.logger.Debugf("File glob and s3_filepath_prefix not provided - skipping upload to s3")
+	} else {
+		// The uploads are cancelled once a file fails to be added, so that
+		// those in flight stop rather than delaying the failure.
+		uploadCtx, cancelUploads := context.WithCancel(c.ctx)
+		defer cancelUploads()
+
+		var transport uploader.Transport
+		var caBundlePath string
+		if uploadBackend == uploadBackendPresigned {
+			c.logger.Debugf("Uploading files to pre-signed URLs from Pivotal Network\n")
+
+			transport = presigned.NewClient(presigned.Config{
+				ProductSlug: productSlug,
+				URLCreator:  pivnetClient,
+				TLSConfig:   tlsConfig,
+				Context:     uploadCtx,
+				Logger:      c.logger,
+			})
+		} else {
+			stagingDir, err := c.stagingDir(input.Params.TmpDir)
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+			defer os.RemoveAll(stagingDir)
+
+			caBundlePath, err = c.writeCABundle(input.Source.CACert, stagingDir)
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+
+			transport, err = c.newS3Client(uploadCtx, input, caBundlePath, federated, "", "")
+			if err != nil {
+				return concourse.OutResponse{}, err
+			}
+		}
+
+		uploaderConfig := uploader.Config{
+			FileGlob:       input.Params.FileGlob,
+			ExcludeGlobs:   input.Params.ExcludeGlobs,
+			FileOrder:      input.Params.FileOrder,
+			FilepathPrefix: input.Params.FilepathPrefix,
+			SourcesDir:     c.sourcesDir,
+
+			Logger: c.logger,
+
+			Transport: transport,
+		}
+		uploaderClient := uploader.NewClient(uploaderConfig)
+
+		files := map[string]manifest.File{}
+		for _, exactGlob := range exactGlobs {
+			file := c.inheritFile(
+				filepath.Base(exactGlob),
+				fileManifest[filepath.Base(exactGlob)],
+				templateFiles[filepath.Base(exactGlob)],
+			)
+			if file.FileGroup == "" {
+				file.FileGroup = input.Params.FileGroup
+			}
+			files[exactGlob] = file
+		}
+
+		phases, err := uploaderClient.Phases(exactGlobs)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+
+		fileGroups := &fileGroupCache{fileGroups: map[string]pivnet.FileGroup{}}
+
+		// uploadedMutex guards the uploaded files, which files added
+		// concurrently update.
+		var uploadedMutex sync.Mutex
+
+		addFile := func(exactGlob string) (checksum.Sums, error) {
+			file := files[exactGlob]
+			filename := filepath.Base(exactGlob)
+
+			if resumedFile, ok := resumedFiles[filename]; ok {
+				sums, err := checksum.FileSums(filepath.Join(c.sourcesDir, exactGlob))
+				if err != nil {
+					return checksum.Sums{}, err
+				}
+
+				if resumedFile.MD5 != sums.MD5 {
+					return checksum.Sums{}, fmt.Errorf(
+						"file %s is already attached to release %s with md5 %s rather than %s - it cannot be resumed",
+						filename,
+						release.Version,
+						resumedFile.MD5,
+						sums.MD5,
+					)
+				}
+
+				c.logger.Debugf(
+					"Skipping file added by a previous put: {filename: %s, product_file_id: %d}\n",
+					filename,
+					resumedFile.ID,
+				)
+
+				uploadedMutex.Lock()
+				defer uploadedMutex.Unlock()
+
+				uploadedFiles[filename] = resumedFile.ID
+				return sums, nil
+			}
+
+			fileUploader := uploaderClient
+			if file.S3Region != "" || file.S3Bucket != "" {
+				c.logger.Debugf(
+					"Overriding s3 location: {filename: %s, region: %s, bucket: %s}\n",
+					filename,
+					file.S3Region,
+					file.S3Bucket,
+				)
+
+				transport, err := c.newS3Client(uploadCtx, input, caBundlePath, federated, file.S3Region, file.S3Bucket)
+				if err != nil {
+					return checksum.Sums{}, err
+				}
+
+				config := uploaderConfig
+				config.Transport = transport
+				fileUploader = uploader.NewClient(config)
+			}
+
+			sums, productFile, err := c.addFileToRelease(
+				pivnetClient,
+				fileUploader,
+				productSlug,
+				release,
+				exactGlob,
+				file,
+				fileGroups,
+			)
+			if err != nil {
+				return checksum.Sums{}, err
+			}
+
+			if existing, ok := replacedFiles[filename]; ok {
+				err = c.detachFile(pivnetClient, productSlug, release, existing)
+				if err != nil {
+					return checksum.Sums{}, err
+				}
+			}
+
+			uploadedMutex.Lock()
+			defer uploadedMutex.Unlock()
+
+			uploadedFiles[filename] = productFile.ID
+			return sums, nil
+		}
+
+		uploadConcurrency := input.Params.UploadConcurrency
+		if uploadConcurrency == 0 {
+			uploadConcurrency = 1
+		}
+
+		results, notAttempted := c.addFiles(phases, uploadConcurrency, addFile, cancelUploads)
+
+		var succeededFiles []string
+		var failedFiles []string
+		var failure error
+		for _, r := range results {
+			if r.err != nil {
+				failedFiles = append(failedFiles, r.exactGlob)
+				if failure == nil && !r.cancelled {
+					failure = r.err
+				}
+				continue
+			}
+
+			succeededFiles = append(succeededFiles, r.exactGlob)
+
+			filename := filepath.Base(r.exactGlob)
+			fileMetadata = append(fileMetadata,
+				concourse.Metadata{Name: "md5: " + filename, Value: r.sums.MD5},
+				concourse.Metadata{Name: "sha256: " + filename, Value: r.sums.SHA256},
+			)
+
+			if fileGroup := files[r.exactGlob].FileGroup; fileGroup != "" {
+				fileMetadata = append(fileMetadata,
+					concourse.Metadata{Name: "file_group: " + filename, Value: fileGroup},
+				)
+			}
+
+			if fileLabels := files[r.exactGlob].Labels; len(fileLabels) > 0 {
+				fileMetadata = append(fileMetadata,
+					concourse.Metadata{Name: "file_labels: " + filename, Value: strings.Join(fileLabels, ", ")},
+				)
+			}
+		}
+
+		if failure != nil {
+			return concourse.OutResponse{}, c.uploadFailure(
+				pivnetClient,
+				productSlug,
+				release,
+				input.Params.CleanupOnFailure,
+				succeededFiles,
+				strings.Join(failedFiles, ", "),
+				notAttempted,
+				failure,
+			)
+		}
+	}
+
+	if mirror {
+		mirroredMetadata, err := c.mirrorFiles(
+			pivnetClient,
+			productSlug,
+			release,
+			input.Params.MirrorProductSlug,
+			template,
+			resumedFiles,
+			uploadedFiles,
+		)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+		fileMetadata = append(fileMetadata, mirroredMetadata...)
+	}
+
+	// updatable reports whether the setting may be applied to the release.
+	// Only the settings in update_fields are applied to a release the put did
+	// not create, if it is provided.
+	updatable := func(field string) bool {
+		if (!attach && !resumed) || input.Params.UpdateFields == nil {
+			return true
+		}
+
+		for _, f := range input.Params.UpdateFields {
+			if f == field {
+				return true
+			}
+		}
+
+		c.logger.Debugf("Not updating release setting missing from update_fields: {setting: %s}\n", field)
+		return false
+	}
+
+	// The end of support date is the one setting of an existing release that
+	// attach mode updates, e.g. once files for its successor are added.
+	updateAvailability := !attach && availability != "Admins Only" && updatable(updateFieldAvailability)
+	updateEndOfSupportDate := input.Params.EndOfSupportDate != "" && updatable(updateFieldEndOfSupportDate)
+	if updateAvailability || updateEndOfSupportDate {
+		releaseUpdate := pivnet.Release{
+			ID: release.ID,
+		}
+
+		if updateEndOfSupportDate {
+			releaseUpdate.EndOfSupportDate = input.Params.EndOfSupportDate
+		}
+
+		if updateAvailability {
+			releaseUpdate.Availability = availability
+		}
+
+		c.logger.Debugf(
+			"Updating release: {product_slug: %s, release_id: %d, availability: %s, end_of_support_date: %s}\n",
+			productSlug,
+			release.ID,
+			releaseUpdate.Availability,
+			releaseUpdate.EndOfSupportDate,
+		)
+
+		release, err = pivnetClient.UpdateRelease(productSlug, releaseUpdate)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+
+		if updateAvailability && availability == "Selected User Groups Only" {
+			userGroupIDs := templateUserGroupIDs
+			if input.Params.TemplateVersion == "" || input.Params.UserGroupIDsFile != "" {
+				userGroupIDs = nil
+				userGroupIDStrings := strings.Split(
+					readStringContents(c.sourcesDir, input.Params.UserGroupIDsFile),
+					",",
+				)
+
+				for _, userGroupIDString := range userGroupIDStrings {
+					userGroupID, err := strconv.Atoi(userGroupIDString)
+					if err != nil {
+						return concourse.OutResponse{}, err
+					}
+
+					userGroupIDs = append(userGroupIDs, userGroupID)
+				}
+			} else {
+				c.logger.Debugf(
+					"Inherited from template release: {setting: %s, value: %v}\n",
+					"user_group_ids",
+					userGroupIDs,
+				)
+			}
+
+			for _, userGroupID := range userGroupIDs {
+				pivnetClient.AddUserGroup(productSlug, release.ID, userGroupID)
+			}
+		}
+	}
+
+	for _, d := range dependencies {
+		c.logger.Debugf(
+			"Adding release dependency: {product_slug: %s, release_id: %d, dependency_product_slug: %s, dependency_version: %s, dependency_release_id: %d}\n",
+			productSlug,
+			release.ID,
+			d.productSlug,
+			d.release.Version,
+			d.release.ID,
+		)
+
+		err = pivnetClient.AddReleaseDependency(productSlug, release.ID, d.release.ID)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to add dependency %s %s: %s",
+				d.productSlug,
+				d.release.Version,
+				err.Error(),
+			)
+		}
+	}
+
+	if len(input.Params.DependencySpecifiers) > 0 {
+		err = c.addDependencySpecifiers(pivnetClient, productSlug, release, input.Params.DependencySpecifiers)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
+
+	// Unless it is disabled, every file added by the put is checked to be on
+	// the release, as Pivnet does not always attach a file it has created.
+	verifyUpload := input.Params.VerifyUpload == nil || *input.Params.VerifyUpload
+	if verifyUpload && len(uploadedFiles) > 0 {
+		err = c.verifyUploadedFiles(pivnetClient, productSlug, release, uploadedFiles)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
+
+	if input.Params.WaitUntilAvailable {
+		timeout := defaultWaitTimeout
+		if input.Params.WaitTimeoutSeconds > 0 {
+			timeout = time.Duration(input.Params.WaitTimeoutSeconds) * time.Second
+		}
+
+		c.logger.Debugf(
+			"Waiting for release to be available: {product_slug: %s, version: %s, timeout: %s, initial_poll_interval: %s}\n",
+			productSlug,
+			release.Version,
+			timeout.String(),
+			waitPollInterval.String(),
+		)
+
+		_, err := pivnetClient.WaitForRelease(productSlug, release.Version, timeout)
+		if err != nil {
+			return concourse.OutResponse{}, err
+		}
+	}
+
+	var fileHash string
+	if input.Source.VersionFileHashes {
+		fileHash, err = c.releaseFileHash(pivnetClient, productSlug, release)
+		if err != nil {
+			return concourse.OutResponse{}, fmt.Errorf(
+				"failed to hash files of release %s: %s",
+				release.Version,
+				err.Error(),
+			)
+		}
+	}
+
+	// A release that already exists may be listed without its EULA.
+	var releaseEulaSlug string
+	if release.Eula != nil {
+		releaseEulaSlug = release.Eula.Slug
+	}
+
+	metadata := []concourse.Metadata{
+		{Name: "release_type", Value: release.ReleaseType},
+		{Name: "release_date", Value: release.ReleaseDate},
+		{Name: "description", Value: release.Description},
+		{Name: "release_notes_url", Value: release.ReleaseNotesURL},
+		{Name: "eula_slug", Value: releaseEulaSlug},
+		{Name: "availability", Value: release.Availability},
+		{Name: "export_controlled", Value: strconv.FormatBool(release.Controlled)},
+		{Name: "end_of_support_date", Value: release.EndOfSupportDate},
+		{Name: "produced_by", Value: fmt.Sprintf("pivnet-resource/%s", c.binaryVersion)},
+	}
+
+	if !skipUpload && uploadBackend == uploadBackendS3 {
+		sse := input.Params.S3SSE
+		if sse == "" {
+			sse = "none"
+		}
+
+		metadata = append(metadata, concourse.Metadata{Name: "s3_sse", Value: sse})
+
+		if input.Params.S3KMSKeyID != "" {
+			metadata = append(metadata,
+				concourse.Metadata{Name: "s3_kms_key_id", Value: input.Params.S3KMSKeyID},
+			)
+		}
+	}
+
+	if fileHash != "" {
+		metadata = append(metadata, concourse.Metadata{Name: "file_hash", Value: fileHash})
+	}
+
+	metadata = append(metadata, labelMetadata(input.Params.ReleaseLabels)...)
+	metadata = append(metadata, fileMetadata...)
+	if recorder != nil {
+		metadata = append(metadata, concourse.WarningsMetadata(recorder.Warnings())...)
+	}
+	metadata = concourse.SortedMetadata(metadata)
+
+	outputVersion := release.Version
+	if input.Source.VersionFormat == versions.FormatVersionID {
+		outputVersion = versions.WithID(release.Version, release.ID)
+	}
+	if fileHash != "" {
+		outputVersion = versions.WithFileHash(outputVersion, fileHash)
+	}
+
+	out := concourse.OutResponse{
+		Version: concourse.Version{
+			ProductVersion: outputVersion,
 		},
+		Metadata: metadata,
 	}
 
 	return out, nil
 }
 
+// inherit returns the explicitly provided value of the setting, falling back
+// to the value of the template release, and logs which one applies.
+func (c *OutCommand) inherit(setting string, explicit string, inherited string) string {
+	if inherited == "" {
+		return explicit
+	}
+
+	if explicit != "" {
+		c.logger.Debugf(
+			"Overriding template release: {setting: %s, value: %s, template_value: %s}\n",
+			setting,
+			explicit,
+			inherited,
+		)
+		return explicit
+	}
+
+	c.logger.Debugf("Inherited from template release: {setting: %s, value: %s}\n", setting, inherited)
+	return inherited
+}
+
+// inheritFile returns the metadata of the file from the manifest, falling back
+// to the metadata of the template release's file with the same name.
+func (c *OutCommand) inheritFile(name string, explicit manifest.File, inherited manifest.File) manifest.File {
+	systemRequirements := explicit.SystemRequirements
+	if len(systemRequirements) == 0 && len(inherited.SystemRequirements) > 0 {
+		c.logger.Debugf(
+			"Inherited from template release: {setting: %s, value: %v}\n",
+			"system_requirements: "+name,
+			inherited.SystemRequirements,
+		)
+		systemRequirements = inherited.SystemRequirements
+	}
+
+	fileLabels := explicit.Labels
+	if len(fileLabels) == 0 && len(inherited.Labels) > 0 {
+		c.logger.Debugf(
+			"Inherited from template release: {setting: %s, value: %v}\n",
+			"labels: "+name,
+			inherited.Labels,
+		)
+		fileLabels = inherited.Labels
+	}
+
+	return manifest.File{
+		File:        name,
+		Description: c.inherit("description: "+name, explicit.Description, inherited.Description),
+		DocsURL:     c.inherit("docs_url: "+name, explicit.DocsURL, inherited.DocsURL),
+		FileType:    c.inherit("file_type: "+name, explicit.FileType, inherited.FileType),
+		FileGroup:   explicit.FileGroup,
+		Labels:      fileLabels,
+		S3Region:    explicit.S3Region,
+		S3Bucket:    explicit.S3Bucket,
+
+		SystemRequirements: systemRequirements,
+	}
+}
+
+// templateFiles returns the metadata of the template release's product files
+// by the file name of their AWS object key, which is the name of the file that
+// was uploaded.
+func (c *OutCommand) templateFiles(
+	pivnetClient pivnet.Client,
+	template pivnet.Release,
+) (map[string]manifest.File, error) {
+	files := map[string]manifest.File{}
+	if template.Links == nil || template.Links.ProductFiles["href"] == "" {
+		c.logger.Debugf("Template release has no product files link - not inheriting file metadata\n")
+		return files, nil
+	}
+
+	productFiles, err := pivnetClient.GetProductFiles(template)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get product files of template release %s: %s",
+			template.Version,
+			err.Error(),
+		)
+	}
+
+	for _, pf := range productFiles.ProductFiles {
+		fileLabels, description, err := labels.ParseFileLabels(pf.Description)
+		if err != nil {
+			description = pf.Description
+		}
+
+		files[pf.FileName()] = manifest.File{
+			File:        pf.FileName(),
+			Description: description,
+			Labels:      fileLabels,
+			DocsURL:     pf.DocsURL,
+			FileType:    pf.FileType,
+
+			SystemRequirements: pf.SystemRequirements,
+		}
+	}
+
+	return files, nil
+}
+
+// templateUserGroupIDs returns the IDs of the user groups the template release
+// is available to.
+func (c *OutCommand) templateUserGroupIDs(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	template pivnet.Release,
+) ([]int, error) {
+	userGroups, err := pivnetClient.ReleaseUserGroups(productSlug, template.ID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get user groups of template release %s: %s",
+			template.Version,
+			err.Error(),
+		)
+	}
+
+	var ids []int
+	for _, g := range userGroups {
+		ids = append(ids, g.ID)
+	}
+
+	return ids, nil
+}
+
+// templateDependencies returns the releases the template release depends on.
+func (c *OutCommand) templateDependencies(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	template pivnet.Release,
+) ([]releaseDependency, error) {
+	releaseDependencies, err := pivnetClient.ReleaseDependencies(productSlug, template.ID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get dependencies of template release %s: %s",
+			template.Version,
+			err.Error(),
+		)
+	}
+
+	var dependencies []releaseDependency
+	for _, d := range releaseDependencies {
+		var dependencyProductSlug string
+		if d.Release.Product != nil {
+			dependencyProductSlug = d.Release.Product.Slug
+		}
+
+		dependencies = append(dependencies, releaseDependency{
+			productSlug: dependencyProductSlug,
+			release: pivnet.Release{
+				ID:      d.Release.ID,
+				Version: d.Release.Version,
+			},
+		})
+	}
+
+	return dependencies, nil
+}
+
+// labelMetadata returns a metadata entry per release label, in key order.
+func labelMetadata(releaseLabels map[string]string) []concourse.Metadata {
+	var keys []string
+	for key := range releaseLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var metadata []concourse.Metadata
+	for _, key := range keys {
+		metadata = append(metadata,
+			concourse.Metadata{Name: "label: " + key, Value: releaseLabels[key]},
+		)
+	}
+
+	return metadata
+}
+
+// writeCABundle writes the CA certificate to a file in the staging
+// directory for s3-out, which only accepts a path. It returns an empty path
+// if there is no CA certificate.
+func (c *OutCommand) writeCABundle(caCert string, stagingDir string) (string, error) {
+	if caCert == "" {
+		return "", nil
+	}
+
+	caBundleFile, err := ioutil.TempFile(stagingDir, "pivnet-resource-ca-bundle")
+	if err != nil {
+		return "", err
+	}
+	defer caBundleFile.Close()
+
+	_, err = caBundleFile.WriteString(caCert)
+	if err != nil {
+		return "", err // not tested
+	}
+
+	return caBundleFile.Name(), nil
+}
+
+// federation holds temporary S3 credentials issued by Pivotal Network for
+// uploading the files of a product.
+type federation struct {
+	token   pivnet.FederationToken
+	refresh func() (s3.Credentials, error)
+}
+
+func (c *OutCommand) newFederation(
+	pivnetClient pivnet.Client,
+	productSlug string,
+) (*federation, error) {
+	token, err := c.federationToken(pivnetClient, productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &federation{
+		token: token,
+		refresh: func() (s3.Credentials, error) {
+			token, err := c.federationToken(pivnetClient, productSlug)
+			if err != nil {
+				return s3.Credentials{}, err
+			}
+
+			return s3.Credentials{
+				AccessKeyID:     token.AccessKeyID,
+				SecretAccessKey: token.SecretAccessKey,
+				SessionToken:    token.SessionToken,
+			}, nil
+		},
+	}, nil
+}
+
+// federationToken requests temporary S3 credentials and redacts them from
+// the logs before they can be written there.
+func (c *OutCommand) federationToken(
+	pivnetClient pivnet.Client,
+	productSlug string,
+) (pivnet.FederationToken, error) {
+	c.logger.Debugf("Requesting federated S3 credentials: {product_slug: %s}\n", productSlug)
+
+	token, err := pivnetClient.FederationToken(productSlug)
+	if err != nil {
+		return pivnet.FederationToken{}, err
+	}
+
+	if c.sanitizer != nil {
+		c.sanitizer.Add(token.AccessKeyID, "***REDACTED-FEDERATED_AWS_ACCESS_KEY_ID***")
+		c.sanitizer.Add(token.SecretAccessKey, "***REDACTED-FEDERATED_AWS_SECRET_ACCESS_KEY***")
+		c.sanitizer.Add(token.SessionToken, "***REDACTED-FEDERATED_AWS_SESSION_TOKEN***")
+	}
+
+	return token, nil
+}
+
+// newS3Client returns a client that uploads with s3-out to the region and
+// bucket, falling back to those of the source, then to those of the
+// federated credentials and then to the defaults. The federated credentials
+// are used if there are no static AWS keys.
+func (c *OutCommand) newS3Client(
+	ctx context.Context,
+	input concourse.OutRequest,
+	caBundlePath string,
+	federated *federation,
+	region string,
+	bucket string,
+) (s3.Client, error) {
+	credentials := s3.Credentials{
+		AccessKeyID:     input.Source.AccessKeyID,
+		SecretAccessKey: input.Source.SecretAccessKey,
+	}
+	var refreshCredentials func() (s3.Credentials, error)
+	if federated != nil {
+		credentials = s3.Credentials{
+			AccessKeyID:     federated.token.AccessKeyID,
+			SecretAccessKey: federated.token.SecretAccessKey,
+			SessionToken:    federated.token.SessionToken,
+		}
+		refreshCredentials = federated.refresh
+	}
+
+	if bucket == "" {
+		bucket = input.Source.Bucket
+	}
+	if bucket == "" && federated != nil {
+		bucket = federated.token.Bucket
+	}
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+
+	if region == "" {
+		region = input.Source.Region
+	}
+	if region == "" && federated != nil {
+		region = federated.token.Region
+	}
+	if region == "" {
+		region = defaultRegion
+	}
+
+	logFile, err := os.OpenFile(c.logFilePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+	if err != nil {
+		return nil, err
+	}
+
+	retryDelay := defaultS3UploadRetryDelay
+	if input.Params.S3UploadRetryDelaySeconds > 0 {
+		retryDelay = time.Duration(input.Params.S3UploadRetryDelaySeconds) * time.Second
+	}
+
+	return s3.NewClient(s3.NewClientConfig{
+		AccessKeyID:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		RegionName:      region,
+		Bucket:          bucket,
+
+		UploadConcurrency:  input.Params.S3UploadConcurrency,
+		MultipartChunkSize: input.Params.S3MultipartChunkSize,
+
+		UploadAttempts: input.Params.S3UploadAttempts,
+		RetryDelay:     retryDelay,
+
+		RefreshCredentials: refreshCredentials,
+
+		ServerSideEncryption: input.Params.S3SSE,
+		SSEKMSKeyID:          input.Params.S3KMSKeyID,
+
+		CABundlePath:        caBundlePath,
+		SkipSSLVerification: input.Source.SkipSSLVerification,
+
+		ProgressInterval: progress.Interval(
+			input.Params.ProgressIntervalSeconds,
+			input.Params.DisableProgress,
+		),
+
+		Context: ctx,
+
+		Logger: c.logger,
+
+		Stdout: os.Stdout,
+		Stderr: logFile,
+
+		OutBinaryPath: filepath.Join(c.outDir, c.s3OutBinaryName),
+	}), nil
+}
+
+// addFileToRelease uploads the file to S3, creates a product file for it with
+// the metadata from the manifest and adds the product file to the release, or
+// to its file group, returning the sums of the file and the product file.
+// File groups are resolved and added to the release once per name, caching
+// them in fileGroups.
+func (c *OutCommand) addFileToRelease(
+	pivnetClient pivnet.Client,
+	uploaderClient uploader.Client,
+	productSlug string,
+	release pivnet.Release,
+	exactGlob string,
+	fileMetadata manifest.File,
+	fileGroups *fileGroupCache,
+) (checksum.Sums, pivnet.ProductFile, error) {
+	fullFilepath := filepath.Join(c.sourcesDir, exactGlob)
+	stopTimer := c.timer.Start("hash", exactGlob)
+	sums, err := checksum.FileSums(fullFilepath)
+	stopTimer()
+	if err != nil {
+		return checksum.Sums{}, pivnet.ProductFile{}, err
+	}
+
+	stopTimer = c.timer.Start("upload", exactGlob)
+	remotePath, err := uploaderClient.UploadFile(exactGlob)
+	stopTimer()
+	if err != nil {
+		return checksum.Sums{}, pivnet.ProductFile{}, err
+	}
+
+	product, err := pivnetClient.FindProductForSlug(productSlug)
+	if err != nil {
+		return checksum.Sums{}, pivnet.ProductFile{}, err
+	}
+
+	filename := filepath.Base(exactGlob)
+	c.logger.Debugf(
+		"Creating product file: {product_slug: %s, filename: %s, aws_object_key: %s, file_version: %s, file_type: %s}\n",
+		productSlug,
+		filename,
+		remotePath,
+		release.Version,
+		fileMetadata.FileType,
+	)
+
+	productFile, err := pivnetClient.CreateProductFile(pivnet.CreateProductFileConfig{
+		ProductSlug:  productSlug,
+		Name:         filename,
+		AWSObjectKey: remotePath,
+		FileVersion:  release.Version,
+		MD5:          sums.MD5,
+		FileType:     fileMetadata.FileType,
+		Description:  labels.RenderFileLabels(fileMetadata.Labels, fileMetadata.Description),
+		DocsURL:      fileMetadata.DocsURL,
+
+		SystemRequirements: fileMetadata.SystemRequirements,
+	})
+	if err != nil {
+		return checksum.Sums{}, pivnet.ProductFile{}, err
+	}
+
+	if fileMetadata.FileGroup != "" {
+		return sums, productFile, c.addToFileGroup(
+			pivnetClient,
+			productSlug,
+			release,
+			fileMetadata.FileGroup,
+			fileGroups,
+			productFile,
+		)
+	}
+
+	c.logger.Debugf(
+		"Adding product file: {product_slug: %s, product_id: %d, filename: %s, product_file_id: %d, release_id: %d}\n",
+		productSlug,
+		product.ID,
+		filename,
+		productFile.ID,
+		release.ID,
+	)
+
+	err = pivnetClient.AddProductFile(product.ID, release.ID, productFile.ID)
+	if err != nil {
+		return checksum.Sums{}, pivnet.ProductFile{}, err
+	}
+
+	return sums, productFile, nil
+}
+
+// replacedFiles returns the product files already on the release with the
+// same file name as a file to upload, by file name, or an error if there are
+// any and overwrite is false. Product files are matched by the file name of
+// their AWS object key, as their display name may be anything.
+func (c *OutCommand) replacedFiles(
+	pivnetClient pivnet.Client,
+	release pivnet.Release,
+	exactGlobs []string,
+	overwrite bool,
+) (map[string]pivnet.ProductFile, error) {
+	replaced := map[string]pivnet.ProductFile{}
+	if release.Links == nil || release.Links.ProductFiles["href"] == "" {
+		c.logger.Debugf("Release has no product files link - not checking for existing files\n")
+		return replaced, nil
+	}
+
+	productFiles, err := pivnetClient.GetProductFiles(release)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get product files of release %s: %s",
+			release.Version,
+			err.Error(),
+		)
+	}
+
+	existing := map[string]pivnet.ProductFile{}
+	for _, pf := range productFiles.ProductFiles {
+		existing[pf.FileName()] = pf
+	}
+
+	for _, exactGlob := range exactGlobs {
+		filename := filepath.Base(exactGlob)
+
+		pf, ok := existing[filename]
+		if !ok {
+			c.logger.Debugf("No existing file on release: {filename: %s}\n", filename)
+			continue
+		}
+
+		if !overwrite {
+			return nil, fmt.Errorf(
+				"file %s is already attached to release %s - set overwrite_existing to replace it",
+				filename,
+				release.Version,
+			)
+		}
+
+		c.logger.Infof(
+			"Replacing existing file on release: {filename: %s, product_file_id: %d}\n",
+			filename,
+			pf.ID,
+		)
+		replaced[filename] = pf
+	}
+
+	return replaced, nil
+}
+
+// staleFiles returns the product files attached to the release whose file
+// names match none of the files to upload, which sync_files detaches.
+func (c *OutCommand) staleFiles(
+	pivnetClient pivnet.Client,
+	release pivnet.Release,
+	exactGlobs []string,
+) ([]pivnet.ProductFile, error) {
+	if release.Links == nil || release.Links.ProductFiles["href"] == "" {
+		c.logger.Debugf("Release has no product files link - no files to sync\n")
+		return nil, nil
+	}
+
+	productFiles, err := pivnetClient.GetProductFiles(release)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get product files of release %s: %s",
+			release.Version,
+			err.Error(),
+		)
+	}
+
+	uploading := map[string]bool{}
+	for _, exactGlob := range exactGlobs {
+		uploading[filepath.Base(exactGlob)] = true
+	}
+
+	var stale []pivnet.ProductFile
+	for _, pf := range productFiles.ProductFiles {
+		if !uploading[pf.FileName()] {
+			stale = append(stale, pf)
+		}
+	}
+
+	return stale, nil
+}
+
+// detachFile removes the product file replaced by a newly added file, or no
+// longer uploaded with sync_files, from the release. The product file itself
+// is not deleted.
+func (c *OutCommand) detachFile(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	productFile pivnet.ProductFile,
+) error {
+	product, err := pivnetClient.FindProductForSlug(productSlug)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Debugf(
+		"Removing product file: {product_slug: %s, product_id: %d, filename: %s, product_file_id: %d, release_id: %d}\n",
+		productSlug,
+		product.ID,
+		productFile.Name,
+		productFile.ID,
+		release.ID,
+	)
+
+	err = pivnetClient.RemoveProductFile(product.ID, release.ID, productFile.ID)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to detach existing file %s from release %s: %s",
+			productFile.Name,
+			release.Version,
+			err.Error(),
+		)
+	}
+
+	return nil
+}
+
+// releaseFileHash returns the hash of the MD5s of every file of the release,
+// including those added by earlier puts.
+func (c *OutCommand) releaseFileHash(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+) (string, error) {
+	productFiles, err := pivnetClient.GetProductFiles(release)
+	if err != nil {
+		return "", err
+	}
+
+	var md5s []string
+	for _, p := range productFiles.ProductFiles {
+		productFile, err := pivnetClient.GetProductFile(productSlug, release.ID, p.ID)
+		if err != nil {
+			return "", err
+		}
+
+		md5s = append(md5s, productFile.MD5)
+	}
+
+	fileHash := versions.FileHash(md5s)
+
+	c.logger.Debugf(
+		"Hashed release files: {release_id: %d, files: %d, file_hash: %s}\n",
+		release.ID,
+		len(md5s),
+		fileHash,
+	)
+
+	return fileHash, nil
+}
+
+// mirrorFiles adds a product file to the release for each product file of
+// the mirrored release, with the same metadata and AWS object key, so no
+// file is uploaded again. Each product file is fetched for its metadata, as
+// the product files of a release are listed without it. The mirrored
+// product is only read. Files a resumed put already added are skipped. Each
+// product file added is recorded in the uploaded files.
+func (c *OutCommand) mirrorFiles(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	mirrorProductSlug string,
+	mirrored pivnet.Release,
+	resumedFiles map[string]pivnet.ProductFile,
+	uploadedFiles map[string]int,
+) ([]concourse.Metadata, error) {
+	metadata := []concourse.Metadata{
+		{Name: "mirrored_from", Value: fmt.Sprintf("%s %s", mirrorProductSlug, mirrored.Version)},
+	}
+
+	if mirrored.Links == nil || mirrored.Links.ProductFiles["href"] == "" {
+		c.logger.Debugf("Mirrored release has no product files link - not mirroring files\n")
+		return metadata, nil
+	}
+
+	productFiles, err := pivnetClient.GetProductFiles(mirrored)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get product files of release %s of mirrored product %s: %s",
+			mirrored.Version,
+			mirrorProductSlug,
+			err.Error(),
+		)
+	}
+
+	product, err := pivnetClient.FindProductForSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, listed := range productFiles.ProductFiles {
+		// The MD5, description and docs URL of a product file are only
+		// returned for the product file itself.
+		pf, err := pivnetClient.GetProductFile(mirrorProductSlug, mirrored.ID, listed.ID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to get product file %d of release %s of mirrored product %s: %s",
+				listed.ID,
+				mirrored.Version,
+				mirrorProductSlug,
+				err.Error(),
+			)
+		}
+
+		if resumedFile, ok := resumedFiles[pf.FileName()]; ok {
+			c.logger.Debugf(
+				"Skipping file added by a previous put: {filename: %s, product_file_id: %d}\n",
+				pf.FileName(),
+				resumedFile.ID,
+			)
+
+			uploadedFiles[pf.FileName()] = resumedFile.ID
+			metadata = append(metadata, concourse.Metadata{Name: "md5: " + pf.Name, Value: pf.MD5})
+			continue
+		}
+
+		c.logger.Debugf(
+			"Mirroring product file: {product_slug: %s, filename: %s, aws_object_key: %s, mirrored_product_file_id: %d}\n",
+			productSlug,
+			pf.Name,
+			pf.AWSObjectKey,
+			pf.ID,
+		)
+
+		productFile, err := pivnetClient.CreateProductFile(pivnet.CreateProductFileConfig{
+			ProductSlug:  productSlug,
+			Name:         pf.Name,
+			AWSObjectKey: pf.AWSObjectKey,
+			FileVersion:  release.Version,
+			MD5:          pf.MD5,
+			FileType:     pf.FileType,
+			Description:  pf.Description,
+			DocsURL:      pf.DocsURL,
+
+			SystemRequirements: pf.SystemRequirements,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to mirror file %s: %s", pf.Name, err.Error())
+		}
+
+		err = pivnetClient.AddProductFile(product.ID, release.ID, productFile.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mirror file %s: %s", pf.Name, err.Error())
+		}
+
+		uploadedFiles[pf.FileName()] = productFile.ID
+
+		metadata = append(metadata, concourse.Metadata{Name: "md5: " + pf.Name, Value: pf.MD5})
+	}
+
+	return metadata, nil
+}
+
+// resumedFiles returns the product files a previous put added to the
+// release, by file name.
+func (c *OutCommand) resumedFiles(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+) (map[string]pivnet.ProductFile, error) {
+	productFiles, err := pivnetClient.ReleaseProductFiles(productSlug, release.ID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get product files of release %s to resume: %s",
+			release.Version,
+			err.Error(),
+		)
+	}
+
+	// The MD5 of a product file is only returned for the product file itself.
+	resumed := map[string]pivnet.ProductFile{}
+	for _, p := range productFiles.ProductFiles {
+		productFile, err := pivnetClient.GetProductFile(productSlug, release.ID, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to get product file %d of release %s to resume: %s",
+				p.ID,
+				release.Version,
+				err.Error(),
+			)
+		}
+
+		resumed[productFile.FileName()] = productFile
+	}
+
+	c.logger.Debugf(
+		"Resuming release: {release_id: %d, files: %d}\n",
+		release.ID,
+		len(resumed),
+	)
+
+	return resumed, nil
+}
+
+// fileGroupCache holds the file groups added to the release by name, so that
+// each is resolved and added once even when files are added concurrently.
+type fileGroupCache struct {
+	sync.Mutex
+	fileGroups map[string]pivnet.FileGroup
+}
+
+// addToFileGroup adds the product file to the file group with the name, which
+// is reused if the product already has it and created otherwise. The file
+// group is added to the release the first time it is used.
+func (c *OutCommand) addToFileGroup(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	name string,
+	fileGroups *fileGroupCache,
+	productFile pivnet.ProductFile,
+) error {
+	fileGroup, err := c.releaseFileGroup(pivnetClient, productSlug, release, name, fileGroups)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Debugf(
+		"Adding product file to file group: {product_slug: %s, product_file_id: %d, file_group: %s, file_group_id: %d}\n",
+		productSlug,
+		productFile.ID,
+		name,
+		fileGroup.ID,
+	)
+
+	return pivnetClient.AddToFileGroup(productSlug, fileGroup.ID, productFile.ID)
+}
+
+// releaseFileGroup returns the file group with the name from the cache, or
+// resolves it and adds it to the release if it is not cached yet.
+func (c *OutCommand) releaseFileGroup(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	name string,
+	fileGroups *fileGroupCache,
+) (pivnet.FileGroup, error) {
+	fileGroups.Lock()
+	defer fileGroups.Unlock()
+
+	if fileGroup, ok := fileGroups.fileGroups[name]; ok {
+		return fileGroup, nil
+	}
+
+	fileGroup, err := pivnetClient.FileGroupForName(productSlug, name)
+	if err != nil {
+		return pivnet.FileGroup{}, fmt.Errorf("failed to resolve file group %s: %s", name, err.Error())
+	}
+
+	c.logger.Debugf(
+		"Adding file group: {product_slug: %s, file_group: %s, file_group_id: %d, release_id: %d}\n",
+		productSlug,
+		name,
+		fileGroup.ID,
+		release.ID,
+	)
+
+	err = pivnetClient.AddFileGroup(productSlug, release.ID, fileGroup.ID)
+	if err != nil {
+		return pivnet.FileGroup{}, err
+	}
+
+	fileGroups.fileGroups[name] = fileGroup
+	return fileGroup, nil
+}
+
+// addedFile is the result of adding a file to the release.
+type addedFile struct {
+	exactGlob string
+	sums      checksum.Sums
+	err       error
+
+	// cancelled is whether the addition failed after another addition had
+	// failed and cancelled it.
+	cancelled bool
+}
+
+// addFiles adds the files to the release phase by phase, running up to
+// concurrency additions at once within a phase. Once an addition fails no
+// more are started, and cancel is called to stop those in flight. It returns
+// the results of the additions that ran, in the order of the files, and the
+// files that were not attempted.
+func (c *OutCommand) addFiles(
+	phases [][]string,
+	concurrency int,
+	addFile func(exactGlob string) (checksum.Sums, error),
+	cancel func(),
+) ([]addedFile, []string) {
+	var results []addedFile
+	for i, phase := range phases {
+		c.logger.Debugf(
+			"Adding files to release: {phase: %d, files: %v, concurrency: %d}\n",
+			i+1,
+			phase,
+			concurrency,
+		)
+
+		phaseResults := make([]*addedFile, len(phase))
+
+		var (
+			wg     sync.WaitGroup
+			mutex  sync.Mutex
+			failed bool
+		)
+
+		slots := make(chan struct{}, concurrency)
+		for j, exactGlob := range phase {
+			slots <- struct{}{}
+
+			mutex.Lock()
+			stop := failed
+			mutex.Unlock()
+
+			if stop {
+				break
+			}
+
+			wg.Add(1)
+			go func(j int, exactGlob string) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				sums, err := addFile(exactGlob)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				phaseResults[j] = &addedFile{
+					exactGlob: exactGlob,
+					sums:      sums,
+					err:       err,
+					cancelled: err != nil && failed,
+				}
+
+				if err != nil && !failed {
+					failed = true
+					cancel()
+				}
+			}(j, exactGlob)
+		}
+
+		wg.Wait()
+
+		var notAttempted []string
+		for j, r := range phaseResults {
+			if r == nil {
+				notAttempted = append(notAttempted, phase[j])
+				continue
+			}
+			results = append(results, *r)
+		}
+
+		if failed {
+			for _, remaining := range phases[i+1:] {
+				notAttempted = append(notAttempted, remaining...)
+			}
+			return results, notAttempted
+		}
+	}
+
+	return results, nil
+}
+
+// uploadFailure returns an error describing which files were added to the
+// release before the failure, deleting the release first if requested.
+func (c *OutCommand) uploadFailure(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	cleanupOnFailure bool,
+	uploadedFiles []string,
+	failedFile string,
+	remainingFiles []string,
+	uploadErr error,
+) error {
+	c.logger.Debugf(
+		"Failed to add file to release: {failed: %s, uploaded: %v, not_attempted: %v, error: %s}\n",
+		failedFile,
+		uploadedFiles,
+		remainingFiles,
+		uploadErr.Error(),
+	)
+
+	var releaseState string
+	if cleanupOnFailure {
+		c.logger.Debugf(
+			"Deleting release: {product_slug: %s, release_id: %d}\n",
+			productSlug,
+			release.ID,
+		)
+
+		err := pivnetClient.DeleteRelease(productSlug, release)
+		if err != nil {
+			releaseState = fmt.Sprintf("failed to delete release %s: %s", release.Version, err.Error())
+		} else {
+			releaseState = fmt.Sprintf("deleted release %s", release.Version)
+		}
+	} else {
+		releaseState = fmt.Sprintf(
+			"release %s was left with the uploaded files - set %s to delete it",
+			release.Version,
+			"cleanup_on_failure",
+		)
+	}
+
+	return fmt.Errorf(
+		"failed to add file %s to release: %s - uploaded files: %v, files not attempted: %v - %s",
+		failedFile,
+		uploadErr.Error(),
+		uploadedFiles,
+		remainingFiles,
+		releaseState,
+	)
+}
+
+// verifyRequiredFiles returns an error unless the files matched by the file
+// glob meet min_files and match every required glob.
+func (c *OutCommand) verifyRequiredFiles(params concourse.OutParams, files []string) error {
+	if params.MinFiles == 0 && len(params.RequiredGlobs) == 0 {
+		return nil
+	}
+
+	c.logger.Debugf(
+		"Verifying files to upload: {found: %d, min_files: %d, required_globs: %v, files: %v}\n",
+		len(files),
+		params.MinFiles,
+		params.RequiredGlobs,
+		files,
+	)
+
+	if len(files) < params.MinFiles {
+		return fmt.Errorf(
+			"found %d files to upload but %s is %d: %v",
+			len(files),
+			"min_files",
+			params.MinFiles,
+			files,
+		)
+	}
+
+	for _, pattern := range params.RequiredGlobs {
+		matched := false
+		for _, f := range files {
+			for _, name := range []string{f, filepath.Base(f)} {
+				m, err := filepath.Match(pattern, name)
+				if err != nil {
+					return err
+				}
+				matched = matched || m
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf(
+				"no files to upload match required glob: %s - found: %v",
+				pattern,
+				files,
+			)
+		}
+	}
+
+	return nil
+}
+
+// stagingDir creates a directory to stage intermediate files in within
+// tmp_dir, which is relative to the sources directory unless it is absolute,
+// or within the sources directory if there is no tmp_dir. The caller removes
+// it once the put finishes.
+func (c *OutCommand) stagingDir(tmpDir string) (string, error) {
+	root := c.sourcesDir
+	if tmpDir != "" {
+		root = tmpDir
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(c.sourcesDir, root)
+		}
+
+		err := os.MkdirAll(root, os.ModePerm)
+		if err != nil {
+			return "", fmt.Errorf("failed to create %s %s: %s", "tmp_dir", root, err.Error())
+		}
+	}
+
+	stagingDir, err := ioutil.TempDir(root, "pivnet-resource-staging")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory in %s: %s", root, err.Error())
+	}
+
+	c.logger.Debugf("Staging intermediate files in: %s\n", stagingDir)
+
+	return stagingDir, nil
+}
+
+// releaseDependency is a release of a product the release depends on.
+type releaseDependency struct {
+	productSlug string
+	release     pivnet.Release
+}
+
+// resolveDependencies resolves the product slug and version pairs of the
+// dependencies file, one pair per line separated by whitespace, to their
+// releases. Blank lines and lines starting with # are ignored. It returns an
+// error listing every dependency that cannot be found.
+func (c *OutCommand) resolveDependencies(
+	pivnetClient pivnet.Client,
+	contents string,
+) ([]releaseDependency, error) {
+	var dependencies []releaseDependency
+	var missing []string
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(
+				"%s line %d must be a product slug and version - got %s",
+				"dependencies_file",
+				i+1,
+				line,
+			)
+		}
+
+		c.logger.Debugf(
+			"Resolving release dependency: {product_slug: %s, version: %s}\n",
+			fields[0],
+			fields[1],
+		)
+
+		release, err := pivnetClient.GetRelease(fields[0], fields[1])
+		var notFound pivnet.ErrNotFound
+		if errors.As(err, &notFound) {
+			missing = append(missing, fields[0]+" "+fields[1])
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to resolve dependency %s %s: %s",
+				fields[0],
+				fields[1],
+				err.Error(),
+			)
+		}
+
+		dependencies = append(dependencies, releaseDependency{
+			productSlug: fields[0],
+			release:     release,
+		})
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf(
+			"dependencies not found: %s",
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return dependencies, nil
+}
+
+// verifyUploadedFiles returns an error listing the uploaded files, by name
+// and product file ID, that are neither attached to the release nor in any of
+// its file groups.
+func (c *OutCommand) verifyUploadedFiles(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	uploadedFiles map[string]int,
+) error {
+	c.logger.Debugf(
+		"Verifying uploaded files: {product_slug: %s, release_id: %d, files: %d}\n",
+		productSlug,
+		release.ID,
+		len(uploadedFiles),
+	)
+
+	productFiles, err := pivnetClient.ReleaseProductFiles(productSlug, release.ID)
+	if err != nil {
+		return fmt.Errorf("failed to verify uploaded files: %s", err.Error())
+	}
+
+	fileGroups, err := pivnetClient.ReleaseFileGroups(productSlug, release.ID)
+	if err != nil {
+		return fmt.Errorf("failed to verify uploaded files: %s", err.Error())
+	}
+
+	attached := map[int]bool{}
+	for _, p := range productFiles.ProductFiles {
+		attached[p.ID] = true
+	}
+	for _, fg := range fileGroups {
+		for _, p := range fg.ProductFiles {
+			attached[p.ID] = true
+		}
+	}
+
+	var missing []string
+	for filename, productFileID := range uploadedFiles {
+		if !attached[productFileID] {
+			missing = append(missing, fmt.Sprintf("%s (product file %d)", filename, productFileID))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return fmt.Errorf(
+			"files not attached to release %s after upload: %s - Pivnet may have failed to attach them",
+			release.Version,
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
+
+// addDependencySpecifiers adds the dependency specifiers to the release,
+// skipping those it already has, e.g. when a put is resumed.
+func (c *OutCommand) addDependencySpecifiers(
+	pivnetClient pivnet.Client,
+	productSlug string,
+	release pivnet.Release,
+	specifiers []concourse.DependencySpecifier,
+) error {
+	existing, err := pivnetClient.DependencySpecifiers(productSlug, release.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get dependency specifiers: %s", err.Error())
+	}
+
+	for _, d := range specifiers {
+		specifier := strings.TrimSpace(d.Specifier)
+
+		exists := false
+		for _, e := range existing {
+			if e.Product.Slug == d.ProductSlug && strings.TrimSpace(e.Specifier) == specifier {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			c.logger.Debugf(
+				"Skipping existing dependency specifier: {product_slug: %s, release_id: %d, dependency_product_slug: %s, specifier: %s}\n",
+				productSlug,
+				release.ID,
+				d.ProductSlug,
+				specifier,
+			)
+			continue
+		}
+
+		c.logger.Debugf(
+			"Adding dependency specifier: {product_slug: %s, release_id: %d, dependency_product_slug: %s, specifier: %s}\n",
+			productSlug,
+			release.ID,
+			d.ProductSlug,
+			specifier,
+		)
+
+		_, err = pivnetClient.CreateDependencySpecifier(productSlug, release.ID, d.ProductSlug, specifier)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to add dependency specifier %s %s: %s",
+				d.ProductSlug,
+				specifier,
+				err.Error(),
+			)
+		}
+	}
+
+	return nil
+}
+
+// s3OutParams returns the names of the provided params that configure the
+// uploads of s3-out.
+func s3OutParams(params concourse.OutParams) []string {
+	provided := []struct {
+		name     string
+		provided bool
+	}{
+		{"s3_upload_concurrency", params.S3UploadConcurrency != 0},
+		{"s3_multipart_chunk_size", params.S3MultipartChunkSize != 0},
+		{"s3_upload_attempts", params.S3UploadAttempts != 0},
+		{"s3_upload_retry_delay_seconds", params.S3UploadRetryDelaySeconds != 0},
+		{"s3_sse", params.S3SSE != ""},
+		{"s3_kms_key_id", params.S3KMSKeyID != ""},
+	}
+
+	var names []string
+	for _, p := range provided {
+		if p.provided {
+			names = append(names, p.name)
+		}
+	}
+
+	return names
+}
+
+// releaseParams returns the names of the provided params that set up the
+// release itself, rather than the files added to it.
+func releaseParams(params concourse.OutParams) []string {
+	provided := []struct {
+		name     string
+		provided bool
+	}{
+		{"release_type_file", params.ReleaseTypeFile != ""},
+		{"release_date_file", params.ReleaseDateFile != ""},
+		{"release_date", params.ReleaseDate != ""},
+		{"export_controlled", params.ExportControlled != nil},
+		{"eula_slug_file", params.EulaSlugFile != ""},
+		{"eula_id", params.EulaID != 0},
+		{"description_file", params.DescriptionFile != ""},
+		{"release_notes_url_file", params.ReleaseNotesURLFile != ""},
+		{"availability_file", params.AvailabilityFile != ""},
+		{"user_group_ids_file", params.UserGroupIDsFile != ""},
+		{"dependencies_file", params.DependenciesFile != ""},
+		{"dependency_specifiers", len(params.DependencySpecifiers) > 0},
+		{"template_version", params.TemplateVersion != ""},
+		{"release_labels", len(params.ReleaseLabels) > 0},
+		{"cleanup_on_failure", params.CleanupOnFailure},
+	}
+
+	var names []string
+	for _, p := range provided {
+		if p.provided {
+			names = append(names, p.name)
+		}
+	}
+
+	return names
+}
+
+// gitTagVersion returns the version from the latest tag of the git repository
+// in the directory within the sources, without the prefix. The version must
+// be semver, so that a tag which is not a release is never published.
+func (c *OutCommand) gitTagVersion(dir string, prefix string) (string, error) {
+	tag, err := latestGitTag(c.ctx, filepath.Join(c.sourcesDir, dir))
+	if err != nil {
+		return "", err
+	}
+
+	version := strings.TrimPrefix(tag, prefix)
+
+	c.logger.Debugf(
+		"Using version from git tag: {version_git_dir: %s, tag: %s, version: %s}\n",
+		dir,
+		tag,
+		version,
+	)
+
+	if !versions.IsSemver(version) {
+		return "", fmt.Errorf(
+			"version from git tag %s must be a semantic version - got %s",
+			tag,
+			version,
+		)
+	}
+
+	return version, nil
+}
+
 func readStringContents(sourcesDir, file string) string {
 	if file == "" {
 		return ""
@@ -1,22 +1,38 @@
 package out_test
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/ghttp"
 	"github.com/pivotal-cf-experimental/pivnet-resource/concourse"
+	"github.com/pivotal-cf-experimental/pivnet-resource/labels"
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 	"github.com/pivotal-cf-experimental/pivnet-resource/out"
 	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/s3"
 	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/versions"
 )
 
+type createReleaseBody struct {
+	Release pivnet.Release `json:"release"`
+}
+
 var _ = Describe("Out", func() {
 	var (
 		tempDir string
@@ -44,12 +60,20 @@ var _ = Describe("Out", func() {
 		eulaSlugFile     string
 		s3FilepathPrefix string
 
+		s3UploadConcurrency  int
+		s3MultipartChunkSize int64
+
+		releaseDate string
+
+		verifyUpload bool
+
 		version   string
 		productID int
 		releaseID int
 
 		existingReleasesResponse pivnet.Response
 		newReleaseResponse       pivnet.CreateReleaseResponse
+		createReleaseRequest     createReleaseBody
 		productsResponse         pivnet.Product
 
 		outRequest concourse.OutRequest
@@ -75,7 +99,8 @@ var _ = Describe("Out", func() {
 
 		newReleaseResponse = pivnet.CreateReleaseResponse{
 			Release: pivnet.Release{
-				ID: releaseID,
+				ID:      releaseID,
+				Version: version,
 				Eula: &pivnet.Eula{
 					Slug: "some-eula",
 				},
@@ -106,6 +131,7 @@ var _ = Describe("Out", func() {
 		s3OutBinaryName = "s3-out"
 		s3OutScriptContents := `#!/bin/sh
 
+cat > /dev/null
 echo "$@"`
 
 		s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
@@ -121,6 +147,15 @@ echo "$@"`
 		fileGlob = fmt.Sprintf("%s/*", filesToUploadDirName)
 		s3FilepathPrefix = "Some-Case-Sensitive-Path"
 
+		s3UploadConcurrency = 0
+		s3MultipartChunkSize = 0
+
+		releaseDate = ""
+
+		// Most contexts respond to the requests of the put in order, so the
+		// uploaded files are only verified where the requests are expected.
+		verifyUpload = false
+
 		versionFile = "version"
 		versionFilePath := filepath.Join(sourcesDir, versionFile)
 		err = ioutil.WriteFile(versionFilePath, []byte(version), os.ModePerm)
@@ -175,6 +210,11 @@ echo "$@"`
 					"POST",
 					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
 				),
+				func(w http.ResponseWriter, r *http.Request) {
+					createReleaseRequest = createReleaseBody{}
+					err := json.NewDecoder(r.Body).Decode(&createReleaseRequest)
+					Expect(err).NotTo(HaveOccurred())
+				},
 				ghttp.RespondWithJSONEncoded(http.StatusCreated, newReleaseResponse),
 			),
 		)
@@ -243,6 +283,13 @@ echo "$@"`
 				ReleaseTypeFile: releaseTypeFile,
 				EulaSlugFile:    eulaSlugFile,
 				FilepathPrefix:  s3FilepathPrefix,
+
+				S3UploadConcurrency:  s3UploadConcurrency,
+				S3MultipartChunkSize: s3MultipartChunkSize,
+
+				ReleaseDate: releaseDate,
+
+				VerifyUpload: &verifyUpload,
 			},
 		}
 
@@ -259,6 +306,7 @@ echo "$@"`
 			SourcesDir:      sourcesDir,
 			LogFilePath:     logFilePath,
 			S3OutBinaryName: s3OutBinaryName,
+			Sanitizer:       sanitizer,
 		})
 	})
 
@@ -267,6 +315,42 @@ echo "$@"`
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("emits the md5 and sha256 of each uploaded file in metadata", func() {
+		response, err := outCommand.Run(outRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents := []byte("some contents")
+		Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+			Name:  "md5: file-to-upload",
+			Value: fmt.Sprintf("%x", md5.Sum(contents)),
+		}))
+		Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+			Name:  "sha256: file-to-upload",
+			Value: fmt.Sprintf("%x", sha256.Sum256(contents)),
+		}))
+	})
+
+	It("records the resource version that produced the release in metadata", func() {
+		response, err := outCommand.Run(outRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response.Metadata).To(ContainElement(
+			concourse.Metadata{Name: "produced_by", Value: "pivnet-resource/v0.1.2"}))
+	})
+
+	It("emits the well-known metadata first and the rest by name", func() {
+		response, err := outCommand.Run(outRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		var names []string
+		for _, m := range response.Metadata {
+			names = append(names, m.Name)
+		}
+
+		Expect(names[:3]).To(Equal([]string{"release_date", "release_type", "description"}))
+		Expect(response.Metadata).To(Equal(concourse.SortedMetadata(response.Metadata)))
+	})
+
 	Describe("input validation", func() {
 		Context("when outDir is empty", func() {
 			BeforeEach(func() {
@@ -397,24 +481,2965 @@ echo "$@"`
 				Expect(err.Error()).To(MatchRegexp(".*eula_slug_file.*provided"))
 			})
 		})
+
+		Context("when s3 upload concurrency is negative", func() {
+			BeforeEach(func() {
+				s3UploadConcurrency = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*s3_upload_concurrency.*negative"))
+			})
+		})
+
+		Context("when s3 multipart chunk size is below the S3 minimum", func() {
+			BeforeEach(func() {
+				s3MultipartChunkSize = 1024
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*s3_multipart_chunk_size.*between"))
+			})
+		})
+
+		Context("when s3 multipart chunk size is above the S3 maximum", func() {
+			BeforeEach(func() {
+				s3MultipartChunkSize = 6 * 1024 * 1024 * 1024
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*s3_multipart_chunk_size.*between"))
+			})
+		})
 	})
 
-	Context("when the s3-out exits with error", func() {
+	Context("when release date is provided", func() {
 		BeforeEach(func() {
-			s3OutScriptContents := `#!/bin/sh
+			releaseDate = "2016-03-01"
+		})
 
-exit 1`
+		It("creates the release with the provided release date", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
 
-			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
-			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(createReleaseRequest.Release.ReleaseDate).To(Equal(releaseDate))
+		})
+
+		Context("when the release date is not in the form YYYY-MM-DD", func() {
+			BeforeEach(func() {
+				releaseDate = "03/01/2016"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*release_date.*YYYY-MM-DD"))
+			})
+		})
+
+		Context("when release date file is also provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.ReleaseDateFile = "release_date"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(MatchRegexp(".*release_date.*release_date_file"))
+			})
+		})
+	})
+
+	Context("when wait_until_available is true", func() {
+		var listedReleases pivnet.Response
+
+		BeforeEach(func() {
+			newReleaseResponse.Release.Version = version
+
+			listedReleases = pivnet.Response{
+				Releases: []pivnet.Release{
+					{ID: releaseID, Version: version},
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.WaitUntilAvailable = true
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, listedReleases),
+				),
+			)
+		})
+
+		It("waits until the release is listed", func() {
+			_, err := outCommand.Run(outRequest)
 			Expect(err).NotTo(HaveOccurred())
+
+			requests := server.ReceivedRequests()
+			Expect(len(requests)).To(Equal(7))
+			Expect(requests[6].Method).To(Equal("GET"))
 		})
 
-		It("returns an error", func() {
+		Context("when the release is not listed before the timeout", func() {
+			BeforeEach(func() {
+				listedReleases = pivnet.Response{}
+			})
+
+			JustBeforeEach(func() {
+				outRequest.Params.WaitTimeoutSeconds = 1
+				outRequest.Params.WaitPollIntervalSeconds = 1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(ContainSubstring("was not available for product " + productSlug)))
+			})
+		})
+
+		Context("when the wait timeout is negative", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.WaitTimeoutSeconds = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("wait_timeout_seconds must not be negative"))
+			})
+		})
+	})
+
+	Context("when an end of support date is provided", func() {
+		var updateReleaseRequest createReleaseBody
+
+		JustBeforeEach(func() {
+			outRequest.Params.EndOfSupportDate = "2017-06-30"
+
+			updatedRelease := newReleaseResponse
+			updatedRelease.Release.EndOfSupportDate = "2017-06-30"
+
+			server.SetHandler(5, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"PATCH",
+					fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+				),
+				func(w http.ResponseWriter, r *http.Request) {
+					updateReleaseRequest = createReleaseBody{}
+					err := json.NewDecoder(r.Body).Decode(&updateReleaseRequest)
+					Expect(err).NotTo(HaveOccurred())
+				},
+				ghttp.RespondWithJSONEncoded(http.StatusOK, updatedRelease),
+			))
+		})
+
+		It("sets the end of support date on the release", func() {
 			_, err := outCommand.Run(outRequest)
-			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(HaveOccurred())
 
-			Expect(err.Error()).To(MatchRegexp(".*running.*%s.*", s3OutBinaryName))
+			Expect(updateReleaseRequest.Release.EndOfSupportDate).To(Equal("2017-06-30"))
+		})
+
+		It("reports the end of support date in metadata", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "end_of_support_date", Value: "2017-06-30"}))
+		})
+
+		Context("when the availability is admins only", func() {
+			JustBeforeEach(func() {
+				availabilityFilePath := filepath.Join(sourcesDir, "availability")
+				err := ioutil.WriteFile(availabilityFilePath, []byte("Admins Only"), os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+
+				outRequest.Params.AvailabilityFile = "availability"
+			})
+
+			It("still updates the release without changing its availability", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(updateReleaseRequest.Release.EndOfSupportDate).To(Equal("2017-06-30"))
+				Expect(updateReleaseRequest.Release.Availability).To(BeEmpty())
+			})
+		})
+
+		Context("when the end of support date is not a valid date", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.EndOfSupportDate = "30/06/2017"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"end_of_support_date must be in the form YYYY-MM-DD - got 30/06/2017"))
+			})
+		})
+	})
+
+	Context("when export controlled is requested", func() {
+		JustBeforeEach(func() {
+			exportControlled := true
+			outRequest.Params.ExportControlled = &exportControlled
+		})
+
+		It("creates the release as controlled", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.Controlled).To(BeTrue())
+		})
+
+		It("reports the value applied by Pivnet in metadata", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "export_controlled", Value: "false"}))
+		})
+
+		Context("when warnings_metadata is true", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.WarningsMetadata = true
+			})
+
+			It("reports that Pivnet did not mark the release as controlled in metadata", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "warnings",
+					Value: "export_controlled was requested but Pivnet did not mark the release as controlled - the product may not support it",
+				}))
+			})
+		})
+
+		Context("when only warnings are logged", func() {
+			var (
+				logOutput *gbytes.Buffer
+			)
+
+			JustBeforeEach(func() {
+				logOutput = gbytes.NewBuffer()
+				outCommand = out.NewOutCommand(out.OutCommandConfig{
+					BinaryVersion:   "v0.1.2",
+					Logger:          logger.NewLevelLogger(logOutput, logger.LevelWarn),
+					OutDir:          outDir,
+					SourcesDir:      sourcesDir,
+					LogFilePath:     logFilePath,
+					S3OutBinaryName: s3OutBinaryName,
+				})
+			})
+
+			It("logs that Pivnet did not mark the release as controlled", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logOutput).To(gbytes.Say(
+					"Warning: export_controlled was requested but Pivnet did not mark the release as controlled"))
+			})
+		})
+	})
+
+	Context("when an endpoint is provided in the params", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.Endpoint = outRequest.Source.Endpoint
+			outRequest.Source.Endpoint = "http://127.0.0.1:1"
+		})
+
+		It("creates the release on the endpoint of the params", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{ProductVersion: version}))
+		})
+
+		Context("when an api token is provided in the params", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.APIToken = "other-api-token"
+			})
+
+			It("creates the release with the api token of the params", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(server.ReceivedRequests()).NotTo(BeEmpty())
+				for _, r := range server.ReceivedRequests() {
+					if strings.HasPrefix(r.URL.Path, apiPrefix) {
+						Expect(r.Header.Get("Authorization")).To(Equal("Token other-api-token"))
+					}
+				}
+			})
+		})
+
+		Context("when it is not an http or https URL", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.Endpoint = "network.pivotal.io"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("params.endpoint must be an http or https URL - got network.pivotal.io"))
+			})
+		})
+	})
+
+	Context("when warnings_metadata is true and nothing is warned about", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.WarningsMetadata = true
+		})
+
+		It("does not add warnings to the metadata", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, m := range response.Metadata {
+				Expect(m.Name).NotTo(Equal("warnings"))
+			}
+		})
+	})
+
+	Context("when verify_upload is true", func() {
+		var (
+			attachedFiles string
+			groupedFiles  string
+		)
+
+		BeforeEach(func() {
+			verifyUpload = true
+
+			attachedFiles = `{"product_files":[{"id":42,"name":"file-to-upload"}]}`
+			groupedFiles = `{"file_groups":[]}`
+		})
+
+		JustBeforeEach(func() {
+			server.SetHandler(3, ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug)),
+				ghttp.RespondWith(http.StatusCreated, `{"product_file":{"id":42,"name":"file-to-upload"}}`),
+			))
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/product_files", apiPrefix, productSlug, releaseID),
+				ghttp.RespondWith(http.StatusOK, attachedFiles),
+			)
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/file_groups", apiPrefix, productSlug, releaseID),
+				ghttp.RespondWith(http.StatusOK, groupedFiles),
+			)
+		})
+
+		It("runs without error when every uploaded file is on the release", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when an uploaded file is in a file group of the release", func() {
+			BeforeEach(func() {
+				attachedFiles = `{"product_files":[]}`
+				groupedFiles = `{"file_groups":[{"id":3,"name":"tiles","product_files":[{"id":42}]}]}`
+			})
+
+			It("runs without error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when an uploaded file is not on the release", func() {
+			BeforeEach(func() {
+				attachedFiles = `{"product_files":[{"id":7,"name":"other-file"}]}`
+			})
+
+			It("returns an error naming the file", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"files not attached to release 2.1.3 after upload: file-to-upload (product file 42) - Pivnet may have failed to attach them",
+				))
+			})
+
+			Context("when verify_upload is false", func() {
+				BeforeEach(func() {
+					verifyUpload = false
+				})
+
+				It("does not check the release", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when verify_upload is not provided", func() {
+				JustBeforeEach(func() {
+					outRequest.Params.VerifyUpload = nil
+				})
+
+				It("checks the release by default", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).To(MatchError(HavePrefix("files not attached to release 2.1.3 after upload:")))
+				})
+			})
+		})
+	})
+
+	Context("when emit_timings is set", func() {
+		var (
+			logOutput *gbytes.Buffer
+		)
+
+		JustBeforeEach(func() {
+			outRequest.Source.EmitTimings = true
+
+			logOutput = gbytes.NewBuffer()
+			outCommand = out.NewOutCommand(out.OutCommandConfig{
+				BinaryVersion:   "v0.1.2",
+				Logger:          logger.NewLogger(logOutput),
+				OutDir:          outDir,
+				SourcesDir:      sourcesDir,
+				LogFilePath:     logFilePath,
+				S3OutBinaryName: s3OutBinaryName,
+			})
+		})
+
+		It("logs how long hashing and uploading each file and each API call take", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents := string(logOutput.Contents())
+			Expect(contents).To(MatchRegexp(`Timing: {phase: hash, name: \S+, duration_ms: \d+}`))
+			Expect(contents).To(MatchRegexp(`Timing: {phase: upload, name: \S+, duration_ms: \d+}`))
+			Expect(contents).To(MatchRegexp(`Timing: {phase: api, name: POST \S+/releases, duration_ms: \d+}`))
+		})
+	})
+
+	It("returns the version of the release", func() {
+		response, err := outCommand.Run(outRequest)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response.Version).To(Equal(concourse.Version{ProductVersion: version}))
+	})
+
+	Context("when version_from is git_tag", func() {
+		var tag string
+
+		BeforeEach(func() {
+			tag = "v" + version
+		})
+
+		JustBeforeEach(func() {
+			repoDir := filepath.Join(sourcesDir, "repo")
+			err := os.MkdirAll(repoDir, os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, args := range [][]string{
+				{"init", "-q"},
+				{"-c", "user.name=some-user", "-c", "user.email=some-user@example.com", "commit", "-q", "--allow-empty", "-m", "some commit"},
+				{"tag", "v0.0.1"},
+				{"-c", "user.name=some-user", "-c", "user.email=some-user@example.com", "commit", "-q", "--allow-empty", "-m", "other commit"},
+				{"tag", tag},
+			} {
+				cmd := exec.Command("git", args...)
+				cmd.Dir = repoDir
+				output, err := cmd.CombinedOutput()
+				Expect(err).NotTo(HaveOccurred(), string(output))
+			}
+
+			outRequest.Params.VersionFrom = "git_tag"
+			outRequest.Params.VersionGitDir = "repo"
+			outRequest.Params.VersionTagPrefix = "v"
+			outRequest.Params.VersionFile = ""
+		})
+
+		It("creates the release with the version of the latest tag without the prefix", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.Version).To(Equal(version))
+		})
+
+		Context("when the tag is not a semantic version", func() {
+			BeforeEach(func() {
+				tag = "nightly"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("version from git tag nightly must be a semantic version - got nightly"))
+			})
+		})
+
+		Context("when the directory is not a git repository", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.VersionGitDir = "files_to_upload"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(ContainSubstring("failed to find the latest git tag")))
+			})
+		})
+
+		Context("when version_file is also provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.VersionFile = versionFile
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("version_file may only be provided when version_from is file"))
+			})
+		})
+	})
+
+	Context("when version_from is unknown", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.VersionFrom = "branch"
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(MatchError("version_from must be one of file or git_tag - got branch"))
+		})
+	})
+
+	Context("when the version format includes the release id", func() {
+		JustBeforeEach(func() {
+			outRequest.Source.VersionFormat = "{version}#{id}"
+		})
+
+		It("returns the version with the id of the release", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: fmt.Sprintf("%s#%d", version, releaseID),
+			}))
+		})
+
+		Context("when the version format is unknown", func() {
+			JustBeforeEach(func() {
+				outRequest.Source.VersionFormat = "{id}"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("version_format must be one of {version} or {version}#{id} - got {id}"))
+			})
+		})
+	})
+
+	Context("when version_includes_file_hashes is true", func() {
+		BeforeEach(func() {
+			newReleaseResponse.Release.Links = &pivnet.Links{
+				ProductFiles: map[string]string{
+					"href": server.URL() + "/release/product_files",
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Source.VersionFileHashes = true
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/release/product_files"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFiles{
+						ProductFiles: []pivnet.ProductFile{{ID: 9}, {ID: 10}},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/9", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: pivnet.ProductFile{ID: 9, MD5: "md5-a"},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/10", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						ProductFile: pivnet.ProductFile{ID: 10, MD5: "md5-b"},
+					}),
+				),
+			)
+		})
+
+		It("returns the version with a hash of the md5s of the files of the release", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			fileHash := versions.FileHash([]string{"md5-a", "md5-b"})
+			Expect(response.Version).To(Equal(concourse.Version{
+				ProductVersion: fmt.Sprintf("%s@%s", version, fileHash),
+			}))
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "file_hash", Value: fileHash},
+			))
+		})
+
+		Context("when the version format includes the release id", func() {
+			JustBeforeEach(func() {
+				outRequest.Source.VersionFormat = "{version}#{id}"
+			})
+
+			It("appends the hash after the release id", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Version.ProductVersion).To(Equal(fmt.Sprintf(
+					"%s#%d@%s",
+					version,
+					releaseID,
+					versions.FileHash([]string{"md5-a", "md5-b"}),
+				)))
+			})
+		})
+	})
+
+	Context("when release labels are provided", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(filepath.Join(sourcesDir, "description"), []byte("Some description"), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.DescriptionFile = "description"
+			outRequest.Params.ReleaseLabels = map[string]string{
+				"git_sha":  "abc123",
+				"build_id": "42",
+			}
+		})
+
+		It("renders them into the release description", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.Description).To(Equal(`---
+build_id: "42"
+git_sha: "abc123"
+---
+Some description`))
+		})
+
+		It("includes them in metadata", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "label: build_id", Value: "42"}))
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "label: git_sha", Value: "abc123"}))
+		})
+
+		Context("when a label key is invalid", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.ReleaseLabels = map[string]string{"Git SHA": "abc123"}
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(ContainSubstring("release_labels keys must only contain")))
+			})
+		})
+	})
+
+	Context("when s3 upload tuning params are provided", func() {
+		var (
+			s3OutInputPath string
+		)
+
+		BeforeEach(func() {
+			s3UploadConcurrency = 8
+			s3MultipartChunkSize = 100 * 1024 * 1024
+
+			s3OutInputPath = filepath.Join(tempDir, "s3-out-input")
+			s3OutScriptContents := fmt.Sprintf(`#!/bin/sh
+
+cat > %s`, s3OutInputPath)
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("passes them to s3-out", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(s3OutInputPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			var s3OutInput s3.Request
+			err = json.Unmarshal(b, &s3OutInput)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(s3OutInput.Params.Concurrency).To(Equal(s3UploadConcurrency))
+			Expect(s3OutInput.Params.MultipartChunkSize).To(Equal(s3MultipartChunkSize))
+		})
+	})
+
+	Context("when no static aws keys are provided", func() {
+		var (
+			s3OutInputPath string
+			tokenRequests  int
+			logOutput      *gbytes.Buffer
+		)
+
+		writeS3Out := func(contents string) {
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(contents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			accessKeyID = ""
+			secretAccessKey = ""
+
+			tokenRequests = 0
+			server.RouteToHandler(
+				"POST",
+				apiPrefix+"/federation_token",
+				func(w http.ResponseWriter, r *http.Request) {
+					tokenRequests++
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.FederationToken{
+						AccessKeyID:     fmt.Sprintf("federated-access-key-id-%d", tokenRequests),
+						SecretAccessKey: fmt.Sprintf("federated-secret-access-key-%d", tokenRequests),
+						SessionToken:    fmt.Sprintf("federated-session-token-%d", tokenRequests),
+						Bucket:          "federated-bucket",
+						Region:          "us-east-1",
+					})(w, r)
+				},
+			)
+
+			s3OutInputPath = filepath.Join(tempDir, "s3-out-input")
+			writeS3Out(fmt.Sprintf(`#!/bin/sh
+
+cat > %s`, s3OutInputPath))
+		})
+
+		JustBeforeEach(func() {
+			logOutput = gbytes.NewBuffer()
+			sanitizer := sanitizer.NewSanitizer(
+				concourse.SanitizedSource(outRequest.Source),
+				logOutput,
+			)
+
+			outCommand = out.NewOutCommand(out.OutCommandConfig{
+				BinaryVersion:   "v0.1.2",
+				Logger:          logger.NewLogger(sanitizer),
+				OutDir:          outDir,
+				SourcesDir:      sourcesDir,
+				LogFilePath:     logFilePath,
+				S3OutBinaryName: s3OutBinaryName,
+				Sanitizer:       sanitizer,
+			})
+		})
+
+		readS3OutInput := func() s3.Request {
+			b, err := ioutil.ReadFile(s3OutInputPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			var s3OutInput s3.Request
+			err = json.Unmarshal(b, &s3OutInput)
+			Expect(err).NotTo(HaveOccurred())
+
+			return s3OutInput
+		}
+
+		It("uploads with federated credentials from Pivotal Network", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tokenRequests).To(Equal(1))
+
+			s3OutInput := readS3OutInput()
+			Expect(s3OutInput.Source.AccessKeyID).To(Equal("federated-access-key-id-1"))
+			Expect(s3OutInput.Source.SecretAccessKey).To(Equal("federated-secret-access-key-1"))
+			Expect(s3OutInput.Source.SessionToken).To(Equal("federated-session-token-1"))
+			Expect(s3OutInput.Source.Bucket).To(Equal("federated-bucket"))
+			Expect(s3OutInput.Source.RegionName).To(Equal("us-east-1"))
+		})
+
+		It("redacts the federated credentials from the logs", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logOutput.Contents()).To(ContainSubstring("REDACTED-FEDERATED_AWS_SESSION_TOKEN"))
+			Expect(logOutput.Contents()).NotTo(ContainSubstring("federated-access-key-id-1"))
+			Expect(logOutput.Contents()).NotTo(ContainSubstring("federated-secret-access-key-1"))
+			Expect(logOutput.Contents()).NotTo(ContainSubstring("federated-session-token-1"))
+		})
+
+		Context("when the session token expires during the upload", func() {
+			BeforeEach(func() {
+				writeS3Out(fmt.Sprintf(`#!/bin/sh
+
+cat > %s
+if grep -q federated-session-token-1 %s; then
+  echo "ExpiredToken: The provided token has expired." >&2
+  exit 1
+fi`, s3OutInputPath, s3OutInputPath))
+			})
+
+			It("refreshes the credentials and retries the upload", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(tokenRequests).To(Equal(2))
+				Expect(readS3OutInput().Source.SessionToken).To(Equal("federated-session-token-2"))
+			})
+		})
+
+		Context("when the credentials cannot be requested", func() {
+			BeforeEach(func() {
+				server.RouteToHandler(
+					"POST",
+					apiPrefix+"/federation_token",
+					ghttp.RespondWith(http.StatusForbidden, `{"message": "forbidden"}`),
+				)
+			})
+
+			It("returns an error without creating the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(HavePrefix("failed to get federated S3 credentials: ")))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.Method + " " + r.URL.Path).NotTo(Equal(
+						fmt.Sprintf("POST %s/products/%s/releases", apiPrefix, productSlug)))
+				}
+			})
+		})
+
+		Context("when only the secret access key is missing", func() {
+			BeforeEach(func() {
+				accessKeyID = "some-access-key-id"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("secret_access_key must be provided"))
+			})
+		})
+	})
+
+	Context("when min_files is provided", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.MinFiles = 1
+		})
+
+		It("runs without error when enough files are found", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when fewer files are found", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.MinFiles = 2
+			})
+
+			It("returns an error without making any requests to pivnet", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"found 1 files to upload but min_files is 2: [files_to_upload/file-to-upload]"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when min_files is negative", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.MinFiles = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("min_files must not be negative"))
+			})
+		})
+	})
+
+	Context("when required globs are provided", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.RequiredGlobs = []string{"file-to-*"}
+		})
+
+		It("runs without error when every required glob matches", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when a required glob matches no files", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.RequiredGlobs = []string{"file-to-*", "*.pivotal"}
+			})
+
+			It("returns an error without making any requests to pivnet", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"no files to upload match required glob: *.pivotal - found: [files_to_upload/file-to-upload]"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when an eula id is provided", func() {
+		var eula pivnet.Eula
+
+		BeforeEach(func() {
+			eula = pivnet.Eula{ID: 7, Slug: "some_eula"}
+
+			server.RouteToHandler("GET", apiPrefix+"/eulas/7", func(w http.ResponseWriter, r *http.Request) {
+				ghttp.RespondWithJSONEncoded(http.StatusOK, eula)(w, r)
+			})
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.EulaID = 7
+		})
+
+		It("creates the release with the eula id", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.Eula.ID).To(Equal(7))
+			Expect(createReleaseRequest.Release.Eula.Slug).To(Equal("some_eula"))
+		})
+
+		Context("when eula_slug_file is not provided", func() {
+			BeforeEach(func() {
+				eulaSlugFile = ""
+			})
+
+			It("uses the slug of the eula", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createReleaseRequest.Release.Eula.ID).To(Equal(7))
+				Expect(createReleaseRequest.Release.Eula.Slug).To(Equal("some_eula"))
+			})
+		})
+
+		Context("when the eula slug does not match the eula id", func() {
+			BeforeEach(func() {
+				eula.Slug = "other_eula"
+			})
+
+			It("returns an error without creating the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("eula_id 7 is EULA other_eula but eula_slug_file contains some_eula"))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.Method).NotTo(Equal("POST"))
+				}
+			})
+		})
+
+		Context("when the eula does not exist", func() {
+			BeforeEach(func() {
+				server.RouteToHandler("GET", apiPrefix+"/eulas/7", ghttp.RespondWith(http.StatusNotFound, ""))
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(HavePrefix("failed to get EULA 7: "))
+			})
+		})
+
+		Context("when the eula id is negative", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.EulaID = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("eula_id must not be negative"))
+			})
+		})
+	})
+
+	Context("when a dependencies file is provided", func() {
+		var dependencyIDs []int
+
+		BeforeEach(func() {
+			dependencyIDs = nil
+
+			err := ioutil.WriteFile(
+				filepath.Join(sourcesDir, "dependencies.lock"),
+				[]byte("# dependencies of the release\nstemcells 3.1\n\nbuildpacks  1.2.0\n"),
+				os.ModePerm,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			server.RouteToHandler("GET", apiPrefix+"/products/stemcells/releases", ghttp.RespondWithJSONEncoded(
+				http.StatusOK,
+				pivnet.Response{Releases: []pivnet.Release{{ID: 31, Version: "3.1"}}},
+			))
+			server.RouteToHandler("GET", apiPrefix+"/products/buildpacks/releases", ghttp.RespondWithJSONEncoded(
+				http.StatusOK,
+				pivnet.Response{Releases: []pivnet.Release{{ID: 120, Version: "1.2.0"}}},
+			))
+			server.RouteToHandler(
+				"PATCH",
+				fmt.Sprintf("%s/products/%s/releases/%d/add_dependency", apiPrefix, productSlug, releaseID),
+				func(w http.ResponseWriter, r *http.Request) {
+					var body struct {
+						Dependency struct {
+							Release pivnet.Release `json:"release"`
+						} `json:"dependency"`
+					}
+					err := json.NewDecoder(r.Body).Decode(&body)
+					Expect(err).NotTo(HaveOccurred())
+
+					dependencyIDs = append(dependencyIDs, body.Dependency.Release.ID)
+					w.WriteHeader(http.StatusNoContent)
+				},
+			)
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.DependenciesFile = "dependencies.lock"
+		})
+
+		It("adds each dependency to the release by its release id", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dependencyIDs).To(Equal([]int{31, 120}))
+		})
+
+		Context("when dependencies cannot be found", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(
+					filepath.Join(sourcesDir, "dependencies.lock"),
+					[]byte("stemcells 3.2\nbuildpacks 1.2.0\nstemcells 3.3\n"),
+					os.ModePerm,
+				)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error listing them without creating the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("dependencies not found: stemcells 3.2, stemcells 3.3"))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.Method).NotTo(Equal("POST"))
+				}
+			})
+		})
+
+		Context("when a line is not a product slug and version", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(
+					filepath.Join(sourcesDir, "dependencies.lock"),
+					[]byte("stemcells 3.1\nbuildpacks\n"),
+					os.ModePerm,
+				)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("dependencies_file line 2 must be a product slug and version - got buildpacks"))
+			})
+		})
+	})
+
+	Context("when dependency specifiers are provided", func() {
+		var (
+			existingSpecifiers []pivnet.DependencySpecifier
+			createdSpecifiers  []string
+		)
+
+		BeforeEach(func() {
+			existingSpecifiers = nil
+			createdSpecifiers = nil
+
+			dependencySpecifiersPath := fmt.Sprintf("%s/products/%s/releases/%d/dependency_specifiers", apiPrefix, productSlug, releaseID)
+			server.RouteToHandler("GET", dependencySpecifiersPath, func(w http.ResponseWriter, r *http.Request) {
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.DependencySpecifiersResponse{
+					DependencySpecifiers: existingSpecifiers,
+				})(w, r)
+			})
+			server.RouteToHandler("POST", dependencySpecifiersPath, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					DependencySpecifier struct {
+						ProductSlug string `json:"product_slug"`
+						Specifier   string `json:"specifier"`
+					} `json:"dependency_specifier"`
+				}
+				err := json.NewDecoder(r.Body).Decode(&body)
+				Expect(err).NotTo(HaveOccurred())
+
+				createdSpecifiers = append(
+					createdSpecifiers,
+					body.DependencySpecifier.ProductSlug+" "+body.DependencySpecifier.Specifier,
+				)
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"dependency_specifier":{"id":1}}`))
+			})
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.DependencySpecifiers = []concourse.DependencySpecifier{
+				{ProductSlug: "stemcells", Specifier: ">=2.0 <3.0"},
+				{ProductSlug: "buildpacks", Specifier: "1.2.*"},
+			}
+		})
+
+		It("adds each dependency specifier to the release", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createdSpecifiers).To(Equal([]string{"stemcells >=2.0 <3.0", "buildpacks 1.2.*"}))
+		})
+
+		Context("when the release already has a dependency specifier", func() {
+			BeforeEach(func() {
+				existingSpecifiers = []pivnet.DependencySpecifier{
+					{ID: 7, Specifier: ">=2.0 <3.0", Product: pivnet.Product{Slug: "stemcells"}},
+				}
+			})
+
+			It("does not add it again", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createdSpecifiers).To(Equal([]string{"buildpacks 1.2.*"}))
+			})
+		})
+
+		Context("when a specifier is not a version range", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.DependencySpecifiers[1].Specifier = "latest"
+			})
+
+			It("returns an error without creating the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("dependency_specifiers[1].specifier must be a version range such as >=2.0 <3.0 or 2.1.* - got latest"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when a product slug is not provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.DependencySpecifiers[0].ProductSlug = ""
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("dependency_specifiers[0].product_slug must be provided"))
+			})
+		})
+	})
+
+	Context("when a template version is provided", func() {
+		var (
+			templateRelease pivnet.Release
+
+			templateUserGroups   string
+			templateDependencies string
+
+			createProductFileRequest map[string]pivnet.ProductFile
+			addedUserGroupIDs        []int
+			addedDependencyIDs       []int
+		)
+
+		BeforeEach(func() {
+			templateRelease = pivnet.Release{
+				ID:              1000,
+				Version:         "some-template-version",
+				ReleaseType:     "Minor Release",
+				Eula:            &pivnet.Eula{Slug: "template-eula"},
+				Description:     "some template description",
+				ReleaseNotesURL: "https://notes.example.com",
+				Availability:    "All Users",
+				Controlled:      true,
+				Links: &pivnet.Links{
+					ProductFiles: map[string]string{
+						"href": server.URL() + "/template/product_files",
+					},
+				},
+			}
+
+			existingReleasesResponse.Releases = append(
+				existingReleasesResponse.Releases,
+				templateRelease,
+			)
+
+			releaseTypeFile = ""
+			eulaSlugFile = ""
+
+			templateUserGroups = `{"user_groups":[]}`
+			templateDependencies = `{"dependencies":[]}`
+			addedUserGroupIDs = nil
+			addedDependencyIDs = nil
+
+			server.RouteToHandler("GET", "/template/product_files", ghttp.RespondWithJSONEncoded(
+				http.StatusOK,
+				pivnet.ProductFiles{ProductFiles: []pivnet.ProductFile{
+					{
+						Name:         "Some Template File",
+						AWSObjectKey: "product-files/some-product-name/file-to-upload",
+						FileType:     "Documentation",
+						Description:  "some template file description",
+					},
+				}},
+			))
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.TemplateVersion = templateRelease.Version
+
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/user_groups", apiPrefix, productSlug, templateRelease.ID),
+				ghttp.RespondWith(http.StatusOK, templateUserGroups),
+			)
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/dependencies", apiPrefix, productSlug, templateRelease.ID),
+				ghttp.RespondWith(http.StatusOK, templateDependencies),
+			)
+			server.RouteToHandler(
+				"PATCH",
+				fmt.Sprintf("%s/products/%s/releases/%d/add_user_group", apiPrefix, productSlug, releaseID),
+				ghttp.CombineHandlers(
+					func(w http.ResponseWriter, r *http.Request) {
+						var body map[string]pivnet.UserGroup
+						err := json.NewDecoder(r.Body).Decode(&body)
+						Expect(err).NotTo(HaveOccurred())
+						addedUserGroupIDs = append(addedUserGroupIDs, body["user_group"].ID)
+					},
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				),
+			)
+			server.RouteToHandler(
+				"PATCH",
+				fmt.Sprintf("%s/products/%s/releases/%d/add_dependency", apiPrefix, productSlug, releaseID),
+				ghttp.CombineHandlers(
+					func(w http.ResponseWriter, r *http.Request) {
+						var body map[string]pivnet.ReleaseDependency
+						err := json.NewDecoder(r.Body).Decode(&body)
+						Expect(err).NotTo(HaveOccurred())
+						addedDependencyIDs = append(addedDependencyIDs, body["dependency"].Release.ID)
+					},
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				),
+			)
+
+			// The template release is listed by a second request for the
+			// releases, after the existing versions.
+			var handlers []http.HandlerFunc
+			for i := 0; i < 6; i++ {
+				handlers = append(handlers, server.GetHandler(i))
+			}
+
+			handlers[3] = ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"POST",
+					fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug),
+				),
+				func(w http.ResponseWriter, r *http.Request) {
+					createProductFileRequest = nil
+					err := json.NewDecoder(r.Body).Decode(&createProductFileRequest)
+					Expect(err).NotTo(HaveOccurred())
+				},
+				ghttp.RespondWith(http.StatusCreated, ""),
+			)
+
+			handlers = append([]http.HandlerFunc{handlers[0]}, handlers...)
+			for i := 0; i < 6; i++ {
+				server.SetHandler(i, handlers[i])
+			}
+			server.AppendHandlers(handlers[6])
+		})
+
+		It("creates the release with the settings of the template release", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.ReleaseType).To(Equal("Minor Release"))
+			Expect(createReleaseRequest.Release.Eula.Slug).To(Equal("template-eula"))
+			Expect(createReleaseRequest.Release.Description).To(Equal("some template description"))
+			Expect(createReleaseRequest.Release.ReleaseNotesURL).To(Equal("https://notes.example.com"))
+			Expect(createReleaseRequest.Release.Controlled).To(BeTrue())
+		})
+
+		It("creates the product files with the metadata of the template's files", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			productFile := createProductFileRequest["product_file"]
+			Expect(productFile.FileType).To(Equal("Documentation"))
+			Expect(productFile.Description).To(Equal("some template file description"))
+		})
+
+		Context("when settings are provided explicitly", func() {
+			BeforeEach(func() {
+				releaseTypeFile = "release_type"
+			})
+
+			It("overrides the settings of the template release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createReleaseRequest.Release.ReleaseType).To(Equal("some_release"))
+				Expect(createReleaseRequest.Release.Eula.Slug).To(Equal("template-eula"))
+			})
+		})
+
+		Context("when export_controlled is false", func() {
+			JustBeforeEach(func() {
+				exportControlled := false
+				outRequest.Params.ExportControlled = &exportControlled
+			})
+
+			It("overrides the export control of the template release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createReleaseRequest.Release.Controlled).To(BeFalse())
+			})
+		})
+
+		Context("when the template release is only available to user groups", func() {
+			BeforeEach(func() {
+				existingReleasesResponse.Releases[1].Availability = "Selected User Groups Only"
+				templateUserGroups = `{"user_groups":[{"id":3456},{"id":4567}]}`
+			})
+
+			It("adds the user groups of the template release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(addedUserGroupIDs).To(Equal([]int{3456, 4567}))
+			})
+		})
+
+		Context("when the template release has dependencies", func() {
+			BeforeEach(func() {
+				templateDependencies = `{"dependencies":[{"release":{"id":9876,"version":"1.2.3","product":{"slug":"other-product"}}}]}`
+			})
+
+			It("adds the dependencies of the template release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(addedDependencyIDs).To(Equal([]int{9876}))
+			})
+		})
+
+		Context("when the template release does not exist", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.TemplateVersion = "some-missing-version"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"failed to get template release some-missing-version: The requested version: some-missing-version - could not be found"))
+			})
+		})
+	})
+
+	Context("when a metadata manifest is provided", func() {
+		var (
+			manifestContents string
+
+			createProductFileRequest map[string]pivnet.ProductFile
+		)
+
+		BeforeEach(func() {
+			manifestContents = `{"files": [{"file": "file-to-*", "description": "some description", "docs_url": "https://docs.example.com", "file_type": "Documentation"}]}`
+		})
+
+		JustBeforeEach(func() {
+			err := ioutil.WriteFile(
+				filepath.Join(sourcesDir, "manifest.json"),
+				[]byte(manifestContents),
+				os.ModePerm,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			outRequest.Params.MetadataManifestJSON = "manifest.json"
+
+			server.SetHandler(3, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"POST",
+					fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug),
+				),
+				func(w http.ResponseWriter, r *http.Request) {
+					createProductFileRequest = nil
+					err := json.NewDecoder(r.Body).Decode(&createProductFileRequest)
+					Expect(err).NotTo(HaveOccurred())
+				},
+				ghttp.RespondWith(http.StatusCreated, ""),
+			))
+		})
+
+		It("creates the product files with the metadata from the manifest", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			productFile := createProductFileRequest["product_file"]
+			Expect(productFile.FileType).To(Equal("Documentation"))
+			Expect(productFile.Description).To(Equal("some description"))
+			Expect(productFile.DocsURL).To(Equal("https://docs.example.com"))
+		})
+
+		Context("when the manifest provides labels", func() {
+			BeforeEach(func() {
+				manifestContents = `{"files": [{"file": "file-to-*", "description": "some description", "labels": ["linux", "amd64"]}]}`
+			})
+
+			It("renders the labels into the description of the product file", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createProductFileRequest["product_file"].Description).To(Equal(
+					labels.RenderFileLabels([]string{"linux", "amd64"}, "some description"),
+				))
+
+				Expect(response.Metadata).To(ContainElement(
+					concourse.Metadata{Name: "file_labels: file-to-upload", Value: "linux, amd64"}))
+			})
+
+			Context("when a label cannot be parsed", func() {
+				BeforeEach(func() {
+					manifestContents = `{"files": [{"file": "file-to-*", "labels": ["Linux"]}]}`
+				})
+
+				It("returns an error before creating the release", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).To(MatchError(
+						`metadata manifest entry file-to-*: labels must only contain a-z, 0-9, _, . and - - got "Linux"`))
+
+					Expect(server.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the manifest provides a system requirements file", func() {
+			var requirementsContents []byte
+
+			BeforeEach(func() {
+				manifestContents = `{"files": [{"file": "file-to-*", "system_requirements_file": "requirements.txt"}]}`
+				requirementsContents = []byte("Ops Manager 2.10 or later\n\n4 GB of memory per VM\n")
+			})
+
+			JustBeforeEach(func() {
+				err := ioutil.WriteFile(filepath.Join(sourcesDir, "requirements.txt"), requirementsContents, os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("creates the product file with the system requirements", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createProductFileRequest["product_file"].SystemRequirements).To(Equal([]string{
+					"Ops Manager 2.10 or later",
+					"4 GB of memory per VM",
+				}))
+			})
+
+			Context("when the system requirements file is not UTF-8", func() {
+				BeforeEach(func() {
+					requirementsContents = []byte{0xff, 0xfe}
+				})
+
+				It("returns an error before creating the release", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).To(MatchError(MatchRegexp(
+						"metadata manifest entry file-to-\\*: system_requirements_file .*requirements.txt must be UTF-8")))
+
+					Expect(server.ReceivedRequests()).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the manifest overrides the s3 region and bucket", func() {
+			var s3OutInputPath string
+
+			BeforeEach(func() {
+				manifestContents = `{"files": [{"file": "file-to-*", "s3_region": "us-west-2", "s3_bucket": "local-bucket"}]}`
+
+				s3OutInputPath = filepath.Join(tempDir, "s3-out-input")
+				s3OutScriptContents := fmt.Sprintf(`#!/bin/sh
+
+cat > %s`, s3OutInputPath)
+
+				s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+				err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uploads the file to the overridden region and bucket", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(s3OutInputPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				var s3OutInput s3.Request
+				err = json.Unmarshal(b, &s3OutInput)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(s3OutInput.Source.RegionName).To(Equal("us-west-2"))
+				Expect(s3OutInput.Source.Bucket).To(Equal("local-bucket"))
+			})
+
+			Context("when only the region is overridden", func() {
+				BeforeEach(func() {
+					manifestContents = `{"files": [{"file": "file-to-*", "s3_region": "us-west-2"}]}`
+				})
+
+				It("falls back to the bucket of the source", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					b, err := ioutil.ReadFile(s3OutInputPath)
+					Expect(err).NotTo(HaveOccurred())
+
+					var s3OutInput s3.Request
+					err = json.Unmarshal(b, &s3OutInput)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(s3OutInput.Source.RegionName).To(Equal("us-west-2"))
+					Expect(s3OutInput.Source.Bucket).To(Equal("pivotalnetwork"))
+				})
+			})
+
+			Context("when the upload backend is presigned", func() {
+				JustBeforeEach(func() {
+					outRequest.Params.UploadBackend = "presigned"
+				})
+
+				It("returns an error", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).To(MatchError(
+						"metadata manifest s3_region and s3_bucket may only be provided when upload_backend is s3"))
+				})
+			})
+		})
+
+		Context("when the manifest refers to an unknown file", func() {
+			BeforeEach(func() {
+				manifestContents = `{"files": [{"file": "*.pivotal", "description": "some tile"}]}`
+			})
+
+			It("returns an error without making any requests to pivnet", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"metadata manifest entry *.pivotal matches none of the files to upload: [files_to_upload/file-to-upload]"))
+
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+		})
+
+		Context("when the manifest is invalid", func() {
+			BeforeEach(func() {
+				manifestContents = `{"files": [{"description": "some description"}]}`
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("metadata manifest entry 0 must provide file"))
+			})
+		})
+	})
+
+	Context("when a file group is provided", func() {
+		var (
+			existingFileGroups string
+
+			createFileGroupRequests int
+			addFileGroupRequest     map[string]pivnet.FileGroup
+			addToFileGroupRequest   map[string]pivnet.ProductFile
+		)
+
+		BeforeEach(func() {
+			existingFileGroups = `{"file_groups":[{"id":3,"name":"tiles"}]}`
+			createFileGroupRequests = 0
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.FileGroup = "tiles"
+
+			fileGroupsURL := fmt.Sprintf("%s/products/%s/file_groups", apiPrefix, productSlug)
+
+			server.RouteToHandler("GET", fileGroupsURL,
+				ghttp.RespondWith(http.StatusOK, existingFileGroups),
+			)
+			server.RouteToHandler("POST", fileGroupsURL, ghttp.CombineHandlers(
+				func(w http.ResponseWriter, r *http.Request) {
+					createFileGroupRequests++
+				},
+				ghttp.VerifyJSON(`{"file_group":{"name":"tiles"}}`),
+				ghttp.RespondWith(http.StatusCreated, `{"id":4,"name":"tiles"}`),
+			))
+			server.RouteToHandler("PATCH", regexp.MustCompile(`/releases/\d+/add_file_group$`),
+				ghttp.CombineHandlers(
+					func(w http.ResponseWriter, r *http.Request) {
+						addFileGroupRequest = nil
+						err := json.NewDecoder(r.Body).Decode(&addFileGroupRequest)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				),
+			)
+			server.RouteToHandler("PATCH", regexp.MustCompile(`/file_groups/\d+/add_product_file$`),
+				ghttp.CombineHandlers(
+					func(w http.ResponseWriter, r *http.Request) {
+						addToFileGroupRequest = nil
+						err := json.NewDecoder(r.Body).Decode(&addToFileGroupRequest)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				),
+			)
+
+			server.SetHandler(3, ghttp.RespondWith(http.StatusCreated, `{"product_file":{"id":5678}}`))
+
+			// The product file is added to the file group instead of the release.
+			server.SetHandler(4, server.GetHandler(5))
+		})
+
+		It("adds the product file to the existing file group and the file group to the release", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createFileGroupRequests).To(Equal(0))
+			Expect(addFileGroupRequest["file_group"].ID).To(Equal(3))
+			Expect(addToFileGroupRequest["product_file"].ID).To(Equal(5678))
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "file_group: file-to-upload", Value: "tiles"}))
+		})
+
+		Context("when the product has no file group with the name", func() {
+			BeforeEach(func() {
+				existingFileGroups = `{"file_groups":[]}`
+			})
+
+			It("creates the file group", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(createFileGroupRequests).To(Equal(1))
+				Expect(addFileGroupRequest["file_group"].ID).To(Equal(4))
+			})
+		})
+
+		Context("when the metadata manifest provides a file group", func() {
+			BeforeEach(func() {
+				existingFileGroups = `{"file_groups":[{"id":3,"name":"tiles"},{"id":7,"name":"other"}]}`
+			})
+
+			JustBeforeEach(func() {
+				err := ioutil.WriteFile(
+					filepath.Join(sourcesDir, "manifest.json"),
+					[]byte(`{"files": [{"file": "file-to-*", "file_group": "other"}]}`),
+					os.ModePerm,
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				outRequest.Params.MetadataManifestJSON = "manifest.json"
+			})
+
+			It("uses the file group from the manifest", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(addFileGroupRequest["file_group"].ID).To(Equal(7))
+				Expect(response.Metadata).To(ContainElement(
+					concourse.Metadata{Name: "file_group: file-to-upload", Value: "other"}))
+			})
+		})
+
+		Context("when the file group cannot be resolved", func() {
+			JustBeforeEach(func() {
+				server.RouteToHandler("GET", fmt.Sprintf("%s/products/%s/file_groups", apiPrefix, productSlug),
+					ghttp.RespondWith(http.StatusTeapot, ""),
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(ContainSubstring(
+					"failed to resolve file group tiles: Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Context("when update_fields is provided without mode attach or resume", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.UpdateFields = []string{"availability"}
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(MatchError("update_fields may only be provided when mode is attach or with resume"))
+		})
+	})
+
+	Context("when resume is true", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.Resume = true
+		})
+
+		It("creates the release when it does not exist", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(server.ReceivedRequests()[1].Method).To(Equal("POST"))
+		})
+
+		Context("when the release exists", func() {
+			var attachedMD5 string
+
+			BeforeEach(func() {
+				existingReleasesResponse = pivnet.Response{
+					Releases: []pivnet.Release{{ID: releaseID, Version: version}},
+				}
+
+				attachedMD5 = fmt.Sprintf("%x", md5.Sum([]byte("some contents")))
+			})
+
+			JustBeforeEach(func() {
+				server.SetHandler(1, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+					),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, existingReleasesResponse),
+				))
+				server.SetHandler(2, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWith(http.StatusOK, `{"product_files":[{"id":5678,"name":"Some File"}]}`),
+				))
+				server.SetHandler(3, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/%s/releases/%d/product_files/5678", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(
+						`{"product_file":{"id":5678,"name":"Some File","aws_object_key":"%s/file-to-upload","md5":"%s"}}`,
+						s3FilepathPrefix,
+						attachedMD5,
+					)),
+				))
+				server.SetHandler(4, server.GetHandler(5))
+			})
+
+			It("resumes the release without creating it or uploading the attached files again", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(len(server.ReceivedRequests())).To(Equal(5))
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.Method).NotTo(Equal("POST"))
+				}
+
+				Expect(response.Metadata).To(ContainElement(concourse.Metadata{
+					Name:  "md5: file-to-upload",
+					Value: attachedMD5,
+				}))
+			})
+
+			Context("when update_fields does not include availability", func() {
+				JustBeforeEach(func() {
+					outRequest.Params.UpdateFields = []string{"end_of_support_date"}
+				})
+
+				It("does not update the availability of the release", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, r := range server.ReceivedRequests() {
+						Expect(r.Method).NotTo(Equal("PATCH"))
+					}
+				})
+			})
+
+			Context("when the attached file has a different md5", func() {
+				BeforeEach(func() {
+					attachedMD5 = "some-other-md5"
+				})
+
+				It("returns an error", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).To(HaveOccurred())
+
+					Expect(err.Error()).To(ContainSubstring(fmt.Sprintf(
+						"file file-to-upload is already attached to release %s with md5 some-other-md5",
+						version,
+					)))
+				})
+			})
+		})
+
+		Context("when cleanup_on_failure is also provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.CleanupOnFailure = true
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("cleanup_on_failure may not be provided with resume"))
+			})
+		})
+
+		Context("when mode is attach", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.Mode = "attach"
+				outRequest.Params.ReleaseTypeFile = ""
+				outRequest.Params.EulaSlugFile = ""
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("resume may not be provided when mode is attach"))
+			})
+		})
+	})
+
+	Context("when mode is attach", func() {
+		BeforeEach(func() {
+			existingReleasesResponse = pivnet.Response{
+				Releases: []pivnet.Release{{ID: releaseID, Version: version}},
+			}
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.Mode = "attach"
+			outRequest.Params.ReleaseTypeFile = ""
+			outRequest.Params.EulaSlugFile = ""
+
+			server.SetHandler(1, ghttp.CombineHandlers(
+				ghttp.VerifyRequest(
+					"GET",
+					fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug),
+				),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, existingReleasesResponse),
+			))
+		})
+
+		It("adds the files to the existing release without creating or updating it", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			var requests []string
+			for _, r := range server.ReceivedRequests() {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+			}
+			Expect(requests).To(Equal([]string{
+				fmt.Sprintf("GET %s/products/%s/releases", apiPrefix, productSlug),
+				fmt.Sprintf("GET %s/products/%s/releases", apiPrefix, productSlug),
+				fmt.Sprintf("GET %s/products/%s", apiPrefix, productSlug),
+				fmt.Sprintf("POST %s/products/%s/product_files", apiPrefix, productSlug),
+				fmt.Sprintf("PATCH %s/products/%d/releases/%d/add_product_file", apiPrefix, productID, releaseID),
+			}))
+
+			Expect(response.Version.ProductVersion).To(Equal(version))
+		})
+
+		Context("when the release does not exist", func() {
+			BeforeEach(func() {
+				existingReleasesResponse = pivnet.Response{
+					Releases: []pivnet.Release{{ID: 1234, Version: "some-other-version"}},
+				}
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"release does not exist with version: 2.1.3 - mode attach only adds files to an existing release"))
+			})
+		})
+
+		Context("when a setting of the release is provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.ReleaseTypeFile = releaseTypeFile
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("release_type_file may not be provided when mode is attach"))
+			})
+		})
+
+		Context("when an end of support date is provided", func() {
+			var updateReleaseRequest createReleaseBody
+
+			JustBeforeEach(func() {
+				updateReleaseRequest = createReleaseBody{}
+				outRequest.Params.EndOfSupportDate = "2017-06-30"
+
+				server.SetHandler(5, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"PATCH",
+						fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+					),
+					func(w http.ResponseWriter, r *http.Request) {
+						updateReleaseRequest = createReleaseBody{}
+						err := json.NewDecoder(r.Body).Decode(&updateReleaseRequest)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.CreateReleaseResponse{
+						Release: pivnet.Release{ID: releaseID, Version: version, EndOfSupportDate: "2017-06-30"},
+					}),
+				))
+			})
+
+			It("sets only the end of support date on the existing release", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(updateReleaseRequest.Release.EndOfSupportDate).To(Equal("2017-06-30"))
+				Expect(updateReleaseRequest.Release.Availability).To(BeEmpty())
+				Expect(response.Metadata).To(ContainElement(
+					concourse.Metadata{Name: "end_of_support_date", Value: "2017-06-30"}))
+			})
+
+			Context("when update_fields does not include end_of_support_date", func() {
+				JustBeforeEach(func() {
+					outRequest.Params.UpdateFields = []string{}
+				})
+
+				It("does not update the existing release", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(updateReleaseRequest.Release.EndOfSupportDate).To(BeEmpty())
+					for _, r := range server.ReceivedRequests() {
+						Expect(r.Method + " " + r.URL.Path).NotTo(Equal(fmt.Sprintf(
+							"PATCH %s/products/%s/releases/%d", apiPrefix, productSlug, releaseID)))
+					}
+				})
+			})
+		})
+
+		Context("when update_fields contains an unknown setting", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.UpdateFields = []string{"end_of_support_date", "description"}
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"update_fields[1] must be one of availability or end_of_support_date - got description"))
+			})
+		})
+
+		Context("when cleanup_on_failure is true", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.CleanupOnFailure = true
+			})
+
+			It("returns an error rather than risking deleting the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("cleanup_on_failure may not be provided when mode is attach"))
+			})
+		})
+
+		Context("when mode is unknown", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.Mode = "update"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("mode must be one of create, attach or mirror - got update"))
+			})
+		})
+
+		Context("when sync_files is true", func() {
+			var removedProductFileIDs []int
+
+			BeforeEach(func() {
+				existingReleasesResponse = pivnet.Response{
+					Releases: []pivnet.Release{{
+						ID:      releaseID,
+						Version: version,
+						Links: &pivnet.Links{
+							ProductFiles: map[string]string{
+								"href": server.URL() + "/existing/product_files",
+							},
+						},
+					}},
+				}
+
+				server.RouteToHandler("GET", "/existing/product_files", ghttp.RespondWithJSONEncoded(
+					http.StatusOK,
+					pivnet.ProductFiles{ProductFiles: []pivnet.ProductFile{
+						{ID: 10, Name: "file-to-upload", AWSObjectKey: "product-files/some-product-name/stale-file"},
+					}},
+				))
+			})
+
+			JustBeforeEach(func() {
+				outRequest.Params.SyncFiles = true
+
+				removedProductFileIDs = nil
+
+				// Detaching the stale file adds requests before the upload, so
+				// the requests are routed rather than expected in order.
+				server.RouteToHandler("GET", fmt.Sprintf("%s/products/%s", apiPrefix, productSlug),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, productsResponse),
+				)
+				server.RouteToHandler("POST", fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug),
+					ghttp.RespondWith(http.StatusCreated, ""),
+				)
+				server.RouteToHandler("PATCH", fmt.Sprintf(
+					"%s/products/%d/releases/%d/add_product_file",
+					apiPrefix,
+					productID,
+					releaseID,
+				), ghttp.RespondWith(http.StatusNoContent, ""))
+				server.RouteToHandler("PATCH", fmt.Sprintf(
+					"%s/products/%d/releases/%d/remove_product_file",
+					apiPrefix,
+					productID,
+					releaseID,
+				), func(w http.ResponseWriter, r *http.Request) {
+					var body map[string]pivnet.ProductFile
+					err := json.NewDecoder(r.Body).Decode(&body)
+					Expect(err).NotTo(HaveOccurred())
+
+					removedProductFileIDs = append(removedProductFileIDs, body["product_file"].ID)
+					w.WriteHeader(http.StatusNoContent)
+				})
+			})
+
+			It("detaches the files no longer matched by file_glob before uploading", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(removedProductFileIDs).To(Equal([]int{10}))
+
+				var requests []string
+				for _, r := range server.ReceivedRequests() {
+					requests = append(requests, r.Method+" "+r.URL.Path)
+				}
+				removeRequest := fmt.Sprintf("PATCH %s/products/%d/releases/%d/remove_product_file", apiPrefix, productID, releaseID)
+				createRequest := fmt.Sprintf("POST %s/products/%s/product_files", apiPrefix, productSlug)
+				Expect(requests).To(ContainElement(removeRequest))
+				Expect(requests).To(ContainElement(createRequest))
+
+				var removedAt, createdAt int
+				for i, r := range requests {
+					switch r {
+					case removeRequest:
+						removedAt = i
+					case createRequest:
+						createdAt = i
+					}
+				}
+				Expect(removedAt).To(BeNumerically("<", createdAt))
+			})
+		})
+
+		Context("when a file with the same name is already attached to the release", func() {
+			BeforeEach(func() {
+				existingReleasesResponse = pivnet.Response{
+					Releases: []pivnet.Release{{
+						ID:      releaseID,
+						Version: version,
+						Links: &pivnet.Links{
+							ProductFiles: map[string]string{
+								"href": server.URL() + "/existing/product_files",
+							},
+						},
+					}},
+				}
+
+				server.RouteToHandler("GET", "/existing/product_files", ghttp.RespondWithJSONEncoded(
+					http.StatusOK,
+					pivnet.ProductFiles{ProductFiles: []pivnet.ProductFile{
+						{ID: 9, Name: "Some File", AWSObjectKey: "product-files/some-product-name/file-to-upload"},
+						{ID: 10, Name: "file-to-upload", AWSObjectKey: "product-files/some-product-name/some-other-file"},
+					}},
+				))
+			})
+
+			It("returns an error without uploading the file", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"file file-to-upload is already attached to release 2.1.3 - set overwrite_existing to replace it"))
+
+				for _, r := range server.ReceivedRequests() {
+					Expect(r.Method + " " + r.URL.Path).NotTo(Equal(
+						fmt.Sprintf("POST %s/products/%s/product_files", apiPrefix, productSlug)))
+				}
+			})
+
+			Context("when overwrite_existing is true", func() {
+				JustBeforeEach(func() {
+					outRequest.Params.OverwriteExisting = true
+
+					server.SetHandler(5, ghttp.CombineHandlers(
+						ghttp.VerifyRequest(
+							"GET",
+							fmt.Sprintf("%s/products/%s", apiPrefix, productSlug),
+						),
+						ghttp.RespondWithJSONEncoded(http.StatusOK, productsResponse),
+					))
+
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest(
+								"PATCH",
+								fmt.Sprintf("%s/products/%d/releases/%d/remove_product_file", apiPrefix, productID, releaseID),
+							),
+							ghttp.VerifyJSON(`{"product_file":{"id":9}}`),
+							ghttp.RespondWith(http.StatusNoContent, ""),
+						),
+					)
+				})
+
+				It("attaches the new file and detaches the existing one", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					var requests []string
+					for _, r := range server.ReceivedRequests() {
+						requests = append(requests, r.Method+" "+r.URL.Path)
+					}
+					Expect(requests).To(Equal([]string{
+						fmt.Sprintf("GET %s/products/%s/releases", apiPrefix, productSlug),
+						fmt.Sprintf("GET %s/products/%s/releases", apiPrefix, productSlug),
+						"GET /existing/product_files",
+						fmt.Sprintf("GET %s/products/%s", apiPrefix, productSlug),
+						fmt.Sprintf("POST %s/products/%s/product_files", apiPrefix, productSlug),
+						fmt.Sprintf("PATCH %s/products/%d/releases/%d/add_product_file", apiPrefix, productID, releaseID),
+						fmt.Sprintf("GET %s/products/%s", apiPrefix, productSlug),
+						fmt.Sprintf("PATCH %s/products/%d/releases/%d/remove_product_file", apiPrefix, productID, releaseID),
+					}))
+				})
+			})
+		})
+	})
+
+	Context("when mode is mirror", func() {
+		var (
+			mirrorProductSlug string
+			mirroredRelease   pivnet.Release
+
+			createReleaseRequest     createReleaseBody
+			createProductFileRequest map[string]pivnet.ProductFile
+		)
+
+		BeforeEach(func() {
+			mirrorProductSlug = "some-public-product"
+			mirroredRelease = pivnet.Release{
+				ID:           3000,
+				Version:      version,
+				ReleaseType:  "Minor Release",
+				Eula:         &pivnet.Eula{Slug: "mirrored-eula"},
+				Description:  "some mirrored description",
+				Availability: "All Users",
+				Links: &pivnet.Links{
+					ProductFiles: map[string]string{
+						"href": server.URL() + "/mirrored/product_files",
+					},
+				},
+			}
+
+			releaseTypeFile = ""
+			eulaSlugFile = ""
+			fileGlob = ""
+			s3FilepathPrefix = ""
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.Mode = "mirror"
+			outRequest.Params.MirrorProductSlug = mirrorProductSlug
+
+			// The top-level handlers expect the requests of a put with files
+			// to upload, so the requests of a mirror replace them.
+			server.Reset()
+			server.RouteToHandler("GET", "/mirrored/product_files", ghttp.RespondWithJSONEncoded(
+				http.StatusOK,
+				pivnet.ProductFiles{ProductFiles: []pivnet.ProductFile{
+					{
+						ID:           3001,
+						Name:         "some-tile.pivotal",
+						AWSObjectKey: "product_files/some-public-product/some-tile.pivotal",
+						FileType:     "Software",
+					},
+				}},
+			))
+			server.RouteToHandler(
+				"GET",
+				fmt.Sprintf("%s/products/%s/releases/%d/product_files/3001", apiPrefix, mirrorProductSlug, mirroredRelease.ID),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: pivnet.ProductFile{
+						ID:           3001,
+						Name:         "some-tile.pivotal",
+						AWSObjectKey: "product_files/some-public-product/some-tile.pivotal",
+						MD5:          "some-md5",
+						FileType:     "Software",
+						Description:  "some mirrored file description",
+						DocsURL:      "https://docs.example.com",
+					},
+				}),
+			)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, existingReleasesResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s/releases", apiPrefix, mirrorProductSlug)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.Response{
+						Releases: []pivnet.Release{mirroredRelease},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", fmt.Sprintf("%s/products/%s/releases", apiPrefix, productSlug)),
+					func(w http.ResponseWriter, r *http.Request) {
+						createReleaseRequest = createReleaseBody{}
+						err := json.NewDecoder(r.Body).Decode(&createReleaseRequest)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					ghttp.RespondWithJSONEncoded(http.StatusCreated, newReleaseResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s", apiPrefix, productSlug)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, productsResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug)),
+					func(w http.ResponseWriter, r *http.Request) {
+						createProductFileRequest = nil
+						err := json.NewDecoder(r.Body).Decode(&createProductFileRequest)
+						Expect(err).NotTo(HaveOccurred())
+					},
+					ghttp.RespondWith(http.StatusCreated, `{"product_file": {"id": 4001}}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"PATCH",
+						fmt.Sprintf("%s/products/%d/releases/%d/add_product_file", apiPrefix, productID, releaseID),
+					),
+					ghttp.VerifyJSON(`{"product_file":{"id":4001}}`),
+					ghttp.RespondWith(http.StatusNoContent, ""),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, newReleaseResponse),
+				),
+			)
+		})
+
+		It("creates the release from the mirrored release with its files", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(createReleaseRequest.Release.ReleaseType).To(Equal("Minor Release"))
+			Expect(createReleaseRequest.Release.Eula.Slug).To(Equal("mirrored-eula"))
+			Expect(createReleaseRequest.Release.Description).To(Equal("some mirrored description"))
+
+			productFile := createProductFileRequest["product_file"]
+			Expect(productFile.Name).To(Equal("some-tile.pivotal"))
+			Expect(productFile.AWSObjectKey).To(Equal("product_files/some-public-product/some-tile.pivotal"))
+			Expect(productFile.MD5).To(Equal("some-md5"))
+			Expect(productFile.FileVersion).To(Equal(version))
+			Expect(productFile.Description).To(Equal("some mirrored file description"))
+			Expect(productFile.DocsURL).To(Equal("https://docs.example.com"))
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "mirrored_from", Value: "some-public-product 2.1.3"}))
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "md5: some-tile.pivotal", Value: "some-md5"}))
+		})
+
+		It("only reads the mirrored product", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, r := range server.ReceivedRequests() {
+				if strings.Contains(r.URL.Path, mirrorProductSlug) || strings.HasPrefix(r.URL.Path, "/mirrored") {
+					Expect(r.Method).To(Equal("GET"))
+				}
+			}
+		})
+
+		Context("when mirror_product_slug is not provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.MirrorProductSlug = ""
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("mirror_product_slug must be provided when mode is mirror"))
+			})
+		})
+
+		Context("when template_version is provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.TemplateVersion = "some-template-version"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("template_version may not be provided when mode is mirror"))
+			})
+		})
+	})
+
+	Context("when mirror_product_slug is provided and mode is not mirror", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.MirrorProductSlug = "some-public-product"
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(MatchError("mirror_product_slug may only be provided when mode is mirror"))
+		})
+	})
+
+	Context("when sync_files is true and mode is not attach", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.SyncFiles = true
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(MatchError("sync_files may only be provided when mode is attach"))
+		})
+	})
+
+	Context("when overwrite_existing is true and mode is not attach", func() {
+		JustBeforeEach(func() {
+			outRequest.Params.OverwriteExisting = true
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(MatchError("overwrite_existing may only be provided when mode is attach"))
+		})
+	})
+
+	Context("when s3 server-side encryption is provided", func() {
+		var (
+			s3OutInputPath string
+		)
+
+		BeforeEach(func() {
+			s3OutInputPath = filepath.Join(tempDir, "s3-out-input")
+			s3OutScriptContents := fmt.Sprintf(`#!/bin/sh
+
+cat > %s`, s3OutInputPath)
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.S3SSE = "aws:kms"
+			outRequest.Params.S3KMSKeyID = "some-kms-key-id"
+		})
+
+		It("passes it to s3-out", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := ioutil.ReadFile(s3OutInputPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			var s3OutInput s3.Request
+			err = json.Unmarshal(b, &s3OutInput)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(s3OutInput.Params.ServerSideEncryption).To(Equal("aws:kms"))
+			Expect(s3OutInput.Params.SSEKMSKeyID).To(Equal("some-kms-key-id"))
+		})
+
+		It("reports the encryption in metadata", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "s3_sse", Value: "aws:kms"}))
+			Expect(response.Metadata).To(ContainElement(
+				concourse.Metadata{Name: "s3_kms_key_id", Value: "some-kms-key-id"}))
+		})
+
+		Context("when a CA certificate is provided", func() {
+			JustBeforeEach(func() {
+				tlsServer := ghttp.NewTLSServer()
+				defer tlsServer.Close()
+
+				outRequest.Source.CACert = string(pem.EncodeToMemory(&pem.Block{
+					Type:  "CERTIFICATE",
+					Bytes: tlsServer.HTTPTestServer.Certificate().Raw,
+				}))
+				outRequest.Source.SkipSSLVerification = true
+			})
+
+			It("passes a CA bundle to s3-out and removes it afterwards", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(s3OutInputPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				var s3OutInput s3.Request
+				err = json.Unmarshal(b, &s3OutInput)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(s3OutInput.Source.CABundle).NotTo(BeEmpty())
+				Expect(s3OutInput.Source.SkipSSLVerification).To(BeTrue())
+
+				_, err = os.Stat(s3OutInput.Source.CABundle)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("stages the CA bundle in the sources directory and removes the staging directory", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(s3OutInputPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				var s3OutInput s3.Request
+				err = json.Unmarshal(b, &s3OutInput)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Dir(filepath.Dir(s3OutInput.Source.CABundle))).To(Equal(sourcesDir))
+
+				stagingDirs, err := filepath.Glob(filepath.Join(sourcesDir, "pivnet-resource-staging*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stagingDirs).To(BeEmpty())
+			})
+
+			Context("when a tmp dir is provided", func() {
+				var stagingDir string
+
+				JustBeforeEach(func() {
+					stagingDir = filepath.Join(tempDir, "staging")
+					outRequest.Params.TmpDir = stagingDir
+				})
+
+				It("stages the CA bundle in it and removes the staged files", func() {
+					_, err := outCommand.Run(outRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					b, err := ioutil.ReadFile(s3OutInputPath)
+					Expect(err).NotTo(HaveOccurred())
+
+					var s3OutInput s3.Request
+					err = json.Unmarshal(b, &s3OutInput)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(filepath.Dir(filepath.Dir(s3OutInput.Source.CABundle))).To(Equal(stagingDir))
+
+					staged, err := ioutil.ReadDir(stagingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(staged).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when no encryption is requested", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3SSE = ""
+				outRequest.Params.S3KMSKeyID = ""
+			})
+
+			It("reports no encryption in metadata", func() {
+				response, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(response.Metadata).To(ContainElement(
+					concourse.Metadata{Name: "s3_sse", Value: "none"}))
+			})
+		})
+
+		Context("when s3_sse is not a supported value", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3SSE = "aws:kms:dsse"
+				outRequest.Params.S3KMSKeyID = ""
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"s3_sse must be one of AES256 or aws:kms - got aws:kms:dsse"))
+			})
+		})
+
+		Context("when s3_kms_key_id is provided without aws:kms", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3SSE = "AES256"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"s3_kms_key_id may only be provided when s3_sse is aws:kms"))
+			})
+		})
+	})
+
+	Context("when the upload backend is presigned", func() {
+		var (
+			uploadedObjectKeys []string
+			uploadedContents   []string
+		)
+
+		BeforeEach(func() {
+			uploadedObjectKeys = nil
+			uploadedContents = nil
+
+			s3OutScriptContents := `#!/bin/sh
+
+echo "s3-out must not be run" >&2
+exit 1`
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			server.RouteToHandler(
+				"POST",
+				fmt.Sprintf("%s/products/%s/product_files/upload_urls", apiPrefix, productSlug),
+				func(w http.ResponseWriter, r *http.Request) {
+					var body struct {
+						UploadURL pivnet.UploadURL `json:"upload_url"`
+					}
+					err := json.NewDecoder(r.Body).Decode(&body)
+					Expect(err).NotTo(HaveOccurred())
+
+					uploadedObjectKeys = append(uploadedObjectKeys, body.UploadURL.AWSObjectKey)
+
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprintf(w, `{"upload_url":{"url":"%s/bucket/%s?sig=abc"}}`,
+						server.URL(), body.UploadURL.AWSObjectKey)
+				},
+			)
+
+			server.RouteToHandler(
+				"PUT",
+				regexp.MustCompile("^/bucket/"),
+				func(w http.ResponseWriter, r *http.Request) {
+					b, err := ioutil.ReadAll(r.Body)
+					Expect(err).NotTo(HaveOccurred())
+
+					uploadedContents = append(uploadedContents, string(b))
+				},
+			)
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.UploadBackend = "presigned"
+			outRequest.Source.AccessKeyID = ""
+			outRequest.Source.SecretAccessKey = ""
+		})
+
+		It("PUTs the files to pre-signed URLs instead of running s3-out", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(uploadedObjectKeys).To(Equal([]string{
+				fmt.Sprintf("product_files/%s/file-to-upload", s3FilepathPrefix),
+			}))
+			Expect(uploadedContents).To(Equal([]string{"some contents"}))
+
+			for _, m := range response.Metadata {
+				Expect(m.Name).NotTo(Equal("s3_sse"))
+			}
+		})
+
+		Context("when s3_sse is provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3SSE = "AES256"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"s3_sse may only be provided when upload_backend is s3"))
+			})
+		})
+
+		Context("when another param of s3-out is provided", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3MultipartChunkSize = 10 * 1024 * 1024
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"s3_multipart_chunk_size may only be provided when upload_backend is s3"))
+			})
+		})
+
+		Context("when the upload backend is not supported", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.UploadBackend = "ftp"
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(
+					"upload_backend must be one of s3 or presigned - got ftp"))
+			})
+		})
+	})
+
+	Context("when the s3-out exits with error", func() {
+		BeforeEach(func() {
+			s3OutScriptContents := `#!/bin/sh
+
+exit 1`
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns an error", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(HaveOccurred())
+
+			Expect(err.Error()).To(MatchRegexp(".*running.*%s.*", s3OutBinaryName))
+		})
+
+		It("reports which files were and were not uploaded", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(HaveOccurred())
+
+			Expect(err.Error()).To(HavePrefix("failed to add file files_to_upload/file-to-upload to release: "))
+			Expect(err.Error()).To(ContainSubstring("uploaded files: [], files not attempted: []"))
+			Expect(err.Error()).To(ContainSubstring("set cleanup_on_failure to delete it"))
+		})
+
+		Context("when cleanup_on_failure is true", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.CleanupOnFailure = true
+
+				server.SetHandler(2, ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"DELETE",
+						fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, productSlug, releaseID),
+					),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				))
+			})
+
+			It("deletes the release", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(server.ReceivedRequests()).To(HaveLen(3))
+				Expect(err.Error()).To(HaveSuffix("- deleted release " + newReleaseResponse.Release.Version))
+			})
+		})
+	})
+
+	Context("when the s3-out exits without reading the request", func() {
+		BeforeEach(func() {
+			s3OutScriptContents := `#!/bin/sh
+
+exit 3`
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("reports the exit status rather than the failure to write the request", func() {
+			_, err := outCommand.Run(outRequest)
+			Expect(err).To(HaveOccurred())
+
+			Expect(err.Error()).To(ContainSubstring("exit status 3"))
+			Expect(err.Error()).NotTo(ContainSubstring("broken pipe"))
+		})
+	})
+
+	Context("when upload concurrency is provided", func() {
+		var (
+			s3OutScriptContents string
+			uploadLogPath       string
+		)
+
+		BeforeEach(func() {
+			uploadLogPath = filepath.Join(tempDir, "uploads")
+
+			for _, name := range []string{"other-file", "last-file"} {
+				err := ioutil.WriteFile(filepath.Join(uploadFilesSourceDir, name), []byte(name), os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			// Each upload waits until every upload has started, so the put
+			// only succeeds if the uploads run concurrently.
+			startedDir := filepath.Join(tempDir, "started")
+			err := os.Mkdir(startedDir, os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			s3OutScriptContents = fmt.Sprintf(`#!/bin/sh
+
+cat > /dev/null
+touch %s/$$
+for i in $(seq 1 50); do
+  [ $(ls %s | wc -l) -ge 3 ] && exit 0
+  sleep 0.1
+done
+echo "uploads did not run concurrently" >&2
+exit 1`, startedDir, startedDir)
+		})
+
+		JustBeforeEach(func() {
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+
+			outRequest.Params.UploadConcurrency = 3
+
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/%s", apiPrefix, productSlug),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, productsResponse),
+			)
+			server.RouteToHandler("POST", fmt.Sprintf("%s/products/%s/product_files", apiPrefix, productSlug),
+				ghttp.RespondWith(http.StatusCreated, ""),
+			)
+			server.RouteToHandler("PATCH", fmt.Sprintf(
+				"%s/products/%d/releases/%d/add_product_file",
+				apiPrefix,
+				productID,
+				releaseID,
+			), ghttp.RespondWith(http.StatusNoContent, ""))
+
+			server.SetHandler(2, server.GetHandler(5))
+		})
+
+		It("uploads the files concurrently", func() {
+			response, err := outCommand.Run(outRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, m := range response.Metadata {
+				names = append(names, m.Name)
+			}
+
+			for _, name := range []string{"file-to-upload", "other-file", "last-file"} {
+				Expect(names).To(ContainElement("md5: " + name))
+			}
+		})
+
+		Context("when a file order is provided", func() {
+			BeforeEach(func() {
+				s3OutScriptContents = fmt.Sprintf(`#!/bin/sh
+
+cat >> %s
+echo >> %s`, uploadLogPath, uploadLogPath)
+			})
+
+			JustBeforeEach(func() {
+				outRequest.Params.FileOrder = []string{"file-to-upload", "other-file"}
+			})
+
+			It("waits for each file order glob's files before uploading the next", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				b, err := ioutil.ReadFile(uploadLogPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				var files []string
+				for _, line := range strings.Split(string(b), "\n") {
+					if strings.TrimSpace(line) == "" {
+						continue
+					}
+
+					var s3OutInput s3.Request
+					err := json.Unmarshal([]byte(line), &s3OutInput)
+					Expect(err).NotTo(HaveOccurred())
+
+					files = append(files, filepath.Base(s3OutInput.Params.File))
+				}
+
+				Expect(files).To(Equal([]string{"file-to-upload", "other-file", "last-file"}))
+			})
+		})
+
+		Context("when an upload fails", func() {
+			BeforeEach(func() {
+				s3OutScriptContents = `#!/bin/sh
+
+grep -q file-to-upload && exit 1
+exit 0`
+			})
+
+			JustBeforeEach(func() {
+				outRequest.Params.FileOrder = []string{"file-to-upload", "last-file"}
+				outRequest.Params.UploadConcurrency = 2
+			})
+
+			It("does not start the remaining uploads and reports which files completed", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(HavePrefix("failed to add file files_to_upload/file-to-upload to release: "))
+				Expect(err.Error()).To(ContainSubstring(
+					"uploaded files: [], files not attempted: [files_to_upload/last-file files_to_upload/other-file]"))
+			})
+		})
+
+		Context("when an upload fails while others are in flight", func() {
+			BeforeEach(func() {
+				s3OutScriptContents = `#!/bin/sh
+
+grep -q file-to-upload && exit 1
+exec sleep 30`
+			})
+
+			It("cancels the uploads in flight and reports the failure that caused it", func() {
+				done := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+
+					_, err := outCommand.Run(outRequest)
+					done <- err
+				}()
+
+				var err error
+				Eventually(done, 10*time.Second).Should(Receive(&err))
+				Expect(err).To(HaveOccurred())
+
+				Expect(err.Error()).To(HavePrefix("failed to add file files_to_upload/file-to-upload, "))
+				Expect(err.Error()).To(ContainSubstring("exit status 1"))
+				Expect(err.Error()).NotTo(ContainSubstring("killed"))
+				Expect(err.Error()).To(ContainSubstring("uploaded files: []"))
+			})
+		})
+
+		Context("when upload concurrency is negative", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.UploadConcurrency = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("upload_concurrency must not be negative"))
+			})
+		})
+	})
+
+	Context("when s3 upload attempts are configured", func() {
+		var attemptsPath string
+
+		BeforeEach(func() {
+			attemptsPath = filepath.Join(tempDir, "s3-out-attempts")
+		})
+
+		JustBeforeEach(func() {
+			outRequest.Params.S3UploadAttempts = 3
+			outRequest.Params.S3UploadRetryDelaySeconds = 1
+		})
+
+		writeS3Out := func(failure string) {
+			s3OutScriptContents := fmt.Sprintf(`#!/bin/sh
+
+cat > /dev/null
+echo attempt >> %s
+%s`, attemptsPath, failure)
+
+			s3OutBinaryPath := filepath.Join(outDir, s3OutBinaryName)
+			err := ioutil.WriteFile(s3OutBinaryPath, []byte(s3OutScriptContents), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		attempts := func() int {
+			contents, err := ioutil.ReadFile(attemptsPath)
+			Expect(err).NotTo(HaveOccurred())
+			return strings.Count(string(contents), "attempt")
+		}
+
+		Context("when s3-out fails with a transient error", func() {
+			BeforeEach(func() {
+				writeS3Out(fmt.Sprintf(`if [ "$(wc -l < %s)" -lt 2 ]; then
+  echo "RequestTimeout: request timed out" >&2
+  exit 1
+fi`, attemptsPath))
+			})
+
+			It("retries the upload", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(attempts()).To(Equal(2))
+			})
+		})
+
+		Context("when s3-out fails on every attempt", func() {
+			BeforeEach(func() {
+				writeS3Out("exit 1")
+			})
+
+			It("returns an error after the last attempt", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(MatchRegexp(".*running.*%s.*", s3OutBinaryName)))
+
+				Expect(attempts()).To(Equal(3))
+			})
+		})
+
+		Context("when s3-out fails with a fatal error", func() {
+			BeforeEach(func() {
+				writeS3Out(`echo "AccessDenied: Access Denied" >&2
+exit 1`)
+			})
+
+			It("does not retry the upload", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError(ContainSubstring("AccessDenied")))
+
+				Expect(attempts()).To(Equal(1))
+			})
+		})
+
+		Context("when the attempts are negative", func() {
+			JustBeforeEach(func() {
+				outRequest.Params.S3UploadAttempts = -1
+			})
+
+			It("returns an error", func() {
+				_, err := outCommand.Run(outRequest)
+				Expect(err).To(MatchError("s3_upload_attempts must not be negative"))
+			})
 		})
 	})
 
@@ -0,0 +1,46 @@
+package pivnet
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type ArtifactReferencesResponse struct {
+	ArtifactReferences []ArtifactReference `json:"artifact_references,omitempty"`
+}
+
+type ArtifactReference struct {
+	ID           int    `json:"id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	ArtifactPath string `json:"artifact_path,omitempty"`
+	Digest       string `json:"digest,omitempty"`
+}
+
+// ArtifactReferences returns the artifact references attached to the release,
+// each of which is pinned by its digest. Releases without artifact references
+// return an empty slice.
+func (c client) ArtifactReferences(productSlug string, releaseID int) ([]ArtifactReference, error) {
+	url := fmt.Sprintf("%s/products/%s/releases/%d/artifact_references",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response ArtifactReferencesResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ArtifactReferences == nil {
+		return []ArtifactReference{}, nil
+	}
+
+	return response.ArtifactReferences, nil
+}
@@ -0,0 +1,87 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - artifact references", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &logger_fakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("ArtifactReferences", func() {
+		It("returns the artifact references for the release", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/banana/releases/%d/artifact_references", apiPrefix, 12),
+					),
+					ghttp.RespondWith(http.StatusOK, `{"artifact_references": [{
+						"id": 3,
+						"name": "my-artifact",
+						"artifact_path": "registry.example.com/my-artifact:1.2.3",
+						"digest": "sha256:abc123"
+					}]}`),
+				),
+			)
+
+			artifactReferences, err := client.ArtifactReferences("banana", 12)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(artifactReferences).To(Equal([]pivnet.ArtifactReference{
+				{
+					ID:           3,
+					Name:         "my-artifact",
+					ArtifactPath: "registry.example.com/my-artifact:1.2.3",
+					Digest:       "sha256:abc123",
+				},
+			}))
+		})
+
+		Context("when the release has no artifact references", func() {
+			It("returns an empty slice", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{}`),
+				)
+
+				artifactReferences, err := client.ArtifactReferences("banana", 12)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(artifactReferences).To(BeEmpty())
+				Expect(artifactReferences).NotTo(BeNil())
+			})
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.ArtifactReferences("banana", 12)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+})
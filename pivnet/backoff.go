@@ -0,0 +1,119 @@
+package pivnet
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultBackoffConfig waits a second after the first attempt, doubling the
+// wait after each further attempt up to thirty seconds.
+var DefaultBackoffConfig = BackoffConfig{
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+}
+
+type BackoffConfig struct {
+	// InitialInterval, MaxInterval and Multiplier default to the values in
+	// DefaultBackoffConfig when zero. A MaxInterval below InitialInterval is
+	// raised to InitialInterval, and a Multiplier below 1 is taken as 1.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// Clock is the source of time for waits, so that tests can control it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Backoff produces increasing intervals to wait between attempts, so that
+// polling does not hammer Pivotal Network at a fixed rate.
+type Backoff struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	multiplier      float64
+	clock           Clock
+
+	next time.Duration
+}
+
+func NewBackoff(config BackoffConfig) *Backoff {
+	initialInterval := config.InitialInterval
+	if initialInterval <= 0 {
+		initialInterval = DefaultBackoffConfig.InitialInterval
+	}
+
+	maxInterval := config.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultBackoffConfig.MaxInterval
+	}
+	if maxInterval < initialInterval {
+		maxInterval = initialInterval
+	}
+
+	multiplier := config.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultBackoffConfig.Multiplier
+	}
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &Backoff{
+		initialInterval: initialInterval,
+		maxInterval:     maxInterval,
+		multiplier:      multiplier,
+		clock:           clock,
+
+		next: initialInterval,
+	}
+}
+
+// Next returns the interval to wait before the next attempt and increases
+// the interval after it.
+func (b *Backoff) Next() time.Duration {
+	interval := b.next
+
+	b.next = time.Duration(float64(b.next) * b.multiplier)
+	if b.next > b.maxInterval {
+		b.next = b.maxInterval
+	}
+
+	return interval
+}
+
+// Reset makes the next interval the initial interval again.
+func (b *Backoff) Reset() {
+	b.next = b.initialInterval
+}
+
+// Now returns the current time of the backoff's clock.
+func (b *Backoff) Now() time.Time {
+	return b.clock.Now()
+}
+
+// Wait waits for the interval, returning early with the context's error if
+// it is cancelled.
+func (b *Backoff) Wait(ctx context.Context, interval time.Duration) error {
+	select {
+	case <-b.clock.After(interval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
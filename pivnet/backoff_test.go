@@ -0,0 +1,144 @@
+package pivnet_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+// fakeClock advances by the duration of every wait instead of sleeping, and
+// records the durations waited for.
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Waits() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.waits
+}
+
+var _ = Describe("Backoff", func() {
+	var (
+		clock  *fakeClock
+		config pivnet.BackoffConfig
+	)
+
+	BeforeEach(func() {
+		clock = &fakeClock{now: time.Unix(0, 0)}
+
+		config = pivnet.BackoffConfig{
+			InitialInterval: time.Second,
+			MaxInterval:     5 * time.Second,
+			Multiplier:      2,
+			Clock:           clock,
+		}
+	})
+
+	It("multiplies the interval after each attempt up to the max interval", func() {
+		backoff := pivnet.NewBackoff(config)
+
+		var intervals []time.Duration
+		for i := 0; i < 5; i++ {
+			intervals = append(intervals, backoff.Next())
+		}
+
+		Expect(intervals).To(Equal([]time.Duration{
+			time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			5 * time.Second,
+			5 * time.Second,
+		}))
+	})
+
+	It("starts again from the initial interval when reset", func() {
+		backoff := pivnet.NewBackoff(config)
+		backoff.Next()
+		backoff.Next()
+
+		backoff.Reset()
+
+		Expect(backoff.Next()).To(Equal(time.Second))
+	})
+
+	It("waits on the clock", func() {
+		backoff := pivnet.NewBackoff(config)
+
+		err := backoff.Wait(context.Background(), backoff.Next())
+		Expect(err).NotTo(HaveOccurred())
+
+		err = backoff.Wait(context.Background(), backoff.Next())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(clock.Waits()).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+		Expect(backoff.Now()).To(Equal(time.Unix(3, 0)))
+	})
+
+	Context("when the config is zero", func() {
+		It("uses the default config", func() {
+			backoff := pivnet.NewBackoff(pivnet.BackoffConfig{})
+
+			Expect(backoff.Next()).To(Equal(time.Second))
+			Expect(backoff.Next()).To(Equal(2 * time.Second))
+		})
+
+		It("caps the interval at the default max interval", func() {
+			backoff := pivnet.NewBackoff(pivnet.BackoffConfig{})
+
+			var interval time.Duration
+			for i := 0; i < 10; i++ {
+				interval = backoff.Next()
+			}
+
+			Expect(interval).To(Equal(30 * time.Second))
+		})
+	})
+
+	Context("when the initial interval is above the default max interval", func() {
+		It("does not back off below the initial interval", func() {
+			backoff := pivnet.NewBackoff(pivnet.BackoffConfig{InitialInterval: time.Minute})
+
+			Expect(backoff.Next()).To(Equal(time.Minute))
+			Expect(backoff.Next()).To(Equal(time.Minute))
+		})
+	})
+
+	Context("when the context is cancelled", func() {
+		It("returns the context error", func() {
+			backoff := pivnet.NewBackoff(pivnet.BackoffConfig{InitialInterval: time.Hour})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := backoff.Wait(ctx, backoff.Next())
+			Expect(err).To(Equal(context.Canceled))
+		})
+	})
+})
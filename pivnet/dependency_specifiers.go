@@ -0,0 +1,103 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type DependencySpecifiersResponse struct {
+	DependencySpecifiers []DependencySpecifier `json:"dependency_specifiers,omitempty"`
+}
+
+// DependencySpecifier is a range of versions of a product, e.g. >=2.0 <3.0,
+// that a release depends on, rather than a single release of it.
+type DependencySpecifier struct {
+	ID        int     `json:"id,omitempty"`
+	Specifier string  `json:"specifier,omitempty"`
+	Product   Product `json:"product"`
+}
+
+type dependencySpecifierResponse struct {
+	DependencySpecifier DependencySpecifier `json:"dependency_specifier"`
+}
+
+type createDependencySpecifierBody struct {
+	DependencySpecifier createDependencySpecifier `json:"dependency_specifier"`
+}
+
+type createDependencySpecifier struct {
+	ProductSlug string `json:"product_slug"`
+	Specifier   string `json:"specifier"`
+}
+
+// DependencySpecifiers returns the dependency specifiers of the release.
+func (c client) DependencySpecifiers(productSlug string, releaseID int) ([]DependencySpecifier, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/dependency_specifiers",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response DependencySpecifiersResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.DependencySpecifiers == nil {
+		return []DependencySpecifier{}, nil
+	}
+
+	return response.DependencySpecifiers, nil
+}
+
+// CreateDependencySpecifier adds the specifier of versions of the dependent
+// product, which may be another product, as a dependency of the release.
+func (c client) CreateDependencySpecifier(
+	productSlug string,
+	releaseID int,
+	dependentProductSlug string,
+	specifier string,
+) (DependencySpecifier, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/dependency_specifiers",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	body := createDependencySpecifierBody{
+		DependencySpecifier: createDependencySpecifier{
+			ProductSlug: dependentProductSlug,
+			Specifier:   specifier,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	var response dependencySpecifierResponse
+	err = c.makeRequest(
+		"POST",
+		url,
+		http.StatusCreated,
+		bytes.NewReader(b),
+		&response,
+	)
+	if err != nil {
+		return DependencySpecifier{}, err
+	}
+
+	return response.DependencySpecifier, nil
+}
@@ -0,0 +1,142 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - dependency specifiers", func() {
+	var (
+		server     *ghttp.Server
+		client     pivnet.Client
+		token      string
+		apiAddress string
+		userAgent  string
+
+		newClientConfig pivnet.NewClientConfig
+		fakeLogger      logger.Logger
+
+		productSlug = "banana-slug"
+		releaseID   = 2345
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		apiAddress = server.URL()
+		token = "my-auth-token"
+		userAgent = "pivnet-resource/0.1.0 (some-url)"
+
+		fakeLogger = &logger_fakes.FakeLogger{}
+		newClientConfig = pivnet.NewClientConfig{
+			Endpoint:  apiAddress,
+			Token:     token,
+			UserAgent: userAgent,
+		}
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("DependencySpecifiers", func() {
+		It("returns the dependency specifiers of the release", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf(
+						"%s/products/%s/releases/%d/dependency_specifiers",
+						apiPrefix,
+						productSlug,
+						releaseID,
+					)),
+					ghttp.RespondWith(
+						http.StatusOK,
+						`{"dependency_specifiers":[{"id":7,"specifier":">=2.0 <3.0","product":{"id":3,"slug":"stemcells"}}]}`,
+					),
+				),
+			)
+
+			specifiers, err := client.DependencySpecifiers(productSlug, releaseID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(specifiers).To(Equal([]pivnet.DependencySpecifier{
+				{ID: 7, Specifier: ">=2.0 <3.0", Product: pivnet.Product{ID: 3, Slug: "stemcells"}},
+			}))
+		})
+
+		Context("when the release has none", func() {
+			It("returns an empty slice", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{}`),
+				)
+
+				specifiers, err := client.DependencySpecifiers(productSlug, releaseID)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(specifiers).To(BeEmpty())
+				Expect(specifiers).NotTo(BeNil())
+			})
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.DependencySpecifiers(productSlug, releaseID)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("CreateDependencySpecifier", func() {
+		var (
+			expectedRequestBody = `{"dependency_specifier":{"product_slug":"stemcells","specifier":">=2.0 <3.0"}}`
+		)
+
+		Context("when the server responds with a 201 status code", func() {
+			It("returns the created dependency specifier", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", fmt.Sprintf(
+							"%s/products/%s/releases/%d/dependency_specifiers",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						)),
+						ghttp.VerifyJSON(expectedRequestBody),
+						ghttp.RespondWith(
+							http.StatusCreated,
+							`{"dependency_specifier":{"id":7,"specifier":">=2.0 <3.0","product":{"id":3,"slug":"stemcells"}}}`,
+						),
+					),
+				)
+
+				specifier, err := client.CreateDependencySpecifier(productSlug, releaseID, "stemcells", ">=2.0 <3.0")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(specifier.ID).To(Equal(7))
+				Expect(specifier.Product.Slug).To(Equal("stemcells"))
+			})
+		})
+
+		Context("when the server responds with a non-201 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.CreateDependencySpecifier(productSlug, releaseID, "stemcells", ">=2.0 <3.0")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 201"))
+			})
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package pivnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodyBytes is how much of an error response body is read for the
+// message.
+const maxErrorBodyBytes = 4096
+
+// ResponseError is returned when Pivotal Network responds with an unexpected
+// status code. The more specific errors below embed it, so callers can
+// branch on them with errors.As.
+type ResponseError struct {
+	StatusCode         int
+	ExpectedStatusCode int
+
+	// Message is the message of Pivotal Network's error response body, if any.
+	Message string
+}
+
+func (e ResponseError) Error() string {
+	// A zero status code means the response itself was successful, e.g. a
+	// listing without the requested release, so only the message applies.
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+
+	msg := fmt.Sprintf(
+		"Pivnet returned status code: %d for the request - expected %d",
+		e.StatusCode,
+		e.ExpectedStatusCode,
+	)
+
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+
+	return msg
+}
+
+// ErrNotFound is returned when the requested resource does not exist or is
+// not visible to the token.
+type ErrNotFound struct {
+	ResponseError
+}
+
+// ErrUnauthorized is returned when the token is missing, invalid or expired.
+type ErrUnauthorized struct {
+	ResponseError
+}
+
+// ErrRateLimited is returned when Pivotal Network is throttling the token.
+type ErrRateLimited struct {
+	ResponseError
+
+	// RetryAfter is how long Pivotal Network asked to wait before retrying,
+	// or zero if it did not say.
+	RetryAfter time.Duration
+}
+
+// ErrEULARequired is returned when the EULA of the release must be accepted
+// before the request can succeed.
+type ErrEULARequired struct {
+	ResponseError
+}
+
+// ErrMaintenance is returned when a successful response is an HTML page
+// rather than JSON, as when Pivotal Network serves its maintenance page with
+// a 200.
+type ErrMaintenance struct {
+	ContentType string
+}
+
+func (e ErrMaintenance) Error() string {
+	return fmt.Sprintf(
+		"Pivnet appears to be in maintenance mode - it responded with %s rather than JSON",
+		e.ContentType,
+	)
+}
+
+// isHTMLContentType returns whether the content type of a response is HTML.
+func isHTMLContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return strings.EqualFold(mediaType, "text/html")
+}
+
+type errorResponseBody struct {
+	Message string `json:"message"`
+}
+
+// newResponseError returns the error describing the unexpected response,
+// reading the message from its body.
+func newResponseError(resp *http.Response, expectedStatusCode int) error {
+	responseErr := ResponseError{
+		StatusCode:         resp.StatusCode,
+		ExpectedStatusCode: expectedStatusCode,
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err == nil && len(b) > 0 {
+		var body errorResponseBody
+		if json.Unmarshal(b, &body) == nil {
+			responseErr.Message = body.Message
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnavailableForLegalReasons:
+		return ErrEULARequired{responseErr}
+	case resp.StatusCode == http.StatusForbidden &&
+		strings.Contains(strings.ToLower(responseErr.Message), "eula"):
+		return ErrEULARequired{responseErr}
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized{responseErr}
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound{responseErr}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited{
+			ResponseError: responseErr,
+			RetryAfter:    retryAfter(resp.Header.Get("Retry-After")),
+		}
+	default:
+		return responseErr
+	}
+}
+
+// retryAfter returns the duration of a Retry-After header in seconds, or
+// zero if the header is absent or not a number of seconds.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,91 @@
+package pivnet_test
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - errors", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &logger_fakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	respondWith := func(statusCode int, body string, header http.Header) error {
+		server.AppendHandlers(ghttp.RespondWith(statusCode, body, header))
+
+		_, err := client.FindProductForSlug("banana")
+		return err
+	}
+
+	It("includes the message of the error response body", func() {
+		err := respondWith(http.StatusTeapot, `{"status": 418, "message": "I'm a teapot"}`, nil)
+		Expect(err).To(MatchError(
+			"Pivnet returned status code: 418 for the request - expected 200: I'm a teapot"))
+
+		var responseErr pivnet.ResponseError
+		Expect(errors.As(err, &responseErr)).To(BeTrue())
+		Expect(responseErr.StatusCode).To(Equal(http.StatusTeapot))
+		Expect(responseErr.ExpectedStatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("returns ErrNotFound for 404", func() {
+		err := respondWith(http.StatusNotFound, "", nil)
+
+		var notFound pivnet.ErrNotFound
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+	})
+
+	It("returns ErrUnauthorized for 401", func() {
+		err := respondWith(http.StatusUnauthorized, "", nil)
+
+		var unauthorized pivnet.ErrUnauthorized
+		Expect(errors.As(err, &unauthorized)).To(BeTrue())
+	})
+
+	It("returns ErrRateLimited with the Retry-After duration for 429", func() {
+		header := http.Header{}
+		header.Set("Retry-After", "30")
+
+		err := respondWith(http.StatusTooManyRequests, "", header)
+
+		var rateLimited pivnet.ErrRateLimited
+		Expect(errors.As(err, &rateLimited)).To(BeTrue())
+		Expect(rateLimited.RetryAfter).To(Equal(30 * time.Second))
+	})
+
+	It("returns ErrEULARequired for 451", func() {
+		err := respondWith(http.StatusUnavailableForLegalReasons, "", nil)
+
+		var eulaRequired pivnet.ErrEULARequired
+		Expect(errors.As(err, &eulaRequired)).To(BeTrue())
+	})
+
+	It("returns ErrEULARequired for 403 with a message about the EULA", func() {
+		err := respondWith(http.StatusForbidden, `{"message": "The EULA must be accepted"}`, nil)
+
+		var eulaRequired pivnet.ErrEULARequired
+		Expect(errors.As(err, &eulaRequired)).To(BeTrue())
+	})
+})
@@ -0,0 +1,37 @@
+package pivnet
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// eulaCache holds the EULAs looked up by ID, so each is only requested once
+// per client, e.g. when creating many releases with the same EULA.
+type eulaCache struct {
+	mutex sync.Mutex
+	eulas map[int]Eula
+}
+
+// EULA returns the EULA with the ID, or ErrNotFound if there is no such EULA.
+// The EULA is cached after the first successful request.
+func (c client) EULA(eulaID int) (Eula, error) {
+	c.eulas.mutex.Lock()
+	defer c.eulas.mutex.Unlock()
+
+	if eula, ok := c.eulas.eulas[eulaID]; ok {
+		return eula, nil
+	}
+
+	url := fmt.Sprintf("%s/eulas/%d", c.url, eulaID)
+
+	var response Eula
+	err := c.makeRequest("GET", url, http.StatusOK, nil, &response)
+	if err != nil {
+		return Eula{}, err
+	}
+
+	c.eulas.eulas[eulaID] = response
+
+	return response, nil
+}
@@ -0,0 +1,87 @@
+package pivnet_test
+
+import (
+	"errors"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - EULAs", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+
+		fakeLogger logger.Logger
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		fakeLogger = &logger_fakes.FakeLogger{}
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("EULA", func() {
+		It("returns the EULA with the id", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/eulas/7"),
+					ghttp.RespondWith(http.StatusOK, `{"id": 7, "slug": "pivotal_software_eula"}`),
+				),
+			)
+
+			eula, err := client.EULA(7)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eula).To(Equal(pivnet.Eula{ID: 7, Slug: "pivotal_software_eula"}))
+		})
+
+		It("only requests each EULA once", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, `{"id": 7, "slug": "pivotal_software_eula"}`),
+				ghttp.RespondWith(http.StatusOK, `{"id": 8, "slug": "other_eula"}`),
+			)
+
+			_, err := client.EULA(7)
+			Expect(err).NotTo(HaveOccurred())
+
+			eula, err := client.EULA(7)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eula.Slug).To(Equal("pivotal_software_eula"))
+
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+
+			eula, err = client.EULA(8)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eula.Slug).To(Equal("other_eula"))
+
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		Context("when the EULA does not exist", func() {
+			It("returns a not found error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusNotFound, `{"message": "eula not found"}`),
+				)
+
+				_, err := client.EULA(7)
+
+				var notFound pivnet.ErrNotFound
+				Expect(errors.As(err, &notFound)).To(BeTrue())
+			})
+		})
+	})
+})
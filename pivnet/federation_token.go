@@ -0,0 +1,55 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FederationToken is a set of temporary AWS credentials that can only upload
+// files of the product.
+type FederationToken struct {
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`
+}
+
+type federationTokenBody struct {
+	ProductID string `json:"product_id"`
+}
+
+// FederationToken requests temporary AWS credentials for uploading the
+// product's files.
+func (c client) FederationToken(productSlug string) (FederationToken, error) {
+	url := fmt.Sprintf("%s/federation_token", c.url)
+
+	body := federationTokenBody{
+		ProductID: productSlug,
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	// The response body holds the credentials, so it is never logged.
+	quiet := c
+	quiet.debug = false
+
+	var response FederationToken
+	err = quiet.makeRequest(
+		"POST",
+		url,
+		http.StatusOK,
+		bytes.NewReader(b),
+		&response,
+	)
+	if err != nil {
+		return FederationToken{}, err
+	}
+
+	return response, nil
+}
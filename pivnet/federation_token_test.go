@@ -0,0 +1,75 @@
+package pivnet_test
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - federation token", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+
+		fakeLogger logger.Logger
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		fakeLogger = &logger_fakes.FakeLogger{}
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("FederationToken", func() {
+		It("requests temporary credentials for the product", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", apiPrefix+"/federation_token"),
+					ghttp.VerifyJSON(`{"product_id": "banana-slug"}`),
+					ghttp.RespondWith(http.StatusOK, `{
+						"access_key_id": "some-access-key-id",
+						"secret_access_key": "some-secret-access-key",
+						"session_token": "some-session-token",
+						"bucket": "some-bucket",
+						"region": "us-east-1"
+					}`),
+				),
+			)
+
+			token, err := client.FederationToken("banana-slug")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal(pivnet.FederationToken{
+				AccessKeyID:     "some-access-key-id",
+				SecretAccessKey: "some-secret-access-key",
+				SessionToken:    "some-session-token",
+				Bucket:          "some-bucket",
+				Region:          "us-east-1",
+			}))
+		})
+
+		Context("when the request fails", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusForbidden, `{"message": "not an admin"}`),
+				)
+
+				_, err := client.FederationToken("banana-slug")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type FileGroupsResponse struct {
+	FileGroups []FileGroup `json:"file_groups,omitempty"`
+}
+
+type FileGroup struct {
+	ID           int           `json:"id,omitempty"`
+	Name         string        `json:"name,omitempty"`
+	ProductFiles []ProductFile `json:"product_files,omitempty"`
+}
+
+type createFileGroupBody struct {
+	FileGroup FileGroup `json:"file_group"`
+}
+
+type addFileGroupBody struct {
+	FileGroup FileGroup `json:"file_group"`
+}
+
+type addToFileGroupBody struct {
+	ProductFile ProductFile `json:"product_file"`
+}
+
+// FileGroups returns the file groups of the product.
+func (c client) FileGroups(productSlug string) ([]FileGroup, error) {
+	url := fmt.Sprintf("%s/products/%s/file_groups", c.url, productSlug)
+
+	var response FileGroupsResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.FileGroups == nil {
+		return []FileGroup{}, nil
+	}
+
+	return response.FileGroups, nil
+}
+
+// ReleaseFileGroups returns the file groups of the release, along with the
+// product files in each group.
+func (c client) ReleaseFileGroups(productSlug string, releaseID int) ([]FileGroup, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/file_groups",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response FileGroupsResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.FileGroups == nil {
+		return []FileGroup{}, nil
+	}
+
+	return response.FileGroups, nil
+}
+
+func (c client) CreateFileGroup(productSlug string, name string) (FileGroup, error) {
+	url := fmt.Sprintf("%s/products/%s/file_groups", c.url, productSlug)
+
+	body := createFileGroupBody{
+		FileGroup: FileGroup{
+			Name: name,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	var response FileGroup
+	err = c.makeRequest(
+		"POST",
+		url,
+		http.StatusCreated,
+		bytes.NewReader(b),
+		&response,
+	)
+	if err != nil {
+		return FileGroup{}, err
+	}
+
+	return response, nil
+}
+
+// FileGroupForName returns the file group of the product with the name,
+// creating it if the product has none.
+func (c client) FileGroupForName(productSlug string, name string) (FileGroup, error) {
+	fileGroups, err := c.FileGroups(productSlug)
+	if err != nil {
+		return FileGroup{}, err
+	}
+
+	for _, fg := range fileGroups {
+		if fg.Name == name {
+			c.logger.Debugf("Found file group: {product_slug: %s, name: %s, id: %d}\n", productSlug, name, fg.ID)
+			return fg, nil
+		}
+	}
+
+	c.logger.Debugf("Creating file group: {product_slug: %s, name: %s}\n", productSlug, name)
+	return c.CreateFileGroup(productSlug, name)
+}
+
+// AddFileGroup adds the file group to the release.
+func (c client) AddFileGroup(productSlug string, releaseID int, fileGroupID int) error {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/add_file_group",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	body := addFileGroupBody{
+		FileGroup: FileGroup{
+			ID: fileGroupID,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	return c.makeRequest(
+		"PATCH",
+		url,
+		http.StatusNoContent,
+		bytes.NewReader(b),
+		nil,
+	)
+}
+
+// AddToFileGroup adds the product file to the file group.
+func (c client) AddToFileGroup(productSlug string, fileGroupID int, productFileID int) error {
+	url := fmt.Sprintf(
+		"%s/products/%s/file_groups/%d/add_product_file",
+		c.url,
+		productSlug,
+		fileGroupID,
+	)
+
+	body := addToFileGroupBody{
+		ProductFile: ProductFile{
+			ID: productFileID,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	return c.makeRequest(
+		"PATCH",
+		url,
+		http.StatusNoContent,
+		bytes.NewReader(b),
+		nil,
+	)
+}
@@ -0,0 +1,231 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - file groups", func() {
+	var (
+		server     *ghttp.Server
+		client     pivnet.Client
+		token      string
+		apiAddress string
+		userAgent  string
+
+		newClientConfig pivnet.NewClientConfig
+		fakeLogger      logger.Logger
+
+		productSlug = "banana-slug"
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		apiAddress = server.URL()
+		token = "my-auth-token"
+		userAgent = "pivnet-resource/0.1.0 (some-url)"
+
+		fakeLogger = &logger_fakes.FakeLogger{}
+		newClientConfig = pivnet.NewClientConfig{
+			Endpoint:  apiAddress,
+			Token:     token,
+			UserAgent: userAgent,
+		}
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Release File Groups", func() {
+		var releaseFileGroupsURL string
+
+		BeforeEach(func() {
+			releaseFileGroupsURL = fmt.Sprintf("%s/products/%s/releases/%d/file_groups", apiPrefix, productSlug, 1234)
+		})
+
+		It("returns the file groups of the release with their product files", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", releaseFileGroupsURL),
+					ghttp.RespondWith(http.StatusOK,
+						`{"file_groups":[{"id":2,"name":"tiles","product_files":[{"id":3,"name":"some-tile"}]}]}`),
+				),
+			)
+
+			fileGroups, err := client.ReleaseFileGroups(productSlug, 1234)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fileGroups).To(Equal([]pivnet.FileGroup{{
+				ID:           2,
+				Name:         "tiles",
+				ProductFiles: []pivnet.ProductFile{{ID: 3, Name: "some-tile"}},
+			}}))
+		})
+
+		Context("when the release has no file groups", func() {
+			It("returns no file groups", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", releaseFileGroupsURL),
+						ghttp.RespondWith(http.StatusOK, `{}`),
+					),
+				)
+
+				fileGroups, err := client.ReleaseFileGroups(productSlug, 1234)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fileGroups).To(BeEmpty())
+				Expect(fileGroups).NotTo(BeNil())
+			})
+		})
+	})
+
+	Describe("File Group For Name", func() {
+		var fileGroupsURL string
+
+		BeforeEach(func() {
+			fileGroupsURL = fmt.Sprintf("%s/products/%s/file_groups", apiPrefix, productSlug)
+		})
+
+		Context("when the product has a file group with the name", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", fileGroupsURL),
+						ghttp.RespondWith(http.StatusOK,
+							`{"file_groups":[{"id":1,"name":"other"},{"id":2,"name":"tiles"}]}`),
+					),
+				)
+			})
+
+			It("reuses the file group", func() {
+				fileGroup, err := client.FileGroupForName(productSlug, "tiles")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fileGroup).To(Equal(pivnet.FileGroup{ID: 2, Name: "tiles"}))
+				Expect(len(server.ReceivedRequests())).To(Equal(1))
+			})
+		})
+
+		Context("when the product has no file group with the name", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", fileGroupsURL),
+						ghttp.RespondWith(http.StatusOK, `{"file_groups":[{"id":1,"name":"other"}]}`),
+					),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", fileGroupsURL),
+						ghttp.VerifyJSON(`{"file_group":{"name":"tiles"}}`),
+						ghttp.RespondWith(http.StatusCreated, `{"id":3,"name":"tiles"}`),
+					),
+				)
+			})
+
+			It("creates the file group", func() {
+				fileGroup, err := client.FileGroupForName(productSlug, "tiles")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fileGroup).To(Equal(pivnet.FileGroup{ID: 3, Name: "tiles"}))
+			})
+		})
+
+		Context("when listing the file groups fails", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := client.FileGroupForName(productSlug, "tiles")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+
+		Context("when creating the file group fails", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{"file_groups":[]}`),
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := client.FileGroupForName(productSlug, "tiles")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 201"))
+			})
+		})
+	})
+
+	Describe("Add File Group", func() {
+		It("adds the file group to the release", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", fmt.Sprintf(
+						"%s/products/%s/releases/%d/add_file_group",
+						apiPrefix,
+						productSlug,
+						2345,
+					)),
+					ghttp.VerifyJSON(`{"file_group":{"id":3}}`),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			err := client.AddFileGroup(productSlug, 2345, 3)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				err := client.AddFileGroup(productSlug, 2345, 3)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
+			})
+		})
+	})
+
+	Describe("Add To File Group", func() {
+		It("adds the product file to the file group", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", fmt.Sprintf(
+						"%s/products/%s/file_groups/%d/add_product_file",
+						apiPrefix,
+						productSlug,
+						3,
+					)),
+					ghttp.VerifyJSON(`{"product_file":{"id":5678}}`),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			err := client.AddToFileGroup(productSlug, 3, 5678)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				err := client.AddToFileGroup(productSlug, 3, 5678)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
+			})
+		})
+	})
+})
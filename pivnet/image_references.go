@@ -0,0 +1,68 @@
+package pivnet
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type ImageReferencesResponse struct {
+	ImageReferences []ImageReference `json:"image_references,omitempty"`
+}
+
+type ImageReference struct {
+	ID        int    `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	ImagePath string `json:"image_path,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+// Repository returns the image path without its tag, e.g.
+// "registry.example.com/my-image" for "registry.example.com/my-image:1.2.3".
+func (r ImageReference) Repository() string {
+	repository, _ := r.splitImagePath()
+	return repository
+}
+
+// Tag returns the tag of the image path, or an empty string if it has none.
+func (r ImageReference) Tag() string {
+	_, tag := r.splitImagePath()
+	return tag
+}
+
+func (r ImageReference) splitImagePath() (string, string) {
+	i := strings.LastIndex(r.ImagePath, ":")
+	if i == -1 || strings.Contains(r.ImagePath[i:], "/") {
+		return r.ImagePath, ""
+	}
+
+	return r.ImagePath[:i], r.ImagePath[i+1:]
+}
+
+// ImageReferences returns the OCI image references attached to the release.
+// Releases without image references return an empty slice.
+func (c client) ImageReferences(productSlug string, releaseID int) ([]ImageReference, error) {
+	url := fmt.Sprintf("%s/products/%s/releases/%d/image_references",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response ImageReferencesResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ImageReferences == nil {
+		return []ImageReference{}, nil
+	}
+
+	return response.ImageReferences, nil
+}
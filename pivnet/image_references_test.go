@@ -0,0 +1,101 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - image references", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &logger_fakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("ImageReferences", func() {
+		It("returns the image references for the release", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"GET",
+						fmt.Sprintf("%s/products/banana/releases/%d/image_references", apiPrefix, 12),
+					),
+					ghttp.RespondWith(http.StatusOK, `{"image_references": [{
+						"id": 3,
+						"name": "my-image",
+						"image_path": "registry.example.com:5000/my-image:1.2.3",
+						"digest": "sha256:abc123"
+					}]}`),
+				),
+			)
+
+			imageReferences, err := client.ImageReferences("banana", 12)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imageReferences).To(Equal([]pivnet.ImageReference{
+				{
+					ID:        3,
+					Name:      "my-image",
+					ImagePath: "registry.example.com:5000/my-image:1.2.3",
+					Digest:    "sha256:abc123",
+				},
+			}))
+
+			Expect(imageReferences[0].Repository()).To(Equal("registry.example.com:5000/my-image"))
+			Expect(imageReferences[0].Tag()).To(Equal("1.2.3"))
+		})
+
+		Context("when the image path has no tag", func() {
+			It("returns the whole path as the repository", func() {
+				imageReference := pivnet.ImageReference{
+					ImagePath: "registry.example.com:5000/my-image",
+				}
+
+				Expect(imageReference.Repository()).To(Equal("registry.example.com:5000/my-image"))
+				Expect(imageReference.Tag()).To(BeEmpty())
+			})
+		})
+
+		Context("when the release has no image references", func() {
+			It("returns an empty slice", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{}`),
+				)
+
+				imageReferences, err := client.ImageReferences("banana", 12)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(imageReferences).To(BeEmpty())
+				Expect(imageReferences).NotTo(BeNil())
+			})
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.ImageReferences("banana", 12)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+})
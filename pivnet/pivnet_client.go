@@ -1,35 +1,85 @@
 package pivnet
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+	"github.com/pivotal-cf-experimental/pivnet-resource/timing"
 )
 
 const (
 	Endpoint = "https://network.pivotal.io"
 	path     = "/api/v2"
+
+	// maxLoggedBodyBytes is how much of each response body is logged when
+	// debug logging is enabled.
+	maxLoggedBodyBytes = 4096
+
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
 )
 
+// ErrNotModified is returned when a conditional request finds that the
+// resource has not changed since the provided ETag.
+var ErrNotModified = errors.New("Pivnet returned not modified")
+
 type Client interface {
 	ProductVersions(string) ([]string, error)
+	ProductVersionsIfNoneMatch(productSlug string, etag string) ([]string, string, error)
+	ReleasesForProductSlug(string) ([]Release, error)
+	ReleasesUpdatedSince(productSlug string, since time.Time) ([]Release, error)
 	CreateRelease(config CreateReleaseConfig) (Release, error)
 	GetRelease(string, string) (Release, error)
+	ReleaseForID(productSlug string, releaseID int) (Release, error)
+	RawRelease(productSlug string, releaseID int) (json.RawMessage, error)
 	UpdateRelease(string, Release) (Release, error)
+	DeleteRelease(productSlug string, release Release) error
+	WaitForRelease(productSlug string, version string, timeout time.Duration) (Release, error)
 	GetProductFiles(Release) (ProductFiles, error)
+	ReleaseProductFiles(productSlug string, releaseID int) (ProductFiles, error)
+	RawReleaseProductFiles(productSlug string, releaseID int) (json.RawMessage, error)
 	GetProductFile(productSlug string, releaseID int, productID int) (ProductFile, error)
+	WaitForProductFile(productSlug string, releaseID int, productFileID int, timeout time.Duration) (ProductFile, error)
+	ProductFileDownloadURL(productSlug string, releaseID int, productFileID int) string
 	AcceptEULA(productSlug string, releaseID int) error
+	EULA(eulaID int) (Eula, error)
+	FederationToken(productSlug string) (FederationToken, error)
+	ImageReferences(productSlug string, releaseID int) ([]ImageReference, error)
+	ArtifactReferences(productSlug string, releaseID int) ([]ArtifactReference, error)
 	CreateProductFile(config CreateProductFileConfig) (ProductFile, error)
 	DeleteProductFile(productSlug string, id int) (ProductFile, error)
 	AddProductFile(productID int, releaseID int, productFileID int) error
+	RemoveProductFile(productID int, releaseID int, productFileID int) error
+	CreateUploadURL(productSlug string, awsObjectKey string) (UploadURL, error)
 	FindProductForSlug(slug string) (Product, error)
+	Products() ([]Product, error)
+	ProductIcon(productSlug string) ([]byte, string, error)
 	AddUserGroup(productSlug string, releaseID int, userGroupID int) error
+	ReleaseUserGroups(productSlug string, releaseID int) ([]UserGroup, error)
+	AddReleaseDependency(productSlug string, releaseID int, dependentReleaseID int) error
+	ReleaseDependencies(productSlug string, releaseID int) ([]ReleaseDependency, error)
+	DependencySpecifiers(productSlug string, releaseID int) ([]DependencySpecifier, error)
+	CreateDependencySpecifier(productSlug string, releaseID int, dependentProductSlug string, specifier string) (DependencySpecifier, error)
+	FileGroups(productSlug string) ([]FileGroup, error)
+	ReleaseFileGroups(productSlug string, releaseID int) ([]FileGroup, error)
+	CreateFileGroup(productSlug string, name string) (FileGroup, error)
+	FileGroupForName(productSlug string, name string) (FileGroup, error)
+	AddFileGroup(productSlug string, releaseID int, fileGroupID int) error
+	AddToFileGroup(productSlug string, fileGroupID int, productFileID int) error
+	CurrentUser() (User, error)
 }
 
 type client struct {
@@ -37,22 +87,100 @@ type client struct {
 	token     string
 	userAgent string
 	logger    logger.Logger
+	debug     bool
+	timer     timing.Timer
+	ctx       context.Context
+	backoff   BackoffConfig
+
+	extraHeaders map[string]string
+
+	httpClient *http.Client
+
+	currentUser *currentUserCache
+	eulas       *eulaCache
 }
 
 type NewClientConfig struct {
 	Endpoint  string
 	Token     string
 	UserAgent string
+
+	// Backoff sets the intervals between polls when waiting, e.g. in
+	// WaitForRelease. It defaults to DefaultBackoffConfig.
+	Backoff BackoffConfig
+
+	// Debug logs the method, URL, status and duration of every request, along
+	// with its response body truncated to maxLoggedBodyBytes.
+	Debug bool
+
+	// Timings logs the duration of every request at the info level.
+	Timings bool
+
+	// Context aborts any in-flight request when it is cancelled. Defaults to
+	// context.Background().
+	Context context.Context
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout tune how many
+	// connections are kept open for reuse between requests, and for how long.
+	// They default to 100, 10 and 90 seconds respectively.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// TLSConfig is used for connections to Pivotal Network, e.g. to trust a
+	// private CA. Defaults to the system TLS config.
+	TLSConfig *tls.Config
+
+	// ExtraHeaders are added to every request, e.g. for a proxy in front of
+	// Pivotal Network that requires its own authentication.
+	ExtraHeaders map[string]string
 }
 
 func NewClient(config NewClientConfig, logger logger.Logger) Client {
 	url := fmt.Sprintf("%s%s", config.Endpoint, path)
 
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        defaultMaxIdleConns,
+		MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+		TLSClientConfig:     config.TLSConfig,
+	}
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+
 	return &client{
 		url:       url,
 		token:     config.Token,
 		userAgent: config.UserAgent,
 		logger:    logger,
+		debug:     config.Debug,
+		timer:     timing.NewTimer(logger, config.Timings),
+		ctx:       ctx,
+		backoff:   config.Backoff,
+
+		extraHeaders: config.ExtraHeaders,
+
+		httpClient: &http.Client{Transport: transport},
+
+		currentUser: &currentUserCache{},
+		eulas:       &eulaCache{eulas: map[int]Eula{}},
 	}
 }
 
@@ -79,6 +207,38 @@ func (c client) ProductVersions(id string) ([]string, error) {
 	return versions, nil
 }
 
+// ProductVersionsIfNoneMatch returns the versions of the product along with
+// the ETag of the response. If the provided ETag is non-empty and still matches,
+// ErrNotModified is returned instead.
+func (c client) ProductVersionsIfNoneMatch(productSlug string, etag string) ([]string, string, error) {
+	url := c.url + "/products/" + productSlug + "/releases"
+
+	headers := http.Header{}
+	if etag != "" {
+		headers.Add("If-None-Match", etag)
+	}
+
+	var response Response
+	responseHeaders, err := c.makeRequestWithHeaders(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+		headers,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var versions []string
+	for _, r := range response.Releases {
+		versions = append(versions, r.Version)
+	}
+
+	return versions, responseHeaders.Get("ETag"), nil
+}
+
 func (c client) AcceptEULA(productSlug string, releaseID int) error {
 	url := fmt.Sprintf("%s/products/%s/releases/%d/eula_acceptance", c.url,
 		productSlug, releaseID)
@@ -105,9 +265,39 @@ func (c client) makeRequest(
 	body io.Reader,
 	data interface{},
 ) error {
+	_, err := c.makeRequestWithHeaders(
+		requestType,
+		url,
+		expectedStatusCode,
+		body,
+		data,
+		nil,
+	)
+	return err
+}
+
+func (c client) makeRequestWithHeaders(
+	requestType string,
+	url string,
+	expectedStatusCode int,
+	body io.Reader,
+	data interface{},
+	headers http.Header,
+) (http.Header, error) {
 	req, err := http.NewRequest(requestType, url, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	req = req.WithContext(c.ctx)
+
+	for k, values := range headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	for k, v := range c.extraHeaders {
+		req.Header.Set(k, v)
 	}
 
 	req.Header.Add("Content-Type", "application/json")
@@ -117,38 +307,83 @@ func (c client) makeRequest(
 	reqBytes, err := httputil.DumpRequestOut(req, true)
 	if err != nil {
 		c.logger.Debugf("Error dumping request: %+v\n", err)
-		return err
+		return nil, err
+	}
+	if c.token != "" {
+		reqBytes = bytes.Replace(
+			reqBytes,
+			[]byte(req.Header.Get("Authorization")),
+			[]byte("Token ***REDACTED***"),
+			-1,
+		)
+	}
+	if req.URL.RawQuery != "" {
+		reqBytes = bytes.Replace(reqBytes, []byte("?"+req.URL.RawQuery), nil, 1)
 	}
 
 	c.logger.Debugf("Making request: %s\n", string(reqBytes))
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	stopTimer := c.timer.Start("api", requestType+" "+sanitizer.URL(url))
+	resp, err := c.httpClient.Do(req)
+	stopTimer()
 	if err != nil {
 		c.logger.Debugf("Error making request: %+v\n", err)
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// The connection is only reused if the body has been read to the end.
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 
-	c.logger.Debugf("Response status code: %d\n", resp.StatusCode)
-	if resp.StatusCode != expectedStatusCode {
-		return fmt.Errorf(
-			"Pivnet returned status code: %d for the request - expected %d",
+	if c.debug {
+		c.logger.Debugf(
+			"Request completed: {method: %s, url: %s, status: %d, duration: %s}\n",
+			requestType,
+			sanitizer.URL(url),
 			resp.StatusCode,
-			expectedStatusCode,
+			time.Since(start).String(),
 		)
 	}
 
+	c.logger.Debugf("Response status code: %d\n", resp.StatusCode)
+	if resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		return resp.Header, ErrNotModified
+	}
+
+	if resp.StatusCode != expectedStatusCode {
+		return nil, newResponseError(resp, expectedStatusCode)
+	}
+
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(b) > 0 {
-		c.logger.Debugf("Response body: %s\n", string(b))
+		if c.debug {
+			c.logger.Debugf("Response body: %s\n", truncate(b, maxLoggedBodyBytes))
+		}
+
 		err = json.Unmarshal(b, data)
 		if err != nil {
-			return err
+			// An HTML body is not a malformed response but a page served
+			// in place of the API.
+			contentType := resp.Header.Get("Content-Type")
+			if isHTMLContentType(contentType) {
+				return nil, ErrMaintenance{ContentType: contentType}
+			}
+			return nil, err
 		}
 	}
 
-	return nil
+	return resp.Header, nil
+}
+
+func truncate(b []byte, max int) string {
+	if len(b) <= max {
+		return string(b)
+	}
+
+	return fmt.Sprintf("%s... (truncated %d of %d bytes)", b[:max], len(b)-max, len(b))
 }
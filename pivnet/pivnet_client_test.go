@@ -1,10 +1,17 @@
 package pivnet_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -74,6 +81,279 @@ var _ = Describe("PivnetClient", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("adds extra headers to each request", func() {
+		response := fmt.Sprintf(`{"releases": [{"version": "1234"}]}`)
+
+		server.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+				ghttp.VerifyHeaderKV("X-Proxy-Token", "some-proxy-token"),
+				ghttp.VerifyHeaderKV("Authorization", fmt.Sprintf("Token %s", token)),
+				ghttp.RespondWith(http.StatusOK, response),
+			),
+		)
+
+		newClientConfig.ExtraHeaders = map[string]string{
+			"X-Proxy-Token": "some-proxy-token",
+		}
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+
+		_, err := client.ProductVersions("my-product-id")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reuses connections between requests", func() {
+		unstartedServer := ghttp.NewUnstartedServer()
+
+		var mutex sync.Mutex
+		newConnections := 0
+		unstartedServer.HTTPTestServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				mutex.Lock()
+				newConnections++
+				mutex.Unlock()
+			}
+		}
+
+		unstartedServer.Start()
+		defer unstartedServer.Close()
+
+		unstartedServer.AppendHandlers(
+			ghttp.RespondWith(http.StatusOK, `{"releases": [{"version": "1234"}]}`),
+			ghttp.RespondWith(http.StatusTeapot, `{"error": "unexpected"}`),
+			ghttp.RespondWith(http.StatusOK, `{"releases": [{"version": "1234"}]}`),
+		)
+
+		newClientConfig.Endpoint = unstartedServer.URL()
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+
+		_, err := client.ProductVersions("my-product-id")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ProductVersions("my-product-id")
+		Expect(err).To(HaveOccurred())
+
+		_, err = client.ProductVersions("my-product-id")
+		Expect(err).NotTo(HaveOccurred())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(newConnections).To(Equal(1))
+	})
+
+	Context("when a TLS config is provided", func() {
+		var tlsServer *ghttp.Server
+
+		BeforeEach(func() {
+			tlsServer = ghttp.NewTLSServer()
+			tlsServer.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, `{"releases": [{"version": "1234"}]}`),
+			)
+
+			pool := x509.NewCertPool()
+			pool.AddCert(tlsServer.HTTPTestServer.Certificate())
+
+			newClientConfig.Endpoint = tlsServer.URL()
+			newClientConfig.TLSConfig = &tls.Config{RootCAs: pool}
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+		})
+
+		It("uses it to verify the server", func() {
+			versions, err := client.ProductVersions("my-product-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal([]string{"1234"}))
+		})
+
+		Context("when the TLS config does not trust the server", func() {
+			BeforeEach(func() {
+				newClientConfig.TLSConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+				client = pivnet.NewClient(newClientConfig, fakeLogger)
+			})
+
+			It("returns an error", func() {
+				_, err := client.ProductVersions("my-product-id")
+				Expect(err).To(MatchError(ContainSubstring("certificate")))
+			})
+		})
+	})
+
+	Context("when the context is cancelled during a request", func() {
+		var unblock chan struct{}
+
+		BeforeEach(func() {
+			unblock = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			close(unblock)
+		})
+
+		It("aborts the request", func() {
+			received := make(chan struct{})
+			server.AppendHandlers(func(w http.ResponseWriter, r *http.Request) {
+				close(received)
+				<-unblock
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			newClientConfig.Context = ctx
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := client.ProductVersions("my-product-id")
+				errs <- err
+			}()
+
+			Eventually(received).Should(BeClosed())
+			cancel()
+
+			var err error
+			Eventually(errs).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("context canceled")))
+		})
+	})
+
+	Describe("logging", func() {
+		var (
+			logLines func() []string
+		)
+
+		BeforeEach(func() {
+			logLines = func() []string {
+				l := fakeLogger.(*logger_fakes.FakeLogger)
+
+				var lines []string
+				for i := 0; i < l.DebugfCallCount(); i++ {
+					format, args := l.DebugfArgsForCall(i)
+					lines = append(lines, fmt.Sprintf(format, args...))
+				}
+				return lines
+			}
+
+			server.AppendHandlers(
+				ghttp.RespondWith(
+					http.StatusOK,
+					fmt.Sprintf(`{"releases": [{"version": "%s"}]}`, strings.Repeat("a", 5000)),
+				),
+			)
+		})
+
+		It("redacts the token from the logged request", func() {
+			_, err := client.ProductVersions("my-product-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, line := range logLines() {
+				Expect(line).NotTo(ContainSubstring(token))
+			}
+		})
+
+		It("does not log the request summary or response body", func() {
+			_, err := client.ProductVersions("my-product-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, line := range logLines() {
+				Expect(line).NotTo(HavePrefix("Request completed"))
+				Expect(line).NotTo(HavePrefix("Response body"))
+			}
+		})
+
+		Context("when debug is enabled", func() {
+			BeforeEach(func() {
+				newClientConfig.Debug = true
+				client = pivnet.NewClient(newClientConfig, fakeLogger)
+			})
+
+			It("logs the method, url, status and duration of the request", func() {
+				_, err := client.ProductVersions("my-product-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logLines()).To(ContainElement(MatchRegexp(
+					`^Request completed: {method: GET, url: .*/products/my-product-id/releases, status: 200, duration: .+}`,
+				)))
+			})
+
+			It("logs the response body truncated", func() {
+				_, err := client.ProductVersions("my-product-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logLines()).To(ContainElement(And(
+					HavePrefix("Response body: "),
+					MatchRegexp(`\.\.\. \(truncated \d+ of \d+ bytes\)\n$`),
+				)))
+			})
+		})
+	})
+
+	Describe("ProductVersionsIfNoneMatch", func() {
+		It("returns the versions and the ETag of the response", func() {
+			response := `{"releases": [{"version": "1234"}, {"version": "5678"}]}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+					ghttp.RespondWith(http.StatusOK, response, http.Header{
+						"ETag": []string{`"some-etag"`},
+					}),
+				),
+			)
+
+			versions, etag, err := client.ProductVersionsIfNoneMatch("my-product-id", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal([]string{"1234", "5678"}))
+			Expect(etag).To(Equal(`"some-etag"`))
+
+			Expect(server.ReceivedRequests()[0].Header.Get("If-None-Match")).To(BeEmpty())
+		})
+
+		Context("when an ETag is provided", func() {
+			It("sends it as If-None-Match", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+						ghttp.VerifyHeaderKV("If-None-Match", `"some-etag"`),
+						ghttp.RespondWith(http.StatusOK, `{"releases": []}`),
+					),
+				)
+
+				_, _, err := client.ProductVersionsIfNoneMatch("my-product-id", `"some-etag"`)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			Context("when the releases have not been modified", func() {
+				It("returns ErrNotModified", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+							ghttp.RespondWith(http.StatusNotModified, nil),
+						),
+					)
+
+					_, _, err := client.ProductVersionsIfNoneMatch("my-product-id", `"some-etag"`)
+					Expect(err).To(Equal(pivnet.ErrNotModified))
+				})
+			})
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+						ghttp.RespondWith(http.StatusTeapot, nil),
+					),
+				)
+
+				_, _, err := client.ProductVersionsIfNoneMatch("my-product-id", "")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
 	Describe("Accepting a EULA", func() {
 		var (
 			releaseID         int
@@ -171,6 +451,28 @@ var _ = Describe("PivnetClient", func() {
 			})
 		})
 
+		Context("when Pivnet responds with an HTML page", func() {
+			It("returns ErrMaintenance", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product-id/releases"),
+						ghttp.RespondWith(
+							http.StatusOK,
+							"<html><body>Down for maintenance</body></html>",
+							http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+						),
+					),
+				)
+
+				_, err := client.ProductVersions("my-product-id")
+				Expect(err).To(MatchError(
+					"Pivnet appears to be in maintenance mode - it responded with text/html; charset=utf-8 rather than JSON"))
+
+				var maintenance pivnet.ErrMaintenance
+				Expect(errors.As(err, &maintenance)).To(BeTrue())
+			})
+		})
+
 		It("gets versions", func() {
 			productVersion := "v" + strconv.Itoa(rand.Int())
 			response := fmt.Sprintf(
@@ -3,8 +3,10 @@ package pivnet
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type CreateProductFileConfig struct {
@@ -13,6 +15,13 @@ type CreateProductFileConfig struct {
 	AWSObjectKey string
 	Name         string
 	MD5          string
+
+	// FileType defaults to Software if not provided.
+	FileType    string
+	Description string
+	DocsURL     string
+
+	SystemRequirements []string
 }
 
 func (c client) GetProductFiles(release Release) (ProductFiles, error) {
@@ -35,6 +44,51 @@ func (c client) GetProductFiles(release Release) (ProductFiles, error) {
 	return productFiles, nil
 }
 
+// ReleaseProductFiles returns the product files of the release with the ID.
+// Unlike GetProductFiles it does not need the links of the release.
+func (c client) ReleaseProductFiles(productSlug string, releaseID int) (ProductFiles, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/product_files",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var productFiles ProductFiles
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&productFiles,
+	)
+	if err != nil {
+		return ProductFiles{}, err
+	}
+
+	return productFiles, nil
+}
+
+// RawReleaseProductFiles returns the product files of the release exactly as
+// Pivotal Network returns them, including any fields ProductFile does not
+// model.
+func (c client) RawReleaseProductFiles(productSlug string, releaseID int) (json.RawMessage, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/product_files",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response json.RawMessage
+	err := c.makeRequest("GET", url, http.StatusOK, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 func (c client) GetProductFile(productSlug string, releaseID int, productID int) (ProductFile, error) {
 	url := fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d",
 		c.url,
@@ -58,6 +112,80 @@ func (c client) GetProductFile(productSlug string, releaseID int, productID int)
 	return response.ProductFile, nil
 }
 
+// WaitForProductFile polls for the product file until it has a download
+// link, as files are not downloadable while Pivotal Network is still
+// processing them, e.g. right after the release is published. It backs off
+// between polls, and returns an error if the file has no download link once
+// the timeout has passed.
+func (c client) WaitForProductFile(
+	productSlug string,
+	releaseID int,
+	productFileID int,
+	timeout time.Duration,
+) (ProductFile, error) {
+	backoff := NewBackoff(c.backoff)
+	deadline := backoff.Now().Add(timeout)
+
+	for {
+		productFile, err := c.GetProductFile(productSlug, releaseID, productFileID)
+		if err == nil {
+			if productFile.Links != nil && productFile.Links.Download["href"] != "" {
+				return productFile, nil
+			}
+
+			err = fmt.Errorf("no download link")
+		}
+
+		var unauthorized ErrUnauthorized
+		if errors.As(err, &unauthorized) {
+			// Polling cannot fix the token.
+			return ProductFile{}, err
+		}
+
+		pollInterval := backoff.Next()
+
+		var rateLimited ErrRateLimited
+		if errors.As(err, &rateLimited) && rateLimited.RetryAfter > pollInterval {
+			pollInterval = rateLimited.RetryAfter
+		}
+		if backoff.Now().Add(pollInterval).After(deadline) {
+			return ProductFile{}, fmt.Errorf(
+				"product file %d of release %d was not available for download after %s: %s",
+				productFileID,
+				releaseID,
+				timeout.String(),
+				err.Error(),
+			)
+		}
+
+		c.logger.Debugf(
+			"Waiting for product file: {product_slug: %s, release_id: %d, product_file_id: %d, poll_interval: %s, reason: %s}\n",
+			productSlug,
+			releaseID,
+			productFileID,
+			pollInterval.String(),
+			err.Error(),
+		)
+
+		err = backoff.Wait(c.ctx, pollInterval)
+		if err != nil {
+			return ProductFile{}, err
+		}
+	}
+}
+
+// ProductFileDownloadURL returns the URL of the download endpoint of the
+// product file on the client's endpoint. Pivotal Network redirects requests
+// to it to the file itself.
+func (c client) ProductFileDownloadURL(productSlug string, releaseID int, productFileID int) string {
+	return fmt.Sprintf("%s/products/%s/releases/%d/product_files/%d/download",
+		c.url,
+		productSlug,
+		releaseID,
+		productFileID,
+	)
+}
+
 func (c client) CreateProductFile(config CreateProductFileConfig) (ProductFile, error) {
 	if config.AWSObjectKey == "" {
 		return ProductFile{}, fmt.Errorf("AWS object key must not be empty")
@@ -65,13 +193,22 @@ func (c client) CreateProductFile(config CreateProductFileConfig) (ProductFile,
 
 	url := c.url + "/products/" + config.ProductSlug + "/product_files"
 
+	fileType := config.FileType
+	if fileType == "" {
+		fileType = "Software"
+	}
+
 	body := createProductFileBody{
 		ProductFile: ProductFile{
 			MD5:          config.MD5,
-			FileType:     "Software",
+			FileType:     fileType,
 			FileVersion:  config.FileVersion,
 			AWSObjectKey: config.AWSObjectKey,
 			Name:         config.Name,
+			Description:  config.Description,
+			DocsURL:      config.DocsURL,
+
+			SystemRequirements: config.SystemRequirements,
 		},
 	}
 
@@ -158,3 +295,42 @@ func (c client) AddProductFile(
 
 	return nil
 }
+
+// RemoveProductFile detaches the product file from the release. The product
+// file itself is not deleted.
+func (c client) RemoveProductFile(
+	productID int,
+	releaseID int,
+	productFileID int,
+) error {
+	url := fmt.Sprintf(
+		"%s/products/%d/releases/%d/remove_product_file",
+		c.url,
+		productID,
+		releaseID,
+	)
+
+	body := createProductFileBody{
+		ProductFile: ProductFile{
+			ID: productFileID,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.makeRequest(
+		"PATCH",
+		url,
+		http.StatusNoContent,
+		bytes.NewReader(b),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
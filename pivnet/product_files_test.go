@@ -2,9 +2,9 @@ package pivnet_test
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -78,6 +78,25 @@ var _ = Describe("PivnetClient - product files", func() {
 			Expect(product.ProductFiles[1].Links.Download["href"]).To(Equal("/products/banana/releases/666/product_files/8/download"))
 		})
 
+		It("decodes sizes beyond the precision of a float64 exactly", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases/666/product_files"),
+					ghttp.RespondWith(http.StatusOK, `{"product_files": [{"id": 3, "size": 9007199254740993}]}`),
+				),
+			)
+
+			release := pivnet.Release{
+				Links: &pivnet.Links{
+					ProductFiles: map[string]string{"href": apiAddress + apiPrefix + "/products/banana/releases/666/product_files"},
+				},
+			}
+
+			product, err := client.GetProductFiles(release)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(product.ProductFiles[0].Size).To(Equal(int64(9007199254740993)))
+		})
+
 		Context("when the server responds with a non-2XX status code", func() {
 			It("returns an error", func() {
 				server.AppendHandlers(
@@ -93,8 +112,60 @@ var _ = Describe("PivnetClient - product files", func() {
 				}
 
 				_, err := client.GetProductFiles(release)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("Release Product Files", func() {
+		It("returns the product files of the release with the id", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases/666/product_files"),
+					ghttp.RespondWith(http.StatusOK, `{"product_files":[{"id":3,"name":"anything"}]}`),
+				),
+			)
+
+			productFiles, err := client.ReleaseProductFiles("banana", 666)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(productFiles.ProductFiles).To(Equal([]pivnet.ProductFile{{ID: 3, Name: "anything"}}))
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.ReleaseProductFiles("banana", 666)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("Raw Release Product Files", func() {
+		It("returns the product files of the release as returned", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases/666/product_files"),
+					ghttp.RespondWith(http.StatusOK, `{"product_files": [{"id": 3, "unmodelled": "field"}]}`),
+				),
+			)
+
+			productFiles, err := client.RawReleaseProductFiles("banana", 666)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(productFiles).To(MatchJSON(`{"product_files": [{"id": 3, "unmodelled": "field"}]}`))
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.RawReleaseProductFiles("banana", 666)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
 			})
 		})
 	})
@@ -163,8 +234,56 @@ var _ = Describe("PivnetClient - product files", func() {
 					releaseID,
 					productID,
 				)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("WaitForProductFile", func() {
+		var clock *fakeClock
+
+		BeforeEach(func() {
+			clock = &fakeClock{now: time.Unix(0, 0)}
+
+			newClientConfig.Backoff = pivnet.BackoffConfig{
+				InitialInterval: time.Second,
+				MaxInterval:     4 * time.Second,
+				Multiplier:      2,
+				Clock:           clock,
+			}
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
+		})
+
+		It("returns the product file once it has a download link", func() {
+			productFileURL := apiPrefix + "/products/banana/releases/12/product_files/34"
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", productFileURL),
+					ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 34}}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", productFileURL),
+					ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 34, "_links": {"download": {"href": "/download"}}}}`),
+				),
+			)
+
+			productFile, err := client.WaitForProductFile("banana", 12, 34, time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(productFile.Links.Download["href"]).To(Equal("/download"))
+
+			Expect(clock.Waits()).To(Equal([]time.Duration{time.Second}))
+		})
+
+		Context("when the product file has no download link before the timeout", func() {
+			It("returns an error", func() {
+				server.AllowUnhandledRequests = true
+				server.UnhandledRequestStatusCode = http.StatusOK
+
+				_, err := client.WaitForProductFile("banana", 12, 34, 5*time.Second)
+				Expect(err).To(MatchError(ContainSubstring(
+					"product file 34 of release 12 was not available for download after 5s",
+				)))
 			})
 		})
 	})
@@ -223,6 +342,31 @@ var _ = Describe("PivnetClient - product files", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(release.ID).To(Equal(1234))
 			})
+
+			Context("when the file metadata is provided", func() {
+				BeforeEach(func() {
+					createProductFileConfig.FileType = "Documentation"
+					createProductFileConfig.Description = "some-description"
+					createProductFileConfig.DocsURL = "https://docs.example.com"
+
+					expectedRequestBody.ProductFile.FileType = "Documentation"
+					expectedRequestBody.ProductFile.Description = "some-description"
+					expectedRequestBody.ProductFile.DocsURL = "https://docs.example.com"
+				})
+
+				It("creates the product file with the metadata", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", apiPrefix+"/products/"+productSlug+"/product_files"),
+							ghttp.VerifyJSONRepresenting(&expectedRequestBody),
+							ghttp.RespondWith(http.StatusCreated, validResponse),
+						),
+					)
+
+					_, err := client.CreateProductFile(createProductFileConfig)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
 		})
 
 		Context("when the server responds with a non-201 status code", func() {
@@ -235,8 +379,7 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.CreateProductFile(createProductFileConfig)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 201")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 201"))
 			})
 		})
 
@@ -294,8 +437,7 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.DeleteProductFile(productSlug, id)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
 			})
 		})
 	})
@@ -344,8 +486,48 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				err := client.AddProductFile(productID, releaseID, productFileID)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 204")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
+			})
+		})
+	})
+
+	Describe("Remove Product File", func() {
+		var (
+			productID     = 1234
+			releaseID     = 2345
+			productFileID = 3456
+
+			expectedRequestBody = `{"product_file":{"id":3456}}`
+		)
+
+		Context("when the server responds with a 204 status code", func() {
+			It("returns without error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", fmt.Sprintf(
+							"%s/products/%d/releases/%d/remove_product_file",
+							apiPrefix,
+							productID,
+							releaseID,
+						)),
+						ghttp.VerifyJSON(expectedRequestBody),
+						ghttp.RespondWith(http.StatusNoContent, nil),
+					),
+				)
+
+				err := client.RemoveProductFile(productID, releaseID, productFileID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				err := client.RemoveProductFile(productID, releaseID, productFileID)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
 			})
 		})
 	})
@@ -1,6 +1,12 @@
 package pivnet
 
-import "net/http"
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+)
 
 func (c client) FindProductForSlug(slug string) (Product, error) {
 	url := c.url + "/products/" + slug
@@ -19,3 +25,79 @@ func (c client) FindProductForSlug(slug string) (Product, error) {
 
 	return response, nil
 }
+
+// Products returns all products visible to the client's token, following
+// the next links until every page has been fetched.
+func (c client) Products() ([]Product, error) {
+	url := c.url + "/products"
+
+	products := []Product{}
+	for url != "" {
+		var response ProductsResponse
+		err := c.makeRequest(
+			"GET",
+			url,
+			http.StatusOK,
+			nil,
+			&response,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, response.Products...)
+
+		url = ""
+		if response.Links != nil {
+			url = response.Links.Next["href"]
+		}
+	}
+
+	return products, nil
+}
+
+// ProductIcon returns the icon of the product along with its URL, or no icon
+// and an empty URL if the product has none. The icon is usually hosted
+// outside of Pivotal Network, so it is fetched without the token.
+func (c client) ProductIcon(productSlug string) ([]byte, string, error) {
+	product, err := c.FindProductForSlug(productSlug)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if product.LogoURL == "" {
+		c.logger.Debugf("Product has no icon: {product_slug: %s}\n", productSlug)
+		return nil, "", nil
+	}
+
+	req, err := http.NewRequest("GET", product.LogoURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req = req.WithContext(c.ctx)
+	req.Header.Add("User-Agent", c.userAgent)
+
+	c.logger.Debugf("Getting product icon: {product_slug: %s, url: %s}\n", productSlug, sanitizer.URL(product.LogoURL))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf(
+			"failed to get product icon %s: status code %d - expected %d",
+			product.LogoURL,
+			resp.StatusCode,
+			http.StatusOK,
+		)
+	}
+
+	icon, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return icon, product.LogoURL, nil
+}
@@ -1,7 +1,6 @@
 package pivnet_test
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 
@@ -81,8 +80,132 @@ var _ = Describe("PivnetClient - product", func() {
 				)
 
 				_, err := client.FindProductForSlug(slug)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("Products", func() {
+		Context("when all products fit on one page", func() {
+			It("returns the products", func() {
+				response := `{"products": [
+					{"id": 3, "slug": "my-product", "name": "My Product"},
+					{"id": 4, "slug": "other-product", "name": "Other Product"}
+				]}`
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products"),
+						ghttp.VerifyHeaderKV("Authorization", "Token "+token),
+						ghttp.RespondWith(http.StatusOK, response),
+					),
+				)
+
+				products, err := client.Products()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(products).To(Equal([]pivnet.Product{
+					{ID: 3, Slug: "my-product", Name: "My Product"},
+					{ID: 4, Slug: "other-product", Name: "Other Product"},
+				}))
+			})
+		})
+
+		Context("when the products span multiple pages", func() {
+			It("follows the next links and returns the products from every page", func() {
+				firstPage := fmt.Sprintf(`{
+					"products": [{"id": 3, "slug": "my-product", "name": "My Product"}],
+					"_links": {"next": {"href": "%s%s/products?page=2"}}
+				}`, apiAddress, apiPrefix)
+
+				secondPage := `{
+					"products": [{"id": 4, "slug": "other-product", "name": "Other Product"}],
+					"_links": {}
+				}`
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products"),
+						ghttp.RespondWith(http.StatusOK, firstPage),
+					),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products", "page=2"),
+						ghttp.RespondWith(http.StatusOK, secondPage),
+					),
+				)
+
+				products, err := client.Products()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(products).To(Equal([]pivnet.Product{
+					{ID: 3, Slug: "my-product", Name: "My Product"},
+					{ID: 4, Slug: "other-product", Name: "Other Product"},
+				}))
+			})
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products"),
+						ghttp.RespondWith(http.StatusTeapot, nil),
+					),
+				)
+
+				_, err := client.Products()
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("ProductIcon", func() {
+		It("returns the icon at the logo url of the product without the token", func() {
+			logoURL := server.URL() + "/logos/my-product.png"
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/my-product"),
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(`{"id": 3, "slug": "my-product", "logo_url": "%s"}`, logoURL)),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/logos/my-product.png"),
+					func(w http.ResponseWriter, r *http.Request) {
+						Expect(r.Header.Get("Authorization")).To(BeEmpty())
+					},
+					ghttp.RespondWith(http.StatusOK, "some icon"),
+				),
+			)
+
+			icon, url, err := client.ProductIcon("my-product")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(icon)).To(Equal("some icon"))
+			Expect(url).To(Equal(logoURL))
+		})
+
+		Context("when the product has no icon", func() {
+			It("returns no icon", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{"id": 3, "slug": "my-product"}`),
+				)
+
+				icon, url, err := client.ProductIcon("my-product")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(icon).To(BeNil())
+				Expect(url).To(BeEmpty())
+			})
+		})
+
+		Context("when the icon cannot be fetched", func() {
+			It("returns an error", func() {
+				logoURL := server.URL() + "/logos/my-product.png"
+
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, fmt.Sprintf(`{"id": 3, "slug": "my-product", "logo_url": "%s"}`, logoURL)),
+					ghttp.RespondWith(http.StatusNotFound, nil),
+				)
+
+				_, _, err := client.ProductIcon("my-product")
+				Expect(err).To(MatchError(fmt.Sprintf(
+					"failed to get product icon %s: status code 404 - expected 200", logoURL)))
 			})
 		})
 	})
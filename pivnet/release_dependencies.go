@@ -0,0 +1,92 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type addDependencyBody struct {
+	Dependency ReleaseDependency `json:"dependency"`
+}
+
+type ReleaseDependenciesResponse struct {
+	Dependencies []ReleaseDependency `json:"dependencies,omitempty"`
+}
+
+// ReleaseDependency is a release, which may be of another product, that a
+// release depends on.
+type ReleaseDependency struct {
+	Release DependentRelease `json:"release"`
+}
+
+type DependentRelease struct {
+	ID      int      `json:"id,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Product *Product `json:"product,omitempty"`
+}
+
+// AddReleaseDependency adds the release with the dependent release ID, which
+// may be of another product, as a dependency of the release.
+func (c client) AddReleaseDependency(
+	productSlug string,
+	releaseID int,
+	dependentReleaseID int,
+) error {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/add_dependency",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	body := addDependencyBody{
+		Dependency: ReleaseDependency{
+			Release: DependentRelease{
+				ID: dependentReleaseID,
+			},
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	return c.makeRequest(
+		"PATCH",
+		url,
+		http.StatusNoContent,
+		bytes.NewReader(b),
+		nil,
+	)
+}
+
+// ReleaseDependencies returns the releases the release depends on.
+func (c client) ReleaseDependencies(productSlug string, releaseID int) ([]ReleaseDependency, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/dependencies",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response ReleaseDependenciesResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Dependencies == nil {
+		return []ReleaseDependency{}, nil
+	}
+
+	return response.Dependencies, nil
+}
@@ -0,0 +1,135 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - release dependencies", func() {
+	var (
+		server     *ghttp.Server
+		client     pivnet.Client
+		token      string
+		apiAddress string
+		userAgent  string
+
+		newClientConfig pivnet.NewClientConfig
+		fakeLogger      logger.Logger
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		apiAddress = server.URL()
+		token = "my-auth-token"
+		userAgent = "pivnet-resource/0.1.0 (some-url)"
+
+		fakeLogger = &logger_fakes.FakeLogger{}
+		newClientConfig = pivnet.NewClientConfig{
+			Endpoint:  apiAddress,
+			Token:     token,
+			UserAgent: userAgent,
+		}
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("AddReleaseDependency", func() {
+		var (
+			productSlug        = "banana-slug"
+			releaseID          = 2345
+			dependentReleaseID = 4567
+
+			expectedRequestBody = `{"dependency":{"release":{"id":4567}}}`
+		)
+
+		Context("when the server responds with a 204 status code", func() {
+			It("returns without error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", fmt.Sprintf(
+							"%s/products/%s/releases/%d/add_dependency",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						)),
+						ghttp.VerifyJSON(expectedRequestBody),
+						ghttp.RespondWith(http.StatusNoContent, nil),
+					),
+				)
+
+				err := client.AddReleaseDependency(productSlug, releaseID, dependentReleaseID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				err := client.AddReleaseDependency(productSlug, releaseID, dependentReleaseID)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
+			})
+		})
+	})
+
+	Describe("ReleaseDependencies", func() {
+		var (
+			productSlug = "banana-slug"
+			releaseID   = 2345
+		)
+
+		Context("when the server responds with a 200 status code", func() {
+			It("returns the dependencies of the release", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", fmt.Sprintf(
+							"%s/products/%s/releases/%d/dependencies",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						)),
+						ghttp.RespondWith(
+							http.StatusOK,
+							`{"dependencies":[{"release":{"id":4567,"version":"1.2.3","product":{"id":12,"slug":"other-slug"}}}]}`,
+						),
+					),
+				)
+
+				dependencies, err := client.ReleaseDependencies(productSlug, releaseID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dependencies).To(Equal([]pivnet.ReleaseDependency{
+					{
+						Release: pivnet.DependentRelease{
+							ID:      4567,
+							Version: "1.2.3",
+							Product: &pivnet.Product{ID: 12, Slug: "other-slug"},
+						},
+					},
+				}))
+			})
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.ReleaseDependencies(productSlug, releaseID)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+})
@@ -3,8 +3,10 @@ package pivnet
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -18,13 +20,47 @@ type CreateReleaseConfig struct {
 	ReleaseType     string
 	ReleaseDate     string
 	EulaSlug        string
+	EulaID          int
 	Description     string
 	ReleaseNotesURL string
+	Controlled      bool
 }
 
-func (c client) GetRelease(productSlug, version string) (Release, error) {
-	var matchingRelease Release
+func (c client) ReleasesForProductSlug(productSlug string) ([]Release, error) {
+	url := c.url + "/products/" + productSlug + "/releases"
+
+	var response Response
+	err := c.makeRequest("GET", url, http.StatusOK, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Releases, nil
+}
+
+// ReleasesUpdatedSince returns the releases of the product updated at or
+// after the time, in the order Pivotal Network lists them. The releases
+// endpoint cannot filter by update time and is not paginated, so every
+// release is fetched and filtered here.
+func (c client) ReleasesUpdatedSince(productSlug string, since time.Time) ([]Release, error) {
+	releases, err := c.ReleasesForProductSlug(productSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []Release
+	for _, r := range releases {
+		if r.UpdatedSince(since) {
+			updated = append(updated, r)
+		}
+	}
+
+	return updated, nil
+}
 
+// GetRelease returns the release of the product with the version, or
+// ErrNotFound if the product has no such release.
+func (c client) GetRelease(productSlug, version string) (Release, error) {
 	url := c.url + "/products/" + productSlug + "/releases"
 
 	var response Response
@@ -33,19 +69,107 @@ func (c client) GetRelease(productSlug, version string) (Release, error) {
 		return Release{}, err
 	}
 
-	for i, r := range response.Releases {
-		if r.Version == version {
-			matchingRelease = r
-			break
+	// Versions are compared without surrounding whitespace, which Pivotal
+	// Network does not always strip.
+	for _, r := range response.Releases {
+		if strings.TrimSpace(r.Version) == strings.TrimSpace(version) {
+			return r, nil
 		}
+	}
+
+	return Release{}, ErrNotFound{ResponseError{
+		Message: fmt.Sprintf("The requested version: %s - could not be found", version),
+	}}
+}
 
-		if i == len(response.Releases)-1 {
+// ReleaseForID returns the release of the product with the ID, or ErrNotFound
+// if the product has no such release. Unlike GetRelease it does not list every
+// release, and is not ambiguous when releases share a version.
+func (c client) ReleaseForID(productSlug string, releaseID int) (Release, error) {
+	url := fmt.Sprintf("%s/products/%s/releases/%d", c.url, productSlug, releaseID)
+
+	var response Release
+	err := c.makeRequest("GET", url, http.StatusOK, nil, &response)
+	if err != nil {
+		return Release{}, err
+	}
+
+	return response, nil
+}
+
+// RawRelease returns the release with the given id exactly as Pivotal Network
+// returns it, including any fields Release does not model.
+func (c client) RawRelease(productSlug string, releaseID int) (json.RawMessage, error) {
+	url := fmt.Sprintf("%s/products/%s/releases/%d", c.url, productSlug, releaseID)
+
+	var response json.RawMessage
+	err := c.makeRequest("GET", url, http.StatusOK, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// WaitForRelease polls with the client's backoff until the release with the
+// version is listed for the product, returning an error if it is not listed
+// within the timeout. Newly created releases are not always listed
+// immediately.
+func (c client) WaitForRelease(
+	productSlug string,
+	version string,
+	timeout time.Duration,
+) (Release, error) {
+	backoff := NewBackoff(c.backoff)
+	deadline := backoff.Now().Add(timeout)
+
+	for {
+		releases, err := c.ReleasesForProductSlug(productSlug)
+		if err == nil {
+			for _, r := range releases {
+				if r.Version == version {
+					return r, nil
+				}
+			}
+
+			err = fmt.Errorf("release not listed")
+		}
+
+		var unauthorized ErrUnauthorized
+		if errors.As(err, &unauthorized) {
+			// Polling cannot fix the token.
+			return Release{}, err
+		}
+
+		pollInterval := backoff.Next()
+
+		var rateLimited ErrRateLimited
+		if errors.As(err, &rateLimited) && rateLimited.RetryAfter > pollInterval {
+			pollInterval = rateLimited.RetryAfter
+		}
+		if backoff.Now().Add(pollInterval).After(deadline) {
 			return Release{}, fmt.Errorf(
-				"The requested version: %s - could not be found", version)
+				"release %s was not available for product %s after %s: %s",
+				version,
+				productSlug,
+				timeout.String(),
+				err.Error(),
+			)
 		}
-	}
 
-	return matchingRelease, nil
+		c.logger.Debugf(
+			"Waiting for release: {product_slug: %s, version: %s, poll_interval: %s, reason: %s}\n",
+			productSlug,
+			version,
+			pollInterval.String(),
+			err.Error(),
+		)
+
+		err = backoff.Wait(c.ctx, pollInterval)
+		if err != nil {
+			return Release{}, err
+		}
+	}
 }
 
 func (c client) CreateRelease(config CreateReleaseConfig) (Release, error) {
@@ -56,6 +180,7 @@ func (c client) CreateRelease(config CreateReleaseConfig) (Release, error) {
 			Availability: "Admins Only",
 			Eula: &Eula{
 				Slug: config.EulaSlug,
+				ID:   config.EulaID,
 			},
 			OSSCompliant:    "confirm",
 			ReleaseDate:     config.ReleaseDate,
@@ -63,6 +188,7 @@ func (c client) CreateRelease(config CreateReleaseConfig) (Release, error) {
 			Version:         config.ProductVersion,
 			Description:     config.Description,
 			ReleaseNotesURL: config.ReleaseNotesURL,
+			Controlled:      config.Controlled,
 		},
 	}
 
@@ -110,3 +236,14 @@ func (c client) UpdateRelease(productSlug string, release Release) (Release, err
 
 	return response.Release, nil
 }
+
+func (c client) DeleteRelease(productSlug string, release Release) error {
+	url := fmt.Sprintf("%s/products/%s/releases/%d", c.url, productSlug, release.ID)
+
+	err := c.makeRequest("DELETE", url, http.StatusNoContent, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
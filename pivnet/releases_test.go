@@ -45,6 +45,175 @@ var _ = Describe("PivnetClient - product files", func() {
 		server.Close()
 	})
 
+	Describe("ReleasesForProductSlug", func() {
+		It("returns the releases for the product slug", func() {
+			response := `{"releases": [{"id": 3, "version": "3.2.1"}, {"id": 2, "version": "3.2.0"}]}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+					ghttp.RespondWith(http.StatusOK, response),
+				),
+			)
+
+			releases, err := client.ReleasesForProductSlug("banana")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(releases).To(HaveLen(2))
+			Expect(releases[0].ID).To(Equal(3))
+			Expect(releases[1].Version).To(Equal("3.2.0"))
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+						ghttp.RespondWith(http.StatusTeapot, nil),
+					),
+				)
+
+				_, err := client.ReleasesForProductSlug("banana")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("WaitForRelease", func() {
+		var clock *fakeClock
+
+		BeforeEach(func() {
+			clock = &fakeClock{now: time.Unix(0, 0)}
+
+			newClientConfig.Backoff = pivnet.BackoffConfig{
+				InitialInterval: time.Second,
+				MaxInterval:     4 * time.Second,
+				Multiplier:      2,
+				Clock:           clock,
+			}
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
+		})
+
+		It("returns the release once it is listed", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+					ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 2, "version": "1.0.0"}]}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+					ghttp.RespondWith(http.StatusNotFound, nil),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+					ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 3, "version": "2.0.0"}, {"id": 2, "version": "1.0.0"}]}`),
+				),
+			)
+
+			release, err := client.WaitForRelease("banana", "2.0.0", time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(release.ID).To(Equal(3))
+
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("backs off between polls", func() {
+			server.AllowUnhandledRequests = true
+			server.UnhandledRequestStatusCode = http.StatusOK
+
+			_, err := client.WaitForRelease("banana", "2.0.0", 20*time.Second)
+			Expect(err).To(HaveOccurred())
+
+			Expect(clock.Waits()).To(Equal([]time.Duration{
+				time.Second,
+				2 * time.Second,
+				4 * time.Second,
+				4 * time.Second,
+				4 * time.Second,
+				4 * time.Second,
+			}))
+		})
+
+		Context("when the release is not listed before the timeout", func() {
+			It("returns an error", func() {
+				server.AllowUnhandledRequests = true
+				server.UnhandledRequestStatusCode = http.StatusOK
+
+				_, err := client.WaitForRelease("banana", "2.0.0", 5*time.Second)
+				Expect(err).To(MatchError(HavePrefix(
+					"release 2.0.0 was not available for product banana after 5s")))
+			})
+		})
+
+		Context("when the token is unauthorized", func() {
+			It("returns the error without polling again", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusUnauthorized, `{"status": 401, "message": "invalid token"}`),
+				)
+
+				_, err := client.WaitForRelease("banana", "2.0.0", time.Minute)
+
+				var unauthorized pivnet.ErrUnauthorized
+				Expect(errors.As(err, &unauthorized)).To(BeTrue())
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the requests are rate limited", func() {
+			It("waits for as long as Pivotal Network asks", func() {
+				header := http.Header{}
+				header.Set("Retry-After", "10")
+
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTooManyRequests, nil, header),
+					ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 3, "version": "2.0.0"}]}`),
+				)
+
+				_, err := client.WaitForRelease("banana", "2.0.0", time.Minute)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(clock.Waits()).To(Equal([]time.Duration{10 * time.Second}))
+			})
+		})
+	})
+
+	Describe("ReleasesUpdatedSince", func() {
+		It("returns the releases updated at or after the time", func() {
+			response := `{"releases": [
+				{"id": 3, "version": "3.0.0", "updated_at": "2016-03-01T00:00:00.000Z"},
+				{"id": 2, "version": "2.0.0", "updated_at": "2016-02-01T00:00:00.000Z"},
+				{"id": 1, "version": "1.0.0", "updated_at": "2016-01-01T00:00:00.000Z"}
+			]}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases"),
+					ghttp.RespondWith(http.StatusOK, response),
+				),
+			)
+
+			releases, err := client.ReleasesUpdatedSince("banana", time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			var versions []string
+			for _, r := range releases {
+				versions = append(versions, r.Version)
+			}
+			Expect(versions).To(Equal([]string{"3.0.0", "2.0.0"}))
+		})
+
+		Context("when a release has no valid updated_at", func() {
+			It("includes the release", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 1, "version": "1.0.0"}]}`),
+				)
+
+				releases, err := client.ReleasesUpdatedSince("banana", time.Now())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(releases).To(HaveLen(1))
+			})
+		})
+	})
+
 	Describe("GetRelease", func() {
 		It("returns the release based on the name and version", func() {
 			response := `{"releases": [{"id": 3, "version": "3.2.1", "_links": {"product_files": {"href":"https://banana.org/cookies/download"}}}]}`
@@ -61,6 +230,18 @@ var _ = Describe("PivnetClient - product files", func() {
 			Expect(release.Links.ProductFiles["href"]).To(Equal("https://banana.org/cookies/download"))
 		})
 
+		Context("when the version has surrounding whitespace", func() {
+			It("matches the release regardless", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, `{"releases": [{"id": 3, "version": "3.2.1 "}]}`),
+				)
+
+				release, err := client.GetRelease("banana", "\t3.2.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(release.ID).To(Equal(3))
+			})
+		})
+
 		Context("when the requested version is not available but the request is successful", func() {
 			It("returns an error", func() {
 				response := `{"releases": [{"id": 3, "version": "3.2.1"}]}`
@@ -73,7 +254,10 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.GetRelease("banana", "1.0.0")
-				Expect(err).To(MatchError(errors.New("The requested version: 1.0.0 - could not be found")))
+				Expect(err).To(MatchError("The requested version: 1.0.0 - could not be found"))
+
+				var notFound pivnet.ErrNotFound
+				Expect(errors.As(err, &notFound)).To(BeTrue())
 			})
 		})
 
@@ -87,8 +271,62 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.GetRelease("banana", "1.0.0")
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("ReleaseForID", func() {
+		It("returns the release with the id", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases/3"),
+					ghttp.RespondWith(http.StatusOK, `{"id": 3, "version": "3.2.1"}`),
+				),
+			)
+
+			release, err := client.ReleaseForID("banana", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(release.ID).To(Equal(3))
+			Expect(release.Version).To(Equal("3.2.1"))
+		})
+
+		Context("when the release does not exist", func() {
+			It("returns a not found error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusNotFound, `{"message": "release not found"}`),
+				)
+
+				_, err := client.ReleaseForID("banana", 3)
+
+				var notFound pivnet.ErrNotFound
+				Expect(errors.As(err, &notFound)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("RawRelease", func() {
+		It("returns the release with the id as returned", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/products/banana/releases/3"),
+					ghttp.RespondWith(http.StatusOK, `{"id": 3, "unmodelled": "field"}`),
+				),
+			)
+
+			release, err := client.RawRelease("banana", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(release).To(MatchJSON(`{"id": 3, "unmodelled": "field"}`))
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.RawRelease("banana", 3)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
 			})
 		})
 	})
@@ -285,6 +523,27 @@ var _ = Describe("PivnetClient - product files", func() {
 					})
 				})
 			})
+
+			Context("when the optional controlled field is present", func() {
+				BeforeEach(func() {
+					createReleaseConfig.Controlled = true
+					expectedRequestBody.Release.Controlled = true
+				})
+
+				It("creates the release with the controlled field", func() {
+					server.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", apiPrefix+"/products/"+productSlug+"/releases"),
+							ghttp.VerifyJSONRepresenting(&expectedRequestBody),
+							ghttp.RespondWith(http.StatusCreated, validResponse),
+						),
+					)
+
+					release, err := client.CreateRelease(createReleaseConfig)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(release.Version).To(Equal(productVersion))
+				})
+			})
 		})
 
 		Context("when the server responds with a non-201 status code", func() {
@@ -297,8 +556,7 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.CreateRelease(createReleaseConfig)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 201")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 201"))
 			})
 		})
 	})
@@ -343,8 +601,41 @@ var _ = Describe("PivnetClient - product files", func() {
 				)
 
 				_, err := client.UpdateRelease("banana-slug", release)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 200")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
+			})
+		})
+	})
+
+	Describe("DeleteRelease", func() {
+		It("deletes the release", func() {
+			release := pivnet.Release{ID: 42}
+			deleteURL := fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, "banana-slug", release.ID)
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", deleteURL),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			err := client.DeleteRelease("banana-slug", release)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns the error", func() {
+				release := pivnet.Release{ID: 111}
+				deleteURL := fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, "banana-slug", release.ID)
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("DELETE", deleteURL),
+						ghttp.RespondWith(http.StatusTeapot, nil),
+					),
+				)
+
+				err := client.DeleteRelease("banana-slug", release)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
 			})
 		})
 	})
@@ -1,5 +1,10 @@
 package pivnet
 
+import (
+	"strings"
+	"time"
+)
+
 type Response struct {
 	Releases []Release `json:"releases,omitempty"`
 }
@@ -23,6 +28,54 @@ type Release struct {
 	Links           *Links `json:"_links,omitempty"`
 	Description     string `json:"description,omitempty"`
 	ReleaseNotesURL string `json:"release_notes_url,omitempty"`
+	Controlled      bool   `json:"controlled,omitempty"`
+
+	EndOfSupportDate string `json:"end_of_support_date,omitempty"`
+	UpdatedAt        string `json:"updated_at,omitempty"`
+}
+
+// UpdatedSince returns whether the release was updated at or after the time.
+// A release without a valid updated_at cannot be ruled out, so it counts as
+// updated.
+func (r Release) UpdatedSince(since time.Time) bool {
+	updatedAt, err := time.Parse(time.RFC3339, r.UpdatedAt)
+	if err != nil {
+		return true
+	}
+
+	return !updatedAt.Before(since)
+}
+
+// UpdatedAfter returns whether the release was updated after the time. Unlike
+// UpdatedSince, a release without a valid updated_at counts as not updated.
+func (r Release) UpdatedAfter(t time.Time) bool {
+	updatedAt, err := time.Parse(time.RFC3339, r.UpdatedAt)
+	if err != nil {
+		return false
+	}
+
+	return updatedAt.After(t)
+}
+
+// NewerThan returns whether the release is newer than the other. Release IDs
+// are assigned in creation order, so they are compared first, falling back to
+// updated_at when the IDs are equal or unknown.
+func (r Release) NewerThan(other Release) bool {
+	if r.ID != other.ID && r.ID != 0 && other.ID != 0 {
+		return r.ID > other.ID
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339, r.UpdatedAt)
+	if err != nil {
+		return false
+	}
+
+	otherUpdatedAt, err := time.Parse(time.RFC3339, other.UpdatedAt)
+	if err != nil {
+		return true
+	}
+
+	return updatedAt.After(otherUpdatedAt)
 }
 
 type Eula struct {
@@ -49,6 +102,23 @@ type ProductFile struct {
 	FileVersion  string `json:"file_version,omitempty"`
 	Name         string `json:"name,omitempty"`
 	MD5          string `json:"md5,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Description  string `json:"description,omitempty"`
+	DocsURL      string `json:"docs_url,omitempty"`
+
+	SystemRequirements []string `json:"system_requirements,omitempty"`
+	Platforms          []string `json:"platforms,omitempty"`
+	IncludedFiles      []string `json:"included_files,omitempty"`
+	ReleasedAt         string   `json:"released_at,omitempty"`
+}
+
+// FileName returns the name of the file of the product file, i.e. the last
+// element of its AWS object key. Unlike Name, which is only displayed, it is
+// the name the file was uploaded and is downloaded with.
+func (p ProductFile) FileName() string {
+	parts := strings.Split(p.AWSObjectKey, "/")
+	return parts[len(parts)-1]
 }
 
 type Links struct {
@@ -56,11 +126,19 @@ type Links struct {
 	Download       map[string]string `json:"download,omitempty"`
 	ProductFiles   map[string]string `json:"product_files,omitempty"`
 	EULAAcceptance map[string]string `json:"eula_acceptance,omitempty"`
+	Next           map[string]string `json:"next,omitempty"`
+}
+
+type ProductsResponse struct {
+	Products []Product `json:"products,omitempty"`
+	Links    *Links    `json:"_links,omitempty"`
 }
 
 type Product struct {
-	ID   int    `json:"id,omitempty"`
-	Slug string `json:"slug"`
+	ID      int    `json:"id,omitempty"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name,omitempty"`
+	LogoURL string `json:"logo_url,omitempty"`
 }
 
 type UserGroups struct {
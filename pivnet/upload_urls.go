@@ -0,0 +1,58 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type UploadURLResponse struct {
+	UploadURL UploadURL `json:"upload_url"`
+}
+
+type UploadURL struct {
+	AWSObjectKey string `json:"aws_object_key,omitempty"`
+	URL          string `json:"url,omitempty"`
+	ExpiresAt    string `json:"expires_at,omitempty"`
+}
+
+type createUploadURLBody struct {
+	UploadURL UploadURL `json:"upload_url"`
+}
+
+// CreateUploadURL returns a pre-signed URL to which the contents of the
+// object with the given key can be PUT. The URL expires, after which a new
+// one must be requested.
+func (c client) CreateUploadURL(productSlug string, awsObjectKey string) (UploadURL, error) {
+	if awsObjectKey == "" {
+		return UploadURL{}, fmt.Errorf("AWS object key must not be empty")
+	}
+
+	url := c.url + "/products/" + productSlug + "/product_files/upload_urls"
+
+	body := createUploadURLBody{
+		UploadURL: UploadURL{
+			AWSObjectKey: awsObjectKey,
+		},
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+
+	var response UploadURLResponse
+	err = c.makeRequest(
+		"POST",
+		url,
+		http.StatusCreated,
+		bytes.NewReader(b),
+		&response,
+	)
+	if err != nil {
+		return UploadURL{}, err
+	}
+
+	return response.UploadURL, nil
+}
@@ -0,0 +1,74 @@
+package pivnet_test
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - upload urls", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &logger_fakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("CreateUploadURL", func() {
+		It("requests a pre-signed URL for the object key", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest(
+						"POST",
+						apiPrefix+"/products/banana/product_files/upload_urls",
+					),
+					ghttp.VerifyJSON(`{"upload_url":{"aws_object_key":"product_files/banana/some-file"}}`),
+					ghttp.RespondWith(http.StatusCreated,
+						`{"upload_url":{"url":"https://bucket.example.com/some-file?sig=abc","expires_at":"2016-01-01T00:15:00Z"}}`),
+				),
+			)
+
+			uploadURL, err := client.CreateUploadURL("banana", "product_files/banana/some-file")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(uploadURL.URL).To(Equal("https://bucket.example.com/some-file?sig=abc"))
+			Expect(uploadURL.ExpiresAt).To(Equal("2016-01-01T00:15:00Z"))
+		})
+
+		Context("when the object key is empty", func() {
+			It("returns an error without making a request", func() {
+				_, err := client.CreateUploadURL("banana", "")
+				Expect(err).To(MatchError("AWS object key must not be empty"))
+
+				Expect(len(server.ReceivedRequests())).To(Equal(0))
+			})
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.CreateUploadURL("banana", "some-key")
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 201"))
+			})
+		})
+	})
+})
@@ -47,3 +47,31 @@ func (c client) AddUserGroup(
 
 	return nil
 }
+
+// ReleaseUserGroups returns the user groups the release is available to.
+func (c client) ReleaseUserGroups(productSlug string, releaseID int) ([]UserGroup, error) {
+	url := fmt.Sprintf(
+		"%s/products/%s/releases/%d/user_groups",
+		c.url,
+		productSlug,
+		releaseID,
+	)
+
+	var response UserGroups
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.UserGroups == nil {
+		return []UserGroup{}, nil
+	}
+
+	return response.UserGroups, nil
+}
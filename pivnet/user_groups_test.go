@@ -1,7 +1,6 @@
 package pivnet_test
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 
@@ -88,8 +87,45 @@ var _ = Describe("PivnetClient - user groups", func() {
 				)
 
 				err := client.AddUserGroup(productSlug, releaseID, userGroupID)
-				Expect(err).To(MatchError(errors.New(
-					"Pivnet returned status code: 418 for the request - expected 204")))
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 204"))
+			})
+		})
+	})
+
+	Describe("ReleaseUserGroups", func() {
+		var (
+			productSlug = "banana-slug"
+			releaseID   = 2345
+		)
+
+		Context("when the server responds with a 200 status code", func() {
+			It("returns the user groups of the release", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", fmt.Sprintf(
+							"%s/products/%s/releases/%d/user_groups",
+							apiPrefix,
+							productSlug,
+							releaseID,
+						)),
+						ghttp.RespondWith(http.StatusOK, `{"user_groups":[{"id":3456,"name":"some-group"}]}`),
+					),
+				)
+
+				userGroups, err := client.ReleaseUserGroups(productSlug, releaseID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(userGroups).To(Equal([]pivnet.UserGroup{{ID: 3456, Name: "some-group"}}))
+			})
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusTeapot, nil),
+				)
+
+				_, err := client.ReleaseUserGroups(productSlug, releaseID)
+				Expect(err).To(MatchError("Pivnet returned status code: 418 for the request - expected 200"))
 			})
 		})
 	})
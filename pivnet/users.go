@@ -0,0 +1,51 @@
+package pivnet
+
+import (
+	"net/http"
+	"sync"
+)
+
+type CurrentUserResponse struct {
+	User User `json:"user"`
+}
+
+type User struct {
+	ID    int    `json:"id,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// currentUserCache holds the user the token belongs to, so it is only
+// requested once per client.
+type currentUserCache struct {
+	mutex sync.Mutex
+	user  *User
+}
+
+// CurrentUser returns the user the client's token belongs to. The user is
+// cached after the first successful request.
+func (c client) CurrentUser() (User, error) {
+	c.currentUser.mutex.Lock()
+	defer c.currentUser.mutex.Unlock()
+
+	if c.currentUser.user != nil {
+		return *c.currentUser.user, nil
+	}
+
+	url := c.url + "/users/me"
+
+	var response CurrentUserResponse
+	err := c.makeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+		&response,
+	)
+	if err != nil {
+		return User{}, err
+	}
+
+	c.currentUser.user = &response.User
+
+	return response.User, nil
+}
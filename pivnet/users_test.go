@@ -0,0 +1,74 @@
+package pivnet_test
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+)
+
+var _ = Describe("PivnetClient - users", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		client = pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint:  server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &logger_fakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("CurrentUser", func() {
+		It("returns the user the token belongs to", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", apiPrefix+"/users/me"),
+					ghttp.VerifyHeaderKV("Authorization", "Token my-auth-token"),
+					ghttp.RespondWith(http.StatusOK, `{"user": {"id": 7, "email": "someone@example.com"}}`),
+				),
+			)
+
+			user, err := client.CurrentUser()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user).To(Equal(pivnet.User{ID: 7, Email: "someone@example.com"}))
+		})
+
+		It("only requests the user once", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusOK, `{"user": {"id": 7, "email": "someone@example.com"}}`),
+			)
+
+			_, err := client.CurrentUser()
+			Expect(err).NotTo(HaveOccurred())
+
+			user, err := client.CurrentUser()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user.ID).To(Equal(7))
+
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusUnauthorized, nil),
+				)
+
+				_, err := client.CurrentUser()
+				Expect(err).To(MatchError("Pivnet returned status code: 401 for the request - expected 200"))
+			})
+		})
+	})
+})
@@ -0,0 +1,185 @@
+package presigned
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/sanitizer"
+)
+
+// defaultURLAttempts is how many upload URLs are requested for a file when
+// each one has expired by the time it is used.
+const defaultURLAttempts = 3
+
+type URLCreator interface {
+	CreateUploadURL(productSlug string, awsObjectKey string) (pivnet.UploadURL, error)
+}
+
+type Client interface {
+	Upload(fileGlob string, to string, sourcesDir string) error
+}
+
+type client struct {
+	productSlug string
+	urlAttempts int
+
+	urlCreator URLCreator
+	ctx        context.Context
+
+	httpClient *http.Client
+	logger     logger.Logger
+}
+
+type Config struct {
+	ProductSlug string
+
+	// URLAttempts is how many upload URLs are requested for a file before
+	// the upload fails, when each is rejected as expired with a 403.
+	// Defaults to 3.
+	URLAttempts int
+
+	URLCreator URLCreator
+
+	// TLSConfig is used for connections to the upload URLs. Defaults to the
+	// system TLS config.
+	TLSConfig *tls.Config
+
+	// Context aborts any in-progress upload when it is cancelled. Defaults
+	// to context.Background().
+	Context context.Context
+
+	Logger logger.Logger
+}
+
+func NewClient(config Config) Client {
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	urlAttempts := config.URLAttempts
+	if urlAttempts < 1 {
+		urlAttempts = defaultURLAttempts
+	}
+
+	return &client{
+		productSlug: config.ProductSlug,
+		urlAttempts: urlAttempts,
+
+		urlCreator: config.URLCreator,
+		ctx:        ctx,
+
+		httpClient: newHTTPClient(config.TLSConfig),
+		logger:     config.Logger,
+	}
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return &http.Client{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}
+}
+
+// Upload PUTs the file to a pre-signed URL requested from Pivotal Network
+// for the object key made of the destination and the file name. A 403 is
+// taken to mean the URL expired before it was used, so a new URL is
+// requested and the upload is retried.
+func (c client) Upload(fileGlob string, to string, sourcesDir string) error {
+	path := filepath.Join(sourcesDir, fileGlob)
+	awsObjectKey := to + filepath.Base(fileGlob)
+
+	for attempt := 1; ; attempt++ {
+		c.logger.Debugf(
+			"Requesting upload URL: {product_slug: %s, aws_object_key: %s, attempt: %d}\n",
+			c.productSlug,
+			awsObjectKey,
+			attempt,
+		)
+
+		uploadURL, err := c.urlCreator.CreateUploadURL(c.productSlug, awsObjectKey)
+		if err != nil {
+			return err
+		}
+
+		c.logger.Debugf(
+			"Uploading file: {path: %s, aws_object_key: %s, expires_at: %s}\n",
+			path,
+			awsObjectKey,
+			uploadURL.ExpiresAt,
+		)
+
+		statusCode, err := c.put(path, uploadURL.URL)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case statusCode >= 200 && statusCode < 300:
+			return nil
+		case statusCode == http.StatusForbidden && attempt < c.urlAttempts:
+			c.logger.Debugf(
+				"Upload URL rejected, requesting a new one: {aws_object_key: %s, status_code: %d}\n",
+				awsObjectKey,
+				statusCode,
+			)
+		case statusCode == http.StatusForbidden:
+			return fmt.Errorf(
+				"upload of %s was rejected with status code 403 after %d upload URLs - the URLs may have expired before use",
+				fileGlob,
+				attempt,
+			)
+		default:
+			return fmt.Errorf(
+				"upload of %s returned status code: %d - expected 200",
+				fileGlob,
+				statusCode,
+			)
+		}
+	}
+}
+
+func (c client) put(path string, url string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err // not tested
+	}
+
+	req, err := http.NewRequest("PUT", url, file)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(c.ctx)
+	req.ContentLength = info.Size()
+
+	response, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, sanitizer.URLError(err)
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(ioutil.Discard, response.Body)
+	if err != nil {
+		return 0, err // not tested
+	}
+
+	return response.StatusCode, nil
+}
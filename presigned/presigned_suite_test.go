@@ -0,0 +1,13 @@
+package presigned_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPresigned(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Presigned Suite")
+}
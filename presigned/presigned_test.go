@@ -0,0 +1,171 @@
+package presigned_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/pivnet"
+	"github.com/pivotal-cf-experimental/pivnet-resource/presigned"
+)
+
+var _ = Describe("Presigned", func() {
+	const (
+		uploadURLsPath = "/api/v2/products/some-product/product_files/upload_urls"
+		uploadPath     = "/bucket/product_files/some-prefix/some-file"
+	)
+
+	var (
+		server     *ghttp.Server
+		sourcesDir string
+
+		uploadURLResponse string
+
+		client presigned.Client
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+
+		var err error
+		sourcesDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.Mkdir(filepath.Join(sourcesDir, "files"), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(
+			filepath.Join(sourcesDir, "files", "some-file"),
+			[]byte("some contents"),
+			os.ModePerm,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		uploadURLResponse = `{"upload_url":{"url":"` + server.URL() + uploadPath + `?sig=abc"}}`
+
+		fakeLogger := &logger_fakes.FakeLogger{}
+		pivnetClient := pivnet.NewClient(pivnet.NewClientConfig{
+			Endpoint: server.URL(),
+			Token:    "some-token",
+		}, fakeLogger)
+
+		client = presigned.NewClient(presigned.Config{
+			ProductSlug: "some-product",
+			URLCreator:  pivnetClient,
+			Logger:      fakeLogger,
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+
+		err := os.RemoveAll(sourcesDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("PUTs the file to a URL requested for its object key", func() {
+		server.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", uploadURLsPath),
+				ghttp.VerifyJSON(`{"upload_url":{"aws_object_key":"product_files/some-prefix/some-file"}}`),
+				ghttp.RespondWith(http.StatusCreated, uploadURLResponse),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("PUT", uploadPath, "sig=abc"),
+				func(w http.ResponseWriter, r *http.Request) {
+					Expect(r.Header.Get("Authorization")).To(BeEmpty())
+					Expect(r.ContentLength).To(Equal(int64(len("some contents"))))
+
+					body, err := ioutil.ReadAll(r.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(body)).To(Equal("some contents"))
+				},
+				ghttp.RespondWith(http.StatusOK, ""),
+			),
+		)
+
+		err := client.Upload("files/some-file", "product_files/some-prefix/", sourcesDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(len(server.ReceivedRequests())).To(Equal(2))
+	})
+
+	Context("when the upload URL has expired", func() {
+		BeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusCreated, uploadURLResponse),
+				ghttp.RespondWith(http.StatusForbidden, ""),
+				ghttp.RespondWith(http.StatusCreated, uploadURLResponse),
+				ghttp.CombineHandlers(
+					func(w http.ResponseWriter, r *http.Request) {
+						body, err := ioutil.ReadAll(r.Body)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(body)).To(Equal("some contents"))
+					},
+					ghttp.RespondWith(http.StatusOK, ""),
+				),
+			)
+		})
+
+		It("requests a new URL and uploads the whole file again", func() {
+			err := client.Upload("files/some-file", "product_files/some-prefix/", sourcesDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(len(server.ReceivedRequests())).To(Equal(4))
+		})
+	})
+
+	Context("when every upload URL is rejected", func() {
+		BeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusCreated, uploadURLResponse),
+					ghttp.RespondWith(http.StatusForbidden, ""),
+				)
+			}
+		})
+
+		It("returns an error after the URL attempts", func() {
+			err := client.Upload("files/some-file", "product_files/some-prefix/", sourcesDir)
+			Expect(err).To(MatchError(
+				"upload of files/some-file was rejected with status code 403 after 3 upload URLs - the URLs may have expired before use"))
+
+			Expect(len(server.ReceivedRequests())).To(Equal(6))
+		})
+	})
+
+	Context("when the upload fails with another status code", func() {
+		BeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusCreated, uploadURLResponse),
+				ghttp.RespondWith(http.StatusInternalServerError, ""),
+			)
+		})
+
+		It("returns an error without retrying", func() {
+			err := client.Upload("files/some-file", "product_files/some-prefix/", sourcesDir)
+			Expect(err).To(MatchError("upload of files/some-file returned status code: 500 - expected 200"))
+
+			Expect(len(server.ReceivedRequests())).To(Equal(2))
+		})
+	})
+
+	Context("when Pivotal Network fails to create an upload URL", func() {
+		BeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(http.StatusTeapot, nil),
+			)
+		})
+
+		It("returns the error", func() {
+			err := client.Upload("files/some-file", "product_files/some-prefix/", sourcesDir)
+			Expect(err).To(MatchError(
+				"Pivnet returned status code: 418 for the request - expected 201"))
+		})
+	})
+})
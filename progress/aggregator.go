@@ -0,0 +1,197 @@
+package progress
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/bytesize"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+)
+
+// Aggregator logs the progress of several concurrent transfers as a single
+// status line, so that the progress of each transfer is not interleaved.
+// The completion or failure of each transfer is still logged separately.
+type Aggregator struct {
+	files    int
+	interval time.Duration
+	logger   logger.Logger
+
+	mutex      sync.Mutex
+	transfers  map[string]*transfer
+	completed  int
+	failed     int
+	start      time.Time
+	lastLogged time.Time
+}
+
+type transfer struct {
+	initial     int64
+	transferred int64
+	total       int64
+}
+
+type AggregatorConfig struct {
+	// Files is the number of transfers expected, including those not yet
+	// started.
+	Files int
+
+	// Interval is the minimum time between status lines. A zero interval
+	// disables status lines, but not completion and failure lines.
+	Interval time.Duration
+
+	Logger logger.Logger
+}
+
+func NewAggregator(config AggregatorConfig) *Aggregator {
+	now := time.Now()
+
+	return &Aggregator{
+		files:    config.Files,
+		interval: config.Interval,
+		logger:   config.Logger,
+
+		transfers:  map[string]*transfer{},
+		start:      now,
+		lastLogged: now,
+	}
+}
+
+// Reporter returns a reporter for the transfer with the name, counting the
+// bytes already transferred, e.g. when resuming a partial download. Starting
+// a transfer again with the same name replaces its progress.
+func (a *Aggregator) Reporter(name string, transferred int64, total int64) Reporter {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.transfers[name] = &transfer{
+		initial:     transferred,
+		transferred: transferred,
+		total:       total,
+	}
+
+	return &aggregatedReporter{aggregator: a, name: name}
+}
+
+// Complete logs that the transfer with the name completed.
+func (a *Aggregator) Complete(name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.completed++
+
+	var transferred int64
+	if t, ok := a.transfers[name]; ok {
+		transferred = t.transferred
+	}
+
+	a.logger.Debugf(
+		"Completed: {name: %s, transferred: %s, files: %d/%d}\n",
+		name,
+		bytesize.Format(transferred),
+		a.completed,
+		a.files,
+	)
+}
+
+// Fail logs that the transfer with the name failed.
+func (a *Aggregator) Fail(name string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.failed++
+
+	a.logger.Debugf(
+		"Failed: {name: %s, error: %s, failed: %d, files: %d/%d}\n",
+		name,
+		err.Error(),
+		a.failed,
+		a.completed,
+		a.files,
+	)
+}
+
+func (a *Aggregator) update(name string, transferred func(*transfer) int64, total int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	t, ok := a.transfers[name]
+	if !ok {
+		return
+	}
+
+	t.transferred = transferred(t)
+	if total > 0 {
+		t.total = total
+	}
+
+	if a.interval <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(a.lastLogged) < a.interval {
+		return
+	}
+	a.lastLogged = now
+
+	a.logStatus(now)
+}
+
+// logStatus logs the combined progress of the transfers started so far. The
+// percent only covers started transfers, as totals are not known before.
+func (a *Aggregator) logStatus(now time.Time) {
+	var transferred, newlyTransferred, total int64
+	knownTotals := true
+	for _, t := range a.transfers {
+		transferred += t.transferred
+		newlyTransferred += t.transferred - t.initial
+
+		if t.total <= 0 {
+			knownTotals = false
+		}
+		total += t.total
+	}
+
+	var rate float64
+	elapsed := now.Sub(a.start).Seconds()
+	if elapsed > 0 {
+		rate = float64(newlyTransferred) / elapsed
+	}
+
+	if !knownTotals || total <= 0 {
+		a.logger.Debugf(
+			"Progress: {files: %d/%d, transferred: %s, rate: %s/s}\n",
+			a.completed,
+			a.files,
+			bytesize.Format(transferred),
+			bytesize.Format(int64(rate)),
+		)
+		return
+	}
+
+	a.logger.Debugf(
+		"Progress: {files: %d/%d, transferred: %s, total: %s, percent: %d%%, rate: %s/s}\n",
+		a.completed,
+		a.files,
+		bytesize.Format(transferred),
+		bytesize.Format(total),
+		transferred*100/total,
+		bytesize.Format(int64(rate)),
+	)
+}
+
+type aggregatedReporter struct {
+	aggregator *Aggregator
+	name       string
+}
+
+func (r *aggregatedReporter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	r.aggregator.update(r.name, func(t *transfer) int64 { return t.transferred + n }, 0)
+
+	return len(p), nil
+}
+
+func (r *aggregatedReporter) Update(transferred int64, total int64) {
+	r.aggregator.update(r.name, func(*transfer) int64 { return transferred }, total)
+}
@@ -0,0 +1,92 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	progressPattern = regexp.MustCompile(
+		`([0-9.]+)\s*([KMGT]?i?B)\s*/\s*([0-9.]+)\s*([KMGT]?i?B)`)
+
+	unitMultipliers = map[string]float64{
+		"B":   1,
+		"KB":  1000,
+		"MB":  1000 * 1000,
+		"GB":  1000 * 1000 * 1000,
+		"TB":  1000 * 1000 * 1000 * 1000,
+		"KiB": 1024,
+		"MiB": 1024 * 1024,
+		"GiB": 1024 * 1024 * 1024,
+		"TiB": 1024 * 1024 * 1024 * 1024,
+	}
+)
+
+type outputParser struct {
+	reporter Reporter
+	sink     io.Writer
+	buffer   []byte
+}
+
+// NewOutputParser returns a writer that passes output through to the sink
+// unchanged, and also parses progress lines of the form
+// "1.50 MiB / 10.00 MiB" from it, reporting them to the reporter.
+// Lines may be terminated by either a newline or a carriage return.
+func NewOutputParser(reporter Reporter, sink io.Writer) io.Writer {
+	return &outputParser{
+		reporter: reporter,
+		sink:     sink,
+	}
+}
+
+func (o *outputParser) Write(p []byte) (int, error) {
+	o.buffer = append(o.buffer, p...)
+
+	for {
+		i := bytes.IndexAny(o.buffer, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		o.parseLine(string(o.buffer[:i]))
+		o.buffer = o.buffer[i+1:]
+	}
+
+	return o.sink.Write(p)
+}
+
+func (o *outputParser) parseLine(line string) {
+	matches := progressPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return
+	}
+
+	transferred, ok := parseSize(matches[1], matches[2])
+	if !ok {
+		return
+	}
+
+	total, ok := parseSize(matches[3], matches[4])
+	if !ok {
+		return
+	}
+
+	o.reporter.Update(transferred, total)
+}
+
+func parseSize(value string, unit string) (int64, bool) {
+	multiplier, ok := unitMultipliers[strings.TrimSpace(unit)]
+	if !ok {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return int64(f * multiplier), true
+}
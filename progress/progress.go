@@ -0,0 +1,142 @@
+package progress
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/bytesize"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+)
+
+// Interval returns the interval at which progress should be logged given the
+// configured number of seconds. Zero seconds means the default interval.
+// A disabled interval is returned as zero.
+func Interval(seconds int, disabled bool) time.Duration {
+	if disabled {
+		return 0
+	}
+
+	if seconds <= 0 {
+		return DefaultInterval
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// Reporter logs the progress of a single transfer. Bytes written to it are
+// counted as transferred.
+type Reporter interface {
+	Write(p []byte) (int, error)
+	Update(transferred int64, total int64)
+}
+
+type reporter struct {
+	name     string
+	interval time.Duration
+	logger   logger.Logger
+
+	mutex       sync.Mutex
+	initial     int64
+	transferred int64
+	total       int64
+	start       time.Time
+	lastLogged  time.Time
+}
+
+type Config struct {
+	Name string
+
+	// Transferred is the number of bytes already transferred, e.g. when
+	// resuming a partial download.
+	Transferred int64
+	Total       int64
+
+	// Interval is the minimum time between log lines. A zero interval
+	// disables logging.
+	Interval time.Duration
+
+	Logger logger.Logger
+}
+
+func NewReporter(config Config) Reporter {
+	now := time.Now()
+
+	return &reporter{
+		name:        config.Name,
+		interval:    config.Interval,
+		logger:      config.Logger,
+		initial:     config.Transferred,
+		transferred: config.Transferred,
+		total:       config.Total,
+		start:       now,
+		lastLogged:  now,
+	}
+}
+
+func (r *reporter) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	transferred := r.transferred + int64(len(p))
+	total := r.total
+	r.mutex.Unlock()
+
+	r.Update(transferred, total)
+
+	return len(p), nil
+}
+
+func (r *reporter) Update(transferred int64, total int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.transferred = transferred
+	if total > 0 {
+		r.total = total
+	}
+
+	if r.interval <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(r.lastLogged) < r.interval {
+		return
+	}
+	r.lastLogged = now
+
+	elapsed := now.Sub(r.start).Seconds()
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(r.transferred-r.initial) / elapsed
+	}
+
+	if r.total <= 0 {
+		r.logger.Debugf(
+			"Progress: {name: %s, transferred: %s, rate: %s/s}\n",
+			r.name,
+			bytesize.Format(r.transferred),
+			bytesize.Format(int64(rate)),
+		)
+		return
+	}
+
+	eta := "unknown"
+	if rate > 0 {
+		remaining := float64(r.total-r.transferred) / rate
+		eta = (time.Duration(remaining) * time.Second).String()
+	}
+
+	r.logger.Debugf(
+		"Progress: {name: %s, transferred: %s, total: %s, percent: %d%%, rate: %s/s, eta: %s}\n",
+		r.name,
+		bytesize.Format(r.transferred),
+		bytesize.Format(r.total),
+		r.transferred*100/r.total,
+		bytesize.Format(int64(rate)),
+		eta,
+	)
+}
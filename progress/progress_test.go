@@ -0,0 +1,283 @@
+package progress_test
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	logger_fakes "github.com/pivotal-cf-experimental/pivnet-resource/logger/fakes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/progress"
+)
+
+var _ = Describe("Progress", func() {
+	var (
+		fakeLogger *logger_fakes.FakeLogger
+		config     progress.Config
+	)
+
+	BeforeEach(func() {
+		fakeLogger = &logger_fakes.FakeLogger{}
+
+		config = progress.Config{
+			Name:     "some-file",
+			Total:    2048,
+			Interval: time.Nanosecond,
+			Logger:   fakeLogger,
+		}
+	})
+
+	loggedLine := func(i int) string {
+		format, args := fakeLogger.DebugfArgsForCall(i)
+		return fmt.Sprintf(format, args...)
+	}
+
+	Describe("Interval", func() {
+		It("returns the default interval when no seconds are configured", func() {
+			Expect(progress.Interval(0, false)).To(Equal(progress.DefaultInterval))
+		})
+
+		It("returns the configured interval", func() {
+			Expect(progress.Interval(3, false)).To(Equal(3 * time.Second))
+		})
+
+		It("returns zero when disabled", func() {
+			Expect(progress.Interval(3, true)).To(BeZero())
+		})
+	})
+
+	Describe("Reporter", func() {
+		It("logs bytes transferred, total, percent, rate and eta", func() {
+			reporter := progress.NewReporter(config)
+
+			_, err := reporter.Write(make([]byte, 1024))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLogger.DebugfCallCount()).To(Equal(1))
+
+			line := loggedLine(0)
+			Expect(line).To(ContainSubstring("name: some-file"))
+			Expect(line).To(ContainSubstring("transferred: 1.0 KiB"))
+			Expect(line).To(ContainSubstring("total: 2.0 KiB"))
+			Expect(line).To(ContainSubstring("percent: 50%"))
+			Expect(line).To(ContainSubstring("rate: "))
+			Expect(line).To(ContainSubstring("eta: "))
+		})
+
+		It("includes bytes already transferred", func() {
+			config.Transferred = 1024
+			reporter := progress.NewReporter(config)
+
+			_, err := reporter.Write(make([]byte, 512))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(loggedLine(0)).To(ContainSubstring("transferred: 1.5 KiB"))
+		})
+
+		Context("when the total is not known", func() {
+			BeforeEach(func() {
+				config.Total = 0
+			})
+
+			It("logs bytes transferred and rate only", func() {
+				reporter := progress.NewReporter(config)
+
+				_, err := reporter.Write(make([]byte, 1024))
+				Expect(err).NotTo(HaveOccurred())
+
+				line := loggedLine(0)
+				Expect(line).To(ContainSubstring("transferred: 1.0 KiB"))
+				Expect(line).NotTo(ContainSubstring("percent"))
+			})
+		})
+
+		Context("when the interval has not elapsed", func() {
+			BeforeEach(func() {
+				config.Interval = time.Hour
+			})
+
+			It("does not log", func() {
+				reporter := progress.NewReporter(config)
+
+				_, err := reporter.Write(make([]byte, 1024))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeLogger.DebugfCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the interval is zero", func() {
+			BeforeEach(func() {
+				config.Interval = 0
+			})
+
+			It("does not log", func() {
+				reporter := progress.NewReporter(config)
+
+				_, err := reporter.Write(make([]byte, 1024))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeLogger.DebugfCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Aggregator", func() {
+		var aggregatorConfig progress.AggregatorConfig
+
+		BeforeEach(func() {
+			aggregatorConfig = progress.AggregatorConfig{
+				Files:    3,
+				Interval: time.Nanosecond,
+				Logger:   fakeLogger,
+			}
+		})
+
+		It("logs one status line for all of the transfers", func() {
+			aggregator := progress.NewAggregator(aggregatorConfig)
+
+			first := aggregator.Reporter("first-file", 0, 1024)
+			second := aggregator.Reporter("second-file", 0, 1024)
+
+			_, err := first.Write(make([]byte, 1024))
+			Expect(err).NotTo(HaveOccurred())
+			aggregator.Complete("first-file")
+
+			_, err = second.Write(make([]byte, 256))
+			Expect(err).NotTo(HaveOccurred())
+
+			line := loggedLine(fakeLogger.DebugfCallCount() - 1)
+			Expect(line).To(HavePrefix("Progress: {files: 1/3"))
+			Expect(line).To(ContainSubstring("transferred: 1.2 KiB"))
+			Expect(line).To(ContainSubstring("total: 2.0 KiB"))
+			Expect(line).To(ContainSubstring("percent: 62%"))
+			Expect(line).To(ContainSubstring("rate: "))
+			Expect(line).NotTo(ContainSubstring("first-file"))
+		})
+
+		It("logs the completion and failure of each transfer", func() {
+			aggregator := progress.NewAggregator(aggregatorConfig)
+
+			reporter := aggregator.Reporter("first-file", 0, 1024)
+			reporter.Update(1024, 1024)
+			aggregator.Complete("first-file")
+
+			aggregator.Reporter("second-file", 0, 1024)
+			aggregator.Fail("second-file", fmt.Errorf("some error"))
+
+			Expect(loggedLine(1)).To(Equal(
+				"Completed: {name: first-file, transferred: 1.0 KiB, files: 1/3}\n"))
+			Expect(loggedLine(2)).To(Equal(
+				"Failed: {name: second-file, error: some error, failed: 1, files: 1/3}\n"))
+		})
+
+		It("is safe to use from concurrent transfers", func() {
+			aggregator := progress.NewAggregator(aggregatorConfig)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				reporter := aggregator.Reporter(fmt.Sprintf("file-%d", i), 0, 100*1024)
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+
+					for j := 0; j < 100; j++ {
+						_, err := reporter.Write(make([]byte, 1024))
+						Expect(err).NotTo(HaveOccurred())
+					}
+				}()
+			}
+			wg.Wait()
+
+			Expect(loggedLine(fakeLogger.DebugfCallCount() - 1)).To(ContainSubstring("percent: 100%"))
+		})
+
+		Context("when a total is not known", func() {
+			It("logs bytes transferred and rate only", func() {
+				aggregator := progress.NewAggregator(aggregatorConfig)
+
+				_, err := aggregator.Reporter("some-file", 0, 0).Write(make([]byte, 1024))
+				Expect(err).NotTo(HaveOccurred())
+
+				line := loggedLine(0)
+				Expect(line).To(ContainSubstring("transferred: 1.0 KiB"))
+				Expect(line).NotTo(ContainSubstring("percent"))
+			})
+		})
+
+		Context("when the interval is zero", func() {
+			BeforeEach(func() {
+				aggregatorConfig.Interval = 0
+			})
+
+			It("only logs completion lines", func() {
+				aggregator := progress.NewAggregator(aggregatorConfig)
+
+				_, err := aggregator.Reporter("some-file", 0, 1024).Write(make([]byte, 1024))
+				Expect(err).NotTo(HaveOccurred())
+				aggregator.Complete("some-file")
+
+				Expect(fakeLogger.DebugfCallCount()).To(Equal(1))
+				Expect(loggedLine(0)).To(HavePrefix("Completed: {name: some-file"))
+			})
+		})
+	})
+
+	Describe("OutputParser", func() {
+		var (
+			sink *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			sink = &bytes.Buffer{}
+		})
+
+		It("passes output through to the sink", func() {
+			parser := progress.NewOutputParser(progress.NewReporter(config), sink)
+
+			_, err := parser.Write([]byte("some output\n"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sink.String()).To(Equal("some output\n"))
+		})
+
+		It("reports progress parsed from carriage-return terminated lines", func() {
+			parser := progress.NewOutputParser(progress.NewReporter(config), sink)
+
+			_, err := parser.Write([]byte(" 1.00 MiB / 4.00 MiB [===>------]  25.00 %\r"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLogger.DebugfCallCount()).To(Equal(1))
+
+			line := loggedLine(0)
+			Expect(line).To(ContainSubstring("transferred: 1.0 MiB"))
+			Expect(line).To(ContainSubstring("total: 4.0 MiB"))
+			Expect(line).To(ContainSubstring("percent: 25%"))
+		})
+
+		It("waits for a line to be terminated before parsing it", func() {
+			parser := progress.NewOutputParser(progress.NewReporter(config), sink)
+
+			_, err := parser.Write([]byte(" 1.00 MiB / 4.0"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeLogger.DebugfCallCount()).To(Equal(0))
+
+			_, err = parser.Write([]byte("0 MiB\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeLogger.DebugfCallCount()).To(Equal(1))
+		})
+
+		It("ignores lines without progress", func() {
+			parser := progress.NewOutputParser(progress.NewReporter(config), sink)
+
+			_, err := parser.Write([]byte("uploading things\n"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLogger.DebugfCallCount()).To(Equal(0))
+		})
+	})
+})
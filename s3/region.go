@@ -0,0 +1,18 @@
+package s3
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// regionRegexp matches AWS region names, e.g. eu-west-1 or us-gov-east-1.
+var regionRegexp = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// ValidateRegion returns an error unless the region is an AWS region name.
+func ValidateRegion(region string) error {
+	if !regionRegexp.MatchString(region) {
+		return fmt.Errorf("%s is not a valid AWS region, e.g. eu-west-1", region)
+	}
+
+	return nil
+}
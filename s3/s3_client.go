@@ -1,14 +1,40 @@
 package s3
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/progress"
 )
 
+// fatalErrorCodes are S3 error codes that retrying an upload cannot fix.
+var fatalErrorCodes = []string{
+	"AccessDenied",
+	"InvalidAccessKeyId",
+	"SignatureDoesNotMatch",
+	"NoSuchBucket",
+	expiredTokenCode,
+}
+
+// expiredTokenCode is the S3 error code of a request signed with a session
+// token that has expired.
+const expiredTokenCode = "ExpiredToken"
+
+// Credentials are the AWS credentials that s3-out uploads with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
 type Client interface {
 	Upload(fileGlob string, to string, sourcesDir string) error
 }
@@ -16,9 +42,28 @@ type Client interface {
 type client struct {
 	accessKeyID     string
 	secretAccessKey string
+	sessionToken    string
 	regionName      string
 	bucket          string
 
+	uploadConcurrency  int
+	multipartChunkSize int64
+
+	serverSideEncryption string
+	sseKMSKeyID          string
+
+	caBundlePath        string
+	skipSSLVerification bool
+
+	progressInterval time.Duration
+
+	uploadAttempts int
+	retryDelay     time.Duration
+
+	refreshCredentials func() (Credentials, error)
+
+	ctx context.Context
+
 	logger logger.Logger
 
 	stdout io.Writer
@@ -30,9 +75,37 @@ type client struct {
 type NewClientConfig struct {
 	AccessKeyID     string
 	SecretAccessKey string
+	SessionToken    string
 	RegionName      string
 	Bucket          string
 
+	UploadConcurrency  int
+	MultipartChunkSize int64
+
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+
+	// CABundlePath is the path of a file of PEM encoded CA certificates that
+	// s3-out trusts in addition to the system CAs.
+	CABundlePath        string
+	SkipSSLVerification bool
+
+	ProgressInterval time.Duration
+
+	// UploadAttempts is how many times s3-out is run before the upload fails,
+	// unless its output shows a fatal error. Defaults to 1.
+	UploadAttempts int
+	RetryDelay     time.Duration
+
+	// RefreshCredentials, if set, is called for new credentials when s3-out
+	// fails because the session token has expired. The upload is then
+	// retried with them without using up an attempt.
+	RefreshCredentials func() (Credentials, error)
+
+	// Context kills the s3-out process when it is cancelled. Defaults to
+	// context.Background().
+	Context context.Context
+
 	Logger logger.Logger
 
 	Stdout io.Writer
@@ -42,15 +115,44 @@ type NewClientConfig struct {
 }
 
 func NewClient(config NewClientConfig) Client {
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	uploadAttempts := config.UploadAttempts
+	if uploadAttempts < 1 {
+		uploadAttempts = 1
+	}
+
 	return &client{
 		accessKeyID:     config.AccessKeyID,
 		secretAccessKey: config.SecretAccessKey,
+		sessionToken:    config.SessionToken,
 		regionName:      config.RegionName,
 		bucket:          config.Bucket,
 		stdout:          config.Stdout,
 		stderr:          config.Stderr,
 		outBinaryPath:   config.OutBinaryPath,
 		logger:          config.Logger,
+
+		uploadConcurrency:  config.UploadConcurrency,
+		multipartChunkSize: config.MultipartChunkSize,
+
+		serverSideEncryption: config.ServerSideEncryption,
+		sseKMSKeyID:          config.SSEKMSKeyID,
+
+		caBundlePath:        config.CABundlePath,
+		skipSSLVerification: config.SkipSSLVerification,
+
+		progressInterval: config.ProgressInterval,
+
+		uploadAttempts: uploadAttempts,
+		retryDelay:     config.RetryDelay,
+
+		refreshCredentials: config.RefreshCredentials,
+
+		ctx: ctx,
 	}
 }
 
@@ -59,12 +161,21 @@ func (c client) Upload(fileGlob string, to string, sourcesDir string) error {
 		Source: Source{
 			AccessKeyID:     c.accessKeyID,
 			SecretAccessKey: c.secretAccessKey,
+			SessionToken:    c.sessionToken,
 			Bucket:          c.bucket,
 			RegionName:      c.regionName,
+
+			CABundle:            c.caBundlePath,
+			SkipSSLVerification: c.skipSSLVerification,
 		},
 		Params: Params{
-			File: fileGlob,
-			To:   to,
+			File:               fileGlob,
+			To:                 to,
+			Concurrency:        c.uploadConcurrency,
+			MultipartChunkSize: c.multipartChunkSize,
+
+			ServerSideEncryption: c.serverSideEncryption,
+			SSEKMSKeyID:          c.sseKMSKeyID,
 		},
 	}
 
@@ -74,30 +185,143 @@ func (c client) Upload(fileGlob string, to string, sourcesDir string) error {
 		sourcesDir,
 	)
 
-	cmd := exec.Command(c.outBinaryPath, sourcesDir)
+	var err error
+	var refreshed bool
+	for attempt := 1; attempt <= c.uploadAttempts; attempt++ {
+		var output string
+		output, err = c.runS3Out(s3Input, fileGlob, sourcesDir)
+		if err == nil {
+			return nil
+		}
+
+		if c.ctx.Err() != nil {
+			return err
+		}
+
+		// Only refresh once in a row, so that credentials which are expired
+		// as soon as they are issued do not retry forever.
+		expired := strings.Contains(output, expiredTokenCode)
+		if expired && c.refreshCredentials != nil && !refreshed {
+			c.logger.Debugf("Session token expired while uploading %s - refreshing credentials\n", fileGlob)
+
+			credentials, refreshErr := c.refreshCredentials()
+			if refreshErr != nil {
+				return fmt.Errorf("failed to refresh credentials: %s", refreshErr.Error())
+			}
+
+			s3Input.Source.AccessKeyID = credentials.AccessKeyID
+			s3Input.Source.SecretAccessKey = credentials.SecretAccessKey
+			s3Input.Source.SessionToken = credentials.SessionToken
+
+			refreshed = true
+			attempt--
+			continue
+		}
+		refreshed = false
+
+		if code := fatalErrorCode(output); code != "" {
+			c.logger.Debugf(
+				"Not retrying upload of %s after fatal error: %s - output: %s\n",
+				fileGlob,
+				code,
+				output,
+			)
+			return fmt.Errorf("%s - %s", err.Error(), code)
+		}
+
+		if attempt == c.uploadAttempts {
+			break
+		}
+
+		c.logger.Debugf(
+			"Upload of %s failed on attempt %d of %d - retrying in %s: %s - output: %s\n",
+			fileGlob,
+			attempt,
+			c.uploadAttempts,
+			c.retryDelay.String(),
+			err.Error(),
+			output,
+		)
+
+		select {
+		case <-time.After(c.retryDelay):
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// runS3Out runs s3-out once, returning its combined output so that failures
+// can be classified.
+func (c client) runS3Out(s3Input Request, fileGlob string, sourcesDir string) (string, error) {
+	cmd := exec.CommandContext(c.ctx, c.outBinaryPath, sourcesDir)
 
 	cmdIn, err := cmd.StdinPipe()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	cmd.Stdout = c.stderr
-	cmd.Stderr = c.stderr
+	reporter := progress.NewReporter(progress.Config{
+		Name:     fileGlob,
+		Interval: c.progressInterval,
+		Logger:   c.logger,
+	})
+
+	output := &syncBuffer{}
+	cmd.Stdout = io.MultiWriter(c.stderr, output)
+	cmd.Stderr = progress.NewOutputParser(reporter, io.MultiWriter(c.stderr, output))
 
 	err = cmd.Start()
 	if err != nil {
-		return fmt.Errorf("Error starting %s: %s", c.outBinaryPath, err.Error())
+		return "", fmt.Errorf("Error starting %s: %s", c.outBinaryPath, err.Error())
 	}
 
-	err = json.NewEncoder(cmdIn).Encode(s3Input)
-	if err != nil {
-		return err
-	}
+	encodeErr := json.NewEncoder(cmdIn).Encode(s3Input)
+	cmdIn.Close()
 
 	err = cmd.Wait()
 	if err != nil {
-		return fmt.Errorf("Error running %s: %s", c.outBinaryPath, err.Error())
+		return output.String(), fmt.Errorf("Error running %s: %s", c.outBinaryPath, err.Error())
+	}
+
+	if encodeErr != nil {
+		return output.String(), encodeErr
+	}
+
+	return output.String(), nil
+}
+
+// syncBuffer is a buffer that is safe to write to from both of the output
+// streams of a command at once.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.String()
+}
+
+// fatalErrorCode returns the first of fatalErrorCodes found in the output, or
+// an empty string if there is none.
+func fatalErrorCode(output string) string {
+	for _, code := range fatalErrorCodes {
+		if strings.Contains(output, code) {
+			return code
+		}
 	}
 
-	return nil
+	return ""
 }
@@ -6,14 +6,23 @@ type Request struct {
 }
 
 type Params struct {
-	File string `json:"file"`
-	To   string `json:"to"`
+	File               string `json:"file"`
+	To                 string `json:"to"`
+	Concurrency        int    `json:"concurrency,omitempty"`
+	MultipartChunkSize int64  `json:"multipart_chunk_size,omitempty"`
+
+	ServerSideEncryption string `json:"server_side_encryption,omitempty"`
+	SSEKMSKeyID          string `json:"sse_kms_key_id,omitempty"`
 }
 
 type Source struct {
 	AccessKeyID     string `json:"access_key_id"`
 	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
 	Bucket          string `json:"bucket"`
 	RegionName      string `json:"region_name"`
 	Regexp          string `json:"regexp"`
+
+	CABundle            string `json:"ca_bundle,omitempty"`
+	SkipSSLVerification bool   `json:"skip_ssl_verification,omitempty"`
 }
@@ -3,30 +3,86 @@ package sanitizer
 import (
 	"io"
 	"strings"
+	"sync"
 )
 
 type Sanitizer interface {
 	io.Writer
+
+	// Add redacts a secret that is only known once the command is running,
+	// e.g. temporary credentials issued by Pivotal Network.
+	Add(secret string, replacement string)
+
+	// WithSink returns a sanitizer that writes to the sink, redacting the
+	// same secrets, including those added to either of them later.
+	WithSink(sink io.Writer) Sanitizer
 }
 
 type sanitizer struct {
-	sanitized map[string]string
-	sink      io.Writer
+	mutex          *sync.RWMutex
+	sanitized      map[string]string
+	sink           io.Writer
+	preserveLength bool
 }
 
-func NewSanitizer(sanitized map[string]string, sink io.Writer) Sanitizer {
-	return &sanitizer{
+// Option configures a sanitizer.
+type Option func(*sanitizer)
+
+// PreserveLength replaces each secret with a mask of * of the same length
+// instead of its named placeholder, so that redaction does not change the
+// length of log lines.
+func PreserveLength() Option {
+	return func(s *sanitizer) {
+		s.preserveLength = true
+	}
+}
+
+func NewSanitizer(sanitized map[string]string, sink io.Writer, options ...Option) Sanitizer {
+	s := &sanitizer{
+		mutex:     &sync.RWMutex{},
 		sanitized: sanitized,
 		sink:      sink,
 	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+func (s *sanitizer) Add(secret string, replacement string) {
+	if secret == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sanitized[secret] = replacement
+}
+
+func (s *sanitizer) WithSink(sink io.Writer) Sanitizer {
+	return &sanitizer{
+		mutex:          s.mutex,
+		sanitized:      s.sanitized,
+		sink:           sink,
+		preserveLength: s.preserveLength,
+	}
 }
 
-func (s sanitizer) Write(p []byte) (n int, err error) {
+func (s *sanitizer) Write(p []byte) (n int, err error) {
 	input := string(p)
 
+	s.mutex.RLock()
 	for k, v := range s.sanitized {
+		if s.preserveLength {
+			v = strings.Repeat("*", len(k))
+		}
+
 		input = strings.Replace(input, k, v, -1)
 	}
+	s.mutex.RUnlock()
 
 	scrubbed := []byte(input)
 
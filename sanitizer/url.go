@@ -0,0 +1,35 @@
+package sanitizer
+
+import (
+	"errors"
+	"net/url"
+)
+
+// URL returns the URL without its query string, fragment or user info, which
+// may carry credentials such as the signature of a pre-signed URL, so that it
+// can be logged. A URL that cannot be parsed is replaced entirely.
+func URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "***REDACTED-URL***"
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String()
+}
+
+// URLError strips the URL of a *url.Error, as returned by an http.Client,
+// with URL. Any other error is returned unchanged.
+func URLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = URL(urlErr.URL)
+	}
+
+	return err
+}
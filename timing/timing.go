@@ -0,0 +1,42 @@
+package timing
+
+import (
+	"time"
+
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+)
+
+// Timer logs how long the phases of a command take, as structured lines, if
+// it is enabled. The zero Timer is disabled.
+type Timer struct {
+	logger  logger.Logger
+	enabled bool
+}
+
+// NewTimer returns a timer that logs through the logger at the info level if
+// it is enabled.
+func NewTimer(l logger.Logger, enabled bool) Timer {
+	return Timer{
+		logger:  l,
+		enabled: enabled,
+	}
+}
+
+// Start starts timing the phase, e.g. api, download, hash or upload, and
+// returns a function that logs its duration when called. The name tells
+// apart the timings of the same phase, e.g. by the file.
+func (t Timer) Start(phase string, name string) func() {
+	if !t.enabled {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		t.logger.Infof(
+			"Timing: {phase: %s, name: %s, duration_ms: %d}\n",
+			phase,
+			name,
+			time.Since(start).Milliseconds(),
+		)
+	}
+}
@@ -0,0 +1,57 @@
+package timing_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
+	"github.com/pivotal-cf-experimental/pivnet-resource/timing"
+)
+
+var _ = Describe("Timer", func() {
+	var sink *gbytes.Buffer
+
+	BeforeEach(func() {
+		sink = gbytes.NewBuffer()
+	})
+
+	It("logs the phase, name and duration when the phase is stopped", func() {
+		timer := timing.NewTimer(logger.NewLogger(sink), true)
+
+		stop := timer.Start("download", "some-file.zip")
+		Expect(sink.Contents()).To(BeEmpty())
+
+		time.Sleep(10 * time.Millisecond)
+		stop()
+
+		Expect(sink).To(gbytes.Say(`Timing: \{phase: download, name: some-file.zip, duration_ms: \d+\}\n`))
+	})
+
+	It("logs at the info level", func() {
+		timer := timing.NewTimer(logger.NewLevelLogger(sink, logger.LevelWarn), true)
+
+		timer.Start("download", "some-file.zip")()
+
+		Expect(sink.Contents()).To(BeEmpty())
+	})
+
+	Context("when it is not enabled", func() {
+		It("logs nothing", func() {
+			timer := timing.NewTimer(logger.NewLogger(sink), false)
+
+			timer.Start("download", "some-file.zip")()
+
+			Expect(sink.Contents()).To(BeEmpty())
+		})
+	})
+
+	Context("when it is the zero timer", func() {
+		It("logs nothing", func() {
+			var timer timing.Timer
+
+			timer.Start("download", "some-file.zip")()
+		})
+	})
+})
@@ -0,0 +1,41 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// New returns the TLS config for connecting to endpoints whose certificates
+// are signed by the PEM encoded CA certificates, in addition to the system
+// CAs. Certificate verification is only skipped if explicitly requested. If
+// neither is provided it returns nil, so that clients use their defaults.
+func New(caCert string, skipVerify bool) (*tls.Config, error) {
+	if caCert == "" && !skipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+
+	if caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			// Untested because the system pool is only unavailable on some
+			// platforms.
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf(
+				"%s must contain at least one PEM encoded certificate",
+				"ca_cert",
+			)
+		}
+
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
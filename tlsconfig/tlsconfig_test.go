@@ -0,0 +1,73 @@
+package tlsconfig_test
+
+import (
+	"encoding/pem"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf-experimental/pivnet-resource/tlsconfig"
+)
+
+var _ = Describe("TLSConfig", func() {
+	var (
+		server *ghttp.Server
+		caCert string
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewTLSServer()
+		server.AppendHandlers(ghttp.RespondWith(http.StatusOK, nil))
+
+		caCert = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: server.HTTPTestServer.Certificate().Raw,
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("trusts endpoints signed by the CA certificate", func() {
+		config, err := tlsconfig.New(caCert, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		response, err := client.Get(server.URL())
+		Expect(err).NotTo(HaveOccurred())
+		response.Body.Close()
+
+		Expect(config.InsecureSkipVerify).To(BeFalse())
+	})
+
+	It("does not trust endpoints signed by other CAs", func() {
+		client := &http.Client{}
+		_, err := client.Get(server.URL())
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when neither a CA certificate nor skipping verification is provided", func() {
+		It("returns nil", func() {
+			config, err := tlsconfig.New("", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(BeNil())
+		})
+	})
+
+	Context("when skipping verification is explicitly requested", func() {
+		It("skips verification", func() {
+			config, err := tlsconfig.New("", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.InsecureSkipVerify).To(BeTrue())
+		})
+	})
+
+	Context("when the CA certificate is not PEM encoded", func() {
+		It("returns an error", func() {
+			_, err := tlsconfig.New("not a certificate", false)
+			Expect(err).To(MatchError("ca_cert must contain at least one PEM encoded certificate"))
+		})
+	})
+})
@@ -3,17 +3,21 @@ package uploader
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/pivotal-cf-experimental/pivnet-resource/logger"
 )
 
 type Client interface {
 	ExactGlobs() ([]string, error)
+	Phases(exactGlobs []string) ([][]string, error)
 	UploadFile(string) (string, error)
 }
 
 type client struct {
 	fileGlob       string
+	excludeGlobs   []string
+	fileOrder      []string
 	filepathPrefix string
 	sourcesDir     string
 
@@ -23,6 +27,8 @@ type client struct {
 
 type Config struct {
 	FileGlob       string
+	ExcludeGlobs   []string
+	FileOrder      []string
 	FilepathPrefix string
 	SourcesDir     string
 
@@ -33,6 +39,8 @@ type Config struct {
 func NewClient(config Config) Client {
 	return &client{
 		fileGlob:       config.FileGlob,
+		excludeGlobs:   config.ExcludeGlobs,
+		fileOrder:      config.FileOrder,
 		filepathPrefix: config.FilepathPrefix,
 		sourcesDir:     config.SourcesDir,
 
@@ -77,12 +85,150 @@ func (c client) ExactGlobs() ([]string, error) {
 			match,
 		)
 
+		excluded, err := c.excluded(exactGlob)
+		if err != nil {
+			return nil, err
+		}
+
+		if excluded {
+			c.logger.Debugf("Excluding file: %s\n", exactGlob)
+			continue
+		}
+
 		exactGlobs = append(exactGlobs, exactGlob)
 	}
 
+	if len(exactGlobs) == 0 {
+		return nil, fmt.Errorf(
+			"no matches remain for pattern: %s after applying exclude globs: %v",
+			c.fileGlob,
+			c.excludeGlobs,
+		)
+	}
+
+	exactGlobs, err = c.ordered(exactGlobs)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Debugf("Files to upload: %v\n", exactGlobs)
+
 	return exactGlobs, nil
 }
 
+// excluded returns true if any of the exclude globs matches either the
+// path relative to the sources directory or the file name.
+func (c client) excluded(exactGlob string) (bool, error) {
+	for _, pattern := range c.excludeGlobs {
+		matched, err := match(pattern, exactGlob)
+		if err != nil {
+			return false, err
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ordered sorts the exact globs by the first file order glob each one
+// matches. Files matching no file order glob come last, and files matching
+// the same glob keep their glob-match order.
+func (c client) ordered(exactGlobs []string) ([]string, error) {
+	if len(c.fileOrder) == 0 {
+		return exactGlobs, nil
+	}
+
+	ranked := make(byRank, len(exactGlobs))
+	for i, exactGlob := range exactGlobs {
+		rank, err := c.rank(exactGlob)
+		if err != nil {
+			return nil, err
+		}
+
+		ranked[i] = rankedGlob{exactGlob: exactGlob, rank: rank}
+	}
+
+	sort.Stable(ranked)
+
+	orderedGlobs := make([]string, len(ranked))
+	for i, r := range ranked {
+		orderedGlobs[i] = r.exactGlob
+	}
+
+	return orderedGlobs, nil
+}
+
+// Phases splits the exact globs, in the order given, into runs of files that
+// match the same file order glob. Files within a phase do not depend on each
+// other's order, so they may be uploaded concurrently, while each phase must
+// complete before the next starts. Without a file order every file is in the
+// same phase.
+func (c client) Phases(exactGlobs []string) ([][]string, error) {
+	var phases [][]string
+	previousRank := -1
+	for _, exactGlob := range exactGlobs {
+		rank, err := c.rank(exactGlob)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(phases) == 0 || rank != previousRank {
+			phases = append(phases, nil)
+		}
+
+		phases[len(phases)-1] = append(phases[len(phases)-1], exactGlob)
+		previousRank = rank
+	}
+
+	return phases, nil
+}
+
+// rank returns the index of the first file order glob the exact glob
+// matches, or the number of file order globs if it matches none.
+func (c client) rank(exactGlob string) (int, error) {
+	for rank, pattern := range c.fileOrder {
+		matched, err := match(pattern, exactGlob)
+		if err != nil {
+			return 0, err
+		}
+
+		if matched {
+			return rank, nil
+		}
+	}
+
+	return len(c.fileOrder), nil
+}
+
+func match(pattern string, exactGlob string) (bool, error) {
+	for _, name := range []string{exactGlob, filepath.Base(exactGlob)} {
+		matched, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, err
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type rankedGlob struct {
+	exactGlob string
+	rank      int
+}
+
+type byRank []rankedGlob
+
+func (r byRank) Len() int           { return len(r) }
+func (r byRank) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byRank) Less(i, j int) bool { return r[i].rank < r[j].rank }
+
 func (c client) UploadFile(exactGlob string) (string, error) {
 	if exactGlob == "" {
 		return "", fmt.Errorf("glob must not be empty")
@@ -89,6 +89,142 @@ var _ = Describe("Uploader", func() {
 				Expect(filenamePaths[1]).To(Equal("my_files/file-1"))
 			})
 		})
+
+		Context("when exclude globs are provided", func() {
+			BeforeEach(func() {
+				_, err := os.Create(filepath.Join(myFilesDir, "file-1"))
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Create(filepath.Join(myFilesDir, "scratch.tmp"))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes files matching the exclude globs by file name", func() {
+				uploaderConfig.ExcludeGlobs = []string{"*.tmp"}
+				uploaderClient = uploader.NewClient(uploaderConfig)
+
+				filenamePaths, err := uploaderClient.ExactGlobs()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filenamePaths).To(Equal([]string{"my_files/file-0", "my_files/file-1"}))
+			})
+
+			It("removes files matching the exclude globs by relative path", func() {
+				uploaderConfig.ExcludeGlobs = []string{"my_files/file-1"}
+				uploaderClient = uploader.NewClient(uploaderConfig)
+
+				filenamePaths, err := uploaderClient.ExactGlobs()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filenamePaths).To(Equal([]string{"my_files/file-0", "my_files/scratch.tmp"}))
+			})
+
+			Context("when the exclude globs remove every file", func() {
+				BeforeEach(func() {
+					uploaderConfig.ExcludeGlobs = []string{"*"}
+					uploaderClient = uploader.NewClient(uploaderConfig)
+				})
+
+				It("returns an error", func() {
+					_, err := uploaderClient.ExactGlobs()
+					Expect(err).To(HaveOccurred())
+
+					Expect(err.Error()).To(ContainSubstring("no matches remain"))
+				})
+			})
+
+			Context("when an exclude glob is malformed", func() {
+				BeforeEach(func() {
+					uploaderConfig.ExcludeGlobs = []string{"["}
+					uploaderClient = uploader.NewClient(uploaderConfig)
+				})
+
+				It("returns an error", func() {
+					_, err := uploaderClient.ExactGlobs()
+					Expect(err).To(MatchError("syntax error in pattern"))
+				})
+			})
+		})
+
+		Context("when a file order is provided", func() {
+			BeforeEach(func() {
+				for _, name := range []string{"file-1", "my.pivotal", "notes.txt"} {
+					_, err := os.Create(filepath.Join(myFilesDir, name))
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+
+			It("orders files by the first file order glob they match", func() {
+				uploaderConfig.FileOrder = []string{"*.pivotal", "my_files/file-1"}
+				uploaderClient = uploader.NewClient(uploaderConfig)
+
+				filenamePaths, err := uploaderClient.ExactGlobs()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filenamePaths).To(Equal([]string{
+					"my_files/my.pivotal",
+					"my_files/file-1",
+					"my_files/file-0",
+					"my_files/notes.txt",
+				}))
+			})
+
+			Context("when a file order glob is malformed", func() {
+				BeforeEach(func() {
+					uploaderConfig.FileOrder = []string{"["}
+					uploaderClient = uploader.NewClient(uploaderConfig)
+				})
+
+				It("returns an error", func() {
+					_, err := uploaderClient.ExactGlobs()
+					Expect(err).To(MatchError("syntax error in pattern"))
+				})
+			})
+		})
+	})
+
+	Describe("Phases", func() {
+		exactGlobs := []string{
+			"my_files/my.pivotal",
+			"my_files/file-1",
+			"my_files/file-0",
+			"my_files/notes.txt",
+		}
+
+		It("puts every file in one phase without a file order", func() {
+			uploaderClient := uploader.NewClient(uploader.Config{})
+
+			phases, err := uploaderClient.Phases(exactGlobs)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(phases).To(Equal([][]string{exactGlobs}))
+		})
+
+		It("splits the files by the file order glob they match", func() {
+			uploaderClient := uploader.NewClient(uploader.Config{
+				FileOrder: []string{"*.pivotal", "my_files/file-1"},
+			})
+
+			phases, err := uploaderClient.Phases(exactGlobs)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(phases).To(Equal([][]string{
+				{"my_files/my.pivotal"},
+				{"my_files/file-1"},
+				{"my_files/file-0", "my_files/notes.txt"},
+			}))
+		})
+
+		Context("when a file order glob is malformed", func() {
+			It("returns an error", func() {
+				uploaderClient := uploader.NewClient(uploader.Config{
+					FileOrder: []string{"["},
+				})
+
+				_, err := uploaderClient.Phases(exactGlobs)
+				Expect(err).To(MatchError("syntax error in pattern"))
+			})
+		})
 	})
 
 	Describe("UploadFile", func() {
@@ -0,0 +1,186 @@
+package versions
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var semverRegexp = regexp.MustCompile(
+	`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`,
+)
+
+type semver struct {
+	numbers    [3]int
+	preRelease []string
+	build      []string
+}
+
+func parseSemver(version string) (semver, bool) {
+	matches := semverRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return semver{}, false
+	}
+
+	var s semver
+	for i := 0; i < 3; i++ {
+		if matches[i+1] != "" {
+			n, err := strconv.Atoi(matches[i+1])
+			if err != nil {
+				// Only reachable for numbers too large for an int.
+				return semver{}, false
+			}
+			s.numbers[i] = n
+		}
+	}
+
+	if matches[4] != "" {
+		s.preRelease = strings.Split(matches[4], ".")
+	}
+
+	if matches[5] != "" {
+		s.build = strings.Split(matches[5], ".")
+	}
+
+	return s, true
+}
+
+// CompareSemver returns -1, 0 or 1 if a is lower than, equal to or higher
+// than b. Versions are compared by semver precedence: numeric identifiers
+// are compared numerically, so 1.2.3-build.9 is lower than 1.2.3-build.10,
+// and a version with a pre-release is lower than the same version without.
+// Missing minor and patch numbers are treated as 0.
+//
+// Build metadata, which semver ignores, breaks ties in the same way as
+// pre-release identifiers, so that ordering is stable. Versions that are not
+// semver are lower than any that are, and compare lexically with each other.
+func CompareSemver(a string, b string) int {
+	sa, aOK := parseSemver(a)
+	sb, bOK := parseSemver(b)
+
+	switch {
+	case !aOK && !bOK:
+		return strings.Compare(a, b)
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	}
+
+	for i := 0; i < 3; i++ {
+		if c := compareInts(sa.numbers[i], sb.numbers[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A version without a pre-release is higher than one with.
+	switch {
+	case len(sa.preRelease) == 0 && len(sb.preRelease) > 0:
+		return 1
+	case len(sa.preRelease) > 0 && len(sb.preRelease) == 0:
+		return -1
+	}
+
+	if c := compareIdentifiers(sa.preRelease, sb.preRelease); c != 0 {
+		return c
+	}
+
+	return compareIdentifiers(sa.build, sb.build)
+}
+
+// IsSemver returns whether the version is semver, allowing a leading v and
+// missing minor and patch numbers like CompareSemver.
+func IsSemver(version string) bool {
+	_, ok := parseSemver(version)
+	return ok
+}
+
+// EquivalentSemver returns whether a and b are both semver and have the same
+// precedence, e.g. 1.2 and 1.2.0. Unlike CompareSemver, versions that are
+// not semver are never equivalent.
+func EquivalentSemver(a string, b string) bool {
+	_, aOK := parseSemver(a)
+	_, bOK := parseSemver(b)
+
+	return aOK && bOK && CompareSemver(a, b) == 0
+}
+
+// SortSemver returns the versions ordered from highest to lowest, matching
+// the newest first order returned by Pivotal Network.
+func SortSemver(versions []string) []string {
+	sorted := make([]string, len(versions))
+	copy(sorted, versions)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareSemver(sorted[i], sorted[j]) > 0
+	})
+
+	return sorted
+}
+
+// AtLeastSemver returns the versions with a semver precedence equal to or
+// higher than the minimum, preserving their order. Versions that are not
+// semver are lower than any minimum, so are never returned.
+func AtLeastSemver(versions []string, minimum string) []string {
+	var atLeast []string
+	for _, v := range versions {
+		if CompareSemver(v, minimum) >= 0 {
+			atLeast = append(atLeast, v)
+		}
+	}
+
+	return atLeast
+}
+
+// NewerSemver returns the versions with a higher semver precedence than the
+// version, preserving their order.
+func NewerSemver(versions []string, version string) []string {
+	var newer []string
+	for _, v := range versions {
+		if CompareSemver(v, version) > 0 {
+			newer = append(newer, v)
+		}
+	}
+
+	return newer
+}
+
+func compareIdentifiers(a []string, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	// A longer set of identifiers is higher if all preceding are equal.
+	return compareInts(len(a), len(b))
+}
+
+func compareIdentifier(a string, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(an, bn)
+	case aErr == nil:
+		// Numeric identifiers are lower than alphanumeric ones.
+		return -1
+	case bErr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
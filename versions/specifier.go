@@ -0,0 +1,17 @@
+package versions
+
+import "regexp"
+
+var specifierPattern = func() *regexp.Regexp {
+	constraint := `(?:(?:=|!=|>=|<=|>|<|~>)\s*\d+(?:\.\d+)*|\d+(?:\.\d+)*(?:\.\*)?)`
+	return regexp.MustCompile(`^\s*` + constraint + `(?:\s+` + constraint + `)*\s*$`)
+}()
+
+// IsSpecifier returns whether the specifier is a version range of the form
+// accepted by Pivotal Network for dependency specifiers: one or more
+// constraints separated by whitespace, each a version with an optional
+// comparison operator, e.g. >=2.0 <3.0 or ~>1.2, or a version ending in a
+// wildcard, e.g. 2.1.*.
+func IsSpecifier(specifier string) bool {
+	return specifierPattern.MatchString(specifier)
+}
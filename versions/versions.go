@@ -1,5 +1,26 @@
 package versions
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fileHashLength is the number of hex characters of the hash appended by
+// WithFileHash.
+const fileHashLength = 12
+
+// FormatVersion and FormatVersionID are the version formats of the versions
+// returned by check and out. FormatVersionID appends the release ID with
+// WithID.
+const (
+	FormatVersion   = "{version}"
+	FormatVersionID = "{version}#{id}"
+)
+
 func Since(versions []string, since string) ([]string, error) {
 	for i, v := range versions {
 		if v == since {
@@ -10,6 +31,37 @@ func Since(versions []string, since string) ([]string, error) {
 	return versions[:0], nil
 }
 
+// From returns the version along with the versions listed before it, which
+// are newer, and whether the version was found.
+func From(versions []string, version string) ([]string, bool) {
+	for i, v := range versions {
+		if v == version {
+			return versions[:i+1], true
+		}
+	}
+
+	return versions[:0], false
+}
+
+// Duplicates returns the versions that are listed more than once, in the
+// order they are first listed.
+func Duplicates(versions []string) []string {
+	counts := map[string]int{}
+	for _, v := range versions {
+		counts[v]++
+	}
+
+	var duplicates []string
+	for _, v := range versions {
+		if counts[v] > 1 {
+			duplicates = append(duplicates, v)
+			counts[v] = 0
+		}
+	}
+
+	return duplicates
+}
+
 func Reverse(versions []string) ([]string, error) {
 	var reversed []string
 	for i := len(versions) - 1; i >= 0; i-- {
@@ -18,3 +70,80 @@ func Reverse(versions []string) ([]string, error) {
 
 	return reversed, nil
 }
+
+// ValidateFormat returns an error if the version format configured by the key
+// is provided but is not FormatVersion or FormatVersionID.
+func ValidateFormat(key string, format string) error {
+	switch format {
+	case "", FormatVersion, FormatVersionID:
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%s must be one of %s or %s - got %s",
+		key,
+		FormatVersion,
+		FormatVersionID,
+		format,
+	)
+}
+
+// WithID returns the version with the ID of its release appended, which
+// disambiguates versions shared by more than one release.
+func WithID(version string, releaseID int) string {
+	return fmt.Sprintf("%s#%d", version, releaseID)
+}
+
+// SplitID returns the version and release ID of a version returned by WithID,
+// and whether the version has a release ID at all.
+func SplitID(version string) (string, int, bool) {
+	i := strings.LastIndex(version, "#")
+	if i < 0 {
+		return version, 0, false
+	}
+
+	releaseID, err := strconv.Atoi(version[i+1:])
+	if err != nil || releaseID <= 0 {
+		return version, 0, false
+	}
+
+	return version[:i], releaseID, true
+}
+
+// FileHash returns a short hash of the MD5s of the files of a release, which
+// is the same whatever order the MD5s are given in.
+func FileHash(md5s []string) string {
+	sorted := append([]string{}, md5s...)
+	sort.Strings(sorted)
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])[:fileHashLength]
+}
+
+// WithFileHash returns the version with a hash returned by FileHash appended,
+// which makes versions reused by a release whose files change unique.
+func WithFileHash(version string, hash string) string {
+	return fmt.Sprintf("%s@%s", version, hash)
+}
+
+// SplitFileHash returns the version and file hash of a version returned by
+// WithFileHash, and whether the version has a file hash at all.
+func SplitFileHash(version string) (string, string, bool) {
+	i := strings.LastIndex(version, "@")
+	if i < 0 {
+		return version, "", false
+	}
+
+	hash := version[i+1:]
+	if len(hash) != fileHashLength {
+		return version, "", false
+	}
+
+	for _, r := range hash {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return version, "", false
+		}
+	}
+
+	return version[:i], hash, true
+}
@@ -30,6 +30,39 @@ var _ = Describe("Versions", func() {
 		})
 	})
 
+	Describe("From", func() {
+		It("returns the version along with the new versions", func() {
+			allVersions := []string{"newest version", "newish version", "oldest version"}
+			versions, found := versions.From(allVersions, "newish version")
+
+			Expect(found).To(BeTrue())
+			Expect(versions).To(Equal([]string{"newest version", "newish version"}))
+		})
+
+		Context("when the version is not listed", func() {
+			It("returns no versions", func() {
+				versions, found := versions.From([]string{"newest version"}, "deleted version")
+
+				Expect(found).To(BeFalse())
+				Expect(versions).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Duplicates", func() {
+		It("returns each version listed more than once, in the order first listed", func() {
+			duplicates := versions.Duplicates([]string{"C", "B", "A", "B", "C", "B"})
+
+			Expect(duplicates).To(Equal([]string{"C", "B"}))
+		})
+
+		Context("when no version is listed more than once", func() {
+			It("returns no versions", func() {
+				Expect(versions.Duplicates([]string{"B", "A"})).To(BeEmpty())
+			})
+		})
+	})
+
 	Describe("Reverse", func() {
 		It("returns reversed ordered versions because concourse expects them that way", func() {
 			versions, _ := versions.Reverse([]string{"v201", "v178", "v120", "v200"})
@@ -37,4 +70,190 @@ var _ = Describe("Versions", func() {
 			Expect(versions).To(Equal([]string{"v200", "v120", "v178", "v201"}))
 		})
 	})
+
+	Describe("ValidateFormat", func() {
+		It("accepts the version formats", func() {
+			Expect(versions.ValidateFormat("version_format", "")).To(Succeed())
+			Expect(versions.ValidateFormat("version_format", "{version}")).To(Succeed())
+			Expect(versions.ValidateFormat("version_format", "{version}#{id}")).To(Succeed())
+		})
+
+		It("returns an error for any other format", func() {
+			Expect(versions.ValidateFormat("version_format", "{id}")).To(MatchError(
+				"version_format must be one of {version} or {version}#{id} - got {id}"))
+		})
+	})
+
+	Describe("WithID", func() {
+		It("appends the release ID to the version", func() {
+			Expect(versions.WithID("1.2.3", 1234)).To(Equal("1.2.3#1234"))
+		})
+	})
+
+	Describe("SplitID", func() {
+		It("returns the version and release ID", func() {
+			version, releaseID, ok := versions.SplitID(versions.WithID("1.2.3", 1234))
+
+			Expect(ok).To(BeTrue())
+			Expect(version).To(Equal("1.2.3"))
+			Expect(releaseID).To(Equal(1234))
+		})
+
+		Context("when the version has no release ID", func() {
+			It("returns the version unchanged", func() {
+				for _, v := range []string{"1.2.3", "1.2.3#", "1.2.3#abc", "1.2.3#-1"} {
+					version, _, ok := versions.SplitID(v)
+
+					Expect(ok).To(BeFalse())
+					Expect(version).To(Equal(v))
+				}
+			})
+		})
+	})
+
+	Describe("FileHash", func() {
+		It("returns a short hash that does not depend on the order of the MD5s", func() {
+			hash := versions.FileHash([]string{"md5-a", "md5-b"})
+
+			Expect(hash).To(HaveLen(12))
+			Expect(versions.FileHash([]string{"md5-b", "md5-a"})).To(Equal(hash))
+			Expect(versions.FileHash([]string{"md5-a", "md5-c"})).NotTo(Equal(hash))
+		})
+	})
+
+	Describe("SplitFileHash", func() {
+		It("returns the version and file hash", func() {
+			hash := versions.FileHash([]string{"md5-a"})
+			version, fileHash, ok := versions.SplitFileHash(
+				versions.WithFileHash(versions.WithID("1.2.3", 1234), hash),
+			)
+
+			Expect(ok).To(BeTrue())
+			Expect(version).To(Equal("1.2.3#1234"))
+			Expect(fileHash).To(Equal(hash))
+		})
+
+		Context("when the version has no file hash", func() {
+			It("returns the version unchanged", func() {
+				for _, v := range []string{"1.2.3", "1.2.3@", "1.2.3@abc", "user@example.com", "1.2.3@ABCDEF123456"} {
+					version, _, ok := versions.SplitFileHash(v)
+
+					Expect(ok).To(BeFalse())
+					Expect(version).To(Equal(v))
+				}
+			})
+		})
+	})
+
+	Describe("IsSemver", func() {
+		It("returns whether the version is semver", func() {
+			Expect(versions.IsSemver("v1.2")).To(BeTrue())
+			Expect(versions.IsSemver("1.2.3-rc.1")).To(BeTrue())
+			Expect(versions.IsSemver("latest")).To(BeFalse())
+		})
+	})
+
+	Describe("IsSpecifier", func() {
+		It("accepts version ranges", func() {
+			Expect(versions.IsSpecifier(">=2.0 <3.0")).To(BeTrue())
+			Expect(versions.IsSpecifier("~> 1.2")).To(BeTrue())
+			Expect(versions.IsSpecifier("2.1.*")).To(BeTrue())
+			Expect(versions.IsSpecifier("1.2.3")).To(BeTrue())
+		})
+
+		It("rejects anything else", func() {
+			Expect(versions.IsSpecifier("")).To(BeFalse())
+			Expect(versions.IsSpecifier("latest")).To(BeFalse())
+			Expect(versions.IsSpecifier(">=2.0,<3.0")).To(BeFalse())
+			Expect(versions.IsSpecifier(">=2.*")).To(BeFalse())
+			Expect(versions.IsSpecifier("=>2.0")).To(BeFalse())
+		})
+	})
+
+	Describe("AtLeastSemver", func() {
+		It("returns the versions at or above the minimum in their order", func() {
+			Expect(versions.AtLeastSemver(
+				[]string{"2.1.0", "1.9.9", "2.0", "2.0.0-rc.1", "not-semver", "10.0.0"},
+				"2.0.0",
+			)).To(Equal([]string{"2.1.0", "2.0", "10.0.0"}))
+		})
+	})
+
+	Describe("NewerSemver", func() {
+		It("returns the versions with a higher precedence in their order", func() {
+			Expect(versions.NewerSemver(
+				[]string{"1.3.0", "1.2.10", "1.2.2", "1.1.0"},
+				"1.2.3",
+			)).To(Equal([]string{"1.3.0", "1.2.10"}))
+		})
+	})
+
+	Describe("CompareSemver", func() {
+		It("compares numeric pre-release identifiers numerically", func() {
+			Expect(versions.CompareSemver("1.2.3-build.9", "1.2.3-build.10")).To(Equal(-1))
+			Expect(versions.CompareSemver("1.2.3-build.10", "1.2.3-build.9")).To(Equal(1))
+		})
+
+		It("compares major, minor and patch numerically", func() {
+			Expect(versions.CompareSemver("1.10.0", "1.9.0")).To(Equal(1))
+			Expect(versions.CompareSemver("2.0.0", "10.0.0")).To(Equal(-1))
+		})
+
+		It("treats a version with a pre-release as lower than the same version without", func() {
+			Expect(versions.CompareSemver("1.2.3-build.456", "1.2.3")).To(Equal(-1))
+		})
+
+		It("treats numeric identifiers as lower than alphanumeric ones", func() {
+			Expect(versions.CompareSemver("1.0.0-1", "1.0.0-alpha")).To(Equal(-1))
+		})
+
+		It("treats missing minor and patch numbers as 0", func() {
+			Expect(versions.CompareSemver("1.2", "1.2.0")).To(Equal(0))
+		})
+
+		It("uses build metadata to break ties", func() {
+			Expect(versions.CompareSemver("1.2.3+build.9", "1.2.3+build.10")).To(Equal(-1))
+			Expect(versions.CompareSemver("1.2.3+build.9", "1.2.3+build.9")).To(Equal(0))
+		})
+
+		It("treats versions that are not semver as lower than any that are", func() {
+			Expect(versions.CompareSemver("not-semver", "0.0.1")).To(Equal(-1))
+			Expect(versions.CompareSemver("b-release", "a-release")).To(Equal(1))
+		})
+	})
+
+	Describe("EquivalentSemver", func() {
+		It("returns true for versions with the same precedence", func() {
+			Expect(versions.EquivalentSemver("1.2", "1.2.0")).To(BeTrue())
+			Expect(versions.EquivalentSemver("v1.2.3", "1.2.3")).To(BeTrue())
+		})
+
+		It("returns false for versions with different precedence", func() {
+			Expect(versions.EquivalentSemver("1.2", "1.2.1")).To(BeFalse())
+		})
+
+		It("returns false for versions that are not semver", func() {
+			Expect(versions.EquivalentSemver("not-semver", "not-semver")).To(BeFalse())
+		})
+	})
+
+	Describe("SortSemver", func() {
+		It("returns the versions from highest to lowest", func() {
+			sorted := versions.SortSemver([]string{
+				"1.2.3-build.9",
+				"1.2.3",
+				"1.2.3-build.10",
+				"1.10.0",
+				"1.9.0",
+			})
+
+			Expect(sorted).To(Equal([]string{
+				"1.10.0",
+				"1.9.0",
+				"1.2.3",
+				"1.2.3-build.10",
+				"1.2.3-build.9",
+			}))
+		})
+	})
 })